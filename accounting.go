@@ -0,0 +1,395 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/xml"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= ACCOUNTING ========================
+   ============================================================ */
+
+// ledger export turns the successful transactions of the ledger into
+// journal entries for an accounting package. The CamPay wallet is an asset
+// account: a collection debits it with the amount less CamPay's fee and
+// credits the sales account; a payout or refund credits it with the amount
+// plus the fee. The ledger does not hold fees, so they are derived from the
+// percentages of accounting.fees, rounded by the rounding setting.
+// Transfers between apps are left out, as from the other reports.
+
+// AccountingConfig maps ledger flows to accounts of the books.
+type AccountingConfig struct {
+	Accounts AccountCodes       `json:"accounts,omitempty"`
+	Fees     map[string]float64 `json:"fees,omitempty"` // percent of the amount, by kind: collect or withdraw
+}
+
+// AccountCodes are the account names or codes used in exports. Empty ones
+// take the defaults of defaultAccounts.
+type AccountCodes struct {
+	Wallet      string `json:"wallet,omitempty"`
+	Collections string `json:"collections,omitempty"`
+	Refunds     string `json:"refunds,omitempty"`
+	Payouts     string `json:"payouts,omitempty"`
+	Fees        string `json:"fees,omitempty"`
+}
+
+var defaultAccounts = AccountCodes{
+	Wallet:      "CamPay wallet",
+	Collections: "Mobile money sales",
+	Refunds:     "Sales refunds",
+	Payouts:     "Mobile money payouts",
+	Fees:        "Payment fees",
+}
+
+// validate fills in the default accounts and checks the fees.
+func (a *AccountingConfig) validate() error {
+	for _, f := range []struct {
+		dst *string
+		def string
+	}{
+		{&a.Accounts.Wallet, defaultAccounts.Wallet},
+		{&a.Accounts.Collections, defaultAccounts.Collections},
+		{&a.Accounts.Refunds, defaultAccounts.Refunds},
+		{&a.Accounts.Payouts, defaultAccounts.Payouts},
+		{&a.Accounts.Fees, defaultAccounts.Fees},
+	} {
+		*f.dst = strings.TrimSpace(*f.dst)
+		if *f.dst == "" {
+			*f.dst = f.def
+		}
+		// IIF and CSV fields cannot hold tabs or line breaks
+		if strings.ContainsAny(*f.dst, "\t\r\n") {
+			return fmt.Errorf("account %q contains a tab or line break", *f.dst)
+		}
+	}
+	for kind, percent := range a.Fees {
+		if kind != "collect" && kind != "withdraw" {
+			return fmt.Errorf("fees: unknown kind %q (use collect or withdraw)", kind)
+		}
+		if percent < 0 || percent >= 100 {
+			return fmt.Errorf("fees: %s must be at least 0 and below 100", kind)
+		}
+	}
+	return nil
+}
+
+// journalEntry is one balanced entry of the books.
+type journalEntry struct {
+	ID    string // stable across exports: the reference, or the group
+	Num   string // short number for QuickBooks, e.g. CP20260301-0001
+	Date  time.Time
+	Memo  string
+	Kind  string // collection, payout or refund
+	Count int    // transactions in the entry
+	Lines []journalLine
+}
+
+type journalLine struct {
+	Account       string
+	Debit, Credit int
+}
+
+// wallet returns the change of the wallet account in e.
+func (e *journalEntry) wallet(account string) int {
+	n := 0
+	for _, l := range e.Lines {
+		if l.Account == account {
+			n += l.Debit - l.Credit
+		}
+	}
+	return n
+}
+
+// add books amount on account, merging it with a line on the same side.
+func (e *journalEntry) add(account string, debit, credit int) {
+	if debit == 0 && credit == 0 {
+		return
+	}
+	for i, l := range e.Lines {
+		if l.Account == account && (l.Debit > 0) == (debit > 0) {
+			e.Lines[i].Debit += debit
+			e.Lines[i].Credit += credit
+			return
+		}
+	}
+	e.Lines = append(e.Lines, journalLine{Account: account, Debit: debit, Credit: credit})
+}
+
+var journalKinds = map[string]string{"collection": "Collections", "payout": "Payouts", "refund": "Refunds"}
+
+// journal books the successful entries created in [from, to) of env,
+// one journal entry per transaction or, with group "day" or "month", per
+// kind and period.
+func journal(entries []LedgerEntry, ac AccountingConfig, rounding Rounding, env string, from, to time.Time, group string) []*journalEntry {
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].CreatedAt.Before(entries[j].CreatedAt) })
+	var out []*journalEntry
+	groups := map[string]*journalEntry{}
+	a := ac.Accounts
+	for _, e := range entries {
+		if e.Status != campay.StatusSuccessful || e.Environment != env || e.Source == transferSource ||
+			e.CreatedAt.Before(from) || (!to.IsZero() && !e.CreatedAt.Before(to)) {
+			continue
+		}
+		kind := "collection"
+		switch {
+		case e.Refund:
+			kind = "refund"
+		case e.Kind == "withdraw":
+			kind = "payout"
+		}
+		fee := rounding.PercentOf(e.Amount, floatRat(ac.Fees[e.Kind]))
+		created := inZone(e.CreatedAt)
+
+		var je *journalEntry
+		switch group {
+		case "day", "month":
+			period := created.Format("2006-01-02")
+			if group == "month" {
+				period = created.Format("2006-01")
+			}
+			id := kind + "-" + period
+			if je = groups[id]; je == nil {
+				je = &journalEntry{ID: id, Kind: kind}
+				groups[id] = je
+				out = append(out, je)
+			}
+			je.Memo = fmt.Sprintf("%s of %s (%d)", journalKinds[kind], period, je.Count+1)
+		default:
+			je = &journalEntry{ID: e.Reference, Kind: kind, Memo: strings.TrimSpace(e.Description + " " + e.ExternalReference)}
+			if je.Memo == "" {
+				je.Memo = journalKinds[kind]
+			}
+			out = append(out, je)
+		}
+		je.Date = created
+		je.Count++
+
+		switch kind {
+		case "collection":
+			je.add(a.Wallet, e.Amount-fee, 0)
+			je.add(a.Fees, fee, 0)
+			je.add(a.Collections, 0, e.Amount)
+		case "refund":
+			je.add(a.Refunds, e.Amount, 0)
+			je.add(a.Fees, fee, 0)
+			je.add(a.Wallet, 0, e.Amount+fee)
+		case "payout":
+			je.add(a.Payouts, e.Amount, 0)
+			je.add(a.Fees, fee, 0)
+			je.add(a.Wallet, 0, e.Amount+fee)
+		}
+	}
+
+	sort.SliceStable(out, func(i, j int) bool { return out[i].Date.Before(out[j].Date) })
+	seq := map[string]int{}
+	for _, je := range out {
+		day := je.Date.Format("20060102")
+		seq[day]++
+		je.Num = fmt.Sprintf("CP%s-%04d", day, seq[day])
+	}
+	return out
+}
+
+// writeJournal writes entries in one of the accountingFormats.
+func writeJournal(w io.Writer, format string, entries []*journalEntry, wallet string) error {
+	switch format {
+	case "iif":
+		return writeIIF(w, entries)
+	case "qbcsv":
+		return writeQuickBooksCSV(w, entries)
+	case "ofx":
+		return writeOFX(w, entries, wallet)
+	}
+	return writeJournalCSV(w, entries)
+}
+
+var accountingFormats = []string{"csv", "qbcsv", "iif", "ofx"}
+
+// writeJournalCSV writes a generic double-entry CSV, one row per line.
+func writeJournalCSV(w io.Writer, entries []*journalEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"date", "entry", "account", "debit", "credit", "currency", "memo", "reference"})
+	for _, je := range entries {
+		for _, l := range je.Lines {
+			cw.Write([]string{je.Date.Format("2006-01-02"), je.Num, l.Account, amountField(l.Debit), amountField(l.Credit), "XAF", je.Memo, je.ID})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeQuickBooksCSV writes the journal entry import of QuickBooks Online.
+func writeQuickBooksCSV(w io.Writer, entries []*journalEntry) error {
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"Journal No.", "Journal Date", "Currency", "Memo", "Account Name", "Debits", "Credits", "Description"})
+	for _, je := range entries {
+		for _, l := range je.Lines {
+			cw.Write([]string{je.Num, je.Date.Format("01/02/2006"), "XAF", je.Memo, l.Account, amountField(l.Debit), amountField(l.Credit), je.ID})
+		}
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// writeIIF writes general journal transactions for QuickBooks Desktop:
+// debits are positive amounts and credits negative.
+func writeIIF(w io.Writer, entries []*journalEntry) error {
+	clean := strings.NewReplacer("\t", " ", "\r", " ", "\n", " ", `"`, "'")
+	var b strings.Builder
+	b.WriteString("!TRNS\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!SPL\tTRNSTYPE\tDATE\tACCNT\tAMOUNT\tDOCNUM\tMEMO\n")
+	b.WriteString("!ENDTRNS\n")
+	for _, je := range entries {
+		for i, l := range je.Lines {
+			row := "SPL"
+			if i == 0 {
+				row = "TRNS"
+			}
+			fmt.Fprintf(&b, "%s\tGENERAL JOURNAL\t%s\t%s\t%d\t%s\t%s\n", row, je.Date.Format("01/02/2006"),
+				l.Account, l.Debit-l.Credit, je.Num, clean.Replace(je.Memo+" "+je.ID))
+		}
+		b.WriteString("ENDTRNS\n")
+	}
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// writeOFX writes the movements of the wallet account as an OFX 2 bank
+// statement. The ledger does not know the wallet's opening balance, so the
+// ledger balance is the net of the statement.
+func writeOFX(w io.Writer, entries []*journalEntry, wallet string) error {
+	esc := func(s string) string {
+		var b strings.Builder
+		xml.EscapeText(&b, []byte(s))
+		return b.String()
+	}
+	ofxTime := func(t time.Time) string { return t.UTC().Format("20060102150405") }
+	now := time.Now()
+	start, end, net := now, now, 0
+	if len(entries) > 0 {
+		start, end = entries[0].Date, entries[len(entries)-1].Date
+	}
+
+	var b strings.Builder
+	b.WriteString(`<?xml version="1.0" encoding="UTF-8" standalone="no"?>` + "\n")
+	b.WriteString(`<?OFX OFXHEADER="200" VERSION="220" SECURITY="NONE" OLDFILEUID="NONE" NEWFILEUID="NONE"?>` + "\n")
+	b.WriteString("<OFX>\n<SIGNONMSGSRSV1><SONRS><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>")
+	fmt.Fprintf(&b, "<DTSERVER>%s</DTSERVER><LANGUAGE>ENG</LANGUAGE></SONRS></SIGNONMSGSRSV1>\n", ofxTime(now))
+	b.WriteString("<BANKMSGSRSV1><STMTTRNRS><TRNUID>0</TRNUID><STATUS><CODE>0</CODE><SEVERITY>INFO</SEVERITY></STATUS>\n<STMTRS>")
+	fmt.Fprintf(&b, "<CURDEF>XAF</CURDEF><BANKACCTFROM><BANKID>CAMPAY</BANKID><ACCTID>%s</ACCTID><ACCTTYPE>CHECKING</ACCTTYPE></BANKACCTFROM>\n", esc(wallet))
+	fmt.Fprintf(&b, "<BANKTRANLIST><DTSTART>%s</DTSTART><DTEND>%s</DTEND>\n", ofxTime(start), ofxTime(end))
+	for _, je := range entries {
+		amount := je.wallet(wallet)
+		net += amount
+		trnType := "CREDIT"
+		if amount < 0 {
+			trnType = "DEBIT"
+		}
+		fmt.Fprintf(&b, "<STMTTRN><TRNTYPE>%s</TRNTYPE><DTPOSTED>%s</DTPOSTED><TRNAMT>%d</TRNAMT><FITID>%s</FITID><NAME>%s</NAME><MEMO>%s</MEMO></STMTTRN>\n",
+			trnType, ofxTime(je.Date), amount, esc(je.ID), esc(journalKinds[je.Kind]), esc(je.Memo))
+	}
+	b.WriteString("</BANKTRANLIST>\n")
+	fmt.Fprintf(&b, "<LEDGERBAL><BALAMT>%d</BALAMT><DTASOF>%s</DTASOF></LEDGERBAL>\n", net, ofxTime(end))
+	b.WriteString("</STMTRS></STMTTRNRS></BANKMSGSRSV1>\n</OFX>\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+func amountField(n int) string {
+	if n == 0 {
+		return ""
+	}
+	return strconv.Itoa(n)
+}
+
+// ledgerExportOptions are the flags of ledger export.
+type ledgerExportOptions struct {
+	format string
+	out    string
+	since  string
+	until  string
+	group  string
+	env    string
+}
+
+// ledgerExportFlags defines the flags of ledger export on fs.
+func ledgerExportFlags(fs *flag.FlagSet, cfg *Config) *ledgerExportOptions {
+	opt := &ledgerExportOptions{}
+	fs.StringVar(&opt.format, "format", "csv", "csv (debit/credit columns), qbcsv (QuickBooks Online), iif (QuickBooks Desktop) or ofx")
+	fs.StringVar(&opt.out, "out", "", "file to write (default: stdout)")
+	fs.StringVar(&opt.since, "since", "30d", "transactions created after: 7d, 12h or a date like 2026-01-31")
+	fs.StringVar(&opt.until, "until", "", "transactions created before: 7d, 12h or a date")
+	fs.StringVar(&opt.group, "group", "transaction", "one journal entry per transaction, day or month")
+	fs.StringVar(&opt.env, "env", cfg.Env, "environment whose transactions are exported: DEV or PROD")
+	return opt
+}
+
+// runLedgerExport writes the journal of a period to a file or stdout.
+func runLedgerExport(cfg *Config, ledger *Ledger, args []string) error {
+	fs := newFlagSet("ledger export")
+	opt := ledgerExportFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+	found := false
+	for _, f := range accountingFormats {
+		found = found || f == opt.format
+	}
+	if !found {
+		return invalidInput("--format must be one of %s", strings.Join(accountingFormats, ", "))
+	}
+	if opt.group != "transaction" && opt.group != "day" && opt.group != "month" {
+		return invalidInput("--group must be transaction, day or month")
+	}
+	opt.env = strings.ToUpper(opt.env)
+
+	var from, to time.Time
+	var err error
+	if opt.since != "" {
+		if from, err = parseSince(opt.since); err != nil {
+			return err
+		}
+	}
+	if opt.until != "" {
+		if to, err = parseSince(opt.until); err != nil {
+			return err
+		}
+	}
+
+	entries, err := ledger.Entries()
+	if err != nil {
+		return err
+	}
+	book := journal(entries, cfg.Accounting, cfg.Rounding, opt.env, from, to, opt.group)
+
+	if opt.out == "" {
+		fmt.Fprintf(os.Stderr, "Dates are days in %s\n", zoneLabel(time.Now()))
+		return writeJournal(os.Stdout, opt.format, book, cfg.Accounting.Accounts.Wallet)
+	}
+	f, err := os.Create(opt.out)
+	if err != nil {
+		return err
+	}
+	if err := writeJournal(f, opt.format, book, cfg.Accounting.Accounts.Wallet); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	fmt.Printf("✓ Wrote %d journal entries of %s to %s (dates are days in %s)\n", len(book), opt.env, opt.out, zoneLabel(time.Now()))
+	return nil
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/* ============================================================
+   ========================== AMOUNTS ==========================
+   ============================================================ */
+
+// parseAmount accepts the ways people type XAF amounts: "15000",
+// "15 000", "12.500" or "12,500" (thousands separators), "5k", "1.5k",
+// "2m" and a trailing "XAF" or "FCFA". XAF has no minor unit, so anything
+// that would leave a fraction is rejected.
+func parseAmount(input string) (int, error) {
+	s := strings.ToUpper(strings.TrimSpace(input))
+	for _, unit := range []string{"XAF", "FCFA"} {
+		s = strings.TrimSpace(strings.TrimSuffix(s, unit))
+	}
+	s = strings.ReplaceAll(s, "\u00a0", " ")
+
+	bad := invalidInput("%s", tr("err.amount_format", input))
+	if s == "" {
+		return 0, bad
+	}
+
+	var mult int64 = 1
+	switch s[len(s)-1] {
+	case 'K':
+		mult = 1e3
+	case 'M':
+		mult = 1e6
+	}
+
+	var amount int64
+	if mult > 1 {
+		// "1.5k" / "1,5k": the separator is a decimal point. Exact
+		// arithmetic, so "1.005k" is 1005 and not 1004.99…
+		num := strings.ReplaceAll(strings.TrimSpace(s[:len(s)-1]), ",", ".")
+		x, ok := exactRat(num)
+		if !ok {
+			return 0, bad
+		}
+		x.Mul(x, new(big.Rat).SetInt64(mult))
+		if !x.IsInt() || !x.Num().IsInt64() {
+			return 0, bad
+		}
+		amount = x.Num().Int64()
+	} else {
+		// Otherwise separators may only group thousands
+		groups := strings.FieldsFunc(s, func(r rune) bool {
+			return r == '.' || r == ',' || r == ' ' || r == '\''
+		})
+		if len(groups) == 0 || strings.Trim(s, "0123456789., '") != "" {
+			return 0, bad
+		}
+		for i, g := range groups {
+			if (i == 0 && len(g) > 3 && len(groups) > 1) || (i > 0 && len(g) != 3) {
+				return 0, bad
+			}
+		}
+		n, err := strconv.Atoi(strings.Join(groups, ""))
+		if err != nil {
+			return 0, bad
+		}
+		amount = int64(n)
+	}
+
+	if amount <= 0 || amount > math.MaxInt32 {
+		return 0, invalidInput("%s", tr("err.amount"))
+	}
+	return int(amount), nil
+}
+
+// AmountLimits bound a single transaction. Zero fields are not checked.
+type AmountLimits struct {
+	Min int `json:"min"`
+	Max int `json:"max"`
+}
+
+// operatorFor guesses the mobile operator from a normalized Cameroonian
+// number. It returns "" for prefixes it does not know.
+func operatorFor(phone string) string {
+	local := strings.TrimPrefix(phone, "237")
+	if len(local) != 9 {
+		return ""
+	}
+	switch p2, p3 := local[:2], local[:3]; {
+	case p2 == "67", p3 >= "650" && p3 <= "654", p3 >= "680" && p3 <= "684":
+		return "MTN"
+	case p2 == "69", p3 == "640", p3 >= "655" && p3 <= "659", p3 >= "685" && p3 <= "689":
+		return "ORANGE"
+	}
+	return ""
+}
+
+// checkLimitsFor rejects amounts outside the limits configured for the
+// payer's operator, as found by knownOperator (or the "default" entry),
+// before any API call.
+func checkLimitsFor(limits map[string]AmountLimits, operator string, amount int) error {
+	l, ok := limits[operator]
+	if !ok || operator == "" {
+		if l, ok = limits["default"]; !ok {
+			return nil
+		}
+	}
+	if operator == "" {
+		operator = "this operator"
+	}
+	if l.Min > 0 && amount < l.Min {
+		return invalidInput("amount %d XAF is below the %s minimum of %d XAF", amount, operator, l.Min)
+	}
+	if l.Max > 0 && amount > l.Max {
+		return invalidInput("amount %d XAF is above the %s maximum of %d XAF per transaction", amount, operator, l.Max)
+	}
+	return nil
+}
+
+// operatorLimits normalizes the operator names of the config file.
+func operatorLimits(fc map[string]AmountLimits) map[string]AmountLimits {
+	limits := make(map[string]AmountLimits, len(fc))
+	for name, l := range fc {
+		if name != "default" {
+			name = strings.ToUpper(name)
+		}
+		limits[name] = l
+	}
+	return limits
+}
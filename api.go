@@ -0,0 +1,105 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/* ============================================================
+   ========================== RAW API ==========================
+   ============================================================ */
+
+// apiOptions are the flags of api.
+type apiOptions struct {
+	data string
+}
+
+// apiFlags defines the flags of api on fs.
+func apiFlags(fs *flag.FlagSet, cfg *Config) *apiOptions {
+	opt := &apiOptions{}
+	fs.StringVar(&opt.data, "data", "", "JSON request body, @file to read it from a file or - for stdin")
+	fs.DurationVar(&cfg.Timeouts.Other, "timeout", cfg.Timeouts.Other, "timeout for the call")
+	fs.Usage = func() {
+		fmt.Fprintln(fs.Output(), "Usage: campay api [--data JSON|@file|-] METHOD PATH\n\nExample: campay api GET /balance/")
+		fs.PrintDefaults()
+	}
+	return opt
+}
+
+// runAPI calls any CamPay endpoint through campay.Client.Do and prints the
+// JSON answer, for endpoints the CLI has no command for yet.
+func runAPI(cfg *Config, args []string) error {
+	fs := newFlagSet("api")
+	opt := apiFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() != 2 {
+		return invalidInput("usage: campay api [--data JSON|@file|-] METHOD PATH")
+	}
+	method, path := strings.ToUpper(fs.Arg(0)), fs.Arg(1)
+
+	var body any
+	if opt.data != "" {
+		raw, err := readAPIBody(opt.data)
+		if err != nil {
+			return err
+		}
+		if !json.Valid(raw) {
+			return invalidInput("--data is not valid JSON")
+		}
+		body = json.RawMessage(raw)
+	}
+
+	if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
+	if err := askCredentials(cfg); err != nil {
+		return err
+	}
+	if cfg.Username == "" || cfg.Password == "" {
+		return exitErr(exitAuth, errors.New(tr("auth.missing")))
+	}
+	client, err := newClient(cfg)
+	if err != nil {
+		return err
+	}
+	ctx := context.Background()
+	if err := client.Authenticate(ctx); err != nil {
+		return err
+	}
+	offerSaveCredentials(cfg)
+	var out json.RawMessage
+	if err := client.Do(ctx, method, path, body, &out); err != nil {
+		return err
+	}
+	if len(out) == 0 {
+		return nil
+	}
+	var pretty bytes.Buffer
+	if json.Indent(&pretty, out, "", "  ") != nil {
+		pretty.Reset()
+		pretty.Write(out)
+	}
+	fmt.Println(pretty.String())
+	return nil
+}
+
+// readAPIBody returns the --data value, read from a file for @file or
+// from stdin for -.
+func readAPIBody(data string) ([]byte, error) {
+	switch {
+	case data == "-":
+		return io.ReadAll(os.Stdin)
+	case strings.HasPrefix(data, "@"):
+		return os.ReadFile(strings.TrimPrefix(data, "@"))
+	}
+	return []byte(data), nil
+}
@@ -0,0 +1,454 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math"
+	"net/http"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ============================================================
+   ========================== API KEYS =========================
+   ============================================================ */
+
+// The daemon's HTTP API is open to whoever can reach it until the first
+// key is created with `campay apikey create`. From then on every route but
+// the probes needs `Authorization: Bearer <key>`, and a key only reaches
+// the routes and job kinds of its scope, so a cashier terminal given a
+// collect key cannot send payouts. A read-only key keeps the view of its
+// scope (an admin key sees phone numbers unmasked) but is refused every
+// route that moves money, for auditors. Keys live in ~/.campay/apikeys.jsonl,
+// next to the ledger and like it append-only: a revocation is a new line,
+// and the last line of a key ID wins. Only a hash of each key is stored.
+
+// apiScope is what an API key may do. Each scope includes the ones before
+// it in apiScopes.
+type apiScope string
+
+const (
+	scopeRead    apiScope = "read"    // list and inspect jobs, metrics
+	scopeCollect apiScope = "collect" // and submit collections
+	scopeRefund  apiScope = "refund"  // and pay back collections (refund_of)
+	scopeAdmin   apiScope = "admin"   // and any payout
+)
+
+var apiScopes = []apiScope{scopeRead, scopeCollect, scopeRefund, scopeAdmin}
+
+// allows reports whether a key of scope s may use a route needing need.
+func (s apiScope) allows(need apiScope) bool {
+	return slices.Index(apiScopes, s) >= slices.Index(apiScopes, need)
+}
+
+func parseScope(s string) (apiScope, error) {
+	scope := apiScope(strings.ToLower(strings.TrimSpace(s)))
+	if !slices.Contains(apiScopes, scope) {
+		return "", invalidInput("unknown scope %q (use read, collect, refund or admin)", s)
+	}
+	return scope, nil
+}
+
+const apiKeyPrefix = "cpk_"
+
+// apiKey is one key of the daemon's HTTP API.
+type apiKey struct {
+	ID        string     `json:"id"` // first characters of the key after its prefix
+	Name      string     `json:"name"`
+	Scope     apiScope   `json:"scope"`
+	Rate      int        `json:"rate,omitempty"` // requests per minute, 0 for no limit
+	Hash      string     `json:"hash"`           // SHA-256 of the key, hex
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+	ReadOnly  bool       `json:"read_only,omitempty"` // refused routes that need more than read
+}
+
+// newAPIKey returns a key and its record. The key itself is only shown
+// once, when it is created.
+func newAPIKey(name string, scope apiScope, rate int) (string, apiKey) {
+	var b [20]byte
+	rand.Read(b[:])
+	secret := apiKeyPrefix + hex.EncodeToString(b[:])
+	return secret, apiKey{
+		ID:        secret[len(apiKeyPrefix) : len(apiKeyPrefix)+8],
+		Name:      name,
+		Scope:     scope,
+		Rate:      rate,
+		Hash:      hashAPIKey(secret),
+		CreatedAt: time.Now().UTC(),
+	}
+}
+
+func hashAPIKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// keyring is the API key file, reloaded when it changes so that a
+// revocation applies to a running daemon, and the rate limits of the keys.
+type keyring struct {
+	path string
+
+	mu      sync.Mutex
+	loaded  time.Time // modification time of the file when last read
+	size    int64
+	keys    map[string]apiKey
+	buckets map[string]*rateBucket
+}
+
+func openKeyring() (*keyring, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	return &keyring{path: filepath.Join(dir, "apikeys.jsonl"), buckets: map[string]*rateBucket{}}, nil
+}
+
+func (k *keyring) write(key apiKey) error {
+	line, err := json.Marshal(key)
+	if err != nil {
+		return err
+	}
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	f, err := os.OpenFile(k.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List returns the latest state of every key, oldest first.
+func (k *keyring) List() ([]apiKey, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	keys, err := k.read()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]apiKey, 0, len(keys))
+	for _, key := range keys {
+		list = append(list, key)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+func (k *keyring) read() (map[string]apiKey, error) {
+	f, err := os.Open(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]apiKey{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	keys := map[string]apiKey{}
+	scanner := bufio.NewScanner(f)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var key apiKey
+		if err := json.Unmarshal(scanner.Bytes(), &key); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", k.path, n, err)
+		}
+		keys[key.ID] = key
+	}
+	return keys, scanner.Err()
+}
+
+// refreshLocked rereads the file if it changed since it was last read.
+func (k *keyring) refreshLocked() error {
+	info, err := os.Stat(k.path)
+	if errors.Is(err, os.ErrNotExist) {
+		k.keys = nil
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if k.keys != nil && info.ModTime().Equal(k.loaded) && info.Size() == k.size {
+		return nil
+	}
+	keys, err := k.read()
+	if err != nil {
+		return err
+	}
+	k.keys, k.loaded, k.size = keys, info.ModTime(), info.Size()
+	return nil
+}
+
+// errNoKeys is returned by authenticate while no key was ever created,
+// which leaves the API open.
+var errNoKeys = errors.New("no API keys")
+
+// authenticate returns the key of an Authorization header, and whether
+// the key is within its rate limit (otherwise, how long to wait).
+func (k *keyring) authenticate(header string) (apiKey, time.Duration, error) {
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	if err := k.refreshLocked(); err != nil {
+		return apiKey{}, 0, err
+	}
+	if len(k.keys) == 0 {
+		return apiKey{}, 0, errNoKeys
+	}
+
+	secret, ok := strings.CutPrefix(header, "Bearer ")
+	secret = strings.TrimSpace(secret)
+	if !ok || !strings.HasPrefix(secret, apiKeyPrefix) || len(secret) < len(apiKeyPrefix)+8 {
+		return apiKey{}, 0, errors.New("an API key is required (Authorization: Bearer <key>)")
+	}
+	key, ok := k.keys[secret[len(apiKeyPrefix):len(apiKeyPrefix)+8]]
+	if !ok || subtle.ConstantTimeCompare([]byte(hashAPIKey(secret)), []byte(key.Hash)) != 1 {
+		return apiKey{}, 0, errors.New("unknown API key")
+	}
+	if key.RevokedAt != nil {
+		return apiKey{}, 0, fmt.Errorf("API key %s (%s) was revoked", key.ID, key.Name)
+	}
+	return key, k.takeLocked(key), nil
+}
+
+// rateBucket is a token bucket holding up to a minute of a key's rate.
+type rateBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+// takeLocked spends one request of key's rate, or returns how long until
+// one is available.
+func (k *keyring) takeLocked(key apiKey) time.Duration {
+	if key.Rate <= 0 {
+		return 0
+	}
+	now := time.Now()
+	b := k.buckets[key.ID]
+	if b == nil {
+		b = &rateBucket{tokens: float64(key.Rate), last: now}
+		k.buckets[key.ID] = b
+	}
+	perSecond := float64(key.Rate) / 60
+	b.tokens = math.Min(float64(key.Rate), b.tokens+now.Sub(b.last).Seconds()*perSecond)
+	b.last = now
+	if b.tokens < 1 {
+		return time.Duration((1 - b.tokens) / perSecond * float64(time.Second))
+	}
+	b.tokens--
+	return 0
+}
+
+type apiKeyContext struct{}
+
+// requestScope is the scope of the key a request was made with, or admin
+// while the API is open.
+func requestScope(r *http.Request) apiScope {
+	if key, ok := r.Context().Value(apiKeyContext{}).(apiKey); ok {
+		return key.Scope
+	}
+	return scopeAdmin
+}
+
+// requestKeyName names the key a request was made with, or "".
+func requestKeyName(r *http.Request) string {
+	key, _ := r.Context().Value(apiKeyContext{}).(apiKey)
+	return key.Name
+}
+
+// guard lets through requests whose key has at least scope need and is
+// within its rate limit, or any request while no key exists.
+func (k *keyring) guard(need apiScope, next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key, wait, err := k.authenticate(r.Header.Get("Authorization"))
+		switch {
+		case errors.Is(err, errNoKeys):
+			next(w, r)
+			return
+		case err != nil:
+			w.Header().Set("WWW-Authenticate", `Bearer realm="campay"`)
+			writeJSONError(w, http.StatusUnauthorized, err)
+			return
+		case key.ReadOnly && need != scopeRead:
+			writeJSONError(w, http.StatusForbidden, fmt.Errorf("API key %s is read-only; it cannot move money", key.Name))
+			return
+		case !key.Scope.allows(need):
+			writeJSONError(w, http.StatusForbidden, fmt.Errorf("API key %s has scope %s; this needs %s", key.Name, key.Scope, need))
+			return
+		case wait > 0:
+			w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			writeJSONError(w, http.StatusTooManyRequests, fmt.Errorf("API key %s is limited to %d requests a minute", key.Name, key.Rate))
+			return
+		}
+		next(w, r.WithContext(context.WithValue(r.Context(), apiKeyContext{}, key)))
+	}
+}
+
+// =============================================================
+// Command
+// =============================================================
+
+// apikeyCreateOptions are the flags of apikey create.
+type apikeyCreateOptions struct {
+	name     string
+	scope    string
+	rate     int
+	readOnly bool
+}
+
+// apikeyCreateFlags defines the flags of apikey create on fs.
+func apikeyCreateFlags(fs *flag.FlagSet, cfg *Config) *apikeyCreateOptions {
+	opt := &apikeyCreateOptions{}
+	fs.StringVar(&opt.name, "name", "", "who or what uses the key, e.g. till-2 (required)")
+	fs.StringVar(&opt.scope, "scope", "", "read, collect, refund or admin (required)")
+	fs.IntVar(&opt.rate, "rate", 0, "requests per minute the key may make (0 for no limit)")
+	fs.BoolVar(&opt.readOnly, "read-only", false, "refuse the key everything that moves money, whatever its scope (for auditors)")
+	return opt
+}
+
+// runAPIKey creates, lists and revokes the daemon's API keys.
+func runAPIKey(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return invalidInput("usage: campay apikey create|list|revoke [flags]")
+	}
+	ring, err := openKeyring()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		fs := newFlagSet("apikey create")
+		opt := apikeyCreateFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		if strings.TrimSpace(opt.name) == "" {
+			return invalidInput("--name is required")
+		}
+		scope, err := parseScope(opt.scope)
+		if err != nil {
+			return err
+		}
+		if opt.rate < 0 {
+			return invalidInput("--rate cannot be negative")
+		}
+		keys, err := ring.List()
+		if err != nil {
+			return err
+		}
+		for _, k := range keys {
+			if k.Name == opt.name && k.RevokedAt == nil {
+				return invalidInput("there is already a key named %q (revoke it first)", opt.name)
+			}
+		}
+
+		secret, key := newAPIKey(opt.name, scope, opt.rate)
+		key.ReadOnly = opt.readOnly
+		if err := ring.write(key); err != nil {
+			return err
+		}
+		auditAPIKey("created", key)
+		if len(keys) == 0 {
+			fmt.Println("⚠ The daemon API now needs a key on every request but /healthz, /readyz and /openapi.json")
+		}
+		kind := string(key.Scope)
+		if key.ReadOnly {
+			kind = "read-only " + kind
+		}
+		fmt.Printf("✓ Created %s key %s (%s)\n", kind, key.ID, key.Name)
+		fmt.Println("  It is shown only this once:")
+		fmt.Println("  " + secret)
+		return nil
+
+	case "list":
+		keys, err := ring.List()
+		if err != nil {
+			return err
+		}
+		tbl := newTable("No API keys; the daemon API is open to whoever can reach it",
+			tableColumn{Name: "ID"},
+			tableColumn{Name: "Name"},
+			tableColumn{Name: "Scope"},
+			tableColumn{Name: "Rate/min", Right: true},
+			tableColumn{Name: "Read-only"},
+			tableColumn{Name: "Created"},
+			tableColumn{Name: "Revoked"},
+		)
+		for _, k := range keys {
+			rate, readOnly := "-", ""
+			var revoked any // a time, formatted by the table like CreatedAt
+			if k.Rate > 0 {
+				rate = strconv.Itoa(k.Rate)
+			}
+			if k.ReadOnly {
+				readOnly = "yes"
+			}
+			if k.RevokedAt != nil {
+				revoked = *k.RevokedAt
+			}
+			tbl.Row(k.ID, k.Name, string(k.Scope), rate, readOnly, k.CreatedAt, revoked)
+		}
+		return tbl.Print()
+
+	case "revoke":
+		if len(args) != 2 {
+			return invalidInput("usage: campay apikey revoke <id|name>")
+		}
+		keys, err := ring.List()
+		if err != nil {
+			return err
+		}
+		var match []apiKey
+		for _, k := range keys {
+			if k.RevokedAt == nil && (k.ID == args[1] || k.Name == args[1]) {
+				match = append(match, k)
+			}
+		}
+		if len(match) != 1 {
+			return invalidInput("no active API key %q (see campay apikey list)", args[1])
+		}
+		key := match[0]
+		now := time.Now().UTC()
+		key.RevokedAt = &now
+		if err := ring.write(key); err != nil {
+			return err
+		}
+		auditAPIKey("revoked", key)
+		fmt.Printf("✓ Revoked key %s (%s); a running daemon refuses it from its next request\n", key.ID, key.Name)
+		return nil
+
+	default:
+		return invalidInput("unknown apikey command %q (use create, list or revoke)", args[0])
+	}
+}
+
+// auditAPIKey logs the creation or revocation of a key.
+func auditAPIKey(outcome string, key apiKey) {
+	err := appendAudit(AuditEvent{
+		Action:  "api_key",
+		Outcome: outcome,
+		Details: map[string]any{"id": key.ID, "name": key.Name, "scope": key.Scope, "rate": key.Rate, "read_only": key.ReadOnly},
+	})
+	if err != nil {
+		fmt.Println("⚠ Failed to write audit log:", err)
+	}
+}
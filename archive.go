@@ -0,0 +1,435 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+)
+
+/* ============================================================
+   ====================== LEDGER ARCHIVES ======================
+   ============================================================ */
+
+// Old transactions are moved out of the ledger so that it stays small on
+// devices with little storage. An archive is a gzip-compressed JSON lines
+// file in the archive directory next to the ledger, holding the last line
+// of every archived transaction as it was in the ledger (phones stay
+// encrypted). Only final or abandoned transactions are archived, and
+// `ledger restore` puts an archive back.
+
+// RetentionConfig is the "retention" section of the config file. The
+// daemon archives transactions older than ArchiveAfter by itself.
+type RetentionConfig struct {
+	ArchiveAfter string `json:"archive_after,omitempty"` // e.g. 18m (months), 2y, 6w, 90d
+}
+
+// retentionCutoff returns the creation time before which a transaction is
+// older than age: a number of days (d), weeks (w), months (m) or years (y).
+func retentionCutoff(age string, now time.Time) (time.Time, error) {
+	bad := invalidInput("invalid age %q (use e.g. 90d, 6w, 18m for months or 2y)", age)
+	if len(age) < 2 {
+		return time.Time{}, bad
+	}
+	n, err := strconv.Atoi(age[:len(age)-1])
+	if err != nil || n <= 0 {
+		return time.Time{}, bad
+	}
+	switch age[len(age)-1] {
+	case 'd':
+		return now.AddDate(0, 0, -n), nil
+	case 'w':
+		return now.AddDate(0, 0, -7*n), nil
+	case 'm':
+		return now.AddDate(0, -n, 0), nil
+	case 'y':
+		return now.AddDate(-n, 0, 0), nil
+	}
+	return time.Time{}, bad
+}
+
+func (l *Ledger) archiveDir() string {
+	return filepath.Join(filepath.Dir(l.path), "archive")
+}
+
+// archivable reports whether a transaction may leave the ledger: it can no
+// longer change and was created before cutoff.
+func archivable(e LedgerEntry, cutoff time.Time) bool {
+	return (isFinal(e.Status) || e.Status.Abandoned()) && e.CreatedAt.Before(cutoff)
+}
+
+// Archive moves the transactions created before cutoff that are final or
+// abandoned into a new archive file and rewrites the ledger without them.
+// It returns the archive and the number of transactions moved; with
+// dryRun nothing is written. Lines appended by another process while the
+// ledger is rewritten are carried over.
+func (l *Ledger) Archive(cutoff time.Time, dryRun bool) (string, int, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	data, err := os.ReadFile(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return "", 0, nil
+	}
+	if err != nil {
+		return "", 0, err
+	}
+
+	// Lines are moved as they are, with phones still encrypted
+	lines := bytes.Split(data, []byte("\n"))
+	latest := map[string]int{}
+	refs := make([]string, len(lines))
+	var order []string
+	for i, line := range lines {
+		if len(line) == 0 {
+			continue
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal(line, &e); err != nil {
+			if tornLine(err) {
+				lines[i] = nil // dropped from the rewritten ledger
+				continue
+			}
+			return "", 0, fmt.Errorf("%s:%d: %w", l.path, i+1, err)
+		}
+		if _, seen := latest[e.Reference]; !seen {
+			order = append(order, e.Reference)
+		}
+		refs[i] = e.Reference
+		latest[e.Reference] = i
+	}
+
+	archived := map[string]bool{}
+	var moved [][]byte
+	for _, ref := range order {
+		line := lines[latest[ref]]
+		var e LedgerEntry
+		json.Unmarshal(line, &e)
+		if archivable(e, cutoff) {
+			archived[ref] = true
+			moved = append(moved, line)
+		}
+	}
+	if len(moved) == 0 || dryRun {
+		return "", len(moved), nil
+	}
+
+	dir := l.archiveDir()
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", 0, err
+	}
+	path := filepath.Join(dir, "ledger-"+time.Now().UTC().Format("20060102T150405Z")+".jsonl.gz")
+	if err := writeArchive(path, moved); err != nil {
+		return "", 0, err
+	}
+
+	var kept bytes.Buffer
+	for i, line := range lines {
+		if len(line) > 0 && !archived[refs[i]] {
+			kept.Write(line)
+			kept.WriteByte('\n')
+		}
+	}
+	if err := l.replace(kept.Bytes(), int64(len(data))); err != nil {
+		os.Remove(path)
+		return "", 0, err
+	}
+	return path, len(moved), nil
+}
+
+func writeArchive(path string, lines [][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(f)
+	for _, line := range lines {
+		zw.Write(line)
+		zw.Write([]byte{'\n'})
+	}
+	if err := zw.Close(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+// replace swaps the ledger file for data. read is how much of the old file
+// data was built from; lines appended since by another process are kept,
+// read under the exclusive ledger lock so none is appended after them.
+func (l *Ledger) replace(data []byte, read int64) error {
+	unlock, err := l.lockForWrite(true)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	if f, err := os.Open(l.path); err == nil {
+		f.Seek(read, io.SeekStart)
+		tail, err := io.ReadAll(f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+		data = append(data, tail...)
+	}
+	return writeFileAtomic(l.path, data, 0600)
+}
+
+// readArchive returns the entries of an archive, with phones decrypted.
+func (l *Ledger) readArchive(path string) ([]LedgerEntry, [][]byte, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	var entries []LedgerEntry
+	var lines [][]byte
+	scanner := bufio.NewScanner(zr)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		if e.Phone, err = openField(l.aead, e.Phone); err != nil {
+			return nil, nil, fmt.Errorf("%s:%d: %w", path, n, err)
+		}
+		entries = append(entries, e)
+		lines = append(lines, bytes.Clone(scanner.Bytes()))
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, fmt.Errorf("%s: %w", path, err)
+	}
+	return entries, lines, nil
+}
+
+// Restore appends the transactions of an archive back to the ledger,
+// skipping any the ledger holds again, and deletes the archive. It returns
+// how many were restored.
+func (l *Ledger) Restore(path string) (int, error) {
+	_, lines, err := l.readArchive(path)
+	if err != nil {
+		return 0, err
+	}
+	current, err := l.Entries()
+	if err != nil {
+		return 0, err
+	}
+	present := map[string]bool{}
+	for _, e := range current {
+		present[e.Reference] = true
+	}
+
+	var buf bytes.Buffer
+	restored := 0
+	for _, line := range lines {
+		var e LedgerEntry
+		json.Unmarshal(line, &e)
+		if present[e.Reference] {
+			continue
+		}
+		buf.Write(line)
+		buf.WriteByte('\n')
+		restored++
+	}
+
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if err := l.appendLocked(buf.Bytes()); err != nil {
+		return 0, err
+	}
+	return restored, os.Remove(path)
+}
+
+// archivePath resolves an archive given by path or by its name in the
+// archive directory.
+func (l *Ledger) archivePath(name string) (string, error) {
+	if _, err := os.Stat(name); err == nil {
+		return name, nil
+	}
+	path := filepath.Join(l.archiveDir(), filepath.Base(name))
+	if _, err := os.Stat(path); err != nil {
+		return "", invalidInput("unknown archive %q (see campay ledger archives)", name)
+	}
+	return path, nil
+}
+
+// archiveLedger archives with the retention lease held, so two daemons
+// sharing a data directory never rewrite the ledger at the same time.
+func archiveLedger(ledger *Ledger, coord Coordinator, cutoff time.Time, dryRun bool) (string, int, error) {
+	if coord != nil && !dryRun {
+		ok, err := coord.Acquire(leaseArchive, 10*time.Minute)
+		if err != nil {
+			return "", 0, err
+		}
+		if !ok {
+			return "", 0, errors.New("another process is archiving the ledger")
+		}
+		defer coord.Release(leaseArchive)
+	}
+	return ledger.Archive(cutoff, dryRun)
+}
+
+// runRetention applies the retention policy every interval until ctx is
+// done.
+func runRetention(ctx context.Context, ledger *Ledger, coord Coordinator, age string, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		cutoff, err := retentionCutoff(age, time.Now())
+		if err != nil {
+			fmt.Println("⚠ Retention:", err)
+			return
+		}
+		if path, n, err := archiveLedger(ledger, coord, cutoff, false); err != nil {
+			fmt.Println("⚠ Retention:", err)
+		} else if n > 0 {
+			fmt.Printf("🗄 Archived %d transaction(s) older than %s to %s\n", n, age, path)
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ledgerArchiveOptions are the flags of ledger archive.
+type ledgerArchiveOptions struct {
+	olderThan string
+	dryRun    bool
+}
+
+// ledgerArchiveFlags defines the flags of ledger archive on fs.
+func ledgerArchiveFlags(fs *flag.FlagSet, cfg *Config) *ledgerArchiveOptions {
+	opt := &ledgerArchiveOptions{}
+	fs.StringVar(&opt.olderThan, "older-than", cfg.Retention.ArchiveAfter, "archive transactions created longer ago than this: 90d, 6w, 18m (months) or 2y")
+	fs.BoolVar(&opt.dryRun, "dry-run", false, "only count the transactions that would be archived")
+	return opt
+}
+
+// runLedgerCmd archives old transactions and restores archives.
+func runLedgerCmd(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return invalidInput("usage: campay ledger archive|archives|restore|export [flags]")
+	}
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "archive":
+		fs := newFlagSet("ledger archive")
+		opt := ledgerArchiveFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		if opt.olderThan == "" {
+			return invalidInput("--older-than is required (or set retention.archive_after in the config file)")
+		}
+		cutoff, err := retentionCutoff(opt.olderThan, time.Now())
+		if err != nil {
+			return err
+		}
+		coord, err := openCoordinator()
+		if err != nil {
+			return err
+		}
+		path, n, err := archiveLedger(ledger, coord, cutoff, opt.dryRun)
+		if err != nil {
+			return err
+		}
+		switch {
+		case n == 0:
+			fmt.Printf("No final transaction created before %s\n", inZone(cutoff).Format("2006-01-02"))
+		case opt.dryRun:
+			fmt.Printf("%d transaction(s) created before %s would be archived\n", n, inZone(cutoff).Format("2006-01-02"))
+		default:
+			fmt.Printf("✓ Archived %d transaction(s) created before %s to %s\n", n, inZone(cutoff).Format("2006-01-02"), path)
+			fmt.Printf("  Put them back with: campay ledger restore %s\n", filepath.Base(path))
+		}
+		return nil
+
+	case "archives":
+		files, err := filepath.Glob(filepath.Join(ledger.archiveDir(), "ledger-*.jsonl.gz"))
+		if err != nil {
+			return err
+		}
+		sort.Strings(files)
+		tbl := newTable("No archives",
+			tableColumn{Name: "Archive"},
+			tableColumn{Name: "Transactions", Right: true},
+			tableColumn{Name: "Oldest"},
+			tableColumn{Name: "Newest"},
+			tableColumn{Name: "Size", Right: true},
+		)
+		for _, f := range files {
+			entries, _, err := ledger.readArchive(f)
+			if err != nil {
+				return err
+			}
+			var oldest, newest time.Time
+			for _, e := range entries {
+				if oldest.IsZero() || e.CreatedAt.Before(oldest) {
+					oldest = e.CreatedAt
+				}
+				if e.CreatedAt.After(newest) {
+					newest = e.CreatedAt
+				}
+			}
+			size := int64(0)
+			if fi, err := os.Stat(f); err == nil {
+				size = fi.Size()
+			}
+			tbl.Row(filepath.Base(f), len(entries), oldest, newest, fmt.Sprintf("%.1f KiB", float64(size)/1024))
+		}
+		return tbl.Print()
+
+	case "restore":
+		if len(args) != 2 {
+			return invalidInput("usage: campay ledger restore <archive>")
+		}
+		path, err := ledger.archivePath(args[1])
+		if err != nil {
+			return err
+		}
+		n, err := ledger.Restore(path)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Restored %d transaction(s) from %s\n", n, filepath.Base(path))
+		return nil
+
+	case "export":
+		return runLedgerExport(cfg, ledger, args[1:])
+
+	default:
+		return invalidInput("unknown ledger command %q (use archive, archives, restore or export)", args[0])
+	}
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= AUDIT LOG =========================
+   ============================================================ */
+
+// AuditEvent is one line of the append-only audit log: who did what, when,
+// with which credentials and with what outcome. It is kept apart from
+// --verbose debug output and is meant for compliance reviews.
+type AuditEvent struct {
+	Time              time.Time      `json:"time"`
+	Action            string         `json:"action"` // collect, withdraw, cancel, risk_override, ...
+	Outcome           string         `json:"outcome,omitempty"`
+	Actor             string         `json:"actor"`                // OS user
+	Host              string         `json:"host,omitempty"`       // machine the action ran on
+	Credential        string         `json:"credential,omitempty"` // CamPay app username (never the password)
+	Profile           string         `json:"profile,omitempty"`
+	Environment       string         `json:"environment,omitempty"`
+	Reference         string         `json:"reference,omitempty"`
+	ExternalReference string         `json:"external_reference,omitempty"`
+	Phone             string         `json:"phone,omitempty"`
+	Amount            int            `json:"amount,omitempty"`
+	Details           map[string]any `json:"details,omitempty"`
+}
+
+// Outcomes of money-moving actions. Final statuses are logged as the
+// status itself (SUCCESSFUL, FAILED).
+const (
+	auditRequested = "requested"
+	auditInitiated = "initiated"
+	auditNotSent   = "not sent: " // prefix; the call failed before CamPay could act on it
+)
+
+// auditError is the outcome logged for a failed money-moving call:
+// "not sent: ..." when err proves CamPay never acted on the request, and
+// "error: ..." when it may have, as after a timeout or a 5xx.
+func auditError(err error) string {
+	if collectOutcomeUnknown(err) {
+		return "error: " + err.Error()
+	}
+	return auditNotSent + err.Error()
+}
+
+var auditMu sync.Mutex
+
+func osUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// appendAudit writes ev to ~/.campay/audit.jsonl, filling in the time and
+// the OS user and host. The phone number is encrypted like the ledger's.
+func appendAudit(ev AuditEvent) error {
+	dir, err := dataDir()
+	if err != nil {
+		return err
+	}
+	aead, err := ledgerCipher()
+	if err != nil {
+		return err
+	}
+	if err := sealPhones(aead, &ev.Phone); err != nil {
+		return err
+	}
+	if ev.Time.IsZero() {
+		ev.Time = time.Now().UTC()
+	}
+	if ev.Actor == "" {
+		ev.Actor = osUser()
+	}
+	if ev.Host == "" {
+		ev.Host, _ = os.Hostname()
+	}
+
+	line, err := json.Marshal(ev)
+	if err != nil {
+		return err
+	}
+
+	auditMu.Lock()
+	defer auditMu.Unlock()
+
+	f, err := os.OpenFile(filepath.Join(dir, "audit.jsonl"), os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// auditMoney logs a step of a money-moving action with the credentials and
+// profile in use. Callers refuse to start an action whose "requested"
+// entry cannot be written; later steps only warn.
+func auditMoney(cfg *Config, action, outcome string, e LedgerEntry) error {
+	err := appendAudit(AuditEvent{
+		Action:            action,
+		Outcome:           outcome,
+		Credential:        cfg.Username,
+		Profile:           cfg.Profile,
+		Environment:       cfg.Env,
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Phone:             e.Phone,
+		Amount:            e.Amount,
+	})
+	if err != nil && outcome != auditRequested {
+		fmt.Println("⚠ Failed to write audit log:", err)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("refusing to %s without an audit entry: %w", action, err)
+	}
+	return nil
+}
+
+// lastAuditEvents returns the last event of action for each of the
+// external references refs, read back from the audit log.
+func lastAuditEvents(action string, refs map[string]bool) (map[string]AuditEvent, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(filepath.Join(dir, "audit.jsonl"))
+	if errors.Is(err, os.ErrNotExist) {
+		return map[string]AuditEvent{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	last := map[string]AuditEvent{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 0, 64<<10), 1<<20)
+	for scanner.Scan() {
+		var ev AuditEvent
+		if json.Unmarshal(scanner.Bytes(), &ev) != nil {
+			continue // a line cut short by a crash
+		}
+		if ev.Action == action && refs[ev.ExternalReference] {
+			last[ev.ExternalReference] = ev
+		}
+	}
+	return last, scanner.Err()
+}
+
+// auditStatusConflict raises an alert for a final status observed after e
+// was recorded with a different one, which the ledger keeps.
+func auditStatusConflict(e LedgerEntry, observed campay.Status) {
+	fmt.Printf("🚨 %s: CamPay reported %s, but %s was recorded first and is kept; see the audit log\n", e.Reference, observed, e.Status)
+	err := appendAudit(AuditEvent{
+		Action:            "status_conflict",
+		Outcome:           "kept " + string(e.Status),
+		Environment:       e.Environment,
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Phone:             e.Phone,
+		Amount:            e.Amount,
+		Details:           map[string]any{"kept": e.Status, "observed": observed},
+	})
+	if err != nil {
+		fmt.Println("⚠ Failed to write audit log:", err)
+	}
+}
@@ -0,0 +1,450 @@
+package main
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= BATCH PAYOUTS =======================
+   ============================================================ */
+
+type batchRow struct {
+	Line              int    `json:"line"`
+	Phone             string `json:"phone"`
+	Amount            int    `json:"amount"`
+	Description       string `json:"description"`
+	ExternalReference string `json:"external_reference"`
+	AltPhone          string `json:"alt_phone,omitempty"` // payee's number on another operator, for routing
+	RefundOf          string `json:"refund_of,omitempty"` // collection this payout refunds
+	Operator          string `json:"operator,omitempty"`  // payee's network when not the prefix's, e.g. ported
+	Route             string `json:"route,omitempty"`     // set when the row was rerouted
+}
+
+// operator is the network the row is paid on.
+func (r batchRow) operator() string {
+	if r.Operator != "" {
+		return r.Operator
+	}
+	return operatorFor(r.Phone)
+}
+
+type batchResult struct {
+	Row       batchRow
+	Reference string
+	Status    string
+	Err       error
+}
+
+// withdrawBatchOptions are the flags of withdraw-batch.
+type withdrawBatchOptions struct {
+	concurrency  int
+	out          string
+	signKey      string
+	force        bool
+	descTemplate string
+	routing      string
+	yes          bool
+	forceUnlock  bool
+}
+
+// withdrawBatchFlags defines the flags of withdraw-batch on fs.
+func withdrawBatchFlags(fs *flag.FlagSet, cfg *Config) *withdrawBatchOptions {
+	opt := &withdrawBatchOptions{}
+	fs.IntVar(&opt.concurrency, "concurrency", 4, "number of payouts processed in parallel")
+	fs.StringVar(&opt.out, "out", "", "results file (default: <input>.results.csv)")
+	fs.StringVar(&opt.signKey, "sign-key", os.Getenv("BATCH_SIGNING_KEY"), "HMAC key used to sign the results file")
+	fs.BoolVar(&opt.force, "force", false, "override risk rules (recorded in the audit log)")
+	fs.StringVar(&opt.descTemplate, "description-template", cfg.DescriptionTemplate, "description template for rows without a description; CSV columns are available as variables")
+	fs.StringVar(&opt.routing, "routing", cfg.Routing.Mode, "when an operator balance is short: none, failover or split (uses the alt_phone column)")
+	fs.BoolVar(&opt.yes, "yes", false, "reroute payouts without asking")
+	fs.BoolVar(&opt.forceUnlock, "force-unlock", false, "remove the lock left by a batch run that did not exit cleanly")
+	return opt
+}
+
+func runWithdrawBatch(cfg *Config, args []string) error {
+	fs := newFlagSet("withdraw-batch")
+	opt := withdrawBatchFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "withdraw-batch"); err != nil {
+		return err
+	}
+	if opt.routing == "" {
+		opt.routing = routeNone
+	}
+	if !validRouteMode(opt.routing) {
+		return invalidInput("--routing must be none, failover or split")
+	}
+	if fs.NArg() != 1 {
+		return invalidInput("usage: campay withdraw-batch [flags] <payees.csv>")
+	}
+	if opt.concurrency < 1 {
+		return invalidInput("concurrency must be at least 1")
+	}
+
+	input := fs.Arg(0)
+	if opt.out == "" {
+		opt.out = strings.TrimSuffix(input, ".csv") + ".results.csv"
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	unlock, err := acquireRunLock(ledger, "batch", "withdraw-batch", opt.forceUnlock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	refs, err := newRefAllocator(cfg, ledger)
+	if err != nil {
+		return err
+	}
+	rows, err := readBatchFile(input, opt.descTemplate, refs)
+	if err != nil {
+		return err
+	}
+	for i, r := range rows {
+		if r.Operator == "" {
+			rows[i].Operator = cfg.PortedNumbers[r.Phone]
+		}
+	}
+
+	// Check every row before paying anyone
+	risk, err := newRiskCheck(cfg.Risk, ledger, "withdraw")
+	if err != nil {
+		return err
+	}
+	for _, r := range rows {
+		if err := checkLimitsFor(cfg.OperatorLimits, r.operator(), r.Amount); err != nil {
+			return fmt.Errorf("line %d: %w", r.Line, err)
+		}
+		if err := risk.Enforce(r.Phone, r.Amount, opt.force); err != nil {
+			return fmt.Errorf("line %d: %w", r.Line, err)
+		}
+	}
+
+	total := 0
+	for _, r := range rows {
+		total += r.Amount
+	}
+	fmt.Printf("Loaded %d payees, total %s\n", len(rows), formatAmount(total, "XAF"))
+
+	provider, err := connectProvider(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Refuse to start a run the account cannot cover
+	if bp, ok := provider.(balanceProvider); ok {
+		balance, err := bp.Balance(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to fetch balance: %w", err)
+		}
+		printWarnings(balance.Warnings)
+		if campay.Amount(total) > balance.TotalBalance {
+			return exitErr(exitInsufficientFunds, fmt.Errorf("insufficient balance: batch needs %d XAF, available %.0f %s",
+				total, balance.TotalBalance, balance.Currency))
+		}
+
+		// Each payout is drawn from the payee operator's balance
+		available := operatorBalances(balance, cfg.Routing.Reserve)
+		routed, changed, short := routePayouts(rows, available, opt.routing)
+		if len(short) > 0 {
+			var parts []string
+			for op, v := range short {
+				parts = append(parts, fmt.Sprintf("%s is %s short", op, formatAmount(v, "XAF")))
+			}
+			hint := ""
+			if opt.routing == routeNone {
+				hint = " (see --routing)"
+			}
+			sort.Strings(parts)
+			return exitErr(exitInsufficientFunds, fmt.Errorf("insufficient operator balance: %s%s", strings.Join(parts, ", "), hint))
+		}
+		if changed {
+			printRoutingPlan(routed, available)
+			for _, r := range routed {
+				if err := checkLimitsFor(cfg.OperatorLimits, r.operator(), r.Amount); err != nil {
+					return fmt.Errorf("line %d: %w", r.Line, err)
+				}
+			}
+			if err := confirmRouting(opt.yes); err != nil {
+				return err
+			}
+			rows = routed
+		}
+		fmt.Printf("✓ Balance check passed (available %s)\n\n", formatMoney(balance.TotalBalance, balance.Currency))
+	} else {
+		fmt.Printf("⚠ %s cannot report a balance; skipping the balance check\n\n", provider.Name())
+	}
+
+	run, err := startBatchRun(cfg, ledger, input, opt.out, rows)
+	if err != nil {
+		return err
+	}
+	fmt.Printf("Batch run %s (if interrupted: campay batch resume %s)\n\n", run.ID, run.ID)
+
+	states := make([]rowState, len(rows))
+	for i, r := range rows {
+		states[i].Row = r
+	}
+	results, err := processWithdrawals(cfg, provider, ledger, run, states, opt.concurrency)
+	if err != nil {
+		return err
+	}
+	return finishBatch(ledger, run, results, opt.signKey)
+}
+
+// readBatchFile parses a CSV file with a header row. The phone and amount
+// columns are required; description, external_reference and alt_phone are
+// optional.
+// Phones may reference saved contacts as @alias. Rows without a description
+// get descTemplate rendered with the row's columns, if a template is set.
+// External references are generated and checked by refs (may be nil).
+func readBatchFile(path, descTemplate string, refs *refAllocator) ([]batchRow, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.TrimLeadingSpace = true
+
+	header, err := r.Read()
+	if err != nil {
+		return nil, invalidInput("failed to read header: %v", err)
+	}
+
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	for _, name := range []string{"phone", "amount"} {
+		if _, ok := col[name]; !ok {
+			return nil, invalidInput("missing %q column", name)
+		}
+	}
+
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var rows []batchRow
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		phone, err := resolvePhone(field(rec, "phone"))
+		if err != nil {
+			return nil, exitErr(exitValidation, fmt.Errorf("line %d: %w", line, err))
+		}
+
+		amount, err := parseAmount(field(rec, "amount"))
+		if err != nil {
+			return nil, exitErr(exitValidation, fmt.Errorf("line %d: %w", line, err))
+		}
+
+		row := batchRow{
+			Line:              line,
+			Phone:             phone,
+			Amount:            amount,
+			Description:       field(rec, "description"),
+			ExternalReference: field(rec, "external_reference"),
+			RefundOf:          field(rec, "refund_of"),
+		}
+		if row.Operator, err = parseOperator(field(rec, "operator")); err != nil {
+			return nil, exitErr(exitValidation, fmt.Errorf("line %d: %w", line, err))
+		}
+		if alt := field(rec, "alt_phone"); alt != "" {
+			if row.AltPhone, err = resolvePhone(alt); err != nil {
+				return nil, exitErr(exitValidation, fmt.Errorf("line %d: alt_phone: %w", line, err))
+			}
+		}
+		if row.ExternalReference == "" {
+			if row.ExternalReference, err = refs.Generate("PAY"); err != nil {
+				return nil, err
+			}
+		} else if err := refs.Check(row.ExternalReference); err != nil {
+			return nil, exitErr(exitValidation, fmt.Errorf("line %d: %w", line, err))
+		}
+		if row.Description == "" && descTemplate != "" {
+			vars := map[string]string{}
+			for i, h := range header {
+				if i < len(rec) {
+					vars[strings.TrimSpace(h)] = strings.TrimSpace(rec[i])
+				}
+			}
+			vars["Phone"] = row.Phone
+			vars["Amount"] = strconv.Itoa(row.Amount)
+			vars["ExternalReference"] = row.ExternalReference
+			vars["Line"] = strconv.Itoa(line)
+
+			row.Description, err = renderDescription(descTemplate, vars)
+			if err != nil {
+				return nil, exitErr(exitValidation, fmt.Errorf("line %d: %w", line, err))
+			}
+		}
+		if row.Description == "" {
+			row.Description = "Payout"
+		}
+		rows = append(rows, row)
+	}
+
+	if len(rows) == 0 {
+		return nil, invalidInput("%s contains no rows", path)
+	}
+	return rows, nil
+}
+
+// processWithdrawals pays every row of a batch run using at most
+// concurrency workers. Rows already paid are only waited for, or reported
+// when final. Results are written to the run's results file as they come
+// (see batchresults.go) and returned in input order.
+func processWithdrawals(cfg *Config, provider Provider, ledger *Ledger, run *batchRun, states []rowState, concurrency int) ([]batchResult, error) {
+	out, err := newResultsWriter(run.Out, len(states))
+	if err != nil {
+		return nil, err
+	}
+	results := make([]batchResult, len(states))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				switch s := states[i]; {
+				case s.Interrupted:
+					results[i] = batchResult{Row: s.Row, Err: errors.New("interrupted: requested and may have been sent; check with campay lookup --external-ref " + s.Row.ExternalReference)}
+				case s.Done():
+					results[i] = batchResult{Row: s.Row, Reference: s.Entry.Reference, Status: string(s.Entry.Status)}
+				case s.Entry != nil:
+					results[i] = awaitRow(cfg, provider, ledger, s.Row, s.Entry.Reference)
+				default:
+					results[i] = withdrawRow(cfg, provider, ledger, run.ID, s.Row)
+				}
+				out.Put(i, results[i])
+			}
+		}()
+	}
+
+	for i := range states {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	return results, out.Close()
+}
+
+func withdrawRow(cfg *Config, provider Provider, ledger *Ledger, runID string, row batchRow) batchResult {
+	res := batchResult{Row: row}
+
+	audited := LedgerEntry{ExternalReference: row.ExternalReference, Phone: row.Phone, Amount: row.Amount}
+	if err := auditMoney(cfg, "withdraw", auditRequested, audited); err != nil {
+		res.Err = err
+		return res
+	}
+
+	withdrawResp, err := provider.Withdraw(context.Background(), campay.WithdrawRequest{
+		Amount:            row.Amount,
+		Currency:          "XAF",
+		To:                row.Phone,
+		Description:       row.Description,
+		ExternalReference: row.ExternalReference,
+		Operator:          row.Operator,
+	})
+	if err != nil {
+		auditMoney(cfg, "withdraw", auditError(err), audited)
+		res.Err = err
+		return res
+	}
+	res.Reference = withdrawResp.Reference
+	audited.Reference = withdrawResp.Reference
+	auditMoney(cfg, "withdraw", auditInitiated, audited)
+
+	recordLedger(ledger, LedgerEntry{
+		Reference:         withdrawResp.Reference,
+		ExternalReference: row.ExternalReference,
+		Kind:              "withdraw",
+		Phone:             row.Phone,
+		Amount:            row.Amount,
+		Currency:          "XAF",
+		Description:       row.Description,
+		Status:            campay.StatusPending,
+		Environment:       cfg.Env,
+		Refund:            row.RefundOf != "",
+		RefundOf:          row.RefundOf,
+		Batch:             runID,
+	})
+	return awaitRow(cfg, provider, ledger, row, withdrawResp.Reference)
+}
+
+// awaitRow waits for the payout of a row to become final.
+func awaitRow(cfg *Config, provider Provider, ledger *Ledger, row batchRow, reference string) batchResult {
+	res := batchResult{Row: row, Reference: reference}
+	audited := LedgerEntry{ExternalReference: row.ExternalReference, Phone: row.Phone, Amount: row.Amount, Reference: reference}
+
+	status, err := pollTransactionStatus(provider, ledger, reference, cfg.Deadline, nil)
+	if err != nil {
+		auditMoney(cfg, "withdraw", "error: "+err.Error(), audited)
+		res.Err = err
+		return res
+	}
+	res.Status = status.Status
+	auditMoney(cfg, "withdraw", string(parseStatus(status.Status)), audited)
+
+	if err := ledger.UpdateStatus(reference, parseStatus(status.Status), status.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	return res
+}
+
+// signFile writes <path>.sig containing an HMAC-SHA256 of the file, or a
+// plain SHA-256 digest when no key is configured.
+func signFile(path, key string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	var line string
+	if key != "" {
+		mac := hmac.New(sha256.New, []byte(key))
+		mac.Write(data)
+		line = "hmac-sha256 " + hex.EncodeToString(mac.Sum(nil))
+	} else {
+		fmt.Println("⚠ No signing key configured, writing an unsigned SHA-256 digest")
+		sum := sha256.Sum256(data)
+		line = "sha256 " + hex.EncodeToString(sum[:])
+	}
+
+	return writeFileAtomic(path+".sig", []byte(line+"\n"), 0644)
+}
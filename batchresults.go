@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+)
+
+/* ============================================================
+   ======================= RESULTS FILE ========================
+   ============================================================ */
+
+// Workers hand their results to a single writer goroutine, which prints
+// each as it comes and writes the results file in input order: a result
+// that finishes early waits for the rows before it. Every row is flushed
+// as soon as it can be written, into <out>.partial; when the run ends the
+// file is synced and renamed to <out>. A crash mid-batch therefore leaves
+// the previous results file untouched and a .partial holding whole rows
+// only, which `batch resume` writes again in full.
+
+var resultsHeader = []string{"line", "phone", "amount", "external_reference", "reference", "status", "error", "route"}
+
+// resultsWriter is the writer goroutine of a run's results file.
+type resultsWriter struct {
+	results chan indexedResult
+	done    chan error
+}
+
+type indexedResult struct {
+	index  int
+	result batchResult
+}
+
+// newResultsWriter starts writing the results of n rows to path.
+func newResultsWriter(path string, n int) (*resultsWriter, error) {
+	f, err := os.Create(path + ".partial")
+	if err != nil {
+		return nil, err
+	}
+	w := &resultsWriter{results: make(chan indexedResult), done: make(chan error, 1)}
+	go func() { w.done <- w.run(f, path, n) }()
+	return w, nil
+}
+
+// Put hands the result of row i to the writer. It may be called from any
+// goroutine, once per row.
+func (w *resultsWriter) Put(i int, r batchResult) {
+	w.results <- indexedResult{i, r}
+}
+
+// Close waits for every row to be written and moves the file into place.
+func (w *resultsWriter) Close() error {
+	close(w.results)
+	return <-w.done
+}
+
+func (w *resultsWriter) run(f *os.File, path string, n int) error {
+	cw := csv.NewWriter(f)
+	cw.Write(resultsHeader)
+	cw.Flush()
+
+	pending := map[int]batchResult{}
+	next := 0
+	var err error
+	for ir := range w.results {
+		printBatchResult(ir.result)
+		pending[ir.index] = ir.result
+		for ; err == nil; next++ {
+			r, ok := pending[next]
+			if !ok {
+				break
+			}
+			delete(pending, next)
+			cw.Write(resultRecord(r))
+			cw.Flush()
+			err = cw.Error()
+		}
+	}
+	if err == nil && next != n {
+		err = fmt.Errorf("%d of %d results were never written", n-next, n)
+	}
+	if err != nil {
+		f.Close()
+		return fmt.Errorf("failed to write %s: %w", filepath.Base(path), err)
+	}
+	return commitFile(f, path, 0644)
+}
+
+// printBatchResult shows the outcome of a row on the console.
+func printBatchResult(r batchResult) {
+	if r.Err != nil {
+		fmt.Printf("❌ line %d %s: %v\n", r.Row.Line, displayPhone(r.Row.Phone), r.Err)
+		return
+	}
+	fmt.Printf("• line %d %s: %s\n", r.Row.Line, displayPhone(r.Row.Phone), r.Status)
+	printResult(r.Reference, r.Status)
+}
+
+// resultRecord is the row of r in the results file.
+func resultRecord(r batchResult) []string {
+	errMsg := ""
+	if r.Err != nil {
+		errMsg = r.Err.Error()
+	}
+	return []string{
+		strconv.Itoa(r.Row.Line),
+		r.Row.Phone,
+		strconv.Itoa(r.Row.Amount),
+		r.Row.ExternalReference,
+		r.Reference,
+		r.Status,
+		errMsg,
+		r.Row.Route,
+	}
+}
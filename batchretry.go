@@ -0,0 +1,148 @@
+package main
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== RETRY FILES ========================
+   ============================================================ */
+
+// After a run, the payouts that failed for good are written to a retry
+// file next to the input (payroll.csv gives payroll.retry.csv). It is a
+// withdraw-batch file: the payee columns of the row as sent, with an empty
+// external_reference so that a new one is generated, then the line,
+// reference, status, reason and suggested fix, which withdraw-batch
+// ignores. Once the rows are fixed (or the reason went away), it is paid
+// with `campay withdraw-batch payroll.retry.csv`.
+//
+// Only rows nobody was paid for go there: a final status the status policy
+// retries (FAILED and EXPIRED by default), or a request CamPay refused.
+// Pending, expired locally and unsent rows may still be paid by CamPay or
+// by `batch resume`, so they stay out.
+
+// retryRow is a row of a retry file.
+type retryRow struct {
+	Result     batchResult
+	Reason     string
+	Suggestion string
+}
+
+// retryPath is the retry file of a run's input.
+func retryPath(input string) string {
+	return strings.TrimSuffix(input, ".csv") + ".retry.csv"
+}
+
+// retryRows picks the results to pay again and explains each.
+func retryRows(ledger *Ledger, results []batchResult) []retryRow {
+	var rows []retryRow
+	for _, r := range results {
+		status := parseStatus(r.Status)
+		switch {
+		case r.Err != nil && refused(r.Err):
+			rows = append(rows, retryRow{Result: r, Reason: r.Err.Error(), Suggestion: refusalFix(r.Err)})
+		case r.Err == nil && isFinal(status) && statusPolicy.IsRetryable(status):
+			reason := statusReason(status)
+			if e, _ := ledger.Get(r.Reference); e != nil && e.StatusReason != "" {
+				reason += ": " + e.StatusReason
+			}
+			rows = append(rows, retryRow{Result: r, Reason: reason, Suggestion: statusFix(status, r.Row)})
+		}
+	}
+	return rows
+}
+
+// refused reports whether err means the payout was turned down before any
+// money moved: invalid input, or a 4xx answer other than busy.
+func refused(err error) bool {
+	var apiErr *campay.APIError
+	if errors.As(err, &apiErr) {
+		return apiErr.StatusCode >= 400 && apiErr.StatusCode < 500 && !apiErr.Busy() &&
+			apiErr.StatusCode != http.StatusUnauthorized && apiErr.StatusCode != http.StatusForbidden
+	}
+	return exitCode(err) == exitValidation
+}
+
+// refusalFix suggests how to fix a row CamPay refused.
+func refusalFix(err error) string {
+	text := strings.ToLower(err.Error())
+	switch {
+	case strings.Contains(text, "phone") || strings.Contains(text, "number"):
+		return "correct the phone number"
+	case strings.Contains(text, "amount") || strings.Contains(text, "limit"):
+		return "check the amount against the operator's limits"
+	case strings.Contains(text, "reference"):
+		return "leave external_reference empty or use a new one"
+	}
+	return "correct the row as the reason says"
+}
+
+// statusReason says what a final status means for a payout.
+func statusReason(status campay.Status) string {
+	switch status {
+	case campay.StatusFailed:
+		return "the operator refused the payout"
+	case campay.StatusExpired:
+		return "the operator did not answer in time"
+	}
+	return "CamPay reported " + string(status)
+}
+
+// statusFix suggests what to do about a payout that ended in status.
+func statusFix(status campay.Status, row batchRow) string {
+	switch status {
+	case campay.StatusExpired:
+		return "pay again later"
+	case campay.StatusFailed:
+		if row.AltPhone != "" {
+			return "check that the number is an active Mobile Money wallet, or swap phone and alt_phone"
+		}
+		return "check that the number is an active Mobile Money wallet, fill operator if it was ported, or give another number"
+	}
+	return "check the payout with CamPay before paying again"
+}
+
+// writeRetryFile writes rows to path, or removes a retry file left by an
+// earlier run of the same input when there are none.
+func writeRetryFile(path string, rows []retryRow) error {
+	if len(rows) == 0 {
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		return nil
+	}
+	var buf bytes.Buffer
+	w := csv.NewWriter(&buf)
+	w.Write([]string{"phone", "amount", "description", "alt_phone", "operator", "refund_of", "external_reference",
+		"line", "reference", "status", "reason", "suggestion"})
+	for _, rr := range rows {
+		r := rr.Result
+		w.Write([]string{
+			r.Row.Phone,
+			strconv.Itoa(r.Row.Amount),
+			r.Row.Description,
+			r.Row.AltPhone,
+			r.Row.Operator,
+			r.Row.RefundOf,
+			"",
+			strconv.Itoa(r.Row.Line),
+			r.Reference,
+			r.Status,
+			rr.Reason,
+			rr.Suggestion,
+		})
+	}
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+	return writeFileAtomic(path, buf.Bytes(), 0644)
+}
@@ -0,0 +1,506 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= BATCH RUNS ========================
+   ============================================================ */
+
+// A withdraw-batch run is saved before the first payout: its rows, as
+// finally routed and with their generated external references, go to
+// <data dir>/batches/<run ID>.json. Every payout of the run is recorded in
+// the ledger with the run ID, so the ledger holds the status of each row.
+// `batch resume` pays the rows that never reached CamPay, waits for the
+// pending ones and skips the rest, without paying anyone twice: a row
+// with no ledger entry but a "requested" line in the audit log may have
+// reached CamPay, so it is looked up by external reference first. Unless
+// its call failed in a way proving it was never sent, a row CamPay does not
+// show is left interrupted.
+
+type batchRun struct {
+	ID          string     `json:"id"`
+	Input       string     `json:"input"`
+	Out         string     `json:"out"`
+	Rows        []batchRow `json:"rows"`
+	StartedAt   time.Time  `json:"started_at"`
+	FinishedAt  *time.Time `json:"finished_at,omitempty"`
+	Environment string     `json:"environment"`
+}
+
+// rowState is where a row of a run stands according to the ledger.
+type rowState struct {
+	Row   batchRow
+	Entry *LedgerEntry // nil until CamPay accepted the payout
+
+	// Interrupted is set by reconcileUnsent for a row whose payout was
+	// requested and may have been sent, but that CamPay does not show.
+	Interrupted bool
+}
+
+func (s rowState) Label() string {
+	if s.Interrupted {
+		return "INTERRUPTED"
+	}
+	if s.Entry == nil {
+		return "NOT SENT"
+	}
+	return statusLabel(string(s.Entry.Status))
+}
+
+func (s rowState) Done() bool {
+	return s.Entry != nil && isFinal(s.Entry.Status)
+}
+
+func batchRunsDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "batches")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+func batchRunPath(id string) (string, error) {
+	if id == "" || strings.ContainsAny(id, `/\`) || id != filepath.Base(id) {
+		return "", invalidInput("invalid batch run ID %q", id)
+	}
+	dir, err := batchRunsDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, id+".json"), nil
+}
+
+// startBatchRun saves a new run of rows before any payout is made.
+func startBatchRun(cfg *Config, ledger *Ledger, input, out string, rows []batchRow) (*batchRun, error) {
+	id, err := prefixedULID("BATCH")
+	if err != nil {
+		return nil, err
+	}
+	run := &batchRun{
+		ID:          id,
+		Input:       input,
+		Out:         out,
+		Rows:        rows,
+		StartedAt:   time.Now().UTC(),
+		Environment: cfg.Env,
+	}
+	return run, run.save(ledger)
+}
+
+// save writes the run, with phone numbers encrypted like the ledger's.
+func (r *batchRun) save(ledger *Ledger) error {
+	path, err := batchRunPath(r.ID)
+	if err != nil {
+		return err
+	}
+	stored := *r
+	stored.Rows = make([]batchRow, len(r.Rows))
+	for i, row := range r.Rows {
+		if ledger.aead != nil {
+			if row.Phone, err = sealField(ledger.aead, row.Phone); err != nil {
+				return err
+			}
+			if row.AltPhone, err = sealField(ledger.aead, row.AltPhone); err != nil {
+				return err
+			}
+		}
+		stored.Rows[i] = row
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0600)
+}
+
+func loadBatchRun(ledger *Ledger, id string) (*batchRun, error) {
+	path, err := batchRunPath(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, invalidInput("unknown batch run %q (see campay batch list)", id)
+	}
+	if err != nil {
+		return nil, err
+	}
+	var run batchRun
+	if err := json.Unmarshal(data, &run); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	for i := range run.Rows {
+		row := &run.Rows[i]
+		if row.Phone, err = openField(ledger.aead, row.Phone); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+		if row.AltPhone, err = openField(ledger.aead, row.AltPhone); err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+	return &run, nil
+}
+
+func listBatchRuns(ledger *Ledger) ([]*batchRun, error) {
+	dir, err := batchRunsDir()
+	if err != nil {
+		return nil, err
+	}
+	files, err := filepath.Glob(filepath.Join(dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	var runs []*batchRun
+	for _, f := range files {
+		run, err := loadBatchRun(ledger, strings.TrimSuffix(filepath.Base(f), ".json"))
+		if err != nil {
+			return nil, err
+		}
+		runs = append(runs, run)
+	}
+	sort.Slice(runs, func(i, j int) bool { return runs[i].StartedAt.Before(runs[j].StartedAt) })
+	return runs, nil
+}
+
+// States returns each row of the run with its payout from the ledger.
+func (r *batchRun) States(ledger *Ledger) ([]rowState, error) {
+	entries, err := ledger.FindByBatch(r.ID)
+	if err != nil {
+		return nil, err
+	}
+	byRef := map[string]LedgerEntry{}
+	for _, e := range entries {
+		byRef[e.ExternalReference] = e
+	}
+	states := make([]rowState, len(r.Rows))
+	for i, row := range r.Rows {
+		states[i].Row = row
+		if e, ok := byRef[row.ExternalReference]; ok {
+			states[i].Entry = &e
+		}
+	}
+	return states, nil
+}
+
+// finishBatch signs the results file of a run, prints the failures and
+// marks the run finished once every row is final.
+func finishBatch(ledger *Ledger, run *batchRun, results []batchResult, signKey string) error {
+	if err := signFile(run.Out, signKey); err != nil {
+		return err
+	}
+
+	failed, unfinished := 0, 0
+	failures := newTable("",
+		tableColumn{Name: "Line", Right: true},
+		tableColumn{Name: "Phone"},
+		tableColumn{Name: "Amount", Amount: true},
+		tableColumn{Name: "Status"},
+		tableColumn{Name: "Error", Max: 50},
+	)
+	for _, r := range results {
+		status := parseStatus(r.Status)
+		if r.Err != nil || !isFinal(status) {
+			unfinished++
+		}
+		if r.Err != nil || status != campay.StatusSuccessful {
+			failed++
+			errText := ""
+			if r.Err != nil {
+				errText = r.Err.Error()
+			}
+			failures.Row(r.Row.Line, displayPhone(r.Row.Phone), r.Row.Amount, status, errText)
+		}
+	}
+	fmt.Printf("\nDone: %d successful, %d failed\n", len(results)-failed, failed)
+	if failed > 0 {
+		fmt.Println()
+		failures.render(os.Stdout, "table")
+	}
+	fmt.Printf("Results written to %s\n", run.Out)
+	retries := retryRows(ledger, results)
+	if err := writeRetryFile(retryPath(run.Input), retries); err != nil {
+		fmt.Println("⚠ Failed to write the retry file:", err)
+	} else if len(retries) > 0 {
+		fmt.Printf("%d row(s) to pay again written to %s with a suggested fix for each; once fixed: campay withdraw-batch %s\n",
+			len(retries), retryPath(run.Input), retryPath(run.Input))
+	}
+
+	if unfinished == 0 {
+		now := time.Now().UTC()
+		run.FinishedAt = &now
+		if err := run.save(ledger); err != nil {
+			fmt.Println("⚠ Failed to mark the batch run finished:", err)
+		}
+	} else {
+		fmt.Printf("%d payout(s) did not complete; continue with: campay batch resume %s\n", unfinished, run.ID)
+	}
+
+	if failed > 0 {
+		return exitErr(exitPaymentFailed, fmt.Errorf("%d of %d payouts failed", failed, len(results)))
+	}
+	return nil
+}
+
+// runBatch lists, shows and resumes withdraw-batch runs.
+func runBatch(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		runs, err := listBatchRuns(ledger)
+		if err != nil {
+			return err
+		}
+		tbl := newTable("No batch runs",
+			tableColumn{Name: "Run"},
+			tableColumn{Name: "Started"},
+			tableColumn{Name: "File", Max: 40},
+			tableColumn{Name: "Rows", Right: true},
+			tableColumn{Name: "Done", Right: true},
+			tableColumn{Name: "State"},
+		)
+		for _, run := range runs {
+			states, err := run.States(ledger)
+			if err != nil {
+				return err
+			}
+			done := 0
+			for _, s := range states {
+				if s.Done() {
+					done++
+				}
+			}
+			state := "incomplete"
+			if run.FinishedAt != nil {
+				state = "finished"
+			}
+			tbl.Row(run.ID, run.StartedAt, run.Input, len(states), done, state)
+		}
+		return tbl.Print()
+
+	case "show":
+		if len(args) != 2 {
+			return invalidInput("usage: campay batch show <run-id>")
+		}
+		run, err := loadBatchRun(ledger, args[1])
+		if err != nil {
+			return err
+		}
+		states, err := run.States(ledger)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Run:     %s\nFile:    %s\nResults: %s\nStarted: %s (%s)\n\n", run.ID, run.Input, run.Out,
+			inZone(run.StartedAt).Format("2006-01-02 15:04"), zoneLabel(run.StartedAt))
+		tbl := newTable("",
+			tableColumn{Name: "Line", Right: true},
+			tableColumn{Name: "Phone"},
+			tableColumn{Name: "Amount", Amount: true},
+			tableColumn{Name: "External ref"},
+			tableColumn{Name: "Reference", Wide: true},
+			tableColumn{Name: "Status"},
+		)
+		for _, s := range states {
+			reference := ""
+			if s.Entry != nil {
+				reference = s.Entry.Reference
+			}
+			tbl.Row(s.Row.Line, displayPhone(s.Row.Phone), s.Row.Amount, s.Row.ExternalReference, reference, s.Label())
+		}
+		return tbl.Print()
+
+	case "resume":
+		return resumeBatch(cfg, ledger, args[1:])
+
+	default:
+		return invalidInput("unknown batch command %q (use list, show or resume)", args[0])
+	}
+}
+
+// batchResumeOptions are the flags of batch resume.
+type batchResumeOptions struct {
+	concurrency int
+	signKey     string
+	forceUnlock bool
+	resend      bool
+}
+
+// batchResumeFlags defines the flags of batch resume on fs.
+func batchResumeFlags(fs *flag.FlagSet, cfg *Config) *batchResumeOptions {
+	opt := &batchResumeOptions{}
+	fs.IntVar(&opt.concurrency, "concurrency", 4, "number of payouts processed in parallel")
+	fs.StringVar(&opt.signKey, "sign-key", os.Getenv("BATCH_SIGNING_KEY"), "HMAC key used to sign the results file")
+	fs.BoolVar(&opt.forceUnlock, "force-unlock", false, "remove the lock left by a batch run that did not exit cleanly")
+	fs.BoolVar(&opt.resend, "resend-interrupted", false, "send again the payouts left interrupted, once checked with campay lookup")
+	return opt
+}
+
+// resumeBatch continues a run that stopped before every row was final.
+func resumeBatch(cfg *Config, ledger *Ledger, args []string) error {
+	fs := newFlagSet("batch resume")
+	opt := batchResumeFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "batch resume"); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return invalidInput("usage: campay batch resume [flags] <run-id>")
+	}
+	if opt.concurrency < 1 {
+		return invalidInput("concurrency must be at least 1")
+	}
+	unlock, err := acquireRunLock(ledger, "batch", "withdraw-batch", opt.forceUnlock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	run, err := loadBatchRun(ledger, fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if run.FinishedAt != nil {
+		return invalidInput("batch run %s already finished (see campay batch show %s)", run.ID, run.ID)
+	}
+	if run.Environment != cfg.Env {
+		return invalidInput("batch run %s was started in %s, not %s", run.ID, run.Environment, cfg.Env)
+	}
+	states, err := run.States(ledger)
+	if err != nil {
+		return err
+	}
+
+	provider, err := connectProvider(cfg)
+	if err != nil {
+		return err
+	}
+	if err := reconcileUnsent(cfg, provider, ledger, run, states, opt.resend); err != nil {
+		return err
+	}
+
+	left, pending, interrupted, total := 0, 0, 0, 0
+	for _, s := range states {
+		switch {
+		case s.Interrupted:
+			interrupted++
+		case s.Entry == nil:
+			left++
+			total += s.Row.Amount
+		case !s.Done():
+			pending++
+		}
+	}
+	fmt.Printf("Resuming %s: %d of %d payouts final, %d pending, %d to send (%s)\n",
+		run.ID, len(states)-left-pending-interrupted, len(states), pending, left, formatAmount(total, "XAF"))
+	if interrupted > 0 {
+		fmt.Printf("⚠ %d payout(s) were requested and may have reached CamPay, but CamPay does not show them; they are not sent again.\n", interrupted)
+		fmt.Println("  Check each with campay lookup --external-ref <ref>, then resume with --resend-interrupted if CamPay has none.")
+	}
+	if bp, ok := provider.(balanceProvider); ok && total > 0 {
+		balance, err := bp.Balance(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to fetch balance: %w", err)
+		}
+		printWarnings(balance.Warnings)
+		if campay.Amount(total) > balance.TotalBalance {
+			return exitErr(exitInsufficientFunds, fmt.Errorf("insufficient balance: the rest of the batch needs %d XAF, available %.0f %s",
+				total, balance.TotalBalance, balance.Currency))
+		}
+	}
+	fmt.Println()
+
+	results, err := processWithdrawals(cfg, provider, ledger, run, states, opt.concurrency)
+	if err != nil {
+		return err
+	}
+	return finishBatch(ledger, run, results, opt.signKey)
+}
+
+// reconcileUnsent settles the rows of a run that have no ledger entry but
+// whose payout the audit log shows as requested: the run stopped, or the
+// call failed, after the payout may have reached CamPay. A payout CamPay
+// accepted is recorded in the ledger and followed like a pending one. Only
+// a call whose failure proves it was never sent (auditNotSent) is sent
+// again; any other row CamPay does not show, or that could not be looked
+// up, is marked interrupted unless resend is set.
+func reconcileUnsent(cfg *Config, provider Provider, ledger *Ledger, run *batchRun, states []rowState, resend bool) error {
+	refs := map[string]bool{}
+	for _, s := range states {
+		if s.Entry == nil {
+			refs[s.Row.ExternalReference] = true
+		}
+	}
+	if len(refs) == 0 {
+		return nil
+	}
+	last, err := lastAuditEvents("withdraw", refs)
+	if err != nil {
+		return fmt.Errorf("failed to read the audit log: %w", err)
+	}
+	finder, canFind := provider.(externalRefFinder)
+
+	for i := range states {
+		s := &states[i]
+		ev, requested := last[s.Row.ExternalReference]
+		if s.Entry != nil || !requested {
+			continue
+		}
+		reference, status := ev.Reference, campay.StatusPending // set once CamPay accepted it
+		notSent := strings.HasPrefix(ev.Outcome, auditNotSent)
+		if reference == "" && !notSent && canFind {
+			// History is filtered by day, so include the day before the run
+			found, err := finder.FindByExternalReference(context.Background(), "withdraw", s.Row.ExternalReference, run.StartedAt.Add(-24*time.Hour))
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "⚠ Line %d: could not check whether payout %s reached CamPay: %v\n", s.Row.Line, s.Row.ExternalReference, err)
+			}
+			if found != nil {
+				reference, status = found.Reference, parseStatus(found.Status)
+			}
+		}
+		switch {
+		case reference != "":
+			entry := LedgerEntry{
+				Reference:         reference,
+				ExternalReference: s.Row.ExternalReference,
+				Kind:              "withdraw",
+				Phone:             s.Row.Phone,
+				Amount:            s.Row.Amount,
+				Currency:          "XAF",
+				Description:       s.Row.Description,
+				Status:            status,
+				Environment:       cfg.Env,
+				Refund:            s.Row.RefundOf != "",
+				RefundOf:          s.Row.RefundOf,
+				Batch:             run.ID,
+			}
+			recordLedger(ledger, entry)
+			fmt.Printf("✓ Line %d: found payout %s from the earlier run; following it instead of paying again\n", s.Row.Line, reference)
+			s.Entry = &entry
+		case !notSent && !resend:
+			s.Interrupted = true
+		}
+	}
+	return nil
+}
@@ -0,0 +1,330 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== BENCH ============================
+   ============================================================ */
+
+// benchStats accumulates the measurements of one bench run.
+type benchStats struct {
+	mu          sync.Mutex
+	submit      []time.Duration // collect call latency
+	settle      []time.Duration // submit to final status
+	ledgerWrite []time.Duration
+	polls       atomic.Int64
+	successful  atomic.Int64
+	failed      atomic.Int64
+	errors      atomic.Int64
+	firstErr    error // guarded by mu
+}
+
+func (s *benchStats) add(list *[]time.Duration, d time.Duration) {
+	s.mu.Lock()
+	*list = append(*list, d)
+	s.mu.Unlock()
+}
+
+// percentile returns the p-th percentile (0-100) of sorted durations.
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	i := int(float64(len(sorted)-1) * p / 100)
+	return sorted[i]
+}
+
+func summarize(d []time.Duration) (p50, p95, p99, avg time.Duration) {
+	if len(d) == 0 {
+		return
+	}
+	sort.Slice(d, func(i, j int) bool { return d[i] < d[j] })
+	var total time.Duration
+	for _, v := range d {
+		total += v
+	}
+	return percentile(d, 50), percentile(d, 95), percentile(d, 99), total / time.Duration(len(d))
+}
+
+// benchOptions are the flags of bench.
+type benchOptions struct {
+	payments     int
+	concurrency  int
+	confirmAfter time.Duration
+	failRate     float64
+	interval     time.Duration
+	target       string
+	keep         bool
+	tokenTTL     time.Duration
+	chaos        *mockChaos
+}
+
+// benchFlags defines the flags of bench on fs.
+func benchFlags(fs *flag.FlagSet, cfg *Config) *benchOptions {
+	opt := &benchOptions{}
+	fs.IntVar(&opt.payments, "payments", 500, "number of simulated payments")
+	fs.IntVar(&opt.concurrency, "concurrency", 50, "payments in flight at once")
+	fs.DurationVar(&opt.confirmAfter, "confirm-after", 2*time.Second, "how long the mock keeps transactions PENDING")
+	fs.Float64Var(&opt.failRate, "fail-rate", 0.05, "share of mock transactions that end FAILED")
+	fs.DurationVar(&opt.interval, "poll-interval", 500*time.Millisecond, "time between status checks")
+	fs.StringVar(&opt.target, "target", "", "base URL of a running `campay mock` (default: an in-process mock)")
+	fs.BoolVar(&opt.keep, "keep-ledger", false, "keep the temporary ledger and print its path")
+	fs.DurationVar(&opt.tokenTTL, "token-ttl", time.Hour, "lifetime of the in-process mock's tokens; a short one renews the shared token during the run")
+	opt.chaos = chaosFlags(fs)
+	return opt
+}
+
+// runBench drives simulated payments through the same client, polling and
+// ledger code as the real commands, against the mock CamPay API, to size
+// the daemon before peak traffic. The ledger and data directory are
+// temporary.
+func runBench(cfg *Config, args []string) error {
+	fs := newFlagSet("bench")
+	opt := benchFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := opt.chaos.validate(); err != nil {
+		return err
+	}
+	if opt.chaos.enabled() && opt.target != "" {
+		return invalidInput("fault injection flags apply to the in-process mock; give them to `campay mock` instead")
+	}
+	if opt.payments < 1 || opt.concurrency < 1 {
+		return invalidInput("--payments and --concurrency must be at least 1")
+	}
+	if opt.tokenTTL < time.Second {
+		return invalidInput("--token-ttl must be at least 1s")
+	}
+
+	baseURL := opt.target
+	var mock *mockCampay
+	if baseURL == "" {
+		mock = newMockCampay(opt.confirmAfter, opt.failRate)
+		mock.tokenTTL = opt.tokenTTL
+		if opt.chaos.enabled() {
+			mock.chaos = opt.chaos.start()
+		}
+		server := httptest.NewServer(mock.routes())
+		defer server.Close()
+		baseURL = server.URL
+	}
+
+	dir, err := os.MkdirTemp("", "campay-bench-")
+	if err != nil {
+		return err
+	}
+	if opt.keep {
+		fmt.Println("Ledger:", filepath.Join(dir, "ledger.jsonl"))
+	} else {
+		defer os.RemoveAll(dir)
+	}
+	ledger := &Ledger{path: filepath.Join(dir, "ledger.jsonl")}
+	// Keep hooks and the notification queue of the real data directory out
+	os.Setenv("CAMPAY_HOME", dir)
+
+	bc := *cfg
+	bc.Provider = "campay"
+	bc.APIBaseURL = baseURL
+	bc.Username, bc.Password = "bench", "bench"
+	bc.Secrets = SecretsConfig{}
+	bc.StatusTTL = 0
+	client, err := newClient(&bc)
+	if err != nil {
+		return err
+	}
+	if err := client.Authenticate(context.Background()); err != nil {
+		return fmt.Errorf("mock authentication failed: %w", err)
+	}
+	provider := &campayProvider{cfg: &bc, client: client}
+
+	fmt.Printf("Bench: %d payments, %d concurrent, confirmed after %s, polled every %s, against %s\n",
+		opt.payments, opt.concurrency, opt.confirmAfter, opt.interval, baseURL)
+	if mock != nil && mock.chaos != nil {
+		fmt.Printf("Injecting faults: %s\n", mock.chaos)
+	}
+
+	stats := &benchStats{}
+	var peakHeap atomic.Uint64
+	var before runtime.MemStats
+	runtime.ReadMemStats(&before)
+	sampleDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			var m runtime.MemStats
+			runtime.ReadMemStats(&m)
+			if m.HeapInuse > peakHeap.Load() {
+				peakHeap.Store(m.HeapInuse)
+			}
+			select {
+			case <-sampleDone:
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+
+	started := time.Now()
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < opt.concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				benchPayment(provider, ledger, stats, i, opt.interval)
+			}
+		}()
+	}
+	for i := 0; i < opt.payments; i++ {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+	elapsed := time.Since(started)
+	close(sampleDone)
+
+	var after runtime.MemStats
+	runtime.ReadMemStats(&after)
+	var ledgerSize int64
+	if fi, err := os.Stat(ledger.path); err == nil {
+		ledgerSize = fi.Size()
+	}
+
+	done := stats.successful.Load() + stats.failed.Load()
+	fmt.Printf("\nCompleted %d payments in %s: %.1f payments/s\n", done, elapsed.Round(time.Millisecond), float64(done)/elapsed.Seconds())
+	fmt.Printf("  %d successful, %d failed, %d errors\n", stats.successful.Load(), stats.failed.Load(), stats.errors.Load())
+	if stats.firstErr != nil {
+		fmt.Println("  first error:", stats.firstErr)
+	}
+
+	tbl := newTable("",
+		tableColumn{Name: "Measure"},
+		tableColumn{Name: "p50", Right: true},
+		tableColumn{Name: "p95", Right: true},
+		tableColumn{Name: "p99", Right: true},
+		tableColumn{Name: "Average", Right: true},
+	)
+	for _, m := range []struct {
+		name string
+		d    []time.Duration
+	}{
+		{"collect call", stats.submit},
+		{"time to final", stats.settle},
+		{"ledger write", stats.ledgerWrite},
+	} {
+		p50, p95, p99, avg := summarize(m.d)
+		tbl.Row(m.name, p50.Round(time.Microsecond), p95.Round(time.Microsecond), p99.Round(time.Microsecond), avg.Round(time.Microsecond))
+	}
+	fmt.Println()
+	if err := tbl.Print(); err != nil {
+		return err
+	}
+
+	polls := stats.polls.Load()
+	fmt.Printf("\nPolling: %d status calls, %.2f per payment (a perfect poller needs 1)\n", polls, float64(polls)/float64(max(done, 1)))
+	fmt.Printf("Memory: peak heap %.1f MiB, %.1f MiB allocated, %d GC cycles\n",
+		float64(peakHeap.Load())/(1<<20), float64(after.TotalAlloc-before.TotalAlloc)/(1<<20), after.NumGC-before.NumGC)
+	fmt.Printf("Ledger: %d writes, %.1f KiB\n", len(stats.ledgerWrite), float64(ledgerSize)/1024)
+	if mock != nil {
+		// One exchange per renewal, however many workers needed the token
+		fmt.Printf("Tokens: %d exchanges\n", mock.tokens.Load())
+	}
+	if mock != nil && mock.chaos != nil {
+		faults := mock.chaos.faults()
+		kinds := make([]string, 0, len(faults))
+		for k := range faults {
+			kinds = append(kinds, k)
+		}
+		sort.Strings(kinds)
+		fmt.Print("Faults injected:")
+		for _, k := range kinds {
+			fmt.Printf(" %s %d", k, faults[k])
+		}
+		fmt.Println()
+	}
+	return nil
+}
+
+// benchPayment collects, records and polls one payment to a final status.
+func benchPayment(provider *campayProvider, ledger *Ledger, stats *benchStats, i int, interval time.Duration) {
+	fail := func(err error) {
+		stats.errors.Add(1)
+		stats.mu.Lock()
+		if stats.firstErr == nil {
+			stats.firstErr = err
+		}
+		stats.mu.Unlock()
+	}
+
+	phone := fmt.Sprintf("23767%07d", i)
+	t0 := time.Now()
+	resp, err := provider.Collect(context.Background(), campay.CollectRequest{
+		Amount:            100 + i%900,
+		Currency:          "XAF",
+		From:              phone,
+		Description:       "Bench",
+		ExternalReference: fmt.Sprintf("BENCH-%d", i),
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	stats.add(&stats.submit, time.Since(t0))
+	reference := resp.Reference
+
+	w0 := time.Now()
+	err = ledger.Record(LedgerEntry{
+		Reference: reference, Kind: "collect", Phone: phone, Amount: 100 + i%900,
+		Currency: "XAF", Status: campay.StatusPending, Environment: "BENCH",
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	stats.add(&stats.ledgerWrite, time.Since(w0))
+
+	for {
+		time.Sleep(interval)
+		stats.polls.Add(1)
+		txn, err := provider.Status(context.Background(), reference)
+		if err != nil {
+			fail(err)
+			return
+		}
+		status := parseStatus(txn.Status)
+		if !isFinal(status) {
+			continue
+		}
+		stats.add(&stats.settle, time.Since(t0))
+
+		w0 := time.Now()
+		if err := ledger.UpdateStatus(reference, status, txn.Operator); err != nil {
+			fail(err)
+			return
+		}
+		stats.add(&stats.ledgerWrite, time.Since(w0))
+		if status == campay.StatusSuccessful {
+			stats.successful.Add(1)
+		} else {
+			stats.failed.Add(1)
+		}
+		return
+	}
+}
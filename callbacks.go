@@ -0,0 +1,55 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ===================== EXPIRY CALLBACKS ======================
+   ============================================================ */
+
+// A job submitted to the daemon may name a callback_url. CamPay sends no
+// webhook for a payment the customer never confirms, so when such a
+// payment times out without a final status (the daemon's deadline, or the
+// sweeper of daemon or serve) an EXPIRED event is synthesized and posted
+// there, signed like relayed events. The URL is kept in the ledger entry,
+// so whichever process expires the payment can send it.
+
+// expiredStatus is the status of synthesized expiry events.
+const expiredStatus = "EXPIRED"
+
+func validCallbackURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("callback_url must be an http(s) URL, not %q", raw)
+	}
+	return nil
+}
+
+// expiredEvent is the event posted for e, which expired locally.
+func expiredEvent(e LedgerEntry) RelayEvent {
+	ev := ledgerRelayEvent(e)
+	ev.ID = e.Reference + ":" + expiredStatus
+	ev.Status = expiredStatus
+	ev.Reason = e.StatusReason
+	ev.Synthesized = true
+	return ev
+}
+
+// sendExpiry posts the EXPIRED event of e to its callback URL, if it has
+// one and expired. Deliveries that fail go to the notification queue like
+// relayed events, signed with the relay secret of the URL.
+func sendExpiry(e LedgerEntry, secrets relaySecrets) {
+	if e.CallbackURL == "" || e.Status != campay.StatusExpiredLocal {
+		return
+	}
+	if secrets.For(e.CallbackURL) == "" {
+		fmt.Printf("⚠ %s expired but no relay secret is set to sign its callback\n", e.Reference)
+		return
+	}
+	fmt.Printf("⏰ %s expired; notifying %s\n", e.Reference, e.CallbackURL)
+	newRelay([]string{e.CallbackURL}, secrets).Forward(expiredEvent(e))
+}
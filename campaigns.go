@@ -0,0 +1,533 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= CAMPAIGNS =========================
+   ============================================================ */
+
+// Campaign groups collections towards a target, e.g. "March school fees".
+// Collections join it with `collect --campaign` or `campaign attach`, and
+// carry its ID in the ledger. Like invoices, progress is always computed
+// from the ledger.
+type Campaign struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Target    int             `json:"target"`
+	Currency  string          `json:"currency"`
+	Payers    []CampaignPayer `json:"payers,omitempty"`
+	CreatedAt time.Time       `json:"created_at"`
+}
+
+// CampaignPayer is someone expected to pay into a campaign. Amount is
+// what they owe, 0 when any amount is welcome.
+type CampaignPayer struct {
+	Phone  string `json:"phone"`
+	Name   string `json:"name,omitempty"`
+	Amount int    `json:"amount,omitempty"`
+}
+
+// Campaigns maps a campaign ID to its campaign.
+type Campaigns map[string]Campaign
+
+// payerProgress is where one payer of a campaign stands.
+type payerProgress struct {
+	Phone    string `json:"phone"`
+	Name     string `json:"name,omitempty"`
+	Expected int    `json:"expected"`
+	Paid     int    `json:"paid"`
+	Pending  int    `json:"pending"`
+	Payments int    `json:"payments"`
+	State    string `json:"state"` // paid, partial, pending or unpaid
+}
+
+// campaignProgress sums the collections of a campaign.
+type campaignProgress struct {
+	Campaign  Campaign        `json:"campaign"`
+	Collected int             `json:"collected"`
+	Pending   int             `json:"pending"`
+	Payers    []payerProgress `json:"payers"`
+}
+
+// Percent is how much of the target is collected, or -1 without a target.
+func (p campaignProgress) Percent() float64 {
+	if p.Campaign.Target <= 0 {
+		return -1
+	}
+	return float64(p.Collected) * 100 / float64(p.Campaign.Target)
+}
+
+// PaidPayers counts the payers who paid in full.
+func (p campaignProgress) PaidPayers() int {
+	n := 0
+	for _, pp := range p.Payers {
+		if pp.State == "paid" {
+			n++
+		}
+	}
+	return n
+}
+
+func campaignsPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "campaigns.json"), nil
+}
+
+func loadCampaigns() (Campaigns, error) {
+	path, err := campaignsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Campaigns{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	campaigns := Campaigns{}
+	if err := json.Unmarshal(data, &campaigns); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	aead, err := ledgerCipher()
+	if err != nil {
+		return nil, err
+	}
+	for _, c := range campaigns {
+		for i := range c.Payers {
+			if err := openPhones(aead, &c.Payers[i].Phone); err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+		}
+	}
+	return campaigns, nil
+}
+
+// saveCampaigns writes campaigns, with the payers' phone numbers encrypted
+// like the ledger's.
+func saveCampaigns(campaigns Campaigns) error {
+	path, err := campaignsPath()
+	if err != nil {
+		return err
+	}
+	aead, err := ledgerCipher()
+	if err != nil {
+		return err
+	}
+	stored := make(Campaigns, len(campaigns))
+	for id, c := range campaigns {
+		c.Payers = slices.Clone(c.Payers)
+		for i := range c.Payers {
+			if err := sealPhones(aead, &c.Payers[i].Phone); err != nil {
+				return err
+			}
+		}
+		stored[id] = c
+	}
+
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// lookupCampaign returns the campaign with the given ID, for flags that
+// attach a payment to one.
+func lookupCampaign(id string) (Campaign, error) {
+	campaigns, err := loadCampaigns()
+	if err != nil {
+		return Campaign{}, err
+	}
+	c, ok := campaigns[id]
+	if !ok {
+		return Campaign{}, invalidInput("unknown campaign %q (see campaign list)", id)
+	}
+	return c, nil
+}
+
+// progressOf computes a campaign's progress from its collections. Expected
+// payers come first, in their order; anyone else who paid follows.
+func progressOf(ledger *Ledger, c Campaign) (campaignProgress, error) {
+	entries, err := ledger.FindByCampaign(c.ID)
+	if err != nil {
+		return campaignProgress{}, err
+	}
+
+	p := campaignProgress{Campaign: c}
+	byPhone := map[string]*payerProgress{}
+	var order []string
+	add := func(phone, name string, expected int) *payerProgress {
+		if pp, ok := byPhone[phone]; ok {
+			return pp
+		}
+		byPhone[phone] = &payerProgress{Phone: phone, Name: name, Expected: expected}
+		order = append(order, phone)
+		return byPhone[phone]
+	}
+	for _, payer := range c.Payers {
+		add(payer.Phone, payer.Name, payer.Amount)
+	}
+	for _, e := range entries {
+		if e.Kind != "collect" {
+			continue
+		}
+		pp := add(e.Phone, "", 0)
+		switch e.Status {
+		case campay.StatusSuccessful:
+			pp.Paid += e.Amount
+			pp.Payments++
+			p.Collected += e.Amount
+		case campay.StatusPending, campay.StatusUnknown:
+			pp.Pending += e.Amount
+			p.Pending += e.Amount
+		}
+	}
+
+	for _, phone := range order {
+		pp := byPhone[phone]
+		switch {
+		case pp.Paid > 0 && pp.Paid >= pp.Expected:
+			pp.State = "paid"
+		case pp.Pending > 0:
+			pp.State = "pending"
+		case pp.Paid > 0:
+			pp.State = "partial"
+		default:
+			pp.State = "unpaid"
+		}
+		p.Payers = append(p.Payers, *pp)
+	}
+	return p, nil
+}
+
+// readCampaignPayers reads a CSV file with a phone column and optional
+// name and amount columns.
+func readCampaignPayers(path string) ([]CampaignPayer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, exitErr(exitValidation, err)
+	}
+	defer f.Close()
+
+	r := csv.NewReader(f)
+	r.FieldsPerRecord = -1
+	header, err := r.Read()
+	if err != nil {
+		return nil, invalidInput("%s: %v", path, err)
+	}
+	col := map[string]int{}
+	for i, h := range header {
+		col[strings.ToLower(strings.TrimSpace(h))] = i
+	}
+	if _, ok := col["phone"]; !ok {
+		return nil, invalidInput("%s: missing phone column", path)
+	}
+	field := func(rec []string, name string) string {
+		if i, ok := col[name]; ok && i < len(rec) {
+			return strings.TrimSpace(rec[i])
+		}
+		return ""
+	}
+
+	var payers []CampaignPayer
+	seen := map[string]bool{}
+	for line := 2; ; line++ {
+		rec, err := r.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, invalidInput("%s:%d: %v", path, line, err)
+		}
+		phone, err := resolvePhone(field(rec, "phone"))
+		if err != nil {
+			return nil, invalidInput("%s:%d: %v", path, line, err)
+		}
+		if seen[phone] {
+			return nil, invalidInput("%s:%d: %s is listed twice", path, line, phone)
+		}
+		seen[phone] = true
+		payer := CampaignPayer{Phone: phone, Name: field(rec, "name")}
+		if amount := field(rec, "amount"); amount != "" {
+			if payer.Amount, err = parseAmount(amount); err != nil {
+				return nil, invalidInput("%s:%d: %v", path, line, err)
+			}
+		}
+		payers = append(payers, payer)
+	}
+	return payers, nil
+}
+
+// payersTable lists the payers of a campaign, with their numbers and
+// names masked for display unless --show-pii.
+func payersTable(p campaignProgress, display bool) *table {
+	tbl := newTable("No payers yet",
+		tableColumn{Name: "Phone"},
+		tableColumn{Name: "Name", Max: 30},
+		tableColumn{Name: "Expected", Amount: true},
+		tableColumn{Name: "Paid", Amount: true},
+		tableColumn{Name: "Pending", Amount: true},
+		tableColumn{Name: "Payments", Right: true},
+		tableColumn{Name: "State"},
+	)
+	for _, pp := range p.Payers {
+		phone, name := pp.Phone, pp.Name
+		if display {
+			phone, name = displayPhone(phone), displayName(name)
+		}
+		tbl.Row(phone, name, pp.Expected, pp.Paid, pp.Pending, pp.Payments, pp.State)
+	}
+	return tbl
+}
+
+// printCampaignProgress reports a campaign's progress after a payment.
+func printCampaignProgress(ledger *Ledger, c Campaign) {
+	p, err := progressOf(ledger, c)
+	if err != nil {
+		fmt.Println("⚠ Failed to read campaign progress:", err)
+		return
+	}
+	if pct := p.Percent(); pct >= 0 {
+		fmt.Printf("Campaign %s: %s of %s collected (%.0f%%)\n", c.ID, formatAmount(p.Collected, ""), formatAmount(c.Target, c.Currency), pct)
+	} else {
+		fmt.Printf("Campaign %s: %s collected\n", c.ID, formatAmount(p.Collected, c.Currency))
+	}
+}
+
+// campaignCreateOptions are the flags of campaign create.
+type campaignCreateOptions struct {
+	payersFile string
+}
+
+// campaignCreateFlags defines the flags of campaign create on fs.
+func campaignCreateFlags(fs *flag.FlagSet, cfg *Config) *campaignCreateOptions {
+	opt := &campaignCreateOptions{}
+	fs.StringVar(&opt.payersFile, "payers", "", "CSV file of expected payers: phone, and optional name and amount columns")
+	return opt
+}
+
+// campaignExportOptions are the flags of campaign export.
+type campaignExportOptions struct {
+	out    string
+	format string
+}
+
+// campaignExportFlags defines the flags of campaign export on fs.
+func campaignExportFlags(fs *flag.FlagSet, cfg *Config) *campaignExportOptions {
+	opt := &campaignExportOptions{}
+	fs.StringVar(&opt.out, "out", "", "file to write (default <id>.csv or <id>.json)")
+	fs.StringVar(&opt.format, "format", "csv", "csv or json")
+	return opt
+}
+
+func runCampaign(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	campaigns, err := loadCampaigns()
+	if err != nil {
+		return err
+	}
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		fs := newFlagSet("campaign create")
+		opt := campaignCreateFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		if fs.NArg() < 2 {
+			return invalidInput("usage: campay campaign create [--payers file.csv] <id> <target> [name]")
+		}
+		id := fs.Arg(0)
+		if _, ok := campaigns[id]; ok {
+			return invalidInput("campaign %s already exists", id)
+		}
+		target, err := parseAmount(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		c := Campaign{
+			ID:        id,
+			Name:      strings.Join(fs.Args()[2:], " "),
+			Target:    target,
+			Currency:  "XAF",
+			CreatedAt: time.Now().UTC(),
+		}
+		if c.Name == "" {
+			c.Name = id
+		}
+		if opt.payersFile != "" {
+			if c.Payers, err = readCampaignPayers(opt.payersFile); err != nil {
+				return err
+			}
+		}
+		campaigns[id] = c
+		if err := saveCampaigns(campaigns); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Created campaign %s (%s) with a target of %s", id, c.Name, formatAmount(target, "XAF"))
+		if len(c.Payers) > 0 {
+			fmt.Printf(" and %d expected payers", len(c.Payers))
+		}
+		fmt.Println()
+		fmt.Printf("  Collect for it with: campay collect --campaign %s\n", id)
+		return nil
+
+	case "list":
+		ids := make([]string, 0, len(campaigns))
+		for id := range campaigns {
+			ids = append(ids, id)
+		}
+		sort.Strings(ids)
+		tbl := newTable("No campaigns",
+			tableColumn{Name: "Campaign"},
+			tableColumn{Name: "Name", Max: 30},
+			tableColumn{Name: "Collected", Amount: true},
+			tableColumn{Name: "Target", Amount: true},
+			tableColumn{Name: "Progress", Right: true},
+			tableColumn{Name: "Payers paid", Right: true},
+		)
+		for _, id := range ids {
+			p, err := progressOf(ledger, campaigns[id])
+			if err != nil {
+				return err
+			}
+			progress := ""
+			if pct := p.Percent(); pct >= 0 {
+				progress = fmt.Sprintf("%.0f%%", pct)
+			}
+			tbl.Row(id, p.Campaign.Name, p.Collected, p.Campaign.Target, progress, fmt.Sprintf("%d/%d", p.PaidPayers(), len(p.Payers)))
+		}
+		return tbl.Print()
+
+	case "status":
+		if len(args) != 2 {
+			return invalidInput("usage: campay campaign status <id>")
+		}
+		c, ok := campaigns[args[1]]
+		if !ok {
+			return invalidInput("unknown campaign %q", args[1])
+		}
+		p, err := progressOf(ledger, c)
+		if err != nil {
+			return err
+		}
+		if tableFormat() == "table" {
+			fmt.Printf("Campaign:  %s (%s)\n", c.ID, c.Name)
+			fmt.Printf("Collected: %s of %s", formatAmount(p.Collected, ""), formatAmount(c.Target, c.Currency))
+			if pct := p.Percent(); pct >= 0 {
+				fmt.Printf(" (%.0f%%)", pct)
+			}
+			fmt.Println()
+			if p.Pending > 0 {
+				fmt.Printf("Pending:   %s\n", formatAmount(p.Pending, c.Currency))
+			}
+			if c.Target > p.Collected {
+				fmt.Printf("Remaining: %s\n", formatAmount(c.Target-p.Collected, c.Currency))
+			}
+			fmt.Printf("Payers:    %d of %d paid in full\n\n", p.PaidPayers(), len(p.Payers))
+		}
+		return payersTable(p, true).Print()
+
+	case "attach":
+		if len(args) < 3 {
+			return invalidInput("usage: campay campaign attach <id> <reference>...")
+		}
+		c, ok := campaigns[args[1]]
+		if !ok {
+			return invalidInput("unknown campaign %q", args[1])
+		}
+		for _, ref := range args[2:] {
+			e, err := ledger.Get(ref)
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				return invalidInput("unknown transaction %s", ref)
+			}
+			if e.Kind != "collect" {
+				return invalidInput("%s is a %s, only collections join a campaign", ref, e.Kind)
+			}
+			if e.Campaign == c.ID {
+				continue
+			}
+			if e.Campaign != "" {
+				fmt.Printf("⚠ %s moves from campaign %s\n", ref, e.Campaign)
+			}
+			e.Campaign = c.ID
+			if err := ledger.Record(*e); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("✓ Attached %d transaction(s) to campaign %s\n", len(args)-2, c.ID)
+		printCampaignProgress(ledger, c)
+		return nil
+
+	case "export":
+		fs := newFlagSet("campaign export")
+		opt := campaignExportFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		if fs.NArg() != 1 {
+			return invalidInput("usage: campay campaign export [--out file] [--format csv|json] <id>")
+		}
+		if opt.format != "csv" && opt.format != "json" {
+			return invalidInput("--format must be csv or json")
+		}
+		c, ok := campaigns[fs.Arg(0)]
+		if !ok {
+			return invalidInput("unknown campaign %q", fs.Arg(0))
+		}
+		p, err := progressOf(ledger, c)
+		if err != nil {
+			return err
+		}
+		if opt.out == "" {
+			opt.out = c.ID + "." + opt.format
+		}
+		f, err := os.Create(opt.out)
+		if err != nil {
+			return err
+		}
+		if err := payersTable(p, false).render(f, opt.format); err != nil {
+			f.Close()
+			return err
+		}
+		if err := f.Close(); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Wrote %d payers of campaign %s to %s\n", len(p.Payers), c.ID, opt.out)
+		return nil
+
+	default:
+		return invalidInput("unknown campaign command %q (use list, create, status, attach or export)", args[0])
+	}
+}
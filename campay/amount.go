@@ -0,0 +1,53 @@
+package campay
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// Amount is a sum of money in a response: a collection, a transaction, a
+// history item or a balance. CamPay sends amounts as numbers on some
+// endpoints and as strings on others ("500", "500.00", "1 000"), and not
+// always the same way twice; every Amount field is decoded the same way,
+// by parseNumber, so callers never see the difference. Requests keep plain
+// ints, since XAF has no decimals.
+type Amount float64
+
+// ParseAmount reads an amount written as CamPay writes it, for amounts
+// that arrive as text, such as WebhookEvent.Amount.
+func ParseAmount(s string) (Amount, error) {
+	n, err := parseNumber(json.RawMessage(strconv.Quote(s)))
+	if err != nil {
+		return 0, fmt.Errorf("invalid amount %q", s)
+	}
+	return Amount(n), nil
+}
+
+// Int returns a rounded to the nearest whole unit, halves away from zero.
+func (a Amount) Int() int {
+	return int(math.Round(float64(a)))
+}
+
+// Whole returns a as an int, and whether it was a whole number.
+func (a Amount) Whole() (int, bool) {
+	return a.Int(), float64(a) == math.Trunc(float64(a))
+}
+
+// String formats a without trailing zeros: 500, 12.5.
+func (a Amount) String() string {
+	return strconv.FormatFloat(float64(a), 'f', -1, 64)
+}
+
+func (a *Amount) UnmarshalJSON(data []byte) error {
+	if string(data) == "null" {
+		return nil
+	}
+	n, err := parseNumber(data)
+	if err != nil {
+		return fmt.Errorf("%s is not an amount", data)
+	}
+	*a = Amount(n)
+	return nil
+}
@@ -0,0 +1,132 @@
+package campay
+
+import (
+	"bytes"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"reflect"
+	"slices"
+	"strings"
+	"testing"
+)
+
+var update = flag.Bool("update", false, "rewrite the golden files in testdata")
+
+// TestResponseAmountsGolden decodes the response payloads captured under
+// testdata/responses, named after the call that returned them, and
+// compares every Amount read from them with the .golden file beside it.
+// Run with -update to rewrite the golden files after checking the diff.
+func TestResponseAmountsGolden(t *testing.T) {
+	payloads, err := filepath.Glob(filepath.Join("testdata", "responses", "*.json"))
+	if err != nil || len(payloads) == 0 {
+		t.Fatalf("no payloads in testdata/responses: %v", err)
+	}
+	for _, path := range payloads {
+		name := strings.TrimSuffix(filepath.Base(path), ".json")
+		t.Run(name, func(t *testing.T) {
+			data, err := os.ReadFile(path)
+			if err != nil {
+				t.Fatal(err)
+			}
+			got, err := describeResponse(name, data)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			golden := strings.TrimSuffix(path, ".json") + ".golden"
+			if *update {
+				if err := os.WriteFile(golden, got, 0644); err != nil {
+					t.Fatal(err)
+				}
+				return
+			}
+			want, err := os.ReadFile(golden)
+			if err != nil {
+				t.Fatalf("%v (run go test -update to create it)", err)
+			}
+			if !bytes.Equal(got, want) {
+				t.Errorf("%s differs from %s:\n--- got\n%s--- want\n%s", path, golden, got, want)
+			}
+		})
+	}
+}
+
+// describeResponse decodes data as the response of the call its name
+// starts with, the way the client does, and lists its amounts, warnings
+// and unknown fields.
+func describeResponse(name string, data []byte) ([]byte, error) {
+	var values []any
+	switch call, _, _ := strings.Cut(name, "_"); call {
+	case "collect":
+		values = append(values, new(CollectResponse))
+	case "transaction":
+		values = append(values, new(TransactionResponse))
+	case "balance":
+		values = append(values, new(BalanceResponse))
+	case "history":
+		err := historyStream(func(item HistoryItem) error {
+			values = append(values, &item)
+			return nil
+		}).decodeBody(bytes.NewReader(data))
+		if err != nil {
+			return nil, err
+		}
+	default:
+		return nil, fmt.Errorf("%s: name does not start with a known call", name)
+	}
+	if !strings.HasPrefix(name, "history") {
+		if err := json.Unmarshal(data, values[0]); err != nil {
+			return nil, err
+		}
+	}
+
+	var b bytes.Buffer
+	for i, v := range values {
+		if len(values) > 1 {
+			fmt.Fprintf(&b, "[%d]\n", i)
+		}
+		rv := reflect.ValueOf(v).Elem()
+		for j := range rv.NumField() {
+			if a, ok := rv.Field(j).Interface().(Amount); ok {
+				n, whole := a.Whole()
+				fmt.Fprintf(&b, "%s: %s (int %d, whole %t)\n", rv.Type().Field(j).Name, a, n, whole)
+			}
+		}
+		for _, w := range rv.FieldByName("Warnings").Interface().([]string) {
+			fmt.Fprintf(&b, "warning: %s\n", w)
+		}
+		raw := rv.FieldByName("Raw").Interface().(map[string]json.RawMessage)
+		for _, key := range slices.Sorted(maps.Keys(raw)) {
+			fmt.Fprintf(&b, "raw %s: %s\n", key, raw[key])
+		}
+	}
+	return b.Bytes(), nil
+}
+
+func TestParseAmount(t *testing.T) {
+	tests := []struct {
+		in      string
+		want    Amount
+		wantErr bool
+	}{
+		{"500", 500, false},
+		{"500.00", 500, false},
+		{"1 000", 1000, false},
+		{"1\u00a0000", 1000, false},
+		{" 12.5 ", 12.5, false},
+		{"", 0, true},
+		{"N/A", 0, true},
+		{"NaN", 0, true},
+		{"Inf", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := ParseAmount(tt.in)
+		if (err != nil) != tt.wantErr || got != tt.want {
+			t.Errorf("ParseAmount(%q) = %v, %v; want %v, error %t", tt.in, got, err, tt.want, tt.wantErr)
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package campay
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+)
+
+type cachedResponse struct {
+	status  int
+	header  http.Header
+	body    []byte
+	expires time.Time
+}
+
+// CacheStatus serves repeated status calls (Client.Transaction) made
+// within ttl from memory, so several components watching the same
+// reference share one API call. Calls are recognised by their Operation,
+// so a status endpoint moved with Options.Endpoints is cached too and
+// nothing else is. Only 200 responses are cached.
+func CacheStatus(ttl time.Duration) Middleware {
+	var mu sync.Mutex
+	cache := map[string]cachedResponse{}
+
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			if Operation(req) != "status" {
+				return next.Do(req)
+			}
+			key := req.URL.String()
+			now := time.Now()
+
+			mu.Lock()
+			cached, ok := cache[key]
+			for k, v := range cache {
+				if now.After(v.expires) {
+					delete(cache, k)
+				}
+			}
+			mu.Unlock()
+
+			if ok && now.Before(cached.expires) {
+				return &http.Response{
+					StatusCode: cached.status,
+					Header:     cached.header.Clone(),
+					Body:       io.NopCloser(bytes.NewReader(cached.body)),
+					Request:    req,
+				}, nil
+			}
+
+			resp, err := next.Do(req)
+			if err != nil || resp.StatusCode != 200 {
+				return resp, err
+			}
+
+			body, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+
+			mu.Lock()
+			cache[key] = cachedResponse{
+				status:  resp.StatusCode,
+				header:  resp.Header.Clone(),
+				body:    body,
+				expires: time.Now().Add(ttl),
+			}
+			mu.Unlock()
+			return resp, nil
+		})
+	}
+}
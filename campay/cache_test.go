@@ -0,0 +1,43 @@
+package campay
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestCacheStatusFollowsTheOperation(t *testing.T) {
+	var hits atomic.Int32
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hits.Add(1)
+		fmt.Fprint(w, `{"reference":"ref-1","status":"PENDING","amount":100}`)
+	}))
+	defer srv.Close()
+
+	c := NewClient(Options{BaseURL: srv.URL, Endpoints: map[string]string{"status": "/v2/tx/{reference}/"}})
+	c.Use(CacheStatus(time.Minute))
+	ctx := context.Background()
+
+	for range 3 {
+		if _, err := c.Transaction(ctx, "ref-1"); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := hits.Load(); n != 1 {
+		t.Fatalf("status calls sent = %d, want 1", n)
+	}
+
+	// A path that merely looks like the default status one is not cached
+	for range 2 {
+		if err := c.Do(ctx, "GET", "/transaction/ref-1/", nil, nil); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if n := hits.Load(); n != 3 {
+		t.Fatalf("calls sent = %d, want 3", n)
+	}
+}
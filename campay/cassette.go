@@ -0,0 +1,243 @@
+package campay
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// A Cassette holds recorded API calls. Record fills one during a real
+// run; Replay answers from it without touching the network, for
+// deterministic integration tests and reproducible bug reports.
+//
+// Credentials and tokens are replaced with REDACTED and phone numbers
+// masked before anything is stored, so a cassette can be attached to a
+// bug report. Replay matches calls by method and path, in order; once the
+// recorded answers for a call are used up, the last one is repeated, so a
+// replayed run may poll a status more often than the recorded one.
+type Cassette struct {
+	RecordedAt   time.Time     `json:"recorded_at"`
+	Interactions []Interaction `json:"interactions"`
+
+	mu   sync.Mutex
+	used map[string]int // answers replayed per method and path
+}
+
+// Interaction is one recorded call.
+type Interaction struct {
+	Request  RecordedRequest  `json:"request"`
+	Response RecordedResponse `json:"response"`
+}
+
+type RecordedRequest struct {
+	Method string          `json:"method"`
+	Path   string          `json:"path"`
+	Query  string          `json:"query,omitempty"`
+	Body   json.RawMessage `json:"body,omitempty"`
+}
+
+type RecordedResponse struct {
+	Status int               `json:"status"`
+	Header map[string]string `json:"header,omitempty"`
+	Body   json.RawMessage   `json:"body,omitempty"` // JSON bodies
+	Text   string            `json:"text,omitempty"` // other bodies
+}
+
+// keptHeaders are the response headers a cassette keeps. Date is left out
+// so a replay does not report a clock skew.
+var keptHeaders = []string{"Content-Type", "Retry-After"}
+
+// NewCassette returns an empty cassette to record into.
+func NewCassette() *Cassette {
+	return &Cassette{RecordedAt: time.Now().UTC()}
+}
+
+// LoadCassette reads a cassette written by Save.
+func LoadCassette(path string) (*Cassette, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var c Cassette
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, fmt.Errorf("failed to parse cassette %s: %w", path, err)
+	}
+	return &c, nil
+}
+
+// Save writes the cassette as indented JSON.
+func (c *Cassette) Save(path string) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	data, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, append(data, '\n'), 0600)
+}
+
+// Record stores every call made through the client in c. Register it last
+// with Client.Use, so it sees the calls that reach the network.
+func Record(c *Cassette) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			var reqBody []byte
+			if req.Body != nil {
+				var err error
+				if reqBody, err = io.ReadAll(req.Body); err != nil {
+					return nil, err
+				}
+				req.Body.Close()
+				req.Body = io.NopCloser(bytes.NewReader(reqBody))
+			}
+
+			resp, err := next.Do(req)
+			if err != nil {
+				return nil, err
+			}
+			respBody, err := io.ReadAll(resp.Body)
+			resp.Body.Close()
+			if err != nil {
+				return nil, err
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(respBody))
+
+			in := Interaction{
+				Request: RecordedRequest{
+					Method: req.Method,
+					Path:   req.URL.Path,
+					Query:  req.URL.RawQuery,
+					Body:   sanitizeJSON(reqBody),
+				},
+				Response: RecordedResponse{Status: resp.StatusCode},
+			}
+			for _, h := range keptHeaders {
+				if v := resp.Header.Get(h); v != "" {
+					if in.Response.Header == nil {
+						in.Response.Header = map[string]string{}
+					}
+					in.Response.Header[h] = v
+				}
+			}
+			if body := sanitizeJSON(respBody); body != nil || len(respBody) == 0 {
+				in.Response.Body = body
+			} else {
+				in.Response.Text = string(respBody)
+			}
+
+			c.mu.Lock()
+			c.Interactions = append(c.Interactions, in)
+			c.mu.Unlock()
+			return resp, nil
+		})
+	}
+}
+
+// Replay answers every call from c. A call the cassette has no answer for
+// fails, rather than reaching the network.
+func Replay(c *Cassette) Middleware {
+	return func(Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			in, ok := c.next(req.Method, req.URL.Path)
+			if !ok {
+				return nil, fmt.Errorf("cassette has no recorded answer for %s %s", req.Method, req.URL.Path)
+			}
+			resp := &http.Response{
+				StatusCode: in.Response.Status,
+				Status:     fmt.Sprintf("%d %s", in.Response.Status, http.StatusText(in.Response.Status)),
+				Header:     http.Header{},
+				Request:    req,
+			}
+			for k, v := range in.Response.Header {
+				resp.Header.Set(k, v)
+			}
+			body := []byte(in.Response.Body)
+			if in.Response.Text != "" {
+				body = []byte(in.Response.Text)
+			}
+			resp.Body = io.NopCloser(bytes.NewReader(body))
+			resp.ContentLength = int64(len(body))
+			return resp, nil
+		})
+	}
+}
+
+// next returns the next recorded answer for method and path, or the last
+// one once they are used up.
+func (c *Cassette) next(method, path string) (Interaction, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.used == nil {
+		c.used = map[string]int{}
+	}
+	key := method + " " + path
+	var matches []Interaction
+	for _, in := range c.Interactions {
+		if in.Request.Method == method && in.Request.Path == path {
+			matches = append(matches, in)
+		}
+	}
+	if len(matches) == 0 {
+		return Interaction{}, false
+	}
+	i := min(c.used[key], len(matches)-1)
+	c.used[key]++
+	return matches[i], true
+}
+
+// secretFields are replaced with REDACTED and phoneFields masked.
+var (
+	secretFields = map[string]bool{"username": true, "password": true, "token": true, "access_token": true, "refresh_token": true}
+	phoneFields  = map[string]bool{"from": true, "to": true, "phone": true, "phone_number": true, "msisdn": true}
+)
+
+// sanitizeJSON returns body with secrets and phone numbers hidden, or nil
+// when body is not JSON.
+func sanitizeJSON(body []byte) json.RawMessage {
+	var v any
+	if len(bytes.TrimSpace(body)) == 0 || json.Unmarshal(body, &v) != nil {
+		return nil
+	}
+	out, err := json.Marshal(sanitizeValue(v))
+	if err != nil {
+		return nil
+	}
+	return out
+}
+
+func sanitizeValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, field := range v {
+			key := strings.ToLower(k)
+			switch s, isString := field.(string); {
+			case secretFields[key] && field != nil:
+				v[k] = "REDACTED"
+			case phoneFields[key] && isString:
+				v[k] = MaskPhone(s)
+			default:
+				v[k] = sanitizeValue(field)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = sanitizeValue(v[i])
+		}
+	}
+	return v
+}
+
+// MaskPhone keeps the country code and the last two digits of a phone
+// number, as cassettes record it: 237XXXXXXX01.
+func MaskPhone(phone string) string {
+	if len(phone) <= 5 {
+		return phone
+	}
+	return phone[:3] + strings.Repeat("X", len(phone)-5) + phone[len(phone)-2:]
+}
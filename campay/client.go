@@ -0,0 +1,657 @@
+// Package campay is a client for the CamPay mobile money API.
+//
+// A Client is safe for concurrent use: one client, and the token it holds,
+// is meant to be shared by every goroutine of a program. The package keeps
+// no mutable state of its own beyond the two settings NaiveTimeLocation
+// and SignatureLeeway, which may only be changed before the package is
+// used.
+package campay
+
+import (
+	"bytes"
+	"context"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"maps"
+	"net"
+	"net/http"
+	"net/url"
+	"runtime"
+	"slices"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	ProdBaseURL = "https://www.campay.net/api"
+	DemoBaseURL = "https://demo.campay.net/api"
+)
+
+// Timeouts configures how long each kind of call may take. Zero fields
+// fall back to DefaultTimeouts.
+type Timeouts struct {
+	Connect  time.Duration
+	Token    time.Duration
+	Collect  time.Duration
+	Withdraw time.Duration
+	Status   time.Duration
+	Balance  time.Duration
+	History  time.Duration
+	Other    time.Duration // calls made with Client.Do
+}
+
+// DefaultTimeouts keeps token exchanges short and gives money-moving
+// calls room for slow operator round-trips.
+func DefaultTimeouts() Timeouts {
+	return Timeouts{
+		Connect:  5 * time.Second,
+		Token:    10 * time.Second,
+		Collect:  60 * time.Second,
+		Withdraw: 60 * time.Second,
+		Status:   15 * time.Second,
+		Balance:  15 * time.Second,
+		History:  60 * time.Second,
+		Other:    60 * time.Second,
+	}
+}
+
+func (t Timeouts) withDefaults() Timeouts {
+	d := DefaultTimeouts()
+	if t.Connect <= 0 {
+		t.Connect = d.Connect
+	}
+	if t.Token <= 0 {
+		t.Token = d.Token
+	}
+	if t.Collect <= 0 {
+		t.Collect = d.Collect
+	}
+	if t.Withdraw <= 0 {
+		t.Withdraw = d.Withdraw
+	}
+	if t.Status <= 0 {
+		t.Status = d.Status
+	}
+	if t.Balance <= 0 {
+		t.Balance = d.Balance
+	}
+	if t.History <= 0 {
+		t.History = d.History
+	}
+	if t.Other <= 0 {
+		t.Other = d.Other
+	}
+	return t
+}
+
+type Options struct {
+	BaseURL  string
+	Username string
+	Password string
+	Timeouts Timeouts
+
+	// Proxy routes every call through the given proxy. When nil the
+	// HTTPS_PROXY, HTTP_PROXY and NO_PROXY environment variables apply.
+	Proxy *url.URL
+	// RootCAs replaces the system certificate pool, e.g. to trust a
+	// corporate proxy's private CA.
+	RootCAs *x509.CertPool
+	// TLSMinVersion pins the lowest accepted TLS version (tls.VersionTLS12
+	// by default).
+	TLSMinVersion uint16
+	// Headers are added to every request, e.g. for a gateway in front of
+	// CamPay. They cannot override Authorization or X-Request-ID.
+	Headers http.Header
+	// UserAgent identifies the calling application in every request
+	// (default DefaultUserAgent). A User-Agent in Headers takes precedence.
+	UserAgent string
+
+	// BusyRetries is how many times a call answered with 429, or with 503
+	// and a Retry-After header, is retried (default 3; negative disables).
+	BusyRetries int
+	// MaxBusyWait caps a single Retry-After wait (default 2 minutes).
+	// Longer requested waits fail immediately with the APIError.
+	MaxBusyWait time.Duration
+	// OnBusy, if set, is called before each such retry.
+	OnBusy func(op string, status int, wait time.Duration)
+
+	// TokenRefreshMargin is how long before its expiry the token is
+	// renewed, so long runs never send an expired one (default 1 minute).
+	TokenRefreshMargin time.Duration
+
+	// RefGenerator makes the external reference of a collection or payout
+	// sent without one (default ULID).
+	RefGenerator RefGenerator
+
+	// AmountLimits bound the amount of every collection and payout; they
+	// are checked with the rest of the request before it is sent (see
+	// CollectRequest.Validate).
+	AmountLimits AmountRange
+	// SkipValidation sends requests without checking them first, leaving
+	// every check to CamPay.
+	SkipValidation bool
+
+	// Endpoints replaces the path, relative to BaseURL, of the named
+	// operations, e.g. {"collect": "/v2/collect/"}, for gateways and
+	// mirrors that do not follow CamPay's layout. "{reference}" stands
+	// for the transaction in the status path. See DefaultEndpoints.
+	Endpoints map[string]string
+
+	// PreCollect, if set, approves, rejects or flags every collection
+	// before it is sent, e.g. with a fraud service (see HTTPPreCollect).
+	PreCollect PreCollectHook
+
+	// ReadOnly refuses every call that could move money (Collect,
+	// Withdraw, and Do on anything but reads) with ErrReadOnly, for
+	// audits. Status, balance and history calls work as usual.
+	ReadOnly bool
+}
+
+var defaultEndpoints = map[string]string{
+	"token":    "/token/",
+	"collect":  "/collect/",
+	"withdraw": "/withdraw/",
+	"status":   "/transaction/{reference}/",
+	"balance":  "/balance/",
+	"history":  "/history/",
+}
+
+// DefaultEndpoints returns the path of each operation that
+// Options.Endpoints may replace.
+func DefaultEndpoints() map[string]string {
+	return maps.Clone(defaultEndpoints)
+}
+
+// ValidateEndpoints checks that endpoints only names known operations,
+// with paths starting with a slash.
+func ValidateEndpoints(endpoints map[string]string) error {
+	for op, path := range endpoints {
+		if _, ok := defaultEndpoints[op]; !ok {
+			return fmt.Errorf("unknown endpoint %q (use %s)", op, strings.Join(slices.Sorted(maps.Keys(defaultEndpoints)), ", "))
+		}
+		if !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("endpoint %s: path %q must start with /", op, path)
+		}
+		if op == "status" && !strings.Contains(path, "{reference}") {
+			return fmt.Errorf("endpoint status: path %q must contain {reference}", path)
+		}
+	}
+	return nil
+}
+
+// DefaultUserAgent names this package and the Go version it was built
+// with, e.g. "campay-go (go1.25.4; linux/amd64)".
+func DefaultUserAgent() string {
+	return fmt.Sprintf("campay-go (%s; %s/%s)", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+}
+
+// Client calls the CamPay API. Its methods may be called from several
+// goroutines at once; they share one token, renewed by a single exchange
+// however many calls need it. Options are copied by NewClient, so changing
+// them afterwards has no effect.
+type Client struct {
+	opts Options
+	http *http.Client
+	doer atomic.Pointer[Doer] // http wrapped in the middleware
+
+	// mu guards the fields below it.
+	mu          sync.Mutex
+	middleware  []Middleware
+	token       string
+	tokenInfo   *TokenResponse
+	tokenExpiry time.Time  // zero when the API gave no lifetime
+	tokenRenew  time.Time  // when currentToken starts renewing it
+	refreshing  *tokenCall // token exchange in flight, shared by callers
+	skew        time.Duration
+	haveSkew    bool
+	statuses    map[string]Status // last status seen of unfinished references
+
+	events EventBus
+}
+
+// tokenCall is one token exchange that concurrent callers wait on.
+type tokenCall struct {
+	done chan struct{}
+	err  error
+}
+
+func NewClient(opts Options) *Client {
+	if opts.BaseURL == "" {
+		opts.BaseURL = DemoBaseURL
+	}
+	opts.Timeouts = opts.Timeouts.withDefaults()
+
+	if opts.TLSMinVersion == 0 {
+		opts.TLSMinVersion = tls.VersionTLS12
+	}
+	if opts.BusyRetries == 0 {
+		opts.BusyRetries = 3
+	}
+	if opts.MaxBusyWait <= 0 {
+		opts.MaxBusyWait = 2 * time.Minute
+	}
+	if opts.TokenRefreshMargin <= 0 {
+		opts.TokenRefreshMargin = time.Minute
+	}
+	if opts.UserAgent == "" {
+		opts.UserAgent = DefaultUserAgent()
+	}
+	// The caller may keep using its maps
+	opts.Headers = opts.Headers.Clone()
+	opts.Endpoints = maps.Clone(opts.Endpoints)
+
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.DialContext = (&net.Dialer{Timeout: opts.Timeouts.Connect}).DialContext
+	transport.Proxy = http.ProxyFromEnvironment
+	if opts.Proxy != nil {
+		transport.Proxy = http.ProxyURL(opts.Proxy)
+	}
+	transport.TLSClientConfig = &tls.Config{
+		RootCAs:    opts.RootCAs,
+		MinVersion: opts.TLSMinVersion,
+	}
+
+	c := &Client{
+		opts: opts,
+		http: &http.Client{Transport: transport},
+	}
+	var d Doer = c.http
+	c.doer.Store(&d)
+	return c
+}
+
+// =============================================================
+// Authentication
+// =============================================================
+
+// Authenticate exchanges the configured credentials for an API token used
+// by every subsequent call. The token is then renewed before it expires,
+// and once more if the API rejects it with 401. Concurrent callers share a
+// single token exchange.
+func (c *Client) Authenticate(ctx context.Context) error {
+	return c.refreshToken(ctx, "")
+}
+
+// TokenInfo returns the response of the last successful Authenticate, or
+// nil before the first one. Raw holds any fields beyond the token.
+func (c *Client) TokenInfo() *TokenResponse {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokenInfo
+}
+
+// TokenExpiry returns when the current token expires, or the zero time if
+// unknown.
+func (c *Client) TokenExpiry() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.tokenExpiry
+}
+
+// currentToken returns the token to send, renewing it first when it is
+// within TokenRefreshMargin of its expiry. Clients that never
+// authenticated send no token.
+func (c *Client) currentToken(ctx context.Context) (string, error) {
+	c.mu.Lock()
+	token, expiry, renew := c.token, c.tokenExpiry, c.tokenRenew
+	c.mu.Unlock()
+
+	if token == "" || expiry.IsZero() || time.Now().Before(renew) {
+		return token, nil
+	}
+	if err := c.refreshToken(ctx, token); err != nil {
+		if time.Now().Before(expiry) {
+			return token, nil // still valid, try renewing on the next call
+		}
+		return "", err
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.token, nil
+}
+
+// refreshToken exchanges the credentials for a new token. With a non-empty
+// stale token it does nothing if another caller already replaced it. A
+// call already in flight is joined rather than repeated.
+func (c *Client) refreshToken(ctx context.Context, stale string) error {
+	c.mu.Lock()
+	call := c.refreshing
+	if call == nil {
+		if stale != "" && c.token != stale {
+			c.mu.Unlock()
+			return nil
+		}
+		call = &tokenCall{done: make(chan struct{})}
+		c.refreshing = call
+		go c.exchangeToken(context.WithoutCancel(ctx), call)
+	}
+	c.mu.Unlock()
+
+	select {
+	case <-call.done:
+		return call.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// exchangeToken runs the token call; a caller giving up does not cancel it
+// for the others waiting on it.
+func (c *Client) exchangeToken(ctx context.Context, call *tokenCall) {
+	var tokenResp TokenResponse
+	issued := time.Now()
+	err := c.do(ctx, "token", c.opts.Timeouts.Token, "POST", c.endpoint("token"),
+		TokenRequest{Username: c.opts.Username, Password: c.opts.Password}, &tokenResp)
+
+	c.mu.Lock()
+	if err == nil {
+		c.token = tokenResp.Token
+		c.tokenInfo = &tokenResp
+		c.tokenExpiry, c.tokenRenew = time.Time{}, time.Time{}
+		if tokenResp.ExpiresIn > 0 {
+			// Short-lived tokens are renewed halfway through instead
+			lifetime := time.Duration(tokenResp.ExpiresIn) * time.Second
+			c.tokenExpiry = issued.Add(lifetime)
+			c.tokenRenew = c.tokenExpiry.Add(-min(c.opts.TokenRefreshMargin, lifetime/2))
+		}
+	}
+	c.refreshing = nil
+	c.mu.Unlock()
+
+	call.err = err
+	close(call.done)
+}
+
+// =============================================================
+// Payments
+// =============================================================
+
+// Collect requests a payment from a customer. Without an
+// ExternalReference one is generated (see Options.RefGenerator) and
+// returned in the response. With Options.PreCollect set, the request is
+// checked first; a read-only client refuses it with ErrReadOnly. The
+// response holds the CamPay reference of the transaction and, when the API
+// sends one, the USSD code to dial if no prompt appears (see DialCode).
+func (c *Client) Collect(ctx context.Context, collect CollectRequest) (*CollectResponse, error) {
+	if err := c.readOnly("collect"); err != nil {
+		return nil, err
+	}
+	if !c.opts.SkipValidation {
+		if err := collect.Validate(c.opts.AmountLimits); err != nil {
+			return nil, err
+		}
+	}
+	if collect.ExternalReference == "" {
+		ref, err := c.NewRef()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate an external reference: %w", err)
+		}
+		collect.ExternalReference = ref
+	}
+	review, err := c.checkCollect(ctx, collect)
+	if err != nil {
+		return nil, err
+	}
+	var collectResp CollectResponse
+	if err := c.do(ctx, "collect", c.opts.Timeouts.Collect, "POST", c.endpoint("collect"), collect, &collectResp); err != nil {
+		return nil, err
+	}
+	if collectResp.ExternalReference == "" {
+		collectResp.ExternalReference = collect.ExternalReference
+	}
+	collectResp.Review = review
+	c.initiated(TxEvent{
+		Reference:         collectResp.Reference,
+		ExternalReference: collectResp.ExternalReference,
+		Type:              "collect",
+		Amount:            collect.Amount,
+		Currency:          collect.Currency,
+		Status:            ParseStatus(collectResp.Status),
+	})
+	return &collectResp, nil
+}
+
+// Withdraw sends a payout, generating the ExternalReference like Collect.
+func (c *Client) Withdraw(ctx context.Context, withdraw WithdrawRequest) (*WithdrawResponse, error) {
+	if err := c.readOnly("withdraw"); err != nil {
+		return nil, err
+	}
+	if !c.opts.SkipValidation {
+		if err := withdraw.Validate(c.opts.AmountLimits); err != nil {
+			return nil, err
+		}
+	}
+	if withdraw.ExternalReference == "" {
+		ref, err := c.NewRef()
+		if err != nil {
+			return nil, fmt.Errorf("failed to generate an external reference: %w", err)
+		}
+		withdraw.ExternalReference = ref
+	}
+	var withdrawResp WithdrawResponse
+	if err := c.do(ctx, "withdraw", c.opts.Timeouts.Withdraw, "POST", c.endpoint("withdraw"), withdraw, &withdrawResp); err != nil {
+		return nil, err
+	}
+	if withdrawResp.ExternalReference == "" {
+		withdrawResp.ExternalReference = withdraw.ExternalReference
+	}
+	c.initiated(TxEvent{
+		Reference:         withdrawResp.Reference,
+		ExternalReference: withdrawResp.ExternalReference,
+		Type:              "withdraw",
+		Amount:            withdraw.Amount,
+		Currency:          withdraw.Currency,
+		Status:            ParseStatus(withdrawResp.Status),
+	})
+	return &withdrawResp, nil
+}
+
+func (c *Client) Transaction(ctx context.Context, reference string) (*TransactionResponse, error) {
+	var txn TransactionResponse
+	if err := c.do(ctx, "status", c.opts.Timeouts.Status, "GET", strings.ReplaceAll(c.endpoint("status"), "{reference}", url.PathEscape(reference)), nil, &txn); err != nil {
+		return nil, err
+	}
+	c.observe(&txn)
+	return &txn, nil
+}
+
+func (c *Client) Balance(ctx context.Context) (*BalanceResponse, error) {
+	var balance BalanceResponse
+	if err := c.do(ctx, "balance", c.opts.Timeouts.Balance, "GET", c.endpoint("balance"), nil, &balance); err != nil {
+		return nil, err
+	}
+	return &balance, nil
+}
+
+// History returns the transactions made between two dates (inclusive,
+// day granularity).
+func (c *Client) History(ctx context.Context, start, end time.Time) ([]HistoryItem, error) {
+	var history HistoryResponse
+	req := HistoryRequest{StartDate: start.Format("2006-01-02"), EndDate: end.Format("2006-01-02")}
+	if err := c.do(ctx, "history", c.opts.Timeouts.History, "POST", c.endpoint("history"), req, &history); err != nil {
+		return nil, err
+	}
+	return history.Data, nil
+}
+
+// StreamHistory is History for large accounts: it calls fn with each
+// transaction as the answer is decoded, rather than holding them all in
+// memory. An error from fn stops the stream and is returned wrapped.
+// Transactions already passed to fn are not passed again, so a stream cut
+// short is not retried.
+func (c *Client) StreamHistory(ctx context.Context, start, end time.Time, fn func(HistoryItem) error) error {
+	req := HistoryRequest{StartDate: start.Format("2006-01-02"), EndDate: end.Format("2006-01-02")}
+	return c.do(ctx, "history", c.opts.Timeouts.History, "POST", c.endpoint("history"), req, historyStream(fn))
+}
+
+// Do calls an endpoint this package has no method for yet, with the same
+// token handling, busy retries, middleware and error parsing as the typed
+// calls. path is relative to Options.BaseURL and keeps CamPay's trailing
+// slash, e.g. "/balance/". body, unless nil, is sent as JSON (a
+// json.RawMessage as is), and a 2xx answer is decoded into out unless it
+// is nil; a *json.RawMessage keeps it undecoded. Calls are bounded by
+// Timeouts.Other.
+//
+// Busy answers are retried like those of Collect, since CamPay did not
+// process the call; an endpoint that moves money needs no more care here
+// than Collect does. A read-only client (see Options.ReadOnly) only makes
+// calls that read.
+func (c *Client) Do(ctx context.Context, method, path string, body, out any) error {
+	if !strings.HasPrefix(path, "/") {
+		path = "/" + path
+	}
+	method = strings.ToUpper(method)
+	if err := c.readOnlyDo(method, path); err != nil {
+		return err
+	}
+	return c.do(ctx, method+" "+path, c.opts.Timeouts.Other, method, path, body, out)
+}
+
+// =============================================================
+// Transport
+// =============================================================
+
+// RequestIDHeader carries the UUID generated for every call. It appears in
+// LogRequests output and in APIError and TimeoutError messages, so a
+// failing call can be quoted to CamPay support.
+const RequestIDHeader = "X-Request-ID"
+
+// newRequestID returns a random (version 4) UUID.
+func newRequestID() string {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	return fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16])
+}
+
+// endpoint returns the path of op, from Options.Endpoints or the default.
+func (c *Client) endpoint(op string) string {
+	if path, ok := c.opts.Endpoints[op]; ok {
+		return path
+	}
+	return defaultEndpoints[op]
+}
+
+// do sends a JSON request bounded by timeout and decodes a 200 response
+// into out. Busy answers are retried as configured by Options.BusyRetries;
+// each attempt gets the full timeout.
+func (c *Client) do(ctx context.Context, op string, timeout time.Duration, method, path string, in, out any) error {
+	var data []byte
+	if in != nil {
+		var err error
+		if data, err = json.Marshal(in); err != nil {
+			return err
+		}
+	}
+
+	reauthenticated := false
+	for attempt := 0; ; attempt++ {
+		var token string
+		if op != "token" {
+			var err error
+			if token, err = c.currentToken(ctx); err != nil {
+				return err
+			}
+		}
+		err := c.doOnce(ctx, op, timeout, method, path, token, data, in != nil, out)
+
+		var apiErr *APIError
+		if !errors.As(err, &apiErr) {
+			return err
+		}
+		// A token rejected before its expiry is renewed once; the call was
+		// refused, so repeating it cannot duplicate a payment
+		if apiErr.StatusCode == http.StatusUnauthorized && token != "" && !reauthenticated {
+			reauthenticated = true
+			if c.refreshToken(ctx, token) != nil {
+				return err
+			}
+			attempt--
+			continue
+		}
+		if !apiErr.Busy() || attempt >= c.opts.BusyRetries {
+			return err
+		}
+		wait := apiErr.RetryAfter
+		if wait == 0 {
+			wait = time.Duration(attempt+1) * 2 * time.Second
+		}
+		if wait > c.opts.MaxBusyWait {
+			return err
+		}
+		if c.opts.OnBusy != nil {
+			c.opts.OnBusy(op, apiErr.StatusCode, wait)
+		}
+
+		select {
+		case <-ctx.Done():
+			return err
+		case <-time.After(wait):
+		}
+	}
+}
+
+func (c *Client) doOnce(ctx context.Context, op string, timeout time.Duration, method, path, token string, data []byte, hasBody bool, out any) error {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var reqBody io.Reader
+	if hasBody {
+		reqBody = bytes.NewReader(data)
+	}
+
+	req, err := http.NewRequestWithContext(withOperation(ctx, op), method, c.opts.BaseURL+path, reqBody)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", c.opts.UserAgent)
+	for name, values := range c.opts.Headers {
+		req.Header[http.CanonicalHeaderKey(name)] = append([]string(nil), values...)
+	}
+	if hasBody {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	if token != "" {
+		req.Header.Set("Authorization", "Token "+token)
+	}
+	requestID := newRequestID()
+	req.Header.Set(RequestIDHeader, requestID)
+
+	resp, err := (*c.doer.Load()).Do(req)
+	if err != nil {
+		return classifyTimeout(op, requestID, c.opts.Timeouts, timeout, err)
+	}
+	defer resp.Body.Close()
+	c.observeDate(resp.Header.Get("Date"))
+
+	if d, ok := out.(bodyDecoder); ok && resp.StatusCode/100 == 2 {
+		if err := d.decodeBody(resp.Body); err != nil {
+			return classifyTimeout(op, requestID, c.opts.Timeouts, timeout, err)
+		}
+		return nil
+	}
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return classifyTimeout(op, requestID, c.opts.Timeouts, timeout, err)
+	}
+
+	if resp.StatusCode/100 != 2 {
+		apiErr := newAPIError(resp.StatusCode, requestID, body)
+		apiErr.RetryAfter = parseRetryAfter(resp.Header.Get("Retry-After"))
+		return apiErr
+	}
+
+	if out == nil || len(bytes.TrimSpace(body)) == 0 {
+		return nil
+	}
+	return json.Unmarshal(body, out)
+}
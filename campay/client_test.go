@@ -0,0 +1,167 @@
+package campay
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// fakeAPI answers token, collect and status calls, accepting only the
+// token it issued last. Run the tests with -race: the client is shared by
+// every goroutine.
+type fakeAPI struct {
+	lifetime   int // expires_in of issued tokens, in seconds
+	tokenCalls atomic.Int32
+
+	mu    sync.Mutex
+	token string
+}
+
+func (f *fakeAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	if r.URL.Path == "/token/" {
+		n := f.tokenCalls.Add(1)
+		time.Sleep(20 * time.Millisecond) // let concurrent callers pile up
+		f.mu.Lock()
+		f.token = fmt.Sprintf("tok-%d", n)
+		f.mu.Unlock()
+		json.NewEncoder(w).Encode(map[string]any{"token": f.token, "expires_in": f.lifetime})
+		return
+	}
+
+	f.mu.Lock()
+	valid := r.Header.Get("Authorization") == "Token "+f.token
+	f.mu.Unlock()
+	if !valid {
+		w.WriteHeader(http.StatusUnauthorized)
+		fmt.Fprint(w, `{"detail":"Invalid token."}`)
+		return
+	}
+
+	switch {
+	case r.URL.Path == "/collect/":
+		var req CollectRequest
+		json.NewDecoder(r.Body).Decode(&req)
+		json.NewEncoder(w).Encode(map[string]any{"reference": "ref-" + req.ExternalReference, "status": "PENDING"})
+	case strings.HasPrefix(r.URL.Path, "/transaction/"):
+		ref := strings.Trim(strings.TrimPrefix(r.URL.Path, "/transaction/"), "/")
+		json.NewEncoder(w).Encode(map[string]any{"reference": ref, "status": "SUCCESSFUL", "amount": 100, "currency": "XAF"})
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// revoke makes the API reject the current token, as after a server-side
+// logout.
+func (f *fakeAPI) revoke() {
+	f.mu.Lock()
+	f.token = "revoked"
+	f.mu.Unlock()
+}
+
+// collectAndCheck makes one collection and looks it up.
+func collectAndCheck(ctx context.Context, c *Client, i int) error {
+	resp, err := c.Collect(ctx, CollectRequest{
+		Amount:            100,
+		Currency:          "XAF",
+		From:              "237650000001",
+		Description:       "race test",
+		ExternalReference: fmt.Sprintf("ext-%d", i),
+	})
+	if err != nil {
+		return fmt.Errorf("collect %d: %w", i, err)
+	}
+	txn, err := c.Transaction(ctx, resp.Reference)
+	if err != nil {
+		return fmt.Errorf("status %d: %w", i, err)
+	}
+	if txn.Reference != resp.Reference || ParseStatus(txn.Status) != StatusSuccessful {
+		return fmt.Errorf("status %d: got %s %s", i, txn.Reference, txn.Status)
+	}
+	return nil
+}
+
+// runParallel calls fn from n goroutines and returns the first error.
+func runParallel(n int, fn func(i int) error) error {
+	errs := make(chan error, n)
+	var wg sync.WaitGroup
+	for i := range n {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			errs <- fn(i)
+		}()
+	}
+	wg.Wait()
+	close(errs)
+	for err := range errs {
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func TestClientParallelCallsShareTokenRefresh(t *testing.T) {
+	api := &fakeAPI{lifetime: 3600}
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	c := NewClient(Options{BaseURL: srv.URL, Username: "u", Password: "p"})
+	ctx := context.Background()
+	if err := c.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	// Every call is refused once with 401; they must share one exchange
+	api.revoke()
+	if err := runParallel(32, func(i int) error { return collectAndCheck(ctx, c, i) }); err != nil {
+		t.Fatal(err)
+	}
+	if n := api.tokenCalls.Load(); n != 2 {
+		t.Fatalf("token exchanges = %d, want 2 (login and one shared renewal)", n)
+	}
+	if got := c.TokenInfo(); got == nil || got.Token != "tok-2" {
+		t.Fatalf("TokenInfo() = %+v, want tok-2", got)
+	}
+}
+
+func TestClientParallelCallsRenewExpiringToken(t *testing.T) {
+	if testing.Short() {
+		t.Skip("waits for a token to expire")
+	}
+	api := &fakeAPI{lifetime: 1} // renewed after half a second
+	srv := httptest.NewServer(api)
+	defer srv.Close()
+
+	c := NewClient(Options{BaseURL: srv.URL, Username: "u", Password: "p"})
+	ctx := context.Background()
+	if err := c.Authenticate(ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	deadline := time.Now().Add(1200 * time.Millisecond)
+	err := runParallel(16, func(i int) error {
+		for n := 0; time.Now().Before(deadline); n++ {
+			if err := collectAndCheck(ctx, c, i*1000+n); err != nil {
+				return err
+			}
+			_ = c.TokenExpiry()
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// Login, then one renewal per half second at most
+	if n := api.tokenCalls.Load(); n < 2 || n > 4 {
+		t.Fatalf("token exchanges = %d, want 2 to 4", n)
+	}
+}
@@ -0,0 +1,120 @@
+package campay
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"strconv"
+	"strings"
+)
+
+// decodeTolerant fills the json-tagged fields of v (a struct pointer) one
+// by one so that a single malformed field does not reject the whole
+// response. Numeric fields accept both numbers and numeric strings. Fields
+// v does not know about are stored in raw, and per-field problems are
+// returned as warnings. Only a missing or undecodable core field is an
+// error.
+func decodeTolerant(data []byte, v any, core ...string) (raw map[string]json.RawMessage, warnings []string, err error) {
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal(data, &fields); err != nil {
+		return nil, nil, err
+	}
+
+	known := map[string]bool{}
+	failed := map[string]bool{}
+
+	rv := reflect.ValueOf(v).Elem()
+	rt := rv.Type()
+	for i := 0; i < rt.NumField(); i++ {
+		name, _, _ := strings.Cut(rt.Field(i).Tag.Get("json"), ",")
+		if name == "" || name == "-" {
+			continue
+		}
+		known[name] = true
+
+		value, ok := fields[name]
+		if !ok || string(value) == "null" {
+			continue
+		}
+		if err := decodeField(rv.Field(i), value); err != nil {
+			failed[name] = true
+			warnings = append(warnings, fmt.Sprintf("could not decode %q: %v", name, err))
+		}
+	}
+
+	for _, name := range core {
+		if _, ok := fields[name]; !ok || failed[name] {
+			return nil, nil, fmt.Errorf("response is missing required field %q", name)
+		}
+	}
+
+	for name, value := range fields {
+		if !known[name] {
+			if raw == nil {
+				raw = map[string]json.RawMessage{}
+			}
+			raw[name] = value
+		}
+	}
+	return raw, warnings, nil
+}
+
+func decodeField(field reflect.Value, value json.RawMessage) error {
+	switch field.Kind() {
+	case reflect.Int, reflect.Int64:
+		n, err := parseNumber(value)
+		if err != nil {
+			return err
+		}
+		if n != math.Trunc(n) {
+			return fmt.Errorf("%s is not a whole number", value)
+		}
+		field.SetInt(int64(n))
+		return nil
+
+	case reflect.Float64:
+		n, err := parseNumber(value)
+		if err != nil {
+			return err
+		}
+		field.SetFloat(n)
+		return nil
+
+	case reflect.String:
+		// Some endpoints send numeric codes unquoted
+		var s string
+		if err := json.Unmarshal(value, &s); err == nil {
+			field.SetString(s)
+			return nil
+		}
+		if _, err := parseNumber(value); err == nil {
+			field.SetString(string(value))
+			return nil
+		}
+		return fmt.Errorf("%s is not a string", value)
+	}
+
+	return json.Unmarshal(value, field.Addr().Interface())
+}
+
+// parseNumber accepts a JSON number or a string holding one, which may
+// group thousands with spaces ("1 000", or a no-break space). It is the
+// only way numbers in responses are read, see Amount.
+func parseNumber(value json.RawMessage) (float64, error) {
+	s := string(value)
+	if strings.HasPrefix(s, `"`) {
+		if err := json.Unmarshal(value, &s); err != nil {
+			return 0, err
+		}
+		s = strings.Join(strings.Fields(s), "")
+	}
+	n, err := strconv.ParseFloat(s, 64)
+	if err != nil {
+		return 0, err
+	}
+	if math.IsNaN(n) || math.IsInf(n, 0) {
+		return 0, fmt.Errorf("%s is not a finite number", value)
+	}
+	return n, nil
+}
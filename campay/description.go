@@ -0,0 +1,116 @@
+package campay
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Descriptions reach the payer's phone through the operator, and some
+// channels garble or reject anything but ASCII. Transliterate rewrites
+// French and other Latin text into ASCII, and FitDescription keeps a
+// description within MaxDescriptionLength.
+
+// asciiFold spells out characters that have no single-letter ASCII form
+// or that Transliterate cannot find by stripping an accent.
+var asciiFold = map[rune]string{
+	'Æ': "AE", 'æ': "ae", 'Œ': "OE", 'œ': "oe", 'ß': "ss",
+	'Ø': "O", 'ø': "o", 'Ð': "D", 'ð': "d", 'Þ': "Th", 'þ': "th",
+	'Ł': "L", 'ł': "l", 'Đ': "D", 'đ': "d", 'ı': "i",
+	'‘': "'", '’': "'", '‚': "'", '‹': "<", '›': ">",
+	'“': `"`, '”': `"`, '„': `"`, '«': `"`, '»': `"`,
+	'–': "-", '—': "-", '‐': "-", '‑': "-", '−': "-",
+	'…': "...", '•': "*", '·': ".", '€': "EUR", '£': "GBP", '°': "o",
+	'×': "x", '÷': "/", '©': "(c)", '®': "(R)", '™': "TM", '№': "No",
+}
+
+// latinBase maps accented Latin letters (Latin-1 and Latin Extended-A) to
+// their base letter.
+var latinBase = map[rune]rune{}
+
+func init() {
+	groups := map[rune]string{
+		'A': "ÀÁÂÃÄÅĀĂĄ", 'a': "àáâãäåāăą",
+		'C': "ÇĆĈĊČ", 'c': "çćĉċč",
+		'D': "Ď", 'd': "ď",
+		'E': "ÈÉÊËĒĔĖĘĚ", 'e': "èéêëēĕėęě",
+		'G': "ĜĞĠĢ", 'g': "ĝğġģ",
+		'H': "ĤĦ", 'h': "ĥħ",
+		'I': "ÌÍÎÏĨĪĬĮİ", 'i': "ìíîïĩīĭį",
+		'J': "Ĵ", 'j': "ĵ",
+		'K': "Ķ", 'k': "ķ",
+		'L': "ĹĻĽĿ", 'l': "ĺļľŀ",
+		'N': "ÑŃŅŇ", 'n': "ñńņň",
+		'O': "ÒÓÔÕÖŌŎŐ", 'o': "òóôõöōŏő",
+		'R': "ŔŖŘ", 'r': "ŕŗř",
+		'S': "ŚŜŞŠ", 's': "śŝşš",
+		'T': "ŢŤŦ", 't': "ţťŧ",
+		'U': "ÙÚÛÜŨŪŬŮŰŲ", 'u': "ùúûüũūŭůűų",
+		'W': "Ŵ", 'w': "ŵ",
+		'Y': "ÝŶŸ", 'y': "ýÿŷ",
+		'Z': "ŹŻŽ", 'z': "źżž",
+	}
+	for base, accented := range groups {
+		for _, r := range accented {
+			latinBase[r] = base
+		}
+	}
+}
+
+// Transliterate returns s in printable ASCII: accented letters lose their
+// accents ("Réglé à Yaoundé" becomes "Regle a Yaounde"), ligatures and
+// typographic punctuation are spelled out, combining marks are dropped and
+// any other character becomes "?". Whitespace is normalized as by
+// NormalizeDescription.
+func Transliterate(s string) string {
+	s = NormalizeDescription(s)
+	var sb strings.Builder
+	sb.Grow(len(s))
+	for _, r := range s {
+		switch {
+		case r < utf8.RuneSelf:
+			sb.WriteRune(r)
+		case unicode.Is(unicode.Mn, r):
+			// combining accent of a decomposed letter
+		case latinBase[r] != 0:
+			sb.WriteRune(latinBase[r])
+		case asciiFold[r] != "":
+			sb.WriteString(asciiFold[r])
+		default:
+			sb.WriteByte('?')
+		}
+	}
+	return sb.String()
+}
+
+// NormalizeDescription replaces line breaks, tabs and other control or
+// space characters with single spaces and trims the result.
+func NormalizeDescription(s string) string {
+	return strings.Join(strings.FieldsFunc(s, func(r rune) bool {
+		return unicode.IsSpace(r) || unicode.IsControl(r)
+	}), " ")
+}
+
+// IsASCII reports whether s holds only ASCII characters.
+func IsASCII(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] >= utf8.RuneSelf {
+			return false
+		}
+	}
+	return true
+}
+
+// FitDescription shortens s to at most max characters (not bytes), cutting
+// at the last space when there is one in the final part, and reports
+// whether it had to.
+func FitDescription(s string, max int) (string, bool) {
+	if max <= 0 || utf8.RuneCountInString(s) <= max {
+		return s, false
+	}
+	runes := []rune(s)[:max]
+	if i := strings.LastIndexFunc(string(runes), unicode.IsSpace); i > 0 && utf8.RuneCountInString(string(runes)[:i]) > max*3/4 {
+		return strings.TrimSpace(string(runes)[:i]), true
+	}
+	return strings.TrimSpace(string(runes)), true
+}
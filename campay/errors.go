@@ -0,0 +1,100 @@
+package campay
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// APIError is returned when CamPay answers with a non-200 status.
+type APIError struct {
+	StatusCode int
+	Code       string
+	Message    string
+	Body       string
+	RequestID  string
+
+	// RetryAfter is the wait requested by a Retry-After header, if any.
+	RetryAfter time.Duration
+}
+
+// Busy reports whether CamPay asked the caller to slow down (429) or is in
+// maintenance (503 with Retry-After). Neither processed the request.
+func (e *APIError) Busy() bool {
+	return e.StatusCode == http.StatusTooManyRequests ||
+		(e.StatusCode == http.StatusServiceUnavailable && e.RetryAfter > 0)
+}
+
+// parseRetryAfter accepts both forms of the header: seconds or an HTTP date.
+func parseRetryAfter(v string) time.Duration {
+	v = strings.TrimSpace(v)
+	if v == "" {
+		return 0
+	}
+	if secs, err := strconv.Atoi(v); err == nil && secs >= 0 {
+		return time.Duration(secs) * time.Second
+	}
+	if t, err := http.ParseTime(v); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+func (e *APIError) Error() string {
+	if e.Message != "" {
+		return fmt.Sprintf("API error (%d): %s - %s [request %s]", e.StatusCode, e.Code, e.Message, e.RequestID)
+	}
+	return fmt.Sprintf("API error (%d): %s [request %s]", e.StatusCode, e.Body, e.RequestID)
+}
+
+func newAPIError(status int, requestID string, body []byte) *APIError {
+	apiErr := &APIError{StatusCode: status, Body: string(body), RequestID: requestID}
+
+	var er ErrorResponse
+	if json.Unmarshal(body, &er) == nil && er.Message != "" {
+		apiErr.Code = er.Code
+		apiErr.Message = er.Message
+	}
+	return apiErr
+}
+
+// TimeoutError reports which operation timed out and whether the
+// connection could not be established or the response never arrived.
+type TimeoutError struct {
+	Op        string
+	Connect   bool
+	After     time.Duration
+	RequestID string
+}
+
+func (e *TimeoutError) Error() string {
+	if e.Connect {
+		return fmt.Sprintf("%s: timed out connecting to CamPay after %s [request %s]", e.Op, e.After, e.RequestID)
+	}
+	return fmt.Sprintf("%s: timed out waiting for CamPay response after %s [request %s]", e.Op, e.After, e.RequestID)
+}
+
+func (e *TimeoutError) Timeout() bool { return true }
+
+// classifyTimeout converts dial and deadline failures into a TimeoutError
+// and tags any other error with the request ID.
+func classifyTimeout(op, requestID string, timeouts Timeouts, opTimeout time.Duration, err error) error {
+	var opErr *net.OpError
+	if errors.As(err, &opErr) && opErr.Op == "dial" && opErr.Timeout() {
+		return &TimeoutError{Op: op, Connect: true, After: timeouts.Connect, RequestID: requestID}
+	}
+
+	var netErr net.Error
+	if errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		return &TimeoutError{Op: op, After: opTimeout, RequestID: requestID}
+	}
+	return fmt.Errorf("%s [request %s]: %w", op, requestID, err)
+}
@@ -0,0 +1,149 @@
+package campay
+
+import (
+	"sync"
+	"time"
+)
+
+// TxEventKind is what happened to a transaction.
+type TxEventKind string
+
+const (
+	// EventInitiated: CamPay accepted a collect or withdraw request.
+	EventInitiated TxEventKind = "initiated"
+	// EventStatusChanged: the status changed to one that is not final.
+	EventStatusChanged TxEventKind = "status_changed"
+	// EventTerminal: the status became final. It replaces
+	// EventStatusChanged for that change.
+	EventTerminal TxEventKind = "terminal"
+	// EventRetried: the payment was sent again as another transaction,
+	// named by RetryOf's counterpart Reference.
+	EventRetried TxEventKind = "retried"
+	// EventRefunded: a payout returning a collection (RefundOf) succeeded.
+	EventRefunded TxEventKind = "refunded"
+)
+
+// TxEvent is one step of a transaction's lifecycle.
+type TxEvent struct {
+	Kind              TxEventKind `json:"kind"`
+	Reference         string      `json:"reference"`
+	ExternalReference string      `json:"external_reference,omitempty"`
+	Type              string      `json:"type,omitempty"` // collect or withdraw
+	Amount            int         `json:"amount,omitempty"`
+	Currency          string      `json:"currency,omitempty"`
+	From              Status      `json:"from,omitempty"` // status before the event, empty when initiated
+	Status            Status      `json:"status"`
+	Reason            string      `json:"reason,omitempty"`
+	RetryOf           string      `json:"retry_of,omitempty"`  // retried: the reference sent again
+	RefundOf          string      `json:"refund_of,omitempty"` // refunded: the collection paid back
+	At                time.Time   `json:"at"`
+}
+
+// EventBus delivers TxEvents to its subscribers. The zero value is ready
+// to use, and its methods may be called from several goroutines.
+type EventBus struct {
+	mu   sync.RWMutex
+	next int
+	subs []subscriber
+}
+
+type subscriber struct {
+	id int
+	fn func(TxEvent)
+}
+
+// Subscribe calls fn with every event published from now on, and returns
+// a function that stops it. Subscribers are called in the order they
+// subscribed, in the publisher's goroutine, so fn must return quickly;
+// hand slow work to a goroutine of its own.
+func (b *EventBus) Subscribe(fn func(TxEvent)) (unsubscribe func()) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.next++
+	id := b.next
+	b.subs = append(b.subs, subscriber{id: id, fn: fn})
+	return func() {
+		b.mu.Lock()
+		defer b.mu.Unlock()
+		for i, s := range b.subs {
+			if s.id == id {
+				b.subs = append(b.subs[:i:i], b.subs[i+1:]...)
+				return
+			}
+		}
+	}
+}
+
+// Publish delivers ev to every subscriber, stamping At if it is zero.
+func (b *EventBus) Publish(ev TxEvent) {
+	if ev.At.IsZero() {
+		ev.At = time.Now().UTC()
+	}
+	b.mu.RLock()
+	subs := b.subs
+	b.mu.RUnlock()
+	for _, s := range subs {
+		s.fn(ev)
+	}
+}
+
+// Subscribe calls fn with the lifecycle events of the transactions this
+// client sees: EventInitiated when Collect or Withdraw succeeds, and
+// EventStatusChanged or EventTerminal when Transaction returns a status
+// other than the last one it returned for that reference. The client
+// knows nothing of retries and refunds; the campay CLI publishes those
+// from its ledger. It returns a function that stops fn.
+//
+// The client forgets a reference once its status is final, so asking
+// again about a finished transaction publishes EventTerminal again.
+func (c *Client) Subscribe(fn func(TxEvent)) (unsubscribe func()) {
+	return c.events.Subscribe(fn)
+}
+
+// initiated publishes ev as EventInitiated and remembers its status, so
+// that polling it does not report a change until there is one.
+func (c *Client) initiated(ev TxEvent) {
+	ev.Kind = EventInitiated
+	if !ev.Status.Terminal() {
+		c.mu.Lock()
+		if c.statuses == nil {
+			c.statuses = map[string]Status{}
+		}
+		c.statuses[ev.Reference] = ev.Status
+		c.mu.Unlock()
+	}
+	c.events.Publish(ev)
+}
+
+// observe publishes the change, if any, of a transaction's status since
+// the last time the client saw it. References are forgotten once final.
+func (c *Client) observe(txn *TransactionResponse) {
+	status := ParseStatus(txn.Status)
+	c.mu.Lock()
+	from, seen := c.statuses[txn.Reference]
+	if status.Terminal() {
+		delete(c.statuses, txn.Reference)
+	} else {
+		if c.statuses == nil {
+			c.statuses = map[string]Status{}
+		}
+		c.statuses[txn.Reference] = status
+	}
+	c.mu.Unlock()
+	if seen && from == status {
+		return
+	}
+	kind := EventStatusChanged
+	if status.Terminal() {
+		kind = EventTerminal
+	}
+	c.events.Publish(TxEvent{
+		Kind:              kind,
+		Reference:         txn.Reference,
+		ExternalReference: txn.ExternalReference,
+		Amount:            txn.Amount.Int(),
+		Currency:          txn.Currency,
+		From:              from,
+		Status:            status,
+	})
+}
@@ -0,0 +1,73 @@
+package campay
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// Doer sends an HTTP request. *http.Client satisfies it.
+type Doer interface {
+	Do(req *http.Request) (*http.Response, error)
+}
+
+// DoerFunc adapts a function to the Doer interface.
+type DoerFunc func(req *http.Request) (*http.Response, error)
+
+func (f DoerFunc) Do(req *http.Request) (*http.Response, error) {
+	return f(req)
+}
+
+// Middleware wraps every HTTP call the client makes, e.g. for logging,
+// metrics, caching or fault injection.
+type Middleware func(next Doer) Doer
+
+// operationKey carries the operation of a request in its context.
+type operationKey struct{}
+
+// Operation returns the operation a request made by the client belongs
+// to: the name of its endpoint ("token", "collect", "withdraw", "status",
+// "balance" or "history"), or the method and path given to Do. Middleware
+// can rely on it where the path, which Options.Endpoints may change,
+// cannot be.
+func Operation(req *http.Request) string {
+	op, _ := req.Context().Value(operationKey{}).(string)
+	return op
+}
+
+func withOperation(ctx context.Context, op string) context.Context {
+	return context.WithValue(ctx, operationKey{}, op)
+}
+
+// Use appends middleware to the client. The first middleware registered is
+// the outermost one. Calls already in flight finish with the middleware
+// they started with.
+func (c *Client) Use(mw ...Middleware) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.middleware = append(c.middleware, mw...)
+
+	var d Doer = c.http
+	for i := len(c.middleware) - 1; i >= 0; i-- {
+		d = c.middleware[i](d)
+	}
+	c.doer.Store(&d)
+}
+
+// LogRequests reports the method, path, request ID, status and duration of
+// every call.
+func LogRequests(logf func(format string, args ...any)) Middleware {
+	return func(next Doer) Doer {
+		return DoerFunc(func(req *http.Request) (*http.Response, error) {
+			start := time.Now()
+			id := req.Header.Get(RequestIDHeader)
+			resp, err := next.Do(req)
+			if err != nil {
+				logf("%s %s [%s] failed after %s: %v", req.Method, req.URL.Path, id, time.Since(start).Round(time.Millisecond), err)
+				return nil, err
+			}
+			logf("%s %s [%s] → %d in %s", req.Method, req.URL.Path, id, resp.StatusCode, time.Since(start).Round(time.Millisecond))
+			return resp, nil
+		})
+	}
+}
@@ -0,0 +1,249 @@
+package campay
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+)
+
+/* ============================================================
+   ===============  REQUEST / RESPONSE MODELS  =================
+   ============================================================ */
+
+type TokenRequest struct {
+	Username string `json:"username"`
+	Password string `json:"password"`
+}
+
+type TokenResponse struct {
+	Token     string `json:"token"`
+	ExpiresIn int    `json:"expires_in"` // seconds
+
+	Raw      map[string]json.RawMessage `json:"-"`
+	Warnings []string                   `json:"-"`
+}
+
+type CollectRequest struct {
+	Amount            int    `json:"amount"`
+	Currency          string `json:"currency"`
+	From              string `json:"from"`
+	Description       string `json:"description"`
+	ExternalReference string `json:"external_reference"`
+	// Operator (MTN or ORANGE) names the payer's network when the number
+	// may be ported. It is only sent when set; CamPay otherwise routes by
+	// the number.
+	Operator string `json:"operator,omitempty"`
+}
+
+type CollectResponse struct {
+	Reference         string `json:"reference"`
+	ExternalReference string `json:"external_reference"`
+	Status            string `json:"status"`
+	Amount            Amount `json:"amount"`
+	Currency          string `json:"currency"`
+	Operator          string `json:"operator"`
+	Code              string `json:"code"`
+	USSDCode          string `json:"ussd_code"`
+	OperatorReference string `json:"operator_reference"`
+
+	// Raw holds response fields this package does not model yet, and
+	// Warnings lists fields that were present but could not be decoded.
+	Raw      map[string]json.RawMessage `json:"-"`
+	Warnings []string                   `json:"-"`
+
+	// Review is the verdict of a pre-collect check that flagged the
+	// collection, nil when it was approved or not checked.
+	Review *Verdict `json:"-"`
+}
+
+// DialCode returns the USSD code the customer can dial to confirm the
+// payment when the operator's push prompt does not arrive, or "".
+func (r *CollectResponse) DialCode() string {
+	for _, code := range []string{r.USSDCode, r.Code} {
+		if code = strings.TrimSpace(code); strings.HasPrefix(code, "*") || strings.HasPrefix(code, "#") {
+			return code
+		}
+	}
+	return ""
+}
+
+// DialURI returns DialCode as a tel: URI, which opens the phone's dialer
+// with the code filled in, or "".
+func (r *CollectResponse) DialURI() string {
+	return DialURI(r.DialCode())
+}
+
+// DialURI turns a USSD code such as "*126#" into a tel: URI for links and
+// mobile apps ("tel:*126%23"). The # is escaped, as RFC 3966 requires;
+// dialers put it back. Codes holding anything but digits, * and # give "".
+func DialURI(code string) string {
+	if code == "" || strings.Trim(code, "0123456789*#") != "" {
+		return ""
+	}
+	return "tel:" + strings.ReplaceAll(code, "#", "%23")
+}
+
+type TransactionResponse struct {
+	Reference         string `json:"reference"`
+	ExternalReference string `json:"external_reference"`
+	Status            string `json:"status"`
+	Amount            Amount `json:"amount"`
+	Currency          string `json:"currency"`
+	Operator          string `json:"operator"`
+	Code              string `json:"code"`
+	OperatorReference string `json:"operator_reference"`
+	Description       string `json:"description"`
+
+	Raw      map[string]json.RawMessage `json:"-"`
+	Warnings []string                   `json:"-"`
+}
+
+type WithdrawRequest struct {
+	Amount            int    `json:"amount"`
+	Currency          string `json:"currency"`
+	To                string `json:"to"`
+	Description       string `json:"description"`
+	ExternalReference string `json:"external_reference"`
+	Operator          string `json:"operator,omitempty"` // as in CollectRequest
+}
+
+type WithdrawResponse struct {
+	Reference         string `json:"reference"`
+	ExternalReference string `json:"external_reference"`
+	Status            string `json:"status"`
+
+	Raw      map[string]json.RawMessage `json:"-"`
+	Warnings []string                   `json:"-"`
+}
+
+type BalanceResponse struct {
+	TotalBalance  Amount `json:"total_balance"`
+	MTNBalance    Amount `json:"mtn_balance"`
+	OrangeBalance Amount `json:"orange_balance"`
+	Currency      string `json:"currency"`
+
+	Raw      map[string]json.RawMessage `json:"-"`
+	Warnings []string                   `json:"-"`
+}
+
+type HistoryRequest struct {
+	StartDate string `json:"start_date"`
+	EndDate   string `json:"end_date"`
+}
+
+// HistoryItem is one transaction from the history endpoint, including
+// those started from the dashboard or other integrations.
+type HistoryItem struct {
+	Reference         string `json:"reference"`
+	ExternalReference string `json:"external_reference"`
+	Status            string `json:"status"`
+	Amount            Amount `json:"amount"`
+	Currency          string `json:"currency"`
+	Operator          string `json:"operator"`
+	PhoneNumber       string `json:"phone_number"`
+	Description       string `json:"description"`
+	Type              string `json:"type"`
+	Datetime          string `json:"datetime"`
+
+	Raw      map[string]json.RawMessage `json:"-"`
+	Warnings []string                   `json:"-"`
+}
+
+type HistoryResponse struct {
+	Data []HistoryItem `json:"data"`
+}
+
+type ErrorResponse struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+/* ============================================================
+   ========================= DECODING ==========================
+   ============================================================ */
+
+func (r *TokenResponse) UnmarshalJSON(data []byte) (err error) {
+	r.Raw, r.Warnings, err = decodeTolerant(data, r, "token")
+	return err
+}
+
+func (r *CollectResponse) UnmarshalJSON(data []byte) (err error) {
+	r.Raw, r.Warnings, err = decodeTolerant(data, r, "reference")
+	return err
+}
+
+func (r *TransactionResponse) UnmarshalJSON(data []byte) (err error) {
+	r.Raw, r.Warnings, err = decodeTolerant(data, r, "reference", "status")
+	return err
+}
+
+func (r *WithdrawResponse) UnmarshalJSON(data []byte) (err error) {
+	r.Raw, r.Warnings, err = decodeTolerant(data, r, "reference")
+	return err
+}
+
+func (r *HistoryItem) UnmarshalJSON(data []byte) (err error) {
+	r.Raw, r.Warnings, err = decodeTolerant(data, r, "reference", "status")
+	return err
+}
+
+// bodyDecoder is implemented by outputs that decode a response while it
+// is read, rather than once it has been read whole.
+type bodyDecoder interface {
+	decodeBody(r io.Reader) error
+}
+
+// historyStream decodes the data array of a history answer one item at a
+// time, skipping the other keys.
+type historyStream func(HistoryItem) error
+
+func (fn historyStream) decodeBody(r io.Reader) error {
+	dec := json.NewDecoder(r)
+	if tok, err := dec.Token(); err != nil {
+		return err
+	} else if tok != json.Delim('{') {
+		return fmt.Errorf("history: answer is not a JSON object")
+	}
+	for dec.More() {
+		key, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if key != "data" {
+			var skip json.RawMessage
+			if err := dec.Decode(&skip); err != nil {
+				return err
+			}
+			continue
+		}
+		tok, err := dec.Token()
+		if err != nil {
+			return err
+		}
+		if tok == nil { // "data": null
+			continue
+		}
+		if tok != json.Delim('[') {
+			return fmt.Errorf("history: data is not an array")
+		}
+		for dec.More() {
+			var item HistoryItem
+			if err := dec.Decode(&item); err != nil {
+				return err
+			}
+			if err := fn(item); err != nil {
+				return err
+			}
+		}
+		if _, err := dec.Token(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *BalanceResponse) UnmarshalJSON(data []byte) (err error) {
+	r.Raw, r.Warnings, err = decodeTolerant(data, r, "total_balance")
+	return err
+}
@@ -0,0 +1,189 @@
+package campay
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+)
+
+// Decision is the answer of a pre-collect check.
+type Decision string
+
+const (
+	// DecisionApprove lets the collection go ahead.
+	DecisionApprove Decision = "approve"
+	// DecisionReject stops it: Collect returns a *RejectedError and
+	// nothing is sent to CamPay.
+	DecisionReject Decision = "reject"
+	// DecisionFlag lets it go ahead marked for review: the response's
+	// Review holds the verdict.
+	DecisionFlag Decision = "flag"
+)
+
+// Verdict is what a PreCollectHook decided about a collection, and why.
+type Verdict struct {
+	Decision Decision `json:"decision"`
+	Reason   string   `json:"reason,omitempty"`
+}
+
+// PreCollectHook checks every collection before Collect sends it, e.g.
+// against a fraud or risk service (see Options.PreCollect). req is the
+// request about to be sent, with its ExternalReference filled in. An error
+// fails the collection with ErrPreCollectFailed; nothing is sent.
+type PreCollectHook interface {
+	CheckCollect(ctx context.Context, req CollectRequest) (Verdict, error)
+}
+
+// PreCollectFunc adapts a function to the PreCollectHook interface.
+type PreCollectFunc func(ctx context.Context, req CollectRequest) (Verdict, error)
+
+func (f PreCollectFunc) CheckCollect(ctx context.Context, req CollectRequest) (Verdict, error) {
+	return f(ctx, req)
+}
+
+// ErrPreCollectFailed wraps the error of a pre-collect check that could
+// not decide. The collection was not sent.
+var ErrPreCollectFailed = errors.New("pre-collect check failed")
+
+// RejectedError is returned by Collect when the pre-collect check rejected
+// the collection.
+type RejectedError struct {
+	ExternalReference string
+	Reason            string
+}
+
+func (e *RejectedError) Error() string {
+	if e.Reason == "" {
+		return "collection rejected by the pre-collect check"
+	}
+	return "collection rejected by the pre-collect check: " + e.Reason
+}
+
+// checkCollect runs the pre-collect hook, if any, on req. It returns the
+// verdict of a flagged collection, nil when it is approved.
+func (c *Client) checkCollect(ctx context.Context, req CollectRequest) (*Verdict, error) {
+	if c.opts.PreCollect == nil {
+		return nil, nil
+	}
+	v, err := c.opts.PreCollect.CheckCollect(ctx, req)
+	if err != nil {
+		return nil, fmt.Errorf("%w: %w", ErrPreCollectFailed, err)
+	}
+	switch v.Decision {
+	case DecisionApprove:
+		return nil, nil
+	case DecisionFlag:
+		return &v, nil
+	case DecisionReject:
+		return nil, &RejectedError{ExternalReference: req.ExternalReference, Reason: v.Reason}
+	}
+	return nil, fmt.Errorf("%w: unknown decision %q", ErrPreCollectFailed, v.Decision)
+}
+
+// HTTPPreCollect is a PreCollectHook that asks a service over HTTP. It
+// POSTs the pending collection as JSON:
+//
+//	{"type":"collect","amount":500,"currency":"XAF","from":"2376...","description":"...","external_reference":"...","operator":"MTN"}
+//
+// signed like relayed events when Secret is set (see VerifyRelaySignature),
+// and expects a 2xx answer holding a Verdict:
+//
+//	{"decision":"approve"|"reject"|"flag","reason":"..."}
+type HTTPPreCollect struct {
+	URL string
+	// Secret signs each request with RelaySignatureHeader and
+	// RelayTimestampHeader.
+	Secret string
+	// Doer sends the request (default http.DefaultClient).
+	Doer Doer
+	// Timeout bounds each check (default 5 seconds).
+	Timeout time.Duration
+	// FailOpen flags the collection, instead of failing it, when the
+	// service cannot be reached or gives no usable answer.
+	FailOpen bool
+}
+
+// pendingCollect is the body sent by HTTPPreCollect.
+type pendingCollect struct {
+	Type              string `json:"type"`
+	Amount            int    `json:"amount"`
+	Currency          string `json:"currency"`
+	From              string `json:"from"`
+	Description       string `json:"description"`
+	ExternalReference string `json:"external_reference"`
+	Operator          string `json:"operator,omitempty"`
+}
+
+func (h *HTTPPreCollect) CheckCollect(ctx context.Context, req CollectRequest) (Verdict, error) {
+	v, err := h.ask(ctx, req)
+	if err != nil && h.FailOpen {
+		return Verdict{Decision: DecisionFlag, Reason: "pre-collect check unavailable: " + err.Error()}, nil
+	}
+	return v, err
+}
+
+func (h *HTTPPreCollect) ask(ctx context.Context, req CollectRequest) (Verdict, error) {
+	timeout := h.Timeout
+	if timeout <= 0 {
+		timeout = 5 * time.Second
+	}
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	body, err := json.Marshal(pendingCollect{
+		Type:              "collect",
+		Amount:            req.Amount,
+		Currency:          req.Currency,
+		From:              req.From,
+		Description:       req.Description,
+		ExternalReference: req.ExternalReference,
+		Operator:          req.Operator,
+	})
+	if err != nil {
+		return Verdict{}, err
+	}
+	r, err := http.NewRequestWithContext(ctx, "POST", h.URL, bytes.NewReader(body))
+	if err != nil {
+		return Verdict{}, err
+	}
+	r.Header.Set("Content-Type", "application/json")
+	if h.Secret != "" {
+		now := time.Now()
+		r.Header.Set(RelayTimestampHeader, fmt.Sprint(now.Unix()))
+		r.Header.Set(RelaySignatureHeader, SignRelay(body, h.Secret, now))
+	}
+
+	var doer Doer = http.DefaultClient
+	if h.Doer != nil {
+		doer = h.Doer
+	}
+	resp, err := doer.Do(r)
+	if err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return Verdict{}, fmt.Errorf("no answer within %s", timeout)
+		}
+		return Verdict{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(io.LimitReader(resp.Body, 64<<10))
+	if err != nil {
+		return Verdict{}, err
+	}
+	if resp.StatusCode/100 != 2 {
+		return Verdict{}, fmt.Errorf("%s answered %s", h.URL, resp.Status)
+	}
+	var v Verdict
+	if err := json.Unmarshal(data, &v); err != nil {
+		return Verdict{}, fmt.Errorf("invalid answer from %s: %w", h.URL, err)
+	}
+	switch v.Decision {
+	case DecisionApprove, DecisionReject, DecisionFlag:
+		return v, nil
+	}
+	return Verdict{}, fmt.Errorf("invalid answer from %s: unknown decision %q", h.URL, v.Decision)
+}
@@ -0,0 +1,35 @@
+package campay
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrReadOnly is returned, wrapped, by every call that would move money on
+// a client made with Options.ReadOnly. Nothing was sent to CamPay.
+var ErrReadOnly = errors.New("read-only mode")
+
+// readOnly refuses the operation op on a read-only client.
+func (c *Client) readOnly(op string) error {
+	if !c.opts.ReadOnly {
+		return nil
+	}
+	return fmt.Errorf("%w: %s is refused", ErrReadOnly, op)
+}
+
+// readOnlyDo refuses the calls of Do that a read-only client cannot tell
+// are harmless: anything but a GET, or a POST to the token or history
+// endpoint. Endpoints this package does not know, such as airtime, may
+// move money, so they are refused rather than guessed at.
+func (c *Client) readOnlyDo(method, path string) error {
+	if !c.opts.ReadOnly {
+		return nil
+	}
+	switch {
+	case method == "GET" || method == "HEAD":
+		return nil
+	case method == "POST" && (path == c.endpoint("token") || path == c.endpoint("history")):
+		return nil
+	}
+	return fmt.Errorf("%w: %s %s is refused", ErrReadOnly, method, path)
+}
@@ -0,0 +1,68 @@
+package campay
+
+import (
+	"crypto/rand"
+	"encoding/binary"
+	"sync/atomic"
+	"time"
+)
+
+// RefGenerator produces external references for collections and payouts
+// sent without one. Implementations backed by a sequence service or a
+// database plug in through Options.RefGenerator.
+type RefGenerator interface {
+	NewRef() (string, error)
+}
+
+// RefGeneratorFunc adapts a function to RefGenerator.
+type RefGeneratorFunc func() (string, error)
+
+func (f RefGeneratorFunc) NewRef() (string, error) { return f() }
+
+// crockford is the ULID alphabet (Crockford's base32, without I L O U).
+const crockford = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+
+// refCounter is shared by every ULID generator, so references made in one
+// process never repeat, even within the same millisecond.
+var refCounter atomic.Uint32
+
+// ULID returns the default RefGenerator: 26-character ULIDs, which sort by
+// creation time. The last 24 bits of the random part are a process-wide
+// counter, so two references from the same process always differ.
+func ULID() RefGenerator {
+	return RefGeneratorFunc(func() (string, error) {
+		return newULID(time.Now())
+	})
+}
+
+func newULID(t time.Time) (string, error) {
+	var id [16]byte
+	ms := uint64(t.UnixMilli())
+	binary.BigEndian.PutUint16(id[0:2], uint16(ms>>32))
+	binary.BigEndian.PutUint32(id[2:6], uint32(ms))
+	if _, err := rand.Read(id[6:13]); err != nil {
+		return "", err
+	}
+	n := refCounter.Add(1)
+	id[13], id[14], id[15] = byte(n>>16), byte(n>>8), byte(n)
+
+	// 128 bits as 26 base32 digits, the first carrying 3 bits
+	hi := binary.BigEndian.Uint64(id[0:8])
+	lo := binary.BigEndian.Uint64(id[8:16])
+	var out [26]byte
+	for i := 25; i >= 0; i-- {
+		out[i] = crockford[lo&31]
+		lo = lo>>5 | hi<<59
+		hi >>= 5
+	}
+	return string(out[:]), nil
+}
+
+// NewRef returns a reference from the configured generator (ULID by
+// default).
+func (c *Client) NewRef() (string, error) {
+	if c.opts.RefGenerator != nil {
+		return c.opts.RefGenerator.NewRef()
+	}
+	return newULID(time.Now())
+}
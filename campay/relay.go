@@ -0,0 +1,65 @@
+package campay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of events relayed by the campay CLI (serve --forward, job
+// callbacks and plan notifications) to internal services.
+const (
+	RelaySignatureHeader = "X-Relay-Signature" // sha256=<hex HMAC of "<timestamp>.<body>">
+	RelayTimestampHeader = "X-Relay-Timestamp" // Unix seconds when the event was signed
+)
+
+var ErrInvalidRelaySignature = errors.New("invalid relay signature")
+
+// RelayTolerance is how far from the local clock a relay timestamp may be.
+// Older events are rejected, so that a captured delivery cannot be
+// replayed later. Retries are signed again, with a new timestamp.
+var RelayTolerance = 5 * time.Minute
+
+// SignRelay returns the X-Relay-Signature value of body signed at ts with
+// the secret of its destination.
+func SignRelay(body []byte, secret string, ts time.Time) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(ts.Unix(), 10) + "."))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifyRelaySignature checks that body, read from a request carrying
+// header, was relayed by the campay CLI with secret within RelayTolerance.
+// Consumers read the body first, then call it:
+//
+//	body, _ := io.ReadAll(r.Body)
+//	if err := campay.VerifyRelaySignature(r.Header, body, secret); err != nil {
+//		http.Error(w, err.Error(), http.StatusUnauthorized)
+//		return
+//	}
+func VerifyRelaySignature(header http.Header, body []byte, secret string) error {
+	if secret == "" {
+		return fmt.Errorf("relay secret is not configured")
+	}
+	secs, err := strconv.ParseInt(header.Get(RelayTimestampHeader), 10, 64)
+	if err != nil {
+		return fmt.Errorf("%w: missing or malformed %s", ErrInvalidRelaySignature, RelayTimestampHeader)
+	}
+	ts := time.Unix(secs, 0)
+	if d := time.Since(ts); d > RelayTolerance || d < -RelayTolerance {
+		return fmt.Errorf("%w: timestamp %s is too far from now (check the clocks if this repeats)",
+			ErrInvalidRelaySignature, ts.UTC().Format(time.RFC3339))
+	}
+	got := header.Get(RelaySignatureHeader)
+	if !strings.HasPrefix(got, "sha256=") || !hmac.Equal([]byte(got), []byte(SignRelay(body, secret, ts))) {
+		return ErrInvalidRelaySignature
+	}
+	return nil
+}
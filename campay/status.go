@@ -0,0 +1,218 @@
+package campay
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Status is the lifecycle state of a transaction.
+type Status string
+
+const (
+	StatusPending    Status = "PENDING"
+	StatusSuccessful Status = "SUCCESSFUL"
+	StatusFailed     Status = "FAILED"
+
+	// StatusExpired is sent by some flows when the customer did not approve
+	// the operator's prompt in time. No money moved.
+	StatusExpired Status = "EXPIRED"
+
+	// StatusReversed is sent when a successful transaction was undone by
+	// the operator, so the money went back.
+	StatusReversed Status = "REVERSED"
+
+	// StatusCancelledLocal marks a transaction abandoned on the client
+	// side. CamPay may still complete it, so a final API status replaces it.
+	StatusCancelledLocal Status = "CANCELLED_LOCAL"
+
+	// StatusExpiredLocal marks a transaction the customer did not confirm
+	// before the client's deadline. Like StatusCancelledLocal it is only a
+	// local verdict and a final API status replaces it.
+	StatusExpiredLocal Status = "EXPIRED_LOCAL"
+
+	// StatusUnknown is any value CamPay sends that this package does not
+	// recognize. What it means is up to StatusPolicy.Unknown; by default it
+	// is not final.
+	StatusUnknown Status = "UNKNOWN"
+)
+
+var ErrInvalidTransition = errors.New("invalid status transition")
+
+// builtinStatuses are the statuses ParseStatus recognizes.
+var builtinStatuses = []Status{
+	StatusPending, StatusSuccessful, StatusFailed, StatusExpired, StatusReversed,
+	StatusCancelledLocal, StatusExpiredLocal,
+}
+
+// UnknownPolicy is what a StatusPolicy does with a status it does not
+// recognize.
+type UnknownPolicy string
+
+const (
+	// UnknownWait reads it as UNKNOWN, which is not final: pollers keep
+	// checking until their deadline. This is the default.
+	UnknownWait UnknownPolicy = "wait"
+	// UnknownStop reads it as UNKNOWN too, but tells pollers to stop at
+	// once and leave the transaction to a later check or webhook.
+	UnknownStop UnknownPolicy = "stop"
+	// UnknownFail keeps the status as sent and makes it final, without
+	// success.
+	UnknownFail UnknownPolicy = "fail"
+)
+
+// StatusPolicy decides how status strings from the API are read, for
+// flows that send statuses this package does not know. The zero value is
+// the package's own behavior, used by ParseStatus, Status.Terminal and
+// Transition. A policy must not be changed while it is in use.
+type StatusPolicy struct {
+	// Aliases maps API values (matched case-insensitively) to a built-in
+	// or Terminal status, e.g. "CANCELED" to FAILED.
+	Aliases map[string]Status `json:"aliases,omitempty"`
+
+	// Terminal lists further final statuses, kept as sent, e.g.
+	// "CHARGEBACK". None of them is a success.
+	Terminal []Status `json:"terminal,omitempty"`
+
+	// Retryable lists the final statuses whose payment may be sent again
+	// under a new reference (default FAILED and EXPIRED). Abandoned
+	// transactions are always retryable.
+	Retryable []Status `json:"retryable,omitempty"`
+
+	// Unknown is what happens to any other status (default UnknownWait).
+	Unknown UnknownPolicy `json:"unknown,omitempty"`
+}
+
+// Validate checks that aliases point to known statuses and that retryable
+// statuses are final.
+func (p *StatusPolicy) Validate() error {
+	for from, to := range p.Aliases {
+		if to == StatusUnknown || (!slices.Contains(builtinStatuses, to) && !slices.Contains(p.Terminal, to)) {
+			return fmt.Errorf("alias %s: %q is neither a built-in nor a terminal status", from, to)
+		}
+	}
+	for _, s := range p.Terminal {
+		if slices.Contains(builtinStatuses, s) || s == StatusUnknown || s == "" {
+			return fmt.Errorf("terminal: %q is a built-in status", s)
+		}
+	}
+	for _, s := range p.Retryable {
+		if !p.IsTerminal(s) {
+			return fmt.Errorf("retryable: %q is not a final status", s)
+		}
+	}
+	switch p.Unknown {
+	case "", UnknownWait, UnknownStop, UnknownFail:
+		return nil
+	}
+	return fmt.Errorf("unknown: %q is not wait, stop or fail", p.Unknown)
+}
+
+// Parse normalizes an API status string.
+func (p *StatusPolicy) Parse(s string) Status {
+	st := Status(strings.ToUpper(strings.TrimSpace(s)))
+	for alias, to := range p.Aliases {
+		if strings.EqualFold(alias, string(st)) {
+			return to
+		}
+	}
+	switch {
+	case slices.Contains(builtinStatuses, st), slices.Contains(p.Terminal, st):
+		return st
+	case p.Unknown == UnknownFail && st != "" && st != StatusUnknown:
+		return st
+	}
+	return StatusUnknown
+}
+
+// known reports whether s is built in or listed by p.
+func (p *StatusPolicy) known(s Status) bool {
+	return s == StatusUnknown || slices.Contains(builtinStatuses, s) || slices.Contains(p.Terminal, s)
+}
+
+// IsTerminal reports whether CamPay will never change s again.
+func (p *StatusPolicy) IsTerminal(s Status) bool {
+	switch s {
+	case StatusSuccessful, StatusFailed, StatusExpired, StatusReversed:
+		return true
+	}
+	if slices.Contains(p.Terminal, s) {
+		return true
+	}
+	return p.Unknown == UnknownFail && s != "" && !p.known(s)
+}
+
+// IsRetryable reports whether a transaction in s may be sent again.
+func (p *StatusPolicy) IsRetryable(s Status) bool {
+	if s.Abandoned() {
+		return true
+	}
+	if p.Retryable == nil {
+		return s == StatusFailed || s == StatusExpired
+	}
+	return slices.Contains(p.Retryable, s)
+}
+
+// StopOnUnknown reports whether pollers should stop at an UNKNOWN answer.
+func (p *StatusPolicy) StopOnUnknown() bool {
+	return p.Unknown == UnknownStop
+}
+
+// defaultPolicy is the zero policy behind the package-level functions.
+var defaultPolicy StatusPolicy
+
+// ParseStatus normalizes an API status string.
+func ParseStatus(s string) Status {
+	return defaultPolicy.Parse(s)
+}
+
+// Terminal reports whether CamPay will never change the status again,
+// under the default policy.
+func (s Status) Terminal() bool {
+	return defaultPolicy.IsTerminal(s)
+}
+
+// Abandoned reports whether the client gave up on the transaction.
+func (s Status) Abandoned() bool {
+	return s == StatusCancelledLocal || s == StatusExpiredLocal
+}
+
+// allowedTransitions lists the legal next states besides terminal ones
+// (see Transition). The empty status is a transaction not seen before.
+var allowedTransitions = map[Status][]Status{
+	"":                 {StatusPending, StatusUnknown},
+	StatusPending:      {StatusCancelledLocal, StatusExpiredLocal, StatusUnknown},
+	StatusUnknown:      {StatusPending, StatusCancelledLocal, StatusExpiredLocal},
+	StatusExpiredLocal: {StatusCancelledLocal},
+	StatusSuccessful:   {StatusReversed},
+}
+
+// Transition returns the state a transaction in from moves to when to is
+// observed, under the default policy. Repeating the current state is
+// allowed. A non-final status arriving after the transaction was finished
+// or cancelled is a stale observation and leaves from unchanged.
+// Contradicting a final status (e.g. SUCCESSFUL then FAILED) returns
+// ErrInvalidTransition; only SUCCESSFUL may still become REVERSED.
+func Transition(from, to Status) (Status, error) {
+	return defaultPolicy.Transition(from, to)
+}
+
+// Transition is the package-level Transition with the final statuses of p.
+func (p *StatusPolicy) Transition(from, to Status) (Status, error) {
+	if from == to {
+		return to, nil
+	}
+	if slices.Contains(allowedTransitions[from], to) {
+		return to, nil
+	}
+	// Any final status ends a transaction that was not final yet
+	if p.IsTerminal(to) && !p.IsTerminal(from) {
+		return to, nil
+	}
+	// Non-final statuses, and the success a reversal undid, are stale
+	if !p.IsTerminal(to) || (from == StatusReversed && to == StatusSuccessful) {
+		return from, nil
+	}
+	return from, fmt.Errorf("%w: %s → %s", ErrInvalidTransition, from, to)
+}
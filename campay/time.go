@@ -0,0 +1,74 @@
+package campay
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// NaiveTimeLocation is the zone assumed for API timestamps that carry no
+// offset, such as "2026-01-31 14:05:09". Set it before using the package;
+// it is read without locking.
+var NaiveTimeLocation = time.UTC
+
+// timeLayouts are the timestamp formats seen in API responses, most
+// specific first. Layouts without an offset are read in NaiveTimeLocation.
+var timeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05.999999999",
+	"2006-01-02 15:04:05.999999999Z07:00",
+	"2006-01-02 15:04:05.999999999",
+	"2006-01-02T15:04",
+	"2006-01-02 15:04",
+	"02/01/2006 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime reads an API timestamp in any of the formats CamPay uses, or a
+// Unix time in seconds or milliseconds, and returns it in UTC. Convert to
+// local time only for display.
+func ParseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return time.Time{}, fmt.Errorf("empty timestamp")
+	}
+	if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+		if n > 1e12 {
+			return time.UnixMilli(n).UTC(), nil
+		}
+		return time.Unix(n, 0).UTC(), nil
+	}
+	for _, layout := range timeLayouts {
+		if t, err := time.ParseInLocation(layout, s, NaiveTimeLocation); err == nil {
+			return t.UTC(), nil
+		}
+	}
+	return time.Time{}, fmt.Errorf("unrecognized timestamp %q", s)
+}
+
+// Time returns when the transaction happened, in UTC.
+func (h HistoryItem) Time() (time.Time, error) {
+	return ParseTime(h.Datetime)
+}
+
+// ClockSkew returns how far the local clock is ahead of the server's
+// (negative when behind), measured from the Date header of the last
+// response, and whether any response carried one yet.
+func (c *Client) ClockSkew() (time.Duration, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.skew, c.haveSkew
+}
+
+// observeDate records the clock skew from a response's Date header.
+func (c *Client) observeDate(header string) {
+	serverTime, err := http.ParseTime(header)
+	if err != nil {
+		return
+	}
+	c.mu.Lock()
+	c.skew, c.haveSkew = time.Since(serverTime), true
+	c.mu.Unlock()
+}
@@ -0,0 +1,168 @@
+package campay
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+	"unicode/utf8"
+)
+
+// Requests are checked before they are sent, so a caller learns about
+// every problem of a request at once instead of one API rejection at a
+// time. The rules follow what CamPay accepts.
+const (
+	// MaxDescriptionLength is the longest description, in characters.
+	MaxDescriptionLength = 255
+	// MaxExternalReferenceLength is the longest external reference.
+	MaxExternalReferenceLength = 100
+)
+
+// allowedCurrencies are the currencies CamPay accepts.
+var allowedCurrencies = []string{"XAF"}
+
+// AllowedCurrencies returns the currencies CamPay accepts.
+func AllowedCurrencies() []string {
+	return slices.Clone(allowedCurrencies)
+}
+
+var (
+	// externalRefPattern allows letters, digits and - _ . : / #, starting
+	// with a letter or digit.
+	externalRefPattern = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.:/#-]*$`)
+	// phonePattern is a Cameroonian mobile number in international form.
+	phonePattern = regexp.MustCompile(`^2376[0-9]{8}$`)
+)
+
+// FieldError is one problem with one field of a request.
+type FieldError struct {
+	Field   string // JSON name of the field
+	Problem string
+}
+
+func (e *FieldError) Error() string {
+	return e.Field + ": " + e.Problem
+}
+
+// ValidationError lists every problem found in a request, which was
+// therefore not sent. Each problem is a *FieldError, also found by
+// errors.As.
+type ValidationError struct {
+	Op       string // collect or withdraw
+	Problems []*FieldError
+}
+
+func (e *ValidationError) Error() string {
+	parts := make([]string, len(e.Problems))
+	for i, p := range e.Problems {
+		parts[i] = p.Error()
+	}
+	return fmt.Sprintf("invalid %s request: %s", e.Op, strings.Join(parts, "; "))
+}
+
+func (e *ValidationError) Unwrap() []error {
+	errs := make([]error, len(e.Problems))
+	for i, p := range e.Problems {
+		errs[i] = p
+	}
+	return errs
+}
+
+// AmountRange bounds the amount of a single request. Zero fields are not
+// checked.
+type AmountRange struct {
+	Min int
+	Max int
+}
+
+// validator collects the problems of one request.
+type validator struct {
+	op       string
+	problems []*FieldError
+}
+
+func (v *validator) add(field, format string, args ...any) {
+	v.problems = append(v.problems, &FieldError{Field: field, Problem: fmt.Sprintf(format, args...)})
+}
+
+func (v *validator) amount(amount int, limits AmountRange) {
+	switch {
+	case amount <= 0:
+		v.add("amount", "must be greater than 0, got %d", amount)
+	case limits.Min > 0 && amount < limits.Min:
+		v.add("amount", "%d is below the minimum of %d", amount, limits.Min)
+	case limits.Max > 0 && amount > limits.Max:
+		v.add("amount", "%d is above the maximum of %d", amount, limits.Max)
+	}
+}
+
+func (v *validator) currency(currency string) {
+	if !slices.Contains(allowedCurrencies, currency) {
+		v.add("currency", "%q is not accepted (use %s)", currency, strings.Join(allowedCurrencies, " or "))
+	}
+}
+
+func (v *validator) phone(field, phone string) {
+	if !phonePattern.MatchString(phone) {
+		v.add(field, "%q is not a Cameroonian mobile number (2376 followed by 8 digits)", phone)
+	}
+}
+
+func (v *validator) description(description string) {
+	switch n := utf8.RuneCountInString(description); {
+	case strings.TrimSpace(description) == "":
+		v.add("description", "is required")
+	case n > MaxDescriptionLength:
+		v.add("description", "is %d characters long, at most %d are accepted", n, MaxDescriptionLength)
+	}
+}
+
+// externalReference accepts an empty reference, which the client
+// generates before sending.
+func (v *validator) externalReference(ref string) {
+	switch {
+	case ref == "":
+	case len(ref) > MaxExternalReferenceLength:
+		v.add("external_reference", "is %d characters long, at most %d are accepted", len(ref), MaxExternalReferenceLength)
+	case !externalRefPattern.MatchString(ref):
+		v.add("external_reference", "%q may only hold letters, digits and - _ . : / #, starting with a letter or digit", ref)
+	}
+}
+
+func (v *validator) operator(operator string) {
+	if operator != "" && operator != "MTN" && operator != "ORANGE" {
+		v.add("operator", "%q is not MTN or ORANGE", operator)
+	}
+}
+
+func (v *validator) err() error {
+	if len(v.problems) == 0 {
+		return nil
+	}
+	return &ValidationError{Op: v.op, Problems: v.problems}
+}
+
+// Validate checks the request against CamPay's rules and the given amount
+// limits, returning a *ValidationError with every problem found.
+func (r CollectRequest) Validate(limits AmountRange) error {
+	v := &validator{op: "collect"}
+	v.amount(r.Amount, limits)
+	v.currency(r.Currency)
+	v.phone("from", r.From)
+	v.description(r.Description)
+	v.externalReference(r.ExternalReference)
+	v.operator(r.Operator)
+	return v.err()
+}
+
+// Validate checks the request like CollectRequest.Validate.
+func (r WithdrawRequest) Validate(limits AmountRange) error {
+	v := &validator{op: "withdraw"}
+	v.amount(r.Amount, limits)
+	v.currency(r.Currency)
+	v.phone("to", r.To)
+	v.description(r.Description)
+	v.externalReference(r.ExternalReference)
+	v.operator(r.Operator)
+	return v.err()
+}
@@ -0,0 +1,286 @@
+package campay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// WebhookEvent is the payment notification CamPay sends to the app's
+// webhook URL once a transaction reaches a final status.
+type WebhookEvent struct {
+	Reference         string `json:"reference"`
+	ExternalReference string `json:"external_reference"`
+	Status            string `json:"status"`
+	Amount            string `json:"amount"`
+	Currency          string `json:"currency"`
+	Operator          string `json:"operator"`
+	Code              string `json:"code"`
+	OperatorReference string `json:"operator_reference"`
+	PhoneNumber       string `json:"phone_number"`
+	Endpoint          string `json:"endpoint"`
+	Signature         string `json:"signature"`
+
+	// PreviousKey is set when the signature matched one of the previous
+	// keys given to ParseWebhook rather than the current one.
+	PreviousKey bool `json:"-"`
+}
+
+var ErrInvalidSignature = errors.New("invalid webhook signature")
+
+// ParseWebhook reads a CamPay callback from the query string (GET), or the
+// form or JSON body (POST), and verifies its signature with the app's
+// webhook key. During a key rotation, pass the keys being replaced as
+// previousKeys: callbacks signed with them are still accepted.
+func ParseWebhook(r *http.Request, webhookKey string, previousKeys ...string) (*WebhookEvent, error) {
+	get, err := webhookFields(r)
+	if err != nil {
+		return nil, err
+	}
+
+	ev := &WebhookEvent{
+		Reference:         get("reference"),
+		ExternalReference: get("external_reference"),
+		Status:            get("status"),
+		Amount:            get("amount"),
+		Currency:          get("currency"),
+		Operator:          get("operator"),
+		Code:              get("code"),
+		OperatorReference: get("operator_reference"),
+		PhoneNumber:       get("phone_number"),
+		Endpoint:          get("endpoint"),
+		Signature:         get("signature"),
+	}
+	if ev.Reference == "" || ev.Status == "" {
+		return nil, fmt.Errorf("webhook is missing reference or status")
+	}
+
+	err = VerifySignature(ev.Signature, webhookKey)
+	for _, key := range previousKeys {
+		// Only a signature that does not match is tried again; an expired
+		// one stays rejected
+		if err != ErrInvalidSignature || key == "" {
+			continue
+		}
+		if err = VerifySignature(ev.Signature, key); err == nil {
+			ev.PreviousKey = true
+		}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return ev, nil
+}
+
+// webhookFields returns a getter of the callback's fields. A JSON body may
+// hold numbers (the amount) where a form has text; a field missing from it
+// is looked up in the query string.
+func webhookFields(r *http.Request) (func(string) string, error) {
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Method != http.MethodPost || mediaType != "application/json" {
+		if err := r.ParseForm(); err != nil {
+			return nil, err
+		}
+		return r.Form.Get, nil
+	}
+
+	var fields map[string]any
+	dec := json.NewDecoder(http.MaxBytesReader(nil, r.Body, 1<<20))
+	dec.UseNumber()
+	if err := dec.Decode(&fields); err != nil {
+		return nil, fmt.Errorf("webhook body is not a JSON object: %w", err)
+	}
+	query := r.URL.Query()
+	return func(name string) string {
+		switch v := fields[name].(type) {
+		case nil:
+			return query.Get(name)
+		case string:
+			return v
+		default:
+			return fmt.Sprint(v)
+		}
+	}, nil
+}
+
+// SignatureLeeway is how long past its exp claim a webhook signature is
+// still accepted, to absorb small clock differences with CamPay. Like
+// NaiveTimeLocation, it may only be changed before the package is used.
+var SignatureLeeway = time.Minute
+
+// VerifySignature checks that signature is an HS256 JWT signed with
+// webhookKey and, if it carries an exp claim, that it has not expired.
+func VerifySignature(signature, webhookKey string) error {
+	if webhookKey == "" {
+		return fmt.Errorf("webhook key is not configured")
+	}
+
+	parts := strings.Split(signature, ".")
+	if len(parts) != 3 {
+		return ErrInvalidSignature
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil || header.Alg != "HS256" {
+		return ErrInvalidSignature
+	}
+
+	mac := hmac.New(sha256.New, []byte(webhookKey))
+	mac.Write([]byte(parts[0] + "." + parts[1]))
+	got, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil || !hmac.Equal(got, mac.Sum(nil)) {
+		return ErrInvalidSignature
+	}
+
+	var claims struct {
+		Exp int64 `json:"exp"`
+	}
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return ErrInvalidSignature
+	}
+	if claims.Exp != 0 && time.Now().Add(-SignatureLeeway).Unix() > claims.Exp {
+		return fmt.Errorf("%w: token expired (check the local clock if this repeats)", ErrInvalidSignature)
+	}
+	return nil
+}
+
+func decodeSegment(seg string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(seg)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
+
+// WebhookDedupWindow is how long a WebhookHandler remembers the callbacks it
+// handled, to acknowledge CamPay's retries of them without handling them
+// again. Like SignatureLeeway, it may only be changed before the package
+// is used.
+var WebhookDedupWindow = 24 * time.Hour
+
+// WebhookHandler returns an http.Handler for the app's webhook URL, to
+// mount in any net/http compatible router:
+//
+//	http.Handle("/webhook", campay.WebhookHandler(webhookKey, func(ev campay.WebhookEvent) error {
+//		return orders.MarkPaid(ev.ExternalReference, ev.Status)
+//	}))
+//
+// It parses and verifies each callback like ParseWebhook (previousKeys
+// during a key rotation), and calls handle once per reference and status:
+// a callback CamPay sends again is answered 200 without calling handle.
+// Callbacks it rejects are answered 400, or 401 for a bad signature. When
+// handle returns an error or panics, the answer is 500 and the callback is
+// handled again when CamPay retries it; the error itself is not sent to
+// CamPay.
+// Callbacks are remembered in memory for WebhookDedupWindow, so replicas
+// behind a load balancer, or a restart, may still call handle twice for
+// the same callback.
+func WebhookHandler(webhookKey string, handle func(WebhookEvent) error, previousKeys ...string) http.Handler {
+	return &webhookHandler{key: webhookKey, previous: previousKeys, handle: handle, seen: map[string]time.Time{}}
+}
+
+type webhookHandler struct {
+	key      string
+	previous []string
+	handle   func(WebhookEvent) error
+
+	mu     sync.Mutex
+	seen   map[string]time.Time // when each reference and status was handled; zero while being handled
+	pruned time.Time
+}
+
+func (h *webhookHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ev, err := ParseWebhook(r, h.key, h.previous...)
+	if err != nil {
+		status := http.StatusBadRequest
+		if errors.Is(err, ErrInvalidSignature) {
+			status = http.StatusUnauthorized
+		}
+		http.Error(w, err.Error(), status)
+		return
+	}
+
+	id := ev.Reference + " " + strings.ToUpper(ev.Status)
+	switch h.claim(id) {
+	case webhookHandled:
+		w.WriteHeader(http.StatusOK)
+		return
+	case webhookInProgress:
+		// The first delivery may still fail; CamPay retries this one
+		w.Header().Set("Retry-After", "5")
+		http.Error(w, "webhook is being handled", http.StatusServiceUnavailable)
+		return
+	}
+
+	handled := false
+	defer func() { h.release(id, handled) }()
+	if err := h.call(*ev); err != nil {
+		http.Error(w, "webhook not handled", http.StatusInternalServerError)
+		return
+	}
+	handled = true
+	w.WriteHeader(http.StatusOK)
+}
+
+// call runs handle, turning a panic into an error so that the callback is
+// released and retried like one handle failed.
+func (h *webhookHandler) call(ev WebhookEvent) (err error) {
+	defer func() {
+		if p := recover(); p != nil {
+			err = fmt.Errorf("webhook handler panicked: %v", p)
+		}
+	}()
+	return h.handle(ev)
+}
+
+const (
+	webhookNew = iota
+	webhookInProgress
+	webhookHandled
+)
+
+// claim marks a callback as being handled, unless it was already.
+func (h *webhookHandler) claim(id string) int {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	now := time.Now()
+	if now.Sub(h.pruned) > time.Minute {
+		for k, at := range h.seen {
+			if !at.IsZero() && now.Sub(at) > WebhookDedupWindow {
+				delete(h.seen, k)
+			}
+		}
+		h.pruned = now
+	}
+	at, ok := h.seen[id]
+	switch {
+	case !ok:
+		h.seen[id] = time.Time{}
+		return webhookNew
+	case at.IsZero():
+		return webhookInProgress
+	}
+	return webhookHandled
+}
+
+// release records the outcome of handling a claimed callback: remembered
+// when handled, forgotten otherwise so that CamPay's retry is handled.
+func (h *webhookHandler) release(id string, handled bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if handled {
+		h.seen[id] = time.Now()
+	} else {
+		delete(h.seen, id)
+	}
+}
@@ -0,0 +1,50 @@
+package campay
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+// signWebhook signs a callback like CamPay, with no expiry.
+func signWebhook(key string) string {
+	enc := base64.RawURLEncoding
+	unsigned := enc.EncodeToString([]byte(`{"alg":"HS256","typ":"JWT"}`)) + "." + enc.EncodeToString([]byte(`{}`))
+	mac := hmac.New(sha256.New, []byte(key))
+	mac.Write([]byte(unsigned))
+	return unsigned + "." + enc.EncodeToString(mac.Sum(nil))
+}
+
+func TestWebhookHandlerRetriesAfterPanic(t *testing.T) {
+	calls := 0
+	h := WebhookHandler("key", func(ev WebhookEvent) error {
+		calls++
+		if calls == 1 {
+			panic("database gone")
+		}
+		return nil
+	})
+	form := url.Values{"reference": {"ref-1"}, "status": {"SUCCESSFUL"}, "signature": {signWebhook("key")}}
+	deliver := func() int {
+		r := httptest.NewRequest(http.MethodPost, "/webhook", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	// A panic fails the delivery instead of leaving it in progress
+	for i, want := range []int{http.StatusInternalServerError, http.StatusOK, http.StatusOK} {
+		if got := deliver(); got != want {
+			t.Fatalf("delivery %d answered %d, want %d", i+1, got, want)
+		}
+	}
+	if calls != 2 {
+		t.Fatalf("handle called %d times, want 2", calls)
+	}
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== CANCEL ===========================
+   ============================================================ */
+
+// cancelOptions are the flags of cancel.
+type cancelOptions struct {
+	reason string
+}
+
+// cancelFlags defines the flags of cancel on fs.
+func cancelFlags(fs *flag.FlagSet, cfg *Config) *cancelOptions {
+	opt := &cancelOptions{}
+	fs.StringVar(&opt.reason, "reason", "abandoned by operator", "why the transaction is being cancelled")
+	return opt
+}
+
+// runCancel abandons a pending transaction locally. CamPay offers no
+// cancellation endpoint for collections, so the customer can still
+// approve the USSD prompt; the ledger records why we stopped waiting and
+// any poller watching the reference gives up.
+func runCancel(cfg *Config, args []string) error {
+	fs := newFlagSet("cancel")
+	opt := cancelFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() != 1 {
+		return invalidInput("usage: campay cancel [--reason text] <reference>")
+	}
+	reference := fs.Arg(0)
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	e, err := ledger.MarkAbandoned(reference, campay.StatusCancelledLocal, opt.reason)
+	if err != nil {
+		return err
+	}
+	auditMoney(cfg, "cancel", opt.reason, *e)
+
+	fmt.Printf("✓ %s marked %s (%s)\n", reference, campay.StatusCancelledLocal, opt.reason)
+	fmt.Println("Note: CamPay has no cancellation endpoint; the customer may still confirm the payment.")
+	return nil
+}
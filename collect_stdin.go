@@ -0,0 +1,227 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= COLLECT STDIN =======================
+   ============================================================ */
+
+// stdinRequest is one line of `collect --stdin` input. Amount may be a
+// number or a string such as "5k".
+type stdinRequest struct {
+	Phone             string          `json:"phone"`
+	Amount            json.RawMessage `json:"amount"`
+	Description       string          `json:"description"`
+	ExternalReference string          `json:"external_reference"`
+	Campaign          string          `json:"campaign"`
+}
+
+// stdinResult is written to stdout, one line per request.
+type stdinResult struct {
+	Line              int    `json:"line"`
+	ExternalReference string `json:"external_reference,omitempty"`
+	Reference         string `json:"reference,omitempty"`
+	Status            string `json:"status,omitempty"`
+	Operator          string `json:"operator,omitempty"`
+	USSDCode          string `json:"ussd_code,omitempty"` // to dial if no prompt appears
+	DialURI           string `json:"dial_uri,omitempty"`  // tel: link of USSDCode
+	Warning           string `json:"warning,omitempty"`   // the operator looks down, see outage.go
+	Error             string `json:"error,omitempty"`
+	Code              int    `json:"code"`
+}
+
+// runCollectStdin reads JSON lines from stdin and emits one JSON result per
+// request. Progress and warnings go to stderr so stdout stays parseable.
+func runCollectStdin(cfg *Config, concurrency int, force bool) error {
+	results := json.NewEncoder(resultOut)
+	os.Stdout = os.Stderr
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	provider, err := connectProvider(cfg)
+	if err != nil {
+		return err
+	}
+	risk, err := newRiskCheck(cfg.Risk, ledger, "collect")
+	if err != nil {
+		return err
+	}
+	refs, err := newRefAllocator(cfg, ledger)
+	if err != nil {
+		return err
+	}
+
+	type job struct {
+		line int
+		data []byte
+	}
+	jobs := make(chan job)
+	var outMu sync.Mutex
+	failed := 0
+
+	var wg sync.WaitGroup
+	for w := 0; w < concurrency; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := range jobs {
+				res := collectLine(cfg, provider, ledger, risk, refs, force, j.line, j.data)
+				outMu.Lock()
+				if res.Code != exitOK {
+					failed++
+				}
+				results.Encode(res)
+				outMu.Unlock()
+			}
+		}()
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		data := []byte(strings.TrimSpace(scanner.Text()))
+		if len(data) == 0 {
+			continue
+		}
+		jobs <- job{line: line, data: data}
+	}
+	close(jobs)
+	wg.Wait()
+
+	if err := scanner.Err(); err != nil && !errors.Is(err, io.EOF) {
+		return err
+	}
+	if failed > 0 {
+		return exitErr(exitPaymentFailed, fmt.Errorf("%d of the requests did not succeed", failed))
+	}
+	return nil
+}
+
+// collectLine runs one request to its final status.
+func collectLine(cfg *Config, provider Provider, ledger *Ledger, risk *riskCheck, refs *refAllocator, force bool, line int, data []byte) stdinResult {
+	res := stdinResult{Line: line}
+	fail := func(err error) stdinResult {
+		res.Error = err.Error()
+		res.Code = exitCode(err)
+		return res
+	}
+
+	var req stdinRequest
+	if err := json.Unmarshal(data, &req); err != nil {
+		return fail(invalidInput("invalid JSON: %v", err))
+	}
+	res.ExternalReference = req.ExternalReference
+
+	phone, err := resolvePhone(req.Phone)
+	if err != nil {
+		return fail(err)
+	}
+	var amountText string
+	if err := json.Unmarshal(req.Amount, &amountText); err != nil {
+		amountText = string(req.Amount)
+	}
+	amount, err := parseAmount(amountText)
+	if err != nil {
+		return fail(err)
+	}
+	operator, _, err := knownOperator(cfg, ledger, phone)
+	if err != nil {
+		return fail(err)
+	}
+	if err := checkLimitsFor(cfg.OperatorLimits, operator, amount); err != nil {
+		return fail(err)
+	}
+	if operator != "" {
+		if h := outageFor(cfg, ledger, operator); h != nil {
+			res.Warning = outageMessage(*h, cfg.Outage.window)
+		}
+	}
+	if err := risk.Enforce(phone, amount, force); err != nil {
+		return fail(err)
+	}
+
+	if req.ExternalReference == "" {
+		if req.ExternalReference, err = refs.Generate("TXN"); err != nil {
+			return fail(err)
+		}
+		res.ExternalReference = req.ExternalReference
+	} else if err := refs.Check(req.ExternalReference); err != nil {
+		return fail(err)
+	}
+	if req.Description == "" {
+		req.Description = "Payment"
+	}
+	if req.Campaign != "" {
+		if _, err := lookupCampaign(req.Campaign); err != nil {
+			return fail(err)
+		}
+	}
+
+	audited := LedgerEntry{ExternalReference: req.ExternalReference, Phone: phone, Amount: amount}
+	if err := auditMoney(cfg, "collect", auditRequested, audited); err != nil {
+		return fail(err)
+	}
+	collectResp, err := submitCollect(provider, campay.CollectRequest{
+		Amount:            amount,
+		Currency:          "XAF",
+		From:              phone,
+		Description:       req.Description,
+		ExternalReference: req.ExternalReference,
+		Operator:          sentOperator(phone, operator),
+	})
+	if err != nil {
+		auditMoney(cfg, "collect", "error: "+err.Error(), audited)
+		return fail(err)
+	}
+	reference := collectResp.Reference
+	res.Reference, res.USSDCode, res.DialURI = reference, collectResp.DialCode(), collectResp.DialURI()
+	audited.Reference = reference
+	auditMoney(cfg, "collect", auditInitiated, audited)
+
+	recordLedger(ledger, LedgerEntry{
+		Reference:         reference,
+		ExternalReference: req.ExternalReference,
+		Kind:              "collect",
+		Phone:             phone,
+		Amount:            amount,
+		Currency:          "XAF",
+		Description:       req.Description,
+		Status:            campay.StatusPending,
+		Environment:       cfg.Env,
+		Campaign:          req.Campaign,
+		DialCode:          res.USSDCode,
+		Review:            reviewReason(collectResp),
+	})
+
+	status, err := pollTransactionStatus(provider, ledger, reference, cfg.Deadline, nil)
+	if err != nil {
+		auditMoney(cfg, "collect", "error: "+err.Error(), audited)
+		return fail(err)
+	}
+	if err := ledger.UpdateStatus(reference, parseStatus(status.Status), status.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	auditMoney(cfg, "collect", string(parseStatus(status.Status)), audited)
+
+	res.Status = string(parseStatus(status.Status))
+	res.Operator = status.Operator
+	if unsuccessful(parseStatus(status.Status)) {
+		res.Code = exitPaymentFailed
+	}
+	return res
+}
@@ -0,0 +1,417 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"strings"
+)
+
+/* ============================================================
+   ======================== COMPLETION =========================
+   ============================================================ */
+
+// Completion is worked out by campay itself. The script printed by
+// `campay completion <shell>` hands the words typed so far to the hidden
+// `campay __complete` command, which prints one candidate per line, with
+// its description after a tab, or ":files" to let the shell complete a
+// path. Commands and subcommands come from the commands table, their
+// flags from the functions declaring them (see describeFlags), and values
+// from the data directory: profile names, ledger references and contact
+// aliases.
+
+const completeCommand = "__complete"
+
+// argKind is what a positional argument or a flag value is.
+type argKind string
+
+const (
+	argNone      argKind = ""
+	argReference argKind = "reference"
+	argContact   argKind = "contact"
+	argProfile   argKind = "profile"
+	argFile      argKind = "file"
+	argCommand   argKind = "command"
+)
+
+// subcommand is a word after a command that selects what it does.
+type subcommand struct {
+	Name  string
+	Args  argKind
+	Flags func(cfg *Config) *flag.FlagSet
+}
+
+// flagValues is what the values of flags are, by flag name.
+var flagValues = map[string]argKind{
+	"profile":   argProfile,
+	"from":      argProfile, // transfer
+	"to":        argProfile,
+	"phone":     argContact,
+	"via":       argContact,
+	"refund-of": argReference,
+	"out":       argFile,
+	"dir":       argFile,
+	"template":  argFile,
+	"payers":    argFile,
+	"payouts":   argFile,
+	"cassette":  argFile,
+	"log":       argFile,
+	"record":    argFile,
+	"replay":    argFile,
+	"socket":    argFile,
+	"ca-cert":   argFile,
+}
+
+func init() {
+	// Registered here since both read the table themselves
+	commands = append(commands,
+		command{Name: "completion", Summary: "Print the shell completion script (bash, zsh, fish or powershell)", Run: runCompletion,
+			Sub: []subcommand{{Name: "bash"}, {Name: "zsh"}, {Name: "fish"}, {Name: "powershell"}}},
+		command{Name: "man", Summary: "Write man pages for campay and each command (--dir), or print one", Run: runMan, Flags: flagsOf("man", manPageFlags), Args: argCommand},
+	)
+}
+
+// describeFlags lists the flags of a command, or of one of its
+// subcommands, against default settings. They come from the function that
+// declares them for Run, so nothing of the command runs.
+func describeFlags(c command, sub *subcommand) (flags []*flag.Flag) {
+	declared := c.Flags
+	if sub != nil {
+		declared = sub.Flags
+	}
+	if declared == nil {
+		return nil
+	}
+
+	cfg := &Config{file: &FileConfig{}}
+	globalFlags(cfg)
+	declared(cfg).VisitAll(func(f *flag.Flag) {
+		flags = append(flags, f)
+	})
+	return flags
+}
+
+// findCommand returns the command named name, or nil.
+func findCommand(name string) *command {
+	for i := range commands {
+		if commands[i].Name == name {
+			return &commands[i]
+		}
+	}
+	return nil
+}
+
+func (c *command) findSub(name string) *subcommand {
+	for i := range c.Sub {
+		if c.Sub[i].Name == name {
+			return &c.Sub[i]
+		}
+	}
+	return nil
+}
+
+// takesValue reports whether f reads the next word as its value.
+func takesValue(f *flag.Flag) bool {
+	b, ok := f.Value.(interface{ IsBoolFlag() bool })
+	return !ok || !b.IsBoolFlag()
+}
+
+// scanWords splits words into positional arguments and flags, looking
+// flags up with lookup. It stops at the first positional argument when
+// stop is set. It returns the positional arguments, the index where it
+// stopped, and the flag waiting for its value when words end with one.
+func scanWords(words []string, lookup func(string) *flag.Flag, stop bool) (positional []string, end int, pending *flag.Flag) {
+	for end = 0; end < len(words); end++ {
+		w := words[end]
+		if len(w) < 2 || w[0] != '-' {
+			if stop {
+				return positional, end, nil
+			}
+			positional = append(positional, w)
+			continue
+		}
+		name := strings.TrimLeft(w, "-")
+		if strings.Contains(name, "=") {
+			continue
+		}
+		if f := lookup(name); f != nil && takesValue(f) {
+			if end+1 == len(words) {
+				return positional, end + 1, f
+			}
+			end++
+		}
+	}
+	return positional, end, nil
+}
+
+// runComplete prints the completions of the last of words, the words
+// after campay on the command line.
+func runComplete(cfg *Config, words []string) error {
+	for _, c := range complete(cfg, words) {
+		fmt.Println(c)
+	}
+	return nil
+}
+
+func complete(cfg *Config, words []string) []string {
+	if len(words) == 0 {
+		words = []string{""}
+	}
+	cur, prev := words[len(words)-1], words[:len(words)-1]
+
+	global, _, _ := globalFlags(&Config{file: &FileConfig{}})
+	_, at, pending := scanWords(prev, global.Lookup, true)
+	if at == len(prev) {
+		switch {
+		case pending != nil:
+			return values(cfg, flagValues[pending.Name], "", cur)
+		case strings.HasPrefix(cur, "-"):
+			return flagCandidates(cfg, flagList(global), cur)
+		}
+		return commandCandidates(cur)
+	}
+
+	c := findCommand(prev[at])
+	if c == nil {
+		return nil
+	}
+	rest := prev[at+1:]
+	var sub *subcommand
+	if len(c.Sub) > 0 && len(rest) > 0 && !strings.HasPrefix(rest[0], "-") {
+		if sub = c.findSub(rest[0]); sub == nil {
+			return nil
+		}
+		rest = rest[1:]
+	}
+	flags := describeFlags(*c, sub)
+	lookup := func(name string) *flag.Flag {
+		for _, f := range flags {
+			if f.Name == name {
+				return f
+			}
+		}
+		return nil
+	}
+	positional, _, pending := scanWords(rest, lookup, false)
+
+	switch {
+	case pending != nil:
+		return values(cfg, flagValues[pending.Name], "", cur)
+	case strings.HasPrefix(cur, "-"):
+		return flagCandidates(cfg, flags, cur)
+	case len(c.Sub) > 0 && sub == nil && len(positional) == 0:
+		var out []string
+		for _, s := range c.Sub {
+			if strings.HasPrefix(s.Name, cur) {
+				out = append(out, s.Name)
+			}
+		}
+		return out
+	case sub != nil:
+		return values(cfg, sub.Args, "", cur)
+	}
+	return values(cfg, c.Args, "", cur)
+}
+
+func flagList(fs *flag.FlagSet) []*flag.Flag {
+	var flags []*flag.Flag
+	fs.VisitAll(func(f *flag.Flag) { flags = append(flags, f) })
+	return flags
+}
+
+// flagCandidates completes cur, a flag or a --flag=value word.
+func flagCandidates(cfg *Config, flags []*flag.Flag, cur string) []string {
+	if name, value, ok := strings.Cut(strings.TrimLeft(cur, "-"), "="); ok {
+		for _, f := range flags {
+			if f.Name == name {
+				return values(cfg, flagValues[name], cur[:len(cur)-len(value)], value)
+			}
+		}
+		return nil
+	}
+	var out []string
+	for _, f := range flags {
+		if strings.HasPrefix("--"+f.Name, cur) || strings.HasPrefix("-"+f.Name, cur) {
+			_, usage := flag.UnquoteUsage(f)
+			out = append(out, "--"+f.Name+"\t"+firstLine(usage))
+		}
+	}
+	return out
+}
+
+func commandCandidates(cur string) []string {
+	var out []string
+	for _, c := range commands {
+		if strings.HasPrefix(c.Name, cur) {
+			out = append(out, c.Name+"\t"+c.Summary)
+		}
+	}
+	return out
+}
+
+// values completes cur as a value of kind, each candidate after prefix.
+func values(cfg *Config, kind argKind, prefix, cur string) []string {
+	var out []string
+	add := func(value, help string) {
+		if strings.HasPrefix(value, cur) {
+			if help != "" {
+				value += "\t" + help
+			}
+			out = append(out, prefix+value)
+		}
+	}
+	switch kind {
+	case argFile:
+		if prefix == "" {
+			return []string{":files"}
+		}
+	case argCommand:
+		for _, c := range commands {
+			add(c.Name, c.Summary)
+		}
+	case argProfile:
+		names := make([]string, 0, len(cfg.Profiles))
+		for name := range cfg.Profiles {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			add(name, cfg.Profiles[name].Environment)
+		}
+	case argContact:
+		contacts, err := loadContacts()
+		if err != nil {
+			return nil
+		}
+		aliases := make([]string, 0, len(contacts))
+		for alias := range contacts {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		for _, alias := range aliases {
+			add("@"+alias, displayPhone(contacts[alias]))
+		}
+	case argReference:
+		ledger, err := openLedger()
+		if err != nil {
+			return nil
+		}
+		entries, err := ledger.Entries()
+		if err != nil {
+			return nil
+		}
+		// Most recent first, as those are the ones asked about
+		for i := len(entries) - 1; i >= 0 && len(out) < 200; i-- {
+			e := entries[i]
+			add(e.Reference, fmt.Sprintf("%s %d %s %s", e.Kind, e.Amount, e.Currency, e.Status))
+		}
+	}
+	return out
+}
+
+func firstLine(s string) string {
+	line, _, _ := strings.Cut(s, "\n")
+	return line
+}
+
+// runCompletion prints the completion script of a shell.
+func runCompletion(cfg *Config, args []string) error {
+	if len(args) != 1 {
+		return invalidInput("usage: campay completion bash|zsh|fish|powershell")
+	}
+	script, ok := completionScripts[args[0]]
+	if !ok {
+		return invalidInput("unknown shell %q (use bash, zsh, fish or powershell)", args[0])
+	}
+	_, err := io.WriteString(os.Stdout, script)
+	return err
+}
+
+var completionScripts = map[string]string{
+	"bash": `# bash completion for campay
+# Load it with: source <(campay completion bash)
+_campay() {
+    local line=${COMP_LINE:0:COMP_POINT}
+    local -a words
+    read -ra words <<<"$line"
+    [[ $line =~ [[:space:]]$ ]] && words+=("")
+    local cur=${words[${#words[@]}-1]} out IFS=$'\n'
+    out=$("${words[0]}" __complete "${words[@]:1}" 2>/dev/null)
+    if [[ $out == ":files" ]]; then
+        compopt -o filenames
+        COMPREPLY=($(compgen -f -- "$cur"))
+        return
+    fi
+    COMPREPLY=($(cut -f1 <<<"$out"))
+    # bash completes --flag=value after the =
+    if [[ $cur == *=* && $COMP_WORDBREAKS == *=* ]]; then
+        COMPREPLY=("${COMPREPLY[@]#*=}")
+    fi
+}
+complete -F _campay campay
+`,
+	"zsh": `#compdef campay
+# zsh completion for campay
+# Load it with: source <(campay completion zsh)
+_campay() {
+    local -a lines candidates
+    local line
+    lines=("${(@f)$("${words[1]}" __complete "${(@)words[2,CURRENT]}" 2>/dev/null)}")
+    if [[ ${lines[1]} == ":files" ]]; then
+        _files
+        return
+    fi
+    for line in $lines; do
+        [[ -z $line ]] && continue
+        if [[ $line == *$'\t'* ]]; then
+            candidates+=("${${line%%$'\t'*}//:/\\:}:${line#*$'\t'}")
+        else
+            candidates+=("${line//:/\\:}")
+        fi
+    done
+    _describe -t campay campay candidates
+}
+compdef _campay campay
+`,
+	"fish": `# fish completion for campay
+# Load it with: campay completion fish | source
+function __campay_complete
+    set -l tokens (commandline -opc)
+    set -l cur (commandline -ct)
+    set -l out ($tokens[1] __complete $tokens[2..-1] "$cur" 2>/dev/null)
+    if test "$out[1]" = ":files"
+        __fish_complete_path "$cur"
+        return
+    end
+    printf '%s\n' $out
+end
+complete -c campay -f -a '(__campay_complete)'
+`,
+	"powershell": `# PowerShell completion for campay
+# Load it with: campay completion powershell | Out-String | Invoke-Expression
+Register-ArgumentCompleter -Native -CommandName campay -ScriptBlock {
+    param($wordToComplete, $commandAst, $cursorPosition)
+    $words = @($commandAst.CommandElements |
+        Where-Object { $_.Extent.StartOffset -lt $cursorPosition } |
+        ForEach-Object { $_.ToString() })
+    if ($wordToComplete -eq '') {
+        # Windows PowerShell drops empty arguments to native commands
+        if ($PSVersionTable.PSVersion -lt [version]'7.3') { $words += '""' } else { $words += '' }
+    }
+    $out = @(& $words[0] __complete @($words | Select-Object -Skip 1) 2>$null)
+    if ($out.Count -gt 0 -and $out[0] -eq ':files') {
+        Get-ChildItem -Path "$wordToComplete*" -ErrorAction SilentlyContinue | ForEach-Object {
+            [System.Management.Automation.CompletionResult]::new($_.Name, $_.Name, 'ProviderItem', $_.Name)
+        }
+        return
+    }
+    foreach ($line in $out) {
+        $value, $help = $line -split "` + "`" + `t", 2
+        if (-not $help) { $help = $value }
+        [System.Management.Automation.CompletionResult]::new($value, $value, 'ParameterValue', $help)
+    }
+}
+`,
+}
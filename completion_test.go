@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"strings"
+	"testing"
+)
+
+// Listing flags for completion and man pages must not run any part of a
+// command: no secrets resolved, no ledger opened, no file written.
+func TestDescribeFlagsRunsNothing(t *testing.T) {
+	home := t.TempDir()
+	t.Setenv("CAMPAY_HOME", home)
+
+	for _, c := range commands {
+		if c.Flags != nil && len(describeFlags(c, nil)) == 0 {
+			t.Errorf("%s: Flags declares no flags", c.Name)
+		}
+		for _, s := range c.Sub {
+			if s.Flags != nil && len(describeFlags(c, &s)) == 0 {
+				t.Errorf("%s %s: Flags declares no flags", c.Name, s.Name)
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(home)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		t.Errorf("describing flags created %s", e.Name())
+	}
+}
+
+func TestCompleteCommandFlags(t *testing.T) {
+	t.Setenv("CAMPAY_HOME", t.TempDir())
+	cfg := &Config{file: &FileConfig{}}
+
+	tests := []struct {
+		words []string
+		want  string
+	}{
+		{[]string{"collect", "--pho"}, "--phone"},
+		{[]string{"serve", "--webhook-p"}, "--webhook-path"},
+		{[]string{"jobs", "submit", "--callback"}, "--callback-url"},
+		{[]string{"batch", "resume", "--resend"}, "--resend-interrupted"},
+		{[]string{"ledger", "export", "--gr"}, "--group"},
+	}
+	for _, tt := range tests {
+		got := complete(cfg, tt.words)
+		found := false
+		for _, c := range got {
+			if c == tt.want || strings.HasPrefix(c, tt.want+"\t") {
+				found = true
+			}
+		}
+		if !found {
+			t.Errorf("complete(%q) = %q, want %s", tt.words, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"reflect"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== CONFIG FILE ========================
+   ============================================================ */
+
+// FileConfig is the optional JSON configuration stored in
+// ~/.campay/config.json (or the file named by CAMPAY_CONFIG). Scalar
+// settings such as proxy or connect_timeout are top-level keys resolved
+// with the flags and environment (see settings.go); they are kept in
+// Other with any unknown key, so that rewriting the file keeps them.
+type FileConfig struct {
+	Conversion        *ConversionConfig       `json:"conversion,omitempty"`
+	Profiles          map[string]Profile      `json:"profiles,omitempty"`
+	Risk              RiskRules               `json:"risk"`
+	OperatorLimits    map[string]AmountLimits `json:"operator_limits,omitempty"`
+	Headers           map[string]string       `json:"headers,omitempty"`
+	Routing           RoutingRules            `json:"payout_routing,omitempty"`
+	Splits            map[string][]SplitCut   `json:"splits,omitempty"`
+	Secrets           SecretsConfig           `json:"secrets,omitempty"`
+	Update            UpdateConfig            `json:"update,omitempty"`
+	PortedNumbers     map[string]string       `json:"ported_numbers,omitempty"`
+	Retention         RetentionConfig         `json:"retention,omitempty"`
+	SMS               SMSConfig               `json:"sms,omitempty"`
+	ASCIIDescriptions []string                `json:"ascii_descriptions,omitempty"`
+	Statuses          campay.StatusPolicy     `json:"statuses,omitempty"`
+	RelaySecrets      map[string]string       `json:"relay_secrets,omitempty"`
+	Endpoints         map[string]string       `json:"endpoints,omitempty"`
+	Accounting        AccountingConfig        `json:"accounting,omitempty"`
+	Outage            OutageConfig            `json:"outage,omitempty"`
+	FraudCheck        FraudCheckConfig        `json:"fraud_check,omitempty"`
+
+	Other map[string]json.RawMessage `json:"-"`
+}
+
+// fileConfigFields is FileConfig without its methods, for encoding/json.
+type fileConfigFields FileConfig
+
+func (fc *FileConfig) UnmarshalJSON(data []byte) error {
+	if err := json.Unmarshal(data, (*fileConfigFields)(fc)); err != nil {
+		return err
+	}
+	if err := json.Unmarshal(data, &fc.Other); err != nil {
+		return err
+	}
+	for _, f := range jsonFields(reflect.TypeOf(fileConfigFields{})) {
+		delete(fc.Other, f.name)
+	}
+	return nil
+}
+
+func (fc FileConfig) MarshalJSON() ([]byte, error) {
+	data, err := json.Marshal(fileConfigFields(fc))
+	if err != nil || len(fc.Other) == 0 {
+		return data, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(data, &all); err != nil {
+		return nil, err
+	}
+	for k, v := range fc.Other {
+		all[k] = v
+	}
+	return json.Marshal(all)
+}
+
+// Profile holds the credentials of one CamPay app, selected with
+// --profile or CAMPAY_PROFILE. Empty fields fall back to the environment.
+type Profile struct {
+	Username    string `json:"username"`
+	Password    string `json:"password"`
+	Environment string `json:"environment"`
+	WebhookKey  string `json:"webhook_key"`
+	RefFormat   string `json:"ref_format,omitempty"`
+	BaseURL     string `json:"base_url,omitempty"`
+
+	// Keychain keeps the password in the OS keychain instead of Password
+	// (see keychain.go).
+	Keychain bool `json:"keychain,omitempty"`
+
+	// PreviousWebhookKey is still accepted on callbacks after a rotation
+	// (see `webhook rotate-key`), until CamPay signs with the new key.
+	PreviousWebhookKey  string     `json:"previous_webhook_key,omitempty"`
+	WebhookKeyRotatedAt *time.Time `json:"webhook_key_rotated_at,omitempty"`
+}
+
+func configPath() (string, error) {
+	if path := os.Getenv("CAMPAY_CONFIG"); path != "" {
+		return path, nil
+	}
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "config.json"), nil
+}
+
+// loadFileConfig returns an empty config when no file exists.
+func loadFileConfig() (*FileConfig, error) {
+	path, err := configPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return &FileConfig{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var fc FileConfig
+	if err := json.Unmarshal(data, &fc); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &fc, nil
+}
+
+// saveFileConfig rewrites the config file, e.g. after `login --save`.
+func saveFileConfig(fc *FileConfig) error {
+	path, err := configPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(fc, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
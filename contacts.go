@@ -0,0 +1,143 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/* ============================================================
+   ======================= CONTACT BOOK ========================
+   ============================================================ */
+
+// Contacts maps an alias to a normalized phone number.
+type Contacts map[string]string
+
+func contactsPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "contacts.json"), nil
+}
+
+func loadContacts() (Contacts, error) {
+	path, err := contactsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Contacts{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	contacts := Contacts{}
+	if err := json.Unmarshal(data, &contacts); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return contacts, nil
+}
+
+func saveContacts(contacts Contacts) error {
+	path, err := contactsPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(contacts, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// resolvePhone accepts either a phone number or an @alias from the contact
+// book and returns the normalized number.
+func resolvePhone(input string) (string, error) {
+	input = strings.TrimSpace(input)
+	if !strings.HasPrefix(input, "@") {
+		return normalizePhone(input)
+	}
+
+	contacts, err := loadContacts()
+	if err != nil {
+		return "", err
+	}
+
+	alias := strings.ToLower(strings.TrimPrefix(input, "@"))
+	phone, ok := contacts[alias]
+	if !ok {
+		return "", invalidInput("unknown contact %q", input)
+	}
+	return phone, nil
+}
+
+func runContacts(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	contacts, err := loadContacts()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		aliases := make([]string, 0, len(contacts))
+		for alias := range contacts {
+			aliases = append(aliases, alias)
+		}
+		sort.Strings(aliases)
+		tbl := newTable("No contacts saved", tableColumn{Name: "Alias"}, tableColumn{Name: "Phone"})
+		for _, alias := range aliases {
+			tbl.Row("@"+alias, displayPhone(contacts[alias]))
+		}
+		return tbl.Print()
+
+	case "add":
+		if len(args) != 3 {
+			return invalidInput("usage: campay contacts add <alias> <phone>")
+		}
+		alias := strings.ToLower(strings.TrimPrefix(args[1], "@"))
+		if alias == "" || strings.ContainsAny(alias, " \t") {
+			return invalidInput("invalid alias %q", args[1])
+		}
+		phone, err := normalizePhone(args[2])
+		if err != nil {
+			return err
+		}
+		contacts[alias] = phone
+		if err := saveContacts(contacts); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Saved @%s → %s\n", alias, phone)
+		return nil
+
+	case "remove", "rm":
+		if len(args) != 2 {
+			return invalidInput("usage: campay contacts remove <alias>")
+		}
+		alias := strings.ToLower(strings.TrimPrefix(args[1], "@"))
+		if _, ok := contacts[alias]; !ok {
+			return invalidInput("unknown contact @%s", alias)
+		}
+		delete(contacts, alias)
+		if err := saveContacts(contacts); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Removed @%s\n", alias)
+		return nil
+
+	default:
+		return invalidInput("unknown contacts command %q (use list, add or remove)", args[0])
+	}
+}
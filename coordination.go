@@ -0,0 +1,162 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ======================== COORDINATION =======================
+   ============================================================ */
+
+// Several replicas of serve or the daemon may share one data directory
+// (CAMPAY_HOME on a shared volume). A Coordinator lets them divide the
+// work: the sweeper and the notification queue only run on the replica
+// holding their lease, and a reference is polled or swept by one replica
+// at a time, so customers and relay destinations are not notified twice.
+type Coordinator interface {
+	// Acquire claims key for ttl, extending the claim when this replica
+	// already holds it. It reports false while another replica does.
+	Acquire(key string, ttl time.Duration) (bool, error)
+	// Release gives key up if this replica holds it.
+	Release(key string) error
+}
+
+// Lease keys.
+const (
+	leaseSweeper       = "sweeper"
+	leaseNotifications = "notifications"
+	leaseArchive       = "archive"
+)
+
+// txnLease is the key under which one reference is polled or swept.
+func txnLease(reference string) string { return "txn-" + reference }
+
+// statusLease is held while the ledger status of one reference is read
+// and changed.
+func statusLease(reference string) string { return "status-" + reference }
+
+// lease is the content of a lock file.
+type lease struct {
+	Owner   string    `json:"owner"`
+	Expires time.Time `json:"expires"`
+}
+
+// fileCoordinator keeps leases as files in <data dir>/locks. Creating a
+// lock file is atomic on local disks and on NFS, and an expired lease is
+// taken over, so a replica that died releases its work after ttl.
+type fileCoordinator struct {
+	dir   string
+	owner string
+	tag   string // for this replica's temporary file names
+}
+
+// replicaID names this process in leases: host, pid and a random suffix.
+func replicaID() string {
+	host, _ := os.Hostname()
+	var b [4]byte
+	rand.Read(b[:])
+	return fmt.Sprintf("%s:%d:%s", host, os.Getpid(), hex.EncodeToString(b[:]))
+}
+
+func openCoordinator() (Coordinator, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	dir = filepath.Join(dir, "locks")
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	var tag [4]byte
+	rand.Read(tag[:])
+	return &fileCoordinator{dir: dir, owner: replicaID(), tag: hex.EncodeToString(tag[:])}, nil
+}
+
+func (c *fileCoordinator) path(key string) string {
+	return filepath.Join(c.dir, strings.NewReplacer("/", "_", `\`, "_").Replace(key)+".lock")
+}
+
+func (c *fileCoordinator) read(path string) (*lease, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l lease
+	if err := json.Unmarshal(data, &l); err != nil {
+		// A lease being written; treat it as held for now.
+		return &lease{Expires: time.Now().Add(time.Second)}, nil
+	}
+	return &l, nil
+}
+
+func (c *fileCoordinator) Acquire(key string, ttl time.Duration) (bool, error) {
+	path := c.path(key)
+	data, err := json.Marshal(lease{Owner: c.owner, Expires: time.Now().Add(ttl).UTC()})
+	if err != nil {
+		return false, err
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			return err == nil, err
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return false, err
+		}
+
+		held, err := c.read(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // released in between
+		}
+		if err != nil {
+			return false, err
+		}
+		switch {
+		case held.Owner == c.owner:
+			// Renew through a rename, so others never read a partial file
+			tmp := path + "." + c.tag + ".tmp"
+			if err := os.WriteFile(tmp, data, 0600); err != nil {
+				return false, err
+			}
+			return true, os.Rename(tmp, path)
+		case time.Now().Before(held.Expires):
+			return false, nil
+		}
+		// Expired: move it aside and try to create it again. If another
+		// replica took it over in between, the lease moved is fresh and is
+		// linked back, which fails rather than replacing a newer one.
+		stale := path + "." + c.tag + ".stale"
+		if err := os.Rename(path, stale); err == nil {
+			if moved, err := c.read(stale); err == nil && (moved.Owner != held.Owner || !moved.Expires.Equal(held.Expires)) {
+				os.Link(stale, path)
+			}
+			os.Remove(stale)
+		}
+	}
+	return false, nil
+}
+
+func (c *fileCoordinator) Release(key string) error {
+	path := c.path(key)
+	held, err := c.read(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	if err != nil || held.Owner != c.owner {
+		return err
+	}
+	return os.Remove(path)
+}
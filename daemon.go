@@ -0,0 +1,609 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== DAEMON ===========================
+   ============================================================ */
+
+// daemon runs payment jobs independently of the terminal that submitted
+// them. It owns one authenticated provider, refreshed periodically, and a
+// pool of workers that submit, poll and record each job.
+type daemon struct {
+	cfg    *Config
+	ledger *Ledger
+	store  *jobStore
+	queue  chan string
+
+	provider atomic.Pointer[Provider]
+	riskMu   sync.Mutex // held from validation until the job is stored
+	coord    Coordinator
+	refs     *refAllocator
+	ready    *readiness
+	keys     *keyring
+
+	relaySecrets relaySecrets // sign expiry callbacks
+}
+
+// daemonOptions are the flags of daemon.
+type daemonOptions struct {
+	socket       string
+	addr         string
+	workers      int
+	refresh      time.Duration
+	sweepAfter   time.Duration
+	sweepEvery   time.Duration
+	relaySecret  string
+	notifyEvery  time.Duration
+	readySLA     time.Duration
+	archiveEvery time.Duration
+	forceUnlock  bool
+}
+
+// daemonFlags defines the flags of daemon on fs.
+func daemonFlags(fs *flag.FlagSet, cfg *Config) *daemonOptions {
+	opt := &daemonOptions{}
+	fs.StringVar(&opt.socket, "socket", defaultSocketPath(), "Unix socket to listen on")
+	fs.StringVar(&opt.addr, "addr", "", "listen on this local TCP address (e.g. 127.0.0.1:8091) instead of the socket")
+	fs.IntVar(&opt.workers, "workers", 4, "jobs processed in parallel")
+	fs.DurationVar(&opt.refresh, "token-refresh", 30*time.Minute, "how often to renew the API token")
+	fs.DurationVar(&opt.sweepAfter, "sweep-after", time.Hour, "expire ledger entries still pending after this long, after checking the API (0 disables)")
+	fs.DurationVar(&opt.sweepEvery, "sweep-every", 5*time.Minute, "how often to look for stale pending entries")
+	fs.StringVar(&opt.relaySecret, "relay-secret", os.Getenv("RELAY_SECRET"), "HMAC secret used to sign callbacks and queued relay events to destinations without one in relay_secrets")
+	fs.DurationVar(&opt.notifyEvery, "notify-every", time.Minute, "how often to retry queued notifications")
+	fs.DurationVar(&opt.readySLA, "ready-sla", 3*time.Second, "/readyz fails when CamPay takes longer than this to answer")
+	fs.DurationVar(&opt.archiveEvery, "archive-every", 24*time.Hour, "how often to apply the retention policy of the config file")
+	fs.BoolVar(&opt.forceUnlock, "force-unlock", false, "remove the lock left by a daemon on this host that did not exit cleanly")
+	return opt
+}
+
+func runDaemon(cfg *Config, args []string) error {
+	fs := newFlagSet("daemon")
+	opt := daemonFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if opt.workers < 1 {
+		return invalidInput("workers must be at least 1")
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	unlock, err := acquireRunLock(ledger, daemonLockName(), "daemon", opt.forceUnlock)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+	store, err := openJobStore(ledger.aead)
+	if err != nil {
+		return err
+	}
+
+	coord, err := openCoordinator()
+	if err != nil {
+		return err
+	}
+
+	refs, err := newRefAllocator(cfg, ledger)
+	if err != nil {
+		return err
+	}
+	keys, err := openKeyring()
+	if err != nil {
+		return err
+	}
+
+	d := &daemon{cfg: cfg, ledger: ledger, store: store, queue: make(chan string, 1024), coord: coord, refs: refs, keys: keys, relaySecrets: cfg.RelaySecrets.withFallback(opt.relaySecret)}
+	subscribeExpiry(ledger, d.relaySecrets)
+	d.ready = &readiness{ledger: ledger, sla: opt.readySLA, cache: readyCache,
+		provider: func(context.Context) (Provider, error) { return *d.provider.Load(), nil }}
+	provider, err := connectProvider(cfg)
+	if err != nil {
+		return err
+	}
+	d.provider.Store(&provider)
+
+	var listener net.Listener
+	if opt.addr != "" {
+		listener, err = net.Listen("tcp", opt.addr)
+	} else {
+		os.Remove(opt.socket) // left over from a previous run
+		listener, err = net.Listen("unix", opt.socket)
+		if err == nil {
+			err = os.Chmod(opt.socket, 0600)
+		}
+	}
+	if err != nil {
+		return err
+	}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	var wg sync.WaitGroup
+	for i := 0; i < opt.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case id := <-d.queue:
+					d.run(id)
+				}
+			}
+		}()
+	}
+	d.requeue(ctx)
+	go d.refreshToken(ctx, opt.refresh)
+	if opt.sweepAfter > 0 {
+		sw := &sweeper{
+			ledger:   ledger,
+			grace:    opt.sweepAfter,
+			provider: func() (Provider, error) { return *d.provider.Load(), nil },
+			coord:    coord,
+		}
+		go sw.run(ctx, opt.sweepEvery)
+	}
+	notifications, err := openNotifyQueue()
+	if err != nil {
+		return err
+	}
+	notifications.coord = coord
+	go notifications.run(ctx, opt.notifyEvery, sendQueuedNotification(ledger, d.relaySecrets))
+	if cfg.Retention.ArchiveAfter != "" {
+		go runRetention(ctx, ledger, coord, cfg.Retention.ArchiveAfter, opt.archiveEvery)
+	}
+
+	server := &http.Server{Handler: d.routes()}
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.Serve(listener) }()
+	fmt.Printf("Daemon listening on %s with %d workers\n", listener.Addr(), opt.workers)
+	if cfg.ReadOnly {
+		fmt.Println("Read-only mode: job submissions are refused")
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("\nShutting down; waiting for running jobs...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	server.Shutdown(shutdownCtx)
+	wg.Wait()
+	return nil
+}
+
+// requeue requeues jobs left queued by a previous run and resumes polling
+// for jobs CamPay had already accepted. Jobs that were being submitted are
+// marked interrupted, since it is unknown whether CamPay received them.
+// The jobs are queued from a goroutine, as the workers take them, so that
+// any number of them fits the queue.
+func (d *daemon) requeue(ctx context.Context) {
+	var ids []string
+	for _, j := range d.store.list() {
+		switch {
+		case j.State == jobQueued, j.State == jobRunning && j.Reference != "":
+			ids = append(ids, j.ID)
+		case j.State == jobRunning:
+			d.store.update(j.ID, func(j *Job) {
+				j.State = jobInterrupted
+				j.Error = "daemon stopped while submitting; check with `campay lookup --external-ref " + j.ExternalReference + "`"
+			})
+		}
+	}
+	go func() {
+		for _, id := range ids {
+			select {
+			case d.queue <- id:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+}
+
+func (d *daemon) refreshToken(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		p, err := newProvider(d.cfg)
+		if err == nil {
+			err = p.Authenticate(context.Background())
+		}
+		if err != nil {
+			fmt.Println("⚠ Token refresh failed:", err)
+			continue
+		}
+		d.provider.Store(&p)
+	}
+}
+
+// run processes one job to a final status.
+func (d *daemon) run(id string) {
+	job, ok := d.store.get(id)
+	if !ok {
+		return
+	}
+	provider := *d.provider.Load()
+
+	audited := LedgerEntry{Reference: job.Reference, ExternalReference: job.ExternalReference, Phone: job.Phone, Amount: job.Amount,
+		Refund: job.RefundOf != "", RefundOf: job.RefundOf}
+	fail := func(err error) {
+		auditMoney(d.cfg, job.Kind, "error: "+err.Error(), audited)
+		d.store.update(id, func(j *Job) {
+			j.State = jobFailed
+			j.Error = err.Error()
+		})
+	}
+
+	if job.Reference == "" {
+		if err := auditMoney(d.cfg, job.Kind, auditRequested, audited); err != nil {
+			fail(err)
+			return
+		}
+		if _, err := d.store.update(id, func(j *Job) { j.State = jobRunning }); err != nil {
+			fmt.Println("⚠ Failed to save job:", err)
+		}
+
+		var reference, dialCode, review string
+		var err error
+		switch job.Kind {
+		case "collect":
+			var resp *campay.CollectResponse
+			resp, err = submitCollect(provider, campay.CollectRequest{
+				Amount:            job.Amount,
+				Currency:          "XAF",
+				From:              job.Phone,
+				Description:       job.Description,
+				ExternalReference: job.ExternalReference,
+				Operator:          sentOperator(job.Phone, job.Operator),
+			})
+			if err == nil {
+				reference, dialCode, review = resp.Reference, resp.DialCode(), reviewReason(resp)
+			}
+		case "withdraw":
+			var resp *campay.WithdrawResponse
+			resp, err = provider.Withdraw(context.Background(), campay.WithdrawRequest{
+				Amount:            job.Amount,
+				Currency:          "XAF",
+				To:                job.Phone,
+				Description:       job.Description,
+				ExternalReference: job.ExternalReference,
+				Operator:          sentOperator(job.Phone, job.Operator),
+			})
+			if err == nil {
+				reference = resp.Reference
+			}
+		}
+		if err != nil {
+			fail(err)
+			return
+		}
+
+		job, _ = d.store.update(id, func(j *Job) {
+			j.Reference = reference
+			j.Status = string(campay.StatusPending)
+			j.USSDCode, j.DialURI = dialCode, campay.DialURI(dialCode)
+		})
+		audited.Reference = reference
+		auditMoney(d.cfg, job.Kind, auditInitiated, audited)
+		recordLedger(d.ledger, LedgerEntry{
+			Reference:         reference,
+			ExternalReference: job.ExternalReference,
+			Kind:              job.Kind,
+			Phone:             job.Phone,
+			Amount:            job.Amount,
+			Currency:          "XAF",
+			Description:       job.Description,
+			Status:            campay.StatusPending,
+			Environment:       d.cfg.Env,
+			CallbackURL:       job.CallbackURL,
+			Refund:            job.RefundOf != "",
+			RefundOf:          job.RefundOf,
+			DialCode:          dialCode,
+			Review:            review,
+		})
+	}
+
+	// Replicas sharing the data directory resume the same accepted jobs
+	lease := txnLease(job.Reference)
+	if ok, err := d.coord.Acquire(lease, d.cfg.Deadline+time.Minute); err != nil {
+		fmt.Println("⚠ Failed to take the polling lease:", err)
+	} else if !ok {
+		fmt.Printf("%s %s is being polled by another replica\n", id, job.Reference)
+		return
+	} else {
+		defer d.coord.Release(lease)
+	}
+
+	status, err := pollTransactionStatus(provider, d.ledger, job.Reference, d.cfg.Deadline, func(status string, _, _ time.Duration) {
+		d.store.update(id, func(j *Job) { j.Status = status })
+	})
+	if err != nil {
+		fail(err)
+		return
+	}
+	if err := d.ledger.UpdateStatus(job.Reference, parseStatus(status.Status), status.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	auditMoney(d.cfg, job.Kind, string(parseStatus(status.Status)), audited)
+
+	d.store.update(id, func(j *Job) {
+		j.Status = status.Status
+		j.State = jobDone
+		if unsuccessful(parseStatus(status.Status)) {
+			j.State = jobFailed
+		}
+	})
+	fmt.Printf("%s %s → %s\n", id, job.Reference, status.Status)
+}
+
+// =============================================================
+// HTTP API
+// =============================================================
+
+func (d *daemon) routes() http.Handler {
+	api := apiSpec{
+		Title:       "CamPay payment daemon",
+		Description: "Submits collections and payouts as background jobs (campay daemon).",
+		Keys:        d.keys,
+		Routes: []apiRoute{
+			{Method: "POST", Path: "/jobs", Summary: "Submit a collect or withdraw job (withdraw needs scope refund with refund_of, admin otherwise)", Handler: d.handleSubmit,
+				Request: Job{}, Response: Job{}, Status: http.StatusAccepted, Errors: []int{http.StatusBadRequest, http.StatusInternalServerError, http.StatusServiceUnavailable}, Scope: scopeCollect},
+			{Method: "GET", Path: "/jobs", Summary: "List jobs", Handler: d.handleList, Response: []Job{}, Scope: scopeRead},
+			{Method: "GET", Path: "/jobs/{id}", Summary: "Get one job", Handler: d.handleGet,
+				Response: Job{}, Errors: []int{http.StatusNotFound}, Scope: scopeRead},
+			{Method: "GET", Path: "/healthz", Summary: "Liveness: the process is up", Handler: handleHealthz, Response: healthStatus{}},
+			{Method: "GET", Path: "/readyz", Summary: "Readiness: ledger writable, token valid, CamPay answering (503 and Retry-After while not)",
+				Handler: d.ready.handleReadyz, Response: readyStatus{}},
+			{Method: "GET", Path: "/metrics", Summary: "Prometheus metrics: notification queue, dead letters and operator failure rates", Handler: handleMetrics(d.cfg, d.ledger),
+				Produces: "text/plain", Errors: []int{http.StatusInternalServerError}, Scope: scopeRead},
+		},
+	}
+	mux := http.NewServeMux()
+	api.register(mux)
+	return mux
+}
+
+// handleSubmit validates and queues a job. Only kind, phone, amount,
+// description, external_reference, callback_url and refund_of are taken
+// from the request.
+func (d *daemon) handleSubmit(w http.ResponseWriter, r *http.Request) {
+	var j Job
+	if err := json.NewDecoder(r.Body).Decode(&j); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+	need := scopeCollect
+	switch {
+	case j.Kind == "withdraw" && j.RefundOf != "":
+		need = scopeRefund
+	case j.Kind == "withdraw":
+		need = scopeAdmin
+	}
+	if scope := requestScope(r); !scope.allows(need) {
+		writeJSONError(w, http.StatusForbidden, fmt.Errorf("API key %s has scope %s; this job needs %s", requestKeyName(r), scope, need))
+		return
+	}
+	if err := refuseReadOnly(d.cfg, "a "+j.Kind+" job"); err != nil {
+		writeJSONError(w, http.StatusForbidden, err)
+		return
+	}
+	// Checks against the ledger and the jobs in flight must see this job
+	// before the next one is checked
+	d.riskMu.Lock()
+	if err := d.validate(&j); err != nil {
+		d.riskMu.Unlock()
+		writeJSONError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	now := time.Now().UTC()
+	j.ID, j.State, j.CreatedAt, j.UpdatedAt = newJobID(), jobQueued, now, now
+	j.Reference, j.Status, j.Error, j.USSDCode, j.DialURI, j.Warning = "", "", "", "", "", ""
+	j.Key = requestKeyName(r)
+	if j.Kind == "collect" {
+		// The job is still collected; the caller decides whether to tell the customer
+		if j.Operator != "" {
+			if h := outageFor(d.cfg, d.ledger, j.Operator); h != nil {
+				j.Warning = outageMessage(*h, d.cfg.Outage.window)
+			}
+		}
+	}
+	err := d.store.add(&j)
+	d.riskMu.Unlock()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	select {
+	case d.queue <- j.ID:
+	default:
+		// Never sent, so the caller may submit it again
+		d.store.update(j.ID, func(j *Job) {
+			j.State = jobFailed
+			j.Error = "the daemon's queue was full"
+		})
+		w.Header().Set("Retry-After", "30")
+		writeJSONError(w, http.StatusServiceUnavailable, fmt.Errorf("job queue is full (%d jobs); try again later", cap(d.queue)))
+		return
+	}
+	writeJSON(w, http.StatusAccepted, maskJob(r, j))
+}
+
+func (d *daemon) handleList(w http.ResponseWriter, r *http.Request) {
+	jobs := d.store.list()
+	for i := range jobs {
+		jobs[i] = maskJob(r, jobs[i])
+	}
+	writeJSON(w, http.StatusOK, jobs)
+}
+
+func (d *daemon) handleGet(w http.ResponseWriter, r *http.Request) {
+	j, ok := d.store.get(r.PathValue("id"))
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("unknown job %s", r.PathValue("id")))
+		return
+	}
+	writeJSON(w, http.StatusOK, maskJob(r, j))
+}
+
+// validate applies the same checks as the interactive commands before a
+// job is accepted. Risk rules cannot be overridden through the daemon.
+// d.riskMu must be held.
+func (d *daemon) validate(j *Job) error {
+	if j.Kind != "collect" && j.Kind != "withdraw" {
+		return errors.New(`kind must be "collect" or "withdraw"`)
+	}
+	if j.RefundOf != "" {
+		if err := d.validateRefund(j); err != nil {
+			return err
+		}
+	}
+	phone, err := normalizePhone(j.Phone)
+	if err != nil {
+		return err
+	}
+	j.Phone = phone
+	if j.Amount <= 0 {
+		return errors.New(tr("err.amount"))
+	}
+	if strings.TrimSpace(j.ExternalReference) == "" {
+		return errors.New("external_reference is required")
+	}
+	if err := d.refs.Check(j.ExternalReference); err != nil {
+		return err
+	}
+	if j.CallbackURL != "" {
+		if err := validCallbackURL(j.CallbackURL); err != nil {
+			return err
+		}
+		if err := d.relaySecrets.missing(j.CallbackURL); err != nil {
+			return fmt.Errorf("callback_url: %w", err)
+		}
+	}
+	if j.Operator, _, err = knownOperator(d.cfg, d.ledger, j.Phone); err != nil {
+		return err
+	}
+	if err := checkLimitsFor(d.cfg.OperatorLimits, j.Operator, j.Amount); err != nil {
+		return err
+	}
+
+	// Jobs accepted but not yet in the ledger count towards today's totals
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		return err
+	}
+	risk := riskCheckOf(d.cfg.Risk, entries, j.Kind)
+	for _, q := range d.inFlight(entries) {
+		if q.Kind == j.Kind {
+			risk.phoneToday[q.Phone] += q.Amount
+			risk.totalToday += q.Amount
+		}
+	}
+	return risk.Enforce(j.Phone, j.Amount, false)
+}
+
+// validateRefund checks that j pays back a successful collection, to its
+// payer and no more than is left of it, counting the refund jobs still
+// queued or running. A missing phone or amount is taken from the
+// collection.
+func (d *daemon) validateRefund(j *Job) error {
+	if j.Kind != "withdraw" {
+		return errors.New("refund_of is only for withdraw jobs")
+	}
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		return err
+	}
+	var collection *LedgerEntry
+	for i := range entries {
+		e := &entries[i]
+		if e.Kind == "collect" && e.Status == campay.StatusSuccessful && (e.Reference == j.RefundOf || e.ExternalReference == j.RefundOf) {
+			collection = e
+		}
+	}
+	if collection == nil {
+		return fmt.Errorf("refund_of: %s is not a successful collection in the ledger", j.RefundOf)
+	}
+	refunded := refundedAmounts(entries)
+	for _, q := range d.inFlight(entries) {
+		if q.RefundOf != "" {
+			refunded[q.RefundOf] += q.Amount
+		}
+	}
+	left := collection.Amount - refunded[collection.Reference] - refunded[collection.ExternalReference]
+	if left <= 0 {
+		return fmt.Errorf("refund_of: %s has nothing left to refund", collection.Reference)
+	}
+	if j.Phone == "" {
+		j.Phone = collection.Phone
+	}
+	if phone, err := normalizePhone(j.Phone); err != nil || phone != collection.Phone {
+		return fmt.Errorf("refund_of: a refund goes back to the payer of %s", collection.Reference)
+	}
+	if j.Amount == 0 {
+		j.Amount = left
+	}
+	if j.Amount > left {
+		return fmt.Errorf("refund_of: only %d XAF of %s is left to refund", left, collection.Reference)
+	}
+	j.RefundOf = collection.Reference
+	return nil
+}
+
+// inFlight returns the queued and running jobs that are not in entries
+// yet: the ledger records a job only once CamPay accepted it. Interrupted
+// jobs count too, as CamPay may have accepted them.
+func (d *daemon) inFlight(entries []LedgerEntry) []Job {
+	recorded := make(map[string]bool, len(entries))
+	for _, e := range entries {
+		recorded[e.Reference] = true
+	}
+	var jobs []Job
+	for _, j := range d.store.list() {
+		if (j.State == jobQueued || j.State == jobRunning || j.State == jobInterrupted) && (j.Reference == "" || !recorded[j.Reference]) {
+			jobs = append(jobs, j)
+		}
+	}
+	return jobs
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func writeJSONError(w http.ResponseWriter, status int, err error) {
+	writeJSON(w, status, apiError{Error: err.Error()})
+}
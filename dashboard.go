@@ -0,0 +1,731 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/subtle"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"html/template"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= DASHBOARD =========================
+   ============================================================ */
+
+// The dashboard is a local web page over the ledger, for merchants who do
+// not live in the terminal: a searchable transaction table, daily volume
+// and success rate, pending payments refreshed from CamPay, and buttons to
+// retry a failed payment or refund a collection. It listens on localhost
+// by default; the buttons send a per-process token embedded in the page,
+// so other sites open in the same browser cannot move money.
+
+type dashboard struct {
+	cfg      *Config
+	ledger   *Ledger
+	provider Provider // nil without credentials: the page is read-only
+	refs     *refAllocator
+	token    string
+}
+
+// dashboardEntry is a ledger entry as shown on the page.
+type dashboardEntry struct {
+	Reference         string    `json:"reference"`
+	ExternalReference string    `json:"external_reference"`
+	Kind              string    `json:"kind"`
+	Refund            bool      `json:"refund,omitempty"`
+	Phone             string    `json:"phone"`
+	Amount            int       `json:"amount"`
+	Currency          string    `json:"currency"`
+	Description       string    `json:"description"`
+	Status            string    `json:"status"`
+	State             string    `json:"state"` // pending, success, failed or abandoned
+	Operator          string    `json:"operator,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	Retry             bool      `json:"retry"`      // the retry button applies
+	Refundable        int       `json:"refundable"` // what is left to refund
+}
+
+// dayStats is one bar of the charts.
+type dayStats struct {
+	Date       string  `json:"date"`
+	Collected  int     `json:"collected"`
+	PaidOut    int     `json:"paid_out"`
+	Successful int     `json:"successful"`
+	Failed     int     `json:"failed"`
+	Rate       float64 `json:"rate"` // successful share of final payments, -1 without any
+}
+
+// dashboardOptions are the flags of dashboard.
+type dashboardOptions struct {
+	addr string
+}
+
+// dashboardFlags defines the flags of dashboard on fs.
+func dashboardFlags(fs *flag.FlagSet, cfg *Config) *dashboardOptions {
+	opt := &dashboardOptions{}
+	fs.StringVar(&opt.addr, "addr", "127.0.0.1:8090", "listen address")
+	return opt
+}
+
+func runDashboard(cfg *Config, args []string) error {
+	fs := newFlagSet("dashboard")
+	opt := dashboardFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	refs, err := newRefAllocator(cfg, ledger)
+	if err != nil {
+		return err
+	}
+	token := make([]byte, 16)
+	if _, err := rand.Read(token); err != nil {
+		return err
+	}
+	d := &dashboard{cfg: cfg, ledger: ledger, refs: refs, token: hex.EncodeToString(token)}
+
+	if cfg.Username != "" && cfg.Password != "" {
+		if d.provider, err = connectProvider(cfg); err != nil {
+			return err
+		}
+	} else {
+		fmt.Println("⚠ No CamPay credentials: the dashboard is read-only and pending statuses are not refreshed")
+	}
+	if cfg.ReadOnly {
+		fmt.Println("Read-only mode: retry and refund are turned off")
+	}
+
+	fmt.Printf("Dashboard on http://%s/ (%s)\n", opt.addr, cfg.Env)
+	return http.ListenAndServe(opt.addr, d.routes())
+}
+
+func (d *dashboard) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /{$}", d.handlePage)
+	mux.HandleFunc("GET /api/transactions", d.handleTransactions)
+	mux.HandleFunc("GET /api/stats", d.handleStats)
+	mux.HandleFunc("GET /api/pending", d.handlePending)
+	mux.HandleFunc("GET /api/campaigns", d.handleCampaigns)
+	mux.HandleFunc("GET /api/outages", d.handleOutages)
+	mux.HandleFunc("GET /api/events", d.handleEvents)
+	mux.HandleFunc("POST /api/transactions/{ref}/retry", d.guard(d.handleRetry))
+	mux.HandleFunc("POST /api/transactions/{ref}/refund", d.guard(d.handleRefund))
+	return mux
+}
+
+// outageReport is the answer of /api/outages.
+type outageReport struct {
+	Window    string           `json:"window"`
+	Operators []operatorHealth `json:"operators"`
+	Warnings  []string         `json:"warnings"` // one per operator looking down
+}
+
+func (d *dashboard) handleOutages(w http.ResponseWriter, r *http.Request) {
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	report := outageReport{Window: formatWindow(d.cfg.Outage.window), Warnings: []string{}}
+	report.Operators = outageRates(entries, d.cfg.Outage, time.Now())
+	for _, h := range report.Operators {
+		if h.Outage {
+			report.Warnings = append(report.Warnings, outageMessage(h, d.cfg.Outage.window))
+		}
+	}
+	writeJSON(w, http.StatusOK, report)
+}
+
+// handleEvents streams the ledger's transaction events (see events.go) as
+// server-sent events named after their kind, so that the page refreshes
+// when a payment moves instead of at its next poll.
+func (d *dashboard) handleEvents(w http.ResponseWriter, r *http.Request) {
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	events := make(chan campay.TxEvent, 64)
+	defer d.ledger.Subscribe(func(ev campay.TxEvent) {
+		select {
+		case events <- ev:
+		default: // a slow page misses events, not the status change
+		}
+	})()
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Accel-Buffering", "no")
+	flusher.Flush()
+	keepAlive := time.NewTicker(15 * time.Second)
+	defer keepAlive.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case ev := <-events:
+			data, _ := json.Marshal(ev)
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", ev.Kind, data)
+		case <-keepAlive.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		flusher.Flush()
+	}
+}
+
+// guard rejects money-moving requests without the page's token.
+func (d *dashboard) guard(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if subtle.ConstantTimeCompare([]byte(r.Header.Get("X-Dashboard-Token")), []byte(d.token)) != 1 {
+			writeJSONError(w, http.StatusForbidden, errors.New("missing or wrong dashboard token; reload the page"))
+			return
+		}
+		if err := refuseReadOnly(d.cfg, "this action"); err != nil {
+			writeJSONError(w, http.StatusForbidden, err)
+			return
+		}
+		if d.provider == nil {
+			writeJSONError(w, http.StatusServiceUnavailable, errors.New("no CamPay credentials configured"))
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (d *dashboard) handlePage(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Header().Set("X-Frame-Options", "DENY")
+	dashboardPage.Execute(w, map[string]any{
+		"Lang":     lang,
+		"Env":      d.cfg.Env,
+		"Token":    d.token,
+		"Actions":  d.provider != nil && !d.cfg.ReadOnly,
+		"Zone":     zoneLabel(time.Now()),
+		"TimeZone": ianaZone(),
+	})
+}
+
+// view turns ledger entries into page rows, with what the buttons may do.
+func (d *dashboard) view(entries []LedgerEntry) map[string]dashboardEntry {
+	refunded := refundedAmounts(entries)
+	out := make(map[string]dashboardEntry, len(entries))
+	for _, e := range entries {
+		v := dashboardEntry{
+			Reference:         e.Reference,
+			ExternalReference: e.ExternalReference,
+			Kind:              e.Kind,
+			Refund:            e.Refund,
+			Phone:             displayPhone(e.Phone),
+			Amount:            e.Amount,
+			Currency:          e.Currency,
+			Description:       e.Description,
+			Status:            statusLabel(string(e.Status)),
+			State:             newPayStatus(e.Status).State,
+			Operator:          e.Operator,
+			CreatedAt:         e.CreatedAt,
+			Retry:             e.Source == "" && statusPolicy.IsRetryable(e.Status) && !strings.HasPrefix(e.StatusReason, retriedAs),
+		}
+		if e.Kind == "collect" && e.Status == campay.StatusSuccessful {
+			v.Refundable = max(e.Amount-refunded[e.Reference]-refunded[e.ExternalReference], 0)
+		}
+		out[e.Reference] = v
+	}
+	return out
+}
+
+// handleTransactions lists the newest matching transactions. q matches
+// references, phone numbers and descriptions.
+func (d *dashboard) handleTransactions(w http.ResponseWriter, r *http.Request) {
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	limit, _ := strconv.Atoi(r.URL.Query().Get("limit"))
+	if limit <= 0 || limit > 1000 {
+		limit = 200
+	}
+	filter := searchFilter{Kind: r.URL.Query().Get("kind")}
+	if s := r.URL.Query().Get("status"); s != "" {
+		filter.Statuses = []campay.Status{parseStatus(s)}
+	}
+	q := strings.ToLower(strings.TrimSpace(r.URL.Query().Get("q")))
+
+	views := d.view(entries)
+	found := []dashboardEntry{}
+	for i := len(entries) - 1; i >= 0 && len(found) < limit; i-- {
+		e := entries[i]
+		if !filter.match(e) {
+			continue
+		}
+		if q != "" && !strings.Contains(strings.ToLower(e.Reference+" "+e.ExternalReference+" "+e.Phone+" "+e.Description), q) {
+			continue
+		}
+		found = append(found, views[e.Reference])
+	}
+	writeJSON(w, http.StatusOK, found)
+}
+
+// handleStats returns daily volume and success rate over ?days (30).
+func (d *dashboard) handleStats(w http.ResponseWriter, r *http.Request) {
+	days, _ := strconv.Atoi(r.URL.Query().Get("days"))
+	if days <= 0 || days > 366 {
+		days = 30
+	}
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	today := inZone(time.Now())
+	first := time.Date(today.Year(), today.Month(), today.Day()-days+1, 0, 0, 0, 0, reportZone)
+	stats := make([]dayStats, days)
+	index := map[string]int{}
+	for i := range stats {
+		stats[i].Date = first.AddDate(0, 0, i).Format("2006-01-02")
+		index[stats[i].Date] = i
+	}
+	for _, e := range entries {
+		i, ok := index[inZone(e.CreatedAt).Format("2006-01-02")]
+		if !ok {
+			continue
+		}
+		switch {
+		case e.Status == campay.StatusSuccessful:
+			stats[i].Successful++
+			if e.Kind == "collect" {
+				stats[i].Collected += e.Amount
+			} else {
+				stats[i].PaidOut += e.Amount
+			}
+		case unsuccessful(e.Status) || e.Status.Abandoned():
+			stats[i].Failed++
+		}
+	}
+	for i := range stats {
+		stats[i].Rate = -1
+		if n := stats[i].Successful + stats[i].Failed; n > 0 {
+			stats[i].Rate = float64(stats[i].Successful) / float64(n)
+		}
+	}
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// handleCampaigns returns the progress of every campaign, newest first.
+func (d *dashboard) handleCampaigns(w http.ResponseWriter, r *http.Request) {
+	campaigns, err := loadCampaigns()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	list := make([]campaignProgress, 0, len(campaigns))
+	for _, c := range campaigns {
+		p, err := progressOf(d.ledger, c)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+		list = append(list, p)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Campaign.CreatedAt.After(list[j].Campaign.CreatedAt) })
+	writeJSON(w, http.StatusOK, list)
+}
+
+// handlePending refreshes the pending transactions from CamPay and lists
+// them.
+func (d *dashboard) handlePending(w http.ResponseWriter, r *http.Request) {
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	var refreshed bool
+	for _, e := range entries {
+		if isFinal(e.Status) || d.provider == nil || e.Environment != d.cfg.Env {
+			continue
+		}
+		status, err := fetchStatus(d.provider, d.ledger, e.Reference)
+		if err != nil {
+			continue
+		}
+		if err := d.ledger.UpdateStatus(e.Reference, parseStatus(status.Status), status.Operator); err == nil {
+			refreshed = true
+		}
+	}
+	if refreshed {
+		if entries, err = d.ledger.Entries(); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err)
+			return
+		}
+	}
+
+	views := d.view(entries)
+	pending := []dashboardEntry{}
+	for i := len(entries) - 1; i >= 0; i-- {
+		if !isFinal(entries[i].Status) {
+			pending = append(pending, views[entries[i].Reference])
+		}
+	}
+	writeJSON(w, http.StatusOK, pending)
+}
+
+// retriedAs starts the status reason of a payment retried from the
+// dashboard or by collect --on-expiry retry, which hides its retry button.
+const retriedAs = "retried as "
+
+// markRetried records that e was sent again as reference.
+func markRetried(ledger *Ledger, e LedgerEntry, reference string) {
+	e.StatusReason = retriedAs + reference
+	recordLedger(ledger, e)
+	ledger.events.Publish(campay.TxEvent{
+		Kind:      campay.EventRetried,
+		Reference: reference,
+		Type:      e.Kind,
+		Amount:    e.Amount,
+		Currency:  e.Currency,
+		Status:    campay.StatusPending,
+		RetryOf:   e.Reference,
+	})
+}
+
+// handleRetry sends a failed or abandoned payment again, under a new
+// external reference.
+func (d *dashboard) handleRetry(w http.ResponseWriter, r *http.Request) {
+	e, err := d.ledger.Get(r.PathValue("ref"))
+	if err != nil || e == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("transaction %s is not in the ledger", r.PathValue("ref")))
+		return
+	}
+	if !d.view([]LedgerEntry{*e})[e.Reference].Retry {
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("transaction %s is %s and cannot be retried", e.Reference, e.Status))
+		return
+	}
+	retry := LedgerEntry{
+		Kind:        e.Kind,
+		Phone:       e.Phone,
+		Amount:      e.Amount,
+		Description: e.Description,
+		Refund:      e.Refund,
+		RefundOf:    e.RefundOf,
+	}
+	if reference, ok := d.submit(w, retry); ok {
+		markRetried(d.ledger, *e, reference)
+	}
+}
+
+// handleRefund pays back what is left of a successful collection.
+func (d *dashboard) handleRefund(w http.ResponseWriter, r *http.Request) {
+	entries, err := d.ledger.Entries()
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return
+	}
+	v, ok := d.view(entries)[r.PathValue("ref")]
+	if !ok {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("transaction %s is not in the ledger", r.PathValue("ref")))
+		return
+	}
+	if v.Refundable <= 0 {
+		writeJSONError(w, http.StatusConflict, fmt.Errorf("transaction %s has nothing left to refund", v.Reference))
+		return
+	}
+	// The view masks the number; the payout goes to the one in the ledger
+	e, err := d.ledger.Get(v.Reference)
+	if err != nil || e == nil {
+		writeJSONError(w, http.StatusNotFound, fmt.Errorf("transaction %s is not in the ledger", v.Reference))
+		return
+	}
+	d.submit(w, LedgerEntry{
+		Kind:        "withdraw",
+		Phone:       e.Phone,
+		Amount:      v.Refundable,
+		Description: "Refund of " + v.Reference,
+		Refund:      true,
+		RefundOf:    v.Reference,
+	})
+}
+
+// submit starts a collect or payout for the buttons, after the same
+// limits and risk rules as the commands. It does not wait: the pending
+// list follows the payment. It returns the new reference, or false once it
+// has written an error.
+func (d *dashboard) submit(w http.ResponseWriter, e LedgerEntry) (string, bool) {
+	operator, _, err := knownOperator(d.cfg, d.ledger, e.Phone)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return "", false
+	}
+	if err := checkLimitsFor(d.cfg.OperatorLimits, operator, e.Amount); err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return "", false
+	}
+	risk, err := newRiskCheck(d.cfg.Risk, d.ledger, e.Kind)
+	if err == nil {
+		err = risk.Enforce(e.Phone, e.Amount, false)
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusUnprocessableEntity, err)
+		return "", false
+	}
+	prefix := "TXN"
+	if e.Kind == "withdraw" {
+		prefix = "PAY"
+	}
+	if e.ExternalReference, err = d.refs.Generate(prefix); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return "", false
+	}
+	if err := auditMoney(d.cfg, e.Kind, auditRequested, e); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err)
+		return "", false
+	}
+
+	switch e.Kind {
+	case "collect":
+		var resp *campay.CollectResponse
+		resp, err = submitCollect(d.provider, campay.CollectRequest{
+			Amount:            e.Amount,
+			Currency:          "XAF",
+			From:              e.Phone,
+			Description:       e.Description,
+			ExternalReference: e.ExternalReference,
+			Operator:          sentOperator(e.Phone, operator),
+		})
+		if err == nil {
+			e.Reference, e.DialCode, e.Review = resp.Reference, resp.DialCode(), reviewReason(resp)
+		}
+	default:
+		var resp *campay.WithdrawResponse
+		resp, err = d.provider.Withdraw(context.Background(), campay.WithdrawRequest{
+			Amount:            e.Amount,
+			Currency:          "XAF",
+			To:                e.Phone,
+			Description:       e.Description,
+			ExternalReference: e.ExternalReference,
+			Operator:          sentOperator(e.Phone, operator),
+		})
+		if err == nil {
+			e.Reference = resp.Reference
+		}
+	}
+	if err != nil {
+		auditMoney(d.cfg, e.Kind, "error: "+err.Error(), e)
+		writeJSONError(w, http.StatusBadGateway, err)
+		return "", false
+	}
+	auditMoney(d.cfg, e.Kind, auditInitiated, e)
+
+	e.Currency = "XAF"
+	e.Status = campay.StatusPending
+	e.Environment = d.cfg.Env
+	e.CreatedAt = time.Now().UTC()
+	recordLedger(d.ledger, e)
+	writeJSON(w, http.StatusAccepted, d.view([]LedgerEntry{e})[e.Reference])
+	return e.Reference, true
+}
+
+var dashboardPage = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>CamPay · {{.Env}}</title>
+<style>
+  body { font-family: system-ui, sans-serif; margin: 0; background: #f4f4f4; color: #222; }
+  header { background: #1f2937; color: #fff; padding: .8rem 1.5rem; display: flex; justify-content: space-between; }
+  main { padding: 1rem 1.5rem; display: grid; gap: 1rem; }
+  section { background: #fff; border-radius: 6px; padding: 1rem; }
+  h2 { font-size: 1rem; margin: 0 0 .6rem; }
+  .charts { display: grid; grid-template-columns: 1fr 1fr; gap: 1rem; }
+  svg { width: 100%; height: 160px; }
+  table { width: 100%; border-collapse: collapse; font-size: .9rem; }
+  th, td { text-align: left; padding: .35rem .5rem; border-bottom: 1px solid #eee; }
+  td.num { text-align: right; font-variant-numeric: tabular-nums; }
+  .pending { color: #b07800; } .success { color: #1a7f37; } .failed, .abandoned { color: #c62828; }
+  input, select, button { font: inherit; padding: .3rem .5rem; }
+  button { cursor: pointer; }
+  #error { color: #c62828; }
+  #outages { background: #fdecea; color: #c62828; }
+  #outages p { margin: .2rem 0; }
+  progress { width: 100%; }
+</style>
+</head>
+<body>
+<header><strong>CamPay dashboard</strong><span>{{.Env}}</span></header>
+<main>
+  <section id="outages" hidden></section>
+  <div class="charts">
+    <section><h2>Daily volume (XAF, 30 days, days in {{.Zone}})</h2><svg id="volume"></svg></section>
+    <section><h2>Success rate</h2><svg id="rate"></svg></section>
+  </div>
+  <section id="campaigns-section" hidden>
+    <h2>Campaigns</h2>
+    <table>
+      <thead><tr><th>Campaign</th><th class="num">Collected</th><th class="num">Target</th><th>Progress</th><th class="num">Payers paid</th><th class="num">Pending</th></tr></thead>
+      <tbody id="campaigns"></tbody>
+    </table>
+  </section>
+  <section>
+    <h2>Pending</h2>
+    <table><tbody id="pending"></tbody></table>
+  </section>
+  <section>
+    <h2>Transactions</h2>
+    <p>
+      <input id="q" type="search" placeholder="Reference, phone or description" size="36">
+      <select id="kind"><option value="">All kinds</option><option>collect</option><option>withdraw</option><option>refund</option></select>
+      <select id="status"><option value="">All statuses</option><option>SUCCESSFUL</option><option>PENDING</option><option>FAILED</option></select>
+      <span id="error"></span>
+    </p>
+    <table>
+      <thead><tr><th>Date ({{.Zone}})</th><th>Kind</th><th>Phone</th><th class="num">Amount</th><th>Status</th><th>Reference</th><th>Description</th><th></th></tr></thead>
+      <tbody id="transactions"></tbody>
+    </table>
+  </section>
+</main>
+<script>
+const token = {{.Token}};
+const actions = {{.Actions}};
+const zone = {{.TimeZone}};
+// Amounts are grouped as for --lang, not as the browser's locale would
+const locale = {{.Lang}} === "fr" ? "fr-FR" : "en-US";
+const money = (n, currency) => n.toLocaleString(locale) + (currency ? " " + currency : "");
+const $ = (id) => document.getElementById(id);
+
+function cell(row, text, cls) {
+  const td = row.insertCell();
+  td.textContent = text;
+  if (cls) td.className = cls;
+  return td;
+}
+
+function button(td, label, confirmText, url) {
+  const b = document.createElement("button");
+  b.textContent = label;
+  b.onclick = async () => {
+    if (!confirm(confirmText)) return;
+    const resp = await fetch(url, {method: "POST", headers: {"X-Dashboard-Token": token}});
+    const body = await resp.json();
+    $("error").textContent = resp.ok ? "" : body.error;
+    refresh();
+  };
+  td.appendChild(b);
+}
+
+function rows(tbody, list, withActions) {
+  tbody.replaceChildren();
+  for (const t of list) {
+    const row = tbody.insertRow();
+    cell(row, new Date(t.created_at).toLocaleString(undefined, {timeZone: zone || undefined}));
+    cell(row, t.refund ? "refund" : t.kind);
+    cell(row, t.phone);
+    cell(row, money(t.amount, t.currency), "num");
+    cell(row, t.status, t.state);
+    cell(row, t.reference);
+    cell(row, t.description);
+    const td = row.insertCell();
+    if (!withActions || !actions) continue;
+    if (t.retry) button(td, "Retry", "Send " + money(t.amount, "XAF") + " " + (t.kind === "collect" ? "from " : "to ") + t.phone + " again?", "/api/transactions/" + t.reference + "/retry");
+    if (t.refundable > 0) button(td, "Refund", "Refund " + money(t.refundable, "XAF") + " to " + t.phone + "?", "/api/transactions/" + t.reference + "/refund");
+  }
+}
+
+function bars(svg, values, color, max) {
+  const w = 1000, h = 160;
+  svg.setAttribute("viewBox", "0 0 " + w + " " + h);
+  svg.setAttribute("preserveAspectRatio", "none");
+  svg.replaceChildren();
+  const bw = w / values.length;
+  values.forEach((v, i) => {
+    if (v.value < 0) return;
+    const r = document.createElementNS("http://www.w3.org/2000/svg", "rect");
+    const bh = max > 0 ? v.value / max * (h - 4) : 0;
+    r.setAttribute("x", i * bw + 1); r.setAttribute("width", bw - 2);
+    r.setAttribute("y", h - bh); r.setAttribute("height", bh);
+    r.setAttribute("fill", color);
+    const title = document.createElementNS("http://www.w3.org/2000/svg", "title");
+    title.textContent = v.label;
+    r.appendChild(title);
+    svg.appendChild(r);
+  });
+}
+
+async function getJSON(url) {
+  const resp = await fetch(url);
+  return resp.json();
+}
+
+function campaignRows(list) {
+  $("campaigns-section").hidden = list.length === 0;
+  const tbody = $("campaigns");
+  tbody.replaceChildren();
+  for (const p of list) {
+    const c = p.campaign, row = tbody.insertRow();
+    cell(row, c.name + " (" + c.id + ")");
+    cell(row, money(p.collected, c.currency), "num");
+    cell(row, money(c.target), "num");
+    const bar = document.createElement("progress");
+    bar.max = c.target || 1; bar.value = Math.min(p.collected, bar.max);
+    bar.title = c.target ? Math.round(p.collected / c.target * 100) + "%" : "";
+    row.insertCell().appendChild(bar);
+    const payers = p.payers || [];
+    cell(row, payers.filter((pp) => pp.state === "paid").length + "/" + payers.length, "num");
+    cell(row, money(p.pending), "num");
+  }
+}
+
+function outageBanner(report) {
+  const section = $("outages");
+  section.hidden = report.warnings.length === 0;
+  section.replaceChildren();
+  for (const w of report.warnings) {
+    const p = document.createElement("p");
+    p.textContent = w;
+    section.appendChild(p);
+  }
+}
+
+async function refresh() {
+  const params = new URLSearchParams({q: $("q").value, kind: $("kind").value, status: $("status").value});
+  rows($("transactions"), await getJSON("/api/transactions?" + params), true);
+  rows($("pending"), await getJSON("/api/pending"), false);
+  campaignRows(await getJSON("/api/campaigns"));
+  outageBanner(await getJSON("/api/outages"));
+
+  const stats = await getJSON("/api/stats?days=30");
+  const volume = stats.map((s) => ({value: s.collected + s.paid_out, label: s.date + ": collected " + money(s.collected, "XAF") + ", paid out " + money(s.paid_out, "XAF")}));
+  bars($("volume"), volume, "#2563eb", Math.max(...volume.map((v) => v.value)));
+  bars($("rate"), stats.map((s) => ({value: s.rate, label: s.date + ": " + (s.rate < 0 ? "no payments" : Math.round(s.rate * 100) + "% of " + (s.successful + s.failed))})), "#1a7f37", 1);
+}
+
+let timer;
+for (const id of ["q", "kind", "status"]) {
+  $(id).addEventListener("input", () => { clearTimeout(timer); timer = setTimeout(refresh, 250); });
+}
+refresh();
+setInterval(refresh, 5000);
+const events = new EventSource("/api/events");
+for (const kind of ["initiated", "status_changed", "terminal", "retried", "refunded"]) {
+  events.addEventListener(kind, () => { clearTimeout(timer); timer = setTimeout(refresh, 250); });
+}
+</script>
+</body>
+</html>
+`))
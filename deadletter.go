@@ -0,0 +1,394 @@
+package main
+
+import (
+	"bufio"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ============================================================
+   ======================== DEAD LETTERS =======================
+   ============================================================ */
+
+// A notification the queue gives up on is moved to
+// ~/.campay/deadletter.jsonl with its last error, where it stays until
+// `campay deadletter retry` delivers it or `purge` drops it, so nothing
+// disappears without a trace. Like the queue, the file is append-only and
+// the last line of an ID wins.
+
+const (
+	deadLetterDead    = "dead"
+	deadLetterRetried = "retried" // delivered by deadletter retry
+	deadLetterPurged  = "purged"
+)
+
+// deadLetter is one notification that could not be delivered after all
+// the retries of the notification queue.
+type deadLetter struct {
+	ID          string          `json:"id"` // the queued notification's ID
+	Kind        string          `json:"kind"`
+	Destination string          `json:"destination"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	State       string          `json:"state"`
+	Attempts    int             `json:"attempts"`
+	Error       string          `json:"error"`
+	CreatedAt   time.Time       `json:"created_at"` // when it was first queued
+	FailedAt    time.Time       `json:"failed_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+
+	// Event is set instead of ID, Kind and Body in lines written by
+	// earlier versions, which only kept relay events.
+	Event *RelayEvent `json:"event,omitempty"`
+}
+
+type deadLetters struct {
+	path string
+	mu   sync.Mutex
+}
+
+func openDeadLetters() (*deadLetters, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	return &deadLetters{path: filepath.Join(dir, "deadletter.jsonl")}, nil
+}
+
+// buryNotification moves n, which the queue just gave up on, to the dead
+// letters. Errors are printed, since there is nowhere else left to report
+// them.
+func buryNotification(n queuedNotification) {
+	d, err := openDeadLetters()
+	if err == nil {
+		err = d.write(deadLetter{
+			ID:          n.ID,
+			Kind:        n.Kind,
+			Destination: n.Destination,
+			Body:        n.Body,
+			State:       deadLetterDead,
+			Attempts:    n.Attempts,
+			Error:       n.Error,
+			CreatedAt:   n.CreatedAt,
+			FailedAt:    time.Now().UTC(),
+		})
+	}
+	if err != nil {
+		fmt.Printf("⚠ Failed to write dead letter for %s notification %s: %v\n", n.Kind, n.ID, err)
+		return
+	}
+	fmt.Printf("💀 Gave up on %s notification %s for %s after %d attempts; see `campay deadletter list`\n", n.Kind, n.ID, n.Destination, n.Attempts)
+}
+
+func (d *deadLetters) write(l deadLetter) error {
+	l.UpdatedAt = time.Now().UTC()
+	line, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	f, err := os.OpenFile(d.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// upgrade fills in the fields of a line written by an earlier version.
+// Its ID is derived from the line, so a later state change finds it again.
+func (l *deadLetter) upgrade() {
+	if l.ID != "" || l.Event == nil {
+		return
+	}
+	sum := sha256.Sum256([]byte(l.Destination + "\n" + l.Event.ID + "\n" + l.FailedAt.Format(time.RFC3339Nano)))
+	l.ID = hex.EncodeToString(sum[:8])
+	l.Kind = notifyRelay
+	l.Body, _ = json.Marshal(l.Event)
+	l.Event = nil
+	l.State = deadLetterDead
+	l.CreatedAt = l.FailedAt
+}
+
+// List returns the latest state of every dead letter, oldest failure
+// first.
+func (d *deadLetters) List() ([]deadLetter, error) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	f, err := os.Open(d.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := map[string]deadLetter{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var l deadLetter
+		if err := json.Unmarshal(scanner.Bytes(), &l); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", d.path, n, err)
+		}
+		l.upgrade()
+		latest[l.ID] = l
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]deadLetter, 0, len(latest))
+	for _, l := range latest {
+		list = append(list, l)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].FailedAt.Before(list[j].FailedAt) })
+	return list, nil
+}
+
+// Dead returns the dead letters neither retried nor purged.
+func (d *deadLetters) Dead() ([]deadLetter, error) {
+	list, err := d.List()
+	if err != nil {
+		return nil, err
+	}
+	dead := list[:0]
+	for _, l := range list {
+		if l.State == deadLetterDead {
+			dead = append(dead, l)
+		}
+	}
+	return dead, nil
+}
+
+// pickDeadLetters returns the dead letters named by ids, each a full ID or
+// a prefix matching only one.
+func pickDeadLetters(dead []deadLetter, ids []string) ([]deadLetter, error) {
+	var picked []deadLetter
+	for _, id := range ids {
+		var match []deadLetter
+		for _, l := range dead {
+			if strings.HasPrefix(l.ID, id) {
+				match = append(match, l)
+			}
+		}
+		switch len(match) {
+		case 0:
+			return nil, invalidInput("no dead letter %q (see campay deadletter list)", id)
+		case 1:
+			picked = append(picked, match[0])
+		default:
+			return nil, invalidInput("%q matches %d dead letters; give more of the ID", id, len(match))
+		}
+	}
+	return picked, nil
+}
+
+// deadletterListOptions are the flags of deadletter list.
+type deadletterListOptions struct {
+	all  bool
+	kind string
+}
+
+// deadletterListFlags defines the flags of deadletter list on fs.
+func deadletterListFlags(fs *flag.FlagSet, cfg *Config) *deadletterListOptions {
+	opt := &deadletterListOptions{}
+	fs.BoolVar(&opt.all, "all", false, "include retried and purged dead letters")
+	fs.StringVar(&opt.kind, "kind", "", "only this kind: relay, hook or sms")
+	return opt
+}
+
+// deadletterRetryOptions are the flags of deadletter retry.
+type deadletterRetryOptions struct {
+	all         bool
+	relaySecret string
+}
+
+// deadletterRetryFlags defines the flags of deadletter retry on fs.
+func deadletterRetryFlags(fs *flag.FlagSet, cfg *Config) *deadletterRetryOptions {
+	opt := &deadletterRetryOptions{}
+	fs.BoolVar(&opt.all, "all", false, "retry every dead letter")
+	fs.StringVar(&opt.relaySecret, "relay-secret", os.Getenv("RELAY_SECRET"), "HMAC secret used to sign relay events to destinations without one in relay_secrets")
+	return opt
+}
+
+// deadletterPurgeOptions are the flags of deadletter purge.
+type deadletterPurgeOptions struct {
+	all       bool
+	olderThan string
+	yes       bool
+}
+
+// deadletterPurgeFlags defines the flags of deadletter purge on fs.
+func deadletterPurgeFlags(fs *flag.FlagSet, cfg *Config) *deadletterPurgeOptions {
+	opt := &deadletterPurgeOptions{}
+	fs.BoolVar(&opt.all, "all", false, "purge every dead letter")
+	fs.StringVar(&opt.olderThan, "older-than", "", "purge dead letters that failed longer ago than this: 30d, 6w, 3m (months) or 1y")
+	fs.BoolVar(&opt.yes, "yes", false, "do not ask for confirmation")
+	return opt
+}
+
+// runDeadLetter lists, retries and purges dead letters.
+func runDeadLetter(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return invalidInput("usage: campay deadletter list|retry|purge [flags]")
+	}
+	store, err := openDeadLetters()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "list":
+		fs := newFlagSet("deadletter list")
+		opt := deadletterListFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		list, err := store.List()
+		if err != nil {
+			return err
+		}
+		tbl := newTable("No dead letters",
+			tableColumn{Name: "ID"},
+			tableColumn{Name: "Kind"},
+			tableColumn{Name: "Destination", Max: 40},
+			tableColumn{Name: "State"},
+			tableColumn{Name: "Attempts", Right: true},
+			tableColumn{Name: "Failed"},
+			tableColumn{Name: "Last error", Max: 60},
+		)
+		for _, l := range list {
+			if (!opt.all && l.State != deadLetterDead) || (opt.kind != "" && l.Kind != opt.kind) {
+				continue
+			}
+			tbl.Row(l.ID, l.Kind, l.Destination, l.State, l.Attempts, l.FailedAt, l.Error)
+		}
+		return tbl.Print()
+
+	case "retry":
+		fs := newFlagSet("deadletter retry")
+		opt := deadletterRetryFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		picked, err := selectDeadLetters(store, fs.Args(), opt.all, "")
+		if err != nil {
+			return err
+		}
+		ledger, err := openLedger()
+		if err != nil {
+			return err
+		}
+		send := sendQueuedNotification(ledger, cfg.RelaySecrets.withFallback(opt.relaySecret))
+		failed := 0
+		for _, l := range picked {
+			l.Attempts++
+			sendErr := send(queuedNotification{ID: l.ID, Kind: l.Kind, Destination: l.Destination, Body: l.Body, Attempts: l.Attempts})
+			if sendErr == nil {
+				l.State, l.Error = deadLetterRetried, ""
+				fmt.Printf("✓ Delivered %s notification %s to %s\n", l.Kind, l.ID, l.Destination)
+			} else {
+				l.Error = sendErr.Error()
+				failed++
+				fmt.Printf("✗ %s notification %s to %s failed again: %v\n", l.Kind, l.ID, l.Destination, sendErr)
+			}
+			if err := store.write(l); err != nil {
+				return err
+			}
+		}
+		if failed > 0 {
+			return fmt.Errorf("%d of %d dead letter(s) still failing", failed, len(picked))
+		}
+		return nil
+
+	case "purge":
+		fs := newFlagSet("deadletter purge")
+		opt := deadletterPurgeFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		picked, err := selectDeadLetters(store, fs.Args(), opt.all, opt.olderThan)
+		if err != nil {
+			return err
+		}
+		if len(picked) == 0 {
+			fmt.Println("No dead letters to purge")
+			return nil
+		}
+		if !opt.yes {
+			answer, err := promptUser(fmt.Sprintf("Purge %d dead letter(s)? They will never be delivered. [y/N]: ", len(picked)))
+			if err != nil {
+				return err
+			}
+			if a := strings.ToLower(answer); a != "y" && a != "yes" {
+				return exitErr(exitCancelled, fmt.Errorf("purge not confirmed"))
+			}
+		}
+		for _, l := range picked {
+			l.State = deadLetterPurged
+			if err := store.write(l); err != nil {
+				return err
+			}
+		}
+		fmt.Printf("✓ Purged %d dead letter(s)\n", len(picked))
+		return nil
+
+	default:
+		return invalidInput("unknown deadletter command %q (use list, retry or purge)", args[0])
+	}
+}
+
+// selectDeadLetters returns the dead letters named by ids, all of them, or
+// those that failed before the olderThan age; exactly one must be given.
+func selectDeadLetters(store *deadLetters, ids []string, all bool, olderThan string) ([]deadLetter, error) {
+	given := 0
+	for _, set := range []bool{len(ids) > 0, all, olderThan != ""} {
+		if set {
+			given++
+		}
+	}
+	if given != 1 {
+		return nil, invalidInput("give dead letter IDs, --all or --older-than (one of them)")
+	}
+	dead, err := store.Dead()
+	if err != nil {
+		return nil, err
+	}
+	switch {
+	case all:
+		return dead, nil
+	case olderThan != "":
+		cutoff, err := retentionCutoff(olderThan, time.Now())
+		if err != nil {
+			return nil, err
+		}
+		var old []deadLetter
+		for _, l := range dead {
+			if l.FailedAt.Before(cutoff) {
+				old = append(old, l)
+			}
+		}
+		return old, nil
+	}
+	return pickDeadLetters(dead, ids)
+}
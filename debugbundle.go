@@ -0,0 +1,358 @@
+package main
+
+import (
+	"archive/zip"
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"runtime"
+	"sort"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== DEBUG BUNDLE =======================
+   ============================================================ */
+
+// debug-bundle gathers what support needs to look into a problem (the
+// version, the settings in effect, the config file, recent ledger entries,
+// the audit log and dead letters, and any cassettes or logs named) into a
+// zip that can be attached to a ticket or issue. Everything goes through
+// scrubValue or scrubText on the way in: credentials, tokens and keys are
+// replaced, phone numbers keep their prefix and last two digits, and
+// names, descriptions and hosts are dropped. Files that are not read here
+// (contacts, campaigns, invoices) never go in.
+
+const redacted = "REDACTED"
+
+var (
+	// Cameroonian numbers, with or without the country code
+	msisdnPattern = regexp.MustCompile(`\b(?:237)?[26]\d{8}\b`)
+	tokenPattern  = regexp.MustCompile(`(?i)\b(bearer|token)(\s*[:=]?\s*)[A-Za-z0-9._~+/=-]{12,}`)
+	jwtPattern    = regexp.MustCompile(`\beyJ[\w-]+\.[\w-]+\.[\w-]*`)
+	userinfoURL   = regexp.MustCompile(`(://)[^/@\s]+@`)
+)
+
+// scrubText hides phone numbers, tokens and URL credentials in free text.
+func scrubText(s string) string {
+	s = jwtPattern.ReplaceAllString(s, redacted)
+	s = tokenPattern.ReplaceAllString(s, "${1}${2}"+redacted)
+	s = userinfoURL.ReplaceAllString(s, "${1}"+redacted+"@")
+	return msisdnPattern.ReplaceAllStringFunc(s, campay.MaskPhone)
+}
+
+// scrubField classifies a JSON key: "secret", "phone", "name" or "".
+func scrubField(key string) string {
+	k := strings.ToLower(key)
+	switch {
+	case strings.Contains(k, "password"), strings.Contains(k, "secret"), strings.Contains(k, "token") && !strings.HasSuffix(k, "timeout"),
+		strings.Contains(k, "authorization"), strings.Contains(k, "signature"), strings.HasSuffix(k, "key"),
+		k == "username", k == "credential", k == "cookie":
+		return "secret"
+	case strings.Contains(k, "phone"), k == "from", k == "to", k == "msisdn", k == "payer":
+		return "phone"
+	case strings.HasSuffix(k, "name"), k == "description", k == "actor", k == "author", k == "host", k == "customer":
+		return "name"
+	}
+	return ""
+}
+
+// scrubValue scrubs a decoded JSON document in place, by key at any
+// depth and by scrubText elsewhere.
+func scrubValue(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			switch scrubField(k) {
+			case "secret":
+				v[k] = redactAll(child)
+			case "name":
+				if s, ok := child.(string); ok && s != "" {
+					v[k] = redacted
+				} else {
+					v[k] = redactAll(child)
+				}
+			case "phone":
+				if s, ok := child.(string); ok {
+					v[k] = campay.MaskPhone(s)
+				} else {
+					v[k] = scrubValue(child)
+				}
+			default:
+				v[k] = scrubValue(child)
+			}
+		}
+	case []any:
+		for i := range v {
+			v[i] = scrubValue(v[i])
+		}
+	case string:
+		return scrubText(v)
+	}
+	return v
+}
+
+// redactAll replaces every non-empty string in v, e.g. the secrets of
+// relay_secrets, which are keyed by URL.
+func redactAll(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			v[k] = redactAll(child)
+		}
+	case []any:
+		for i := range v {
+			v[i] = redactAll(v[i])
+		}
+	case string:
+		if v != "" {
+			return redacted
+		}
+	}
+	return v
+}
+
+// scrubLine scrubs a line of a log: by key when it is a JSON object,
+// as text otherwise.
+func scrubLine(line []byte) []byte {
+	var v any
+	if json.Unmarshal(line, &v) == nil {
+		if out, err := json.Marshal(scrubValue(v)); err == nil {
+			return out
+		}
+	}
+	return []byte(scrubText(string(line)))
+}
+
+// scrubJSONFile scrubs a whole JSON document, such as a cassette.
+func scrubJSONFile(data []byte) ([]byte, error) {
+	var v any
+	if err := json.Unmarshal(data, &v); err != nil {
+		return nil, err
+	}
+	out, err := json.MarshalIndent(scrubValue(v), "", "  ")
+	return append(out, '\n'), err
+}
+
+// tailLines returns the last n lines of the file at path, scrubbed, or
+// nil when it does not exist.
+func tailLines(path string, n int) ([]byte, error) {
+	f, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var lines [][]byte
+	sc := bufio.NewScanner(f)
+	sc.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	for sc.Scan() {
+		lines = append(lines, bytes.Clone(sc.Bytes()))
+		if len(lines) > n {
+			lines = lines[1:]
+		}
+	}
+	if err := sc.Err(); err != nil {
+		return nil, err
+	}
+	var b bytes.Buffer
+	for _, line := range lines {
+		b.Write(scrubLine(line))
+		b.WriteByte('\n')
+	}
+	return b.Bytes(), nil
+}
+
+// debugBundleOptions are the flags of debug-bundle.
+type debugBundleOptions struct {
+	out       string
+	entries   int
+	lines     int
+	cassettes stringList
+	logs      stringList
+}
+
+// debugBundleFlags defines the flags of debug-bundle on fs.
+func debugBundleFlags(fs *flag.FlagSet, cfg *Config) *debugBundleOptions {
+	opt := &debugBundleOptions{}
+	fs.StringVar(&opt.out, "out", "", "zip file to write (default campay-debug-<time>.zip)")
+	fs.IntVar(&opt.entries, "entries", 50, "latest ledger entries to include")
+	fs.IntVar(&opt.lines, "lines", 200, "latest lines of each log to include")
+	fs.Var(&opt.cassettes, "cassette", "cassette recorded with --record to include (repeatable)")
+	fs.Var(&opt.logs, "log", "other log file to include, e.g. the daemon's output (repeatable)")
+	return opt
+}
+
+// runDebugBundle writes the scrubbed support bundle.
+func runDebugBundle(cfg *Config, args []string) error {
+	fs := newFlagSet("debug-bundle")
+	opt := debugBundleFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+	if opt.entries < 0 || opt.lines < 0 {
+		return invalidInput("--entries and --lines cannot be negative")
+	}
+	if opt.out == "" {
+		opt.out = "campay-debug-" + time.Now().UTC().Format("20060102T150405Z") + ".zip"
+	}
+
+	files := map[string][]byte{}
+	var skipped []string
+
+	// Version and settings
+	var info bytes.Buffer
+	fmt.Fprintf(&info, "campay %s %s\n", buildVersion(), buildCommit())
+	fmt.Fprintf(&info, "Go: %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Fprintf(&info, "Created: %s\n\n", time.Now().UTC().Format(time.RFC3339))
+	for _, s := range cfg.settings.list {
+		value := s.value.String()
+		switch {
+		case value == "":
+		case s.Secret || scrubField(s.Name) == "secret":
+			value = redacted
+		case scrubField(s.Name) == "phone":
+			value = campay.MaskPhone(value)
+		}
+		fmt.Fprintf(&info, "%-22s %-30s %s\n", s.Name, scrubText(value), s.Source)
+	}
+	files["settings.txt"] = info.Bytes()
+
+	if path, err := configPath(); err == nil {
+		data, err := os.ReadFile(path)
+		switch {
+		case err == nil:
+			if data, err = scrubJSONFile(data); err != nil {
+				skipped = append(skipped, fmt.Sprintf("config.json: %v", err))
+			} else {
+				files["config.json"] = data
+			}
+		case !errors.Is(err, os.ErrNotExist):
+			skipped = append(skipped, fmt.Sprintf("config.json: %v", err))
+		}
+	}
+
+	// Latest ledger entries, by last change
+	if ledger, err := openLedger(); err != nil {
+		skipped = append(skipped, fmt.Sprintf("ledger: %v", err))
+	} else if all, err := ledger.Entries(); err != nil {
+		skipped = append(skipped, fmt.Sprintf("ledger: %v", err))
+	} else {
+		sort.SliceStable(all, func(i, j int) bool { return all[i].UpdatedAt.Before(all[j].UpdatedAt) })
+		var b bytes.Buffer
+		for _, e := range all[max(len(all)-opt.entries, 0):] {
+			line, _ := json.Marshal(e)
+			b.Write(scrubLine(line))
+			b.WriteByte('\n')
+		}
+		if b.Len() > 0 {
+			files["ledger.jsonl"] = b.Bytes()
+		}
+	}
+
+	if dir, err := dataDir(); err == nil {
+		for _, name := range []string{"audit.jsonl", "deadletter.jsonl", "notifications.jsonl"} {
+			data, err := tailLines(filepath.Join(dir, name), opt.lines)
+			if err != nil {
+				skipped = append(skipped, fmt.Sprintf("%s: %v", name, err))
+			} else if data != nil {
+				files[name] = data
+			}
+		}
+	}
+	for _, path := range opt.cassettes {
+		data, err := os.ReadFile(path)
+		if err == nil {
+			data, err = scrubJSONFile(data)
+		}
+		if err != nil {
+			return exitErr(exitValidation, fmt.Errorf("cassette %s: %w", path, err))
+		}
+		files["cassettes/"+filepath.Base(path)] = data
+	}
+	for _, path := range opt.logs {
+		data, err := tailLines(path, opt.lines)
+		if err == nil && data == nil {
+			err = os.ErrNotExist
+		}
+		if err != nil {
+			return exitErr(exitValidation, fmt.Errorf("log %s: %w", path, err))
+		}
+		files["logs/"+filepath.Base(path)] = data
+	}
+
+	var readme bytes.Buffer
+	readme.WriteString("campay debug bundle\n\n")
+	readme.WriteString("Credentials, tokens, keys and signatures are replaced with REDACTED. Phone numbers\n")
+	readme.WriteString("keep their prefix and last two digits. Names, descriptions and hosts are removed.\n\n")
+	for _, s := range skipped {
+		fmt.Fprintf(&readme, "Left out: %s\n", s)
+	}
+	files["README.txt"] = readme.Bytes()
+
+	if err := writeZip(opt.out, files); err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	fmt.Printf("✓ Wrote %s\n", opt.out)
+	for _, name := range names {
+		fmt.Printf("  %-28s %7d bytes\n", name, len(files[name]))
+	}
+	for _, s := range skipped {
+		fmt.Printf("  ⚠ Left out %s\n", s)
+	}
+	fmt.Println("Look through it before sharing: free text in logs is scrubbed by pattern only.")
+	return nil
+}
+
+// writeZip writes files to a new zip at path, removing it on failure.
+func writeZip(path string, files map[string][]byte) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	names := make([]string, 0, len(files))
+	for name := range files {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	zw := zip.NewWriter(f)
+	err = func() error {
+		for _, name := range names {
+			w, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Deflate, Modified: time.Now()})
+			if err != nil {
+				return err
+			}
+			if _, err := io.Copy(w, bytes.NewReader(files[name])); err != nil {
+				return err
+			}
+		}
+		return zw.Close()
+	}()
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(path)
+	}
+	return err
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ========================= DEMO MODE =========================
+   ============================================================ */
+
+// --demo runs any command against the built-in mock API with fake money,
+// so trainers can walk cashiers through prompts, the USSD wait and
+// receipts without credentials or real phones. The payer's number scripts
+// what the "customer" does, and the demo keeps its own data directory so
+// its transactions never mix with real ones.
+
+type demoOutcome string
+
+const (
+	demoConfirm demoOutcome = "confirm" // approves after the wait
+	demoReject  demoOutcome = "reject"  // declines after the wait
+	demoIgnore  demoOutcome = "ignore"  // never answers the prompt
+)
+
+// demoScript is what the customer behind phone does: numbers ending in 0
+// decline, numbers ending in 9 never answer, all others approve.
+func demoScript(phone string) demoOutcome {
+	switch {
+	case strings.HasSuffix(phone, "0"):
+		return demoReject
+	case strings.HasSuffix(phone, "9"):
+		return demoIgnore
+	}
+	return demoConfirm
+}
+
+// demoSMS prints SMS receipts instead of sending them.
+type demoSMS struct{}
+
+func (demoSMS) SendSMS(ctx context.Context, to, text string) error {
+	fmt.Printf("📱 SMS to %s: %s\n", to, text)
+	return nil
+}
+
+// startDemo points cfg at an in-process mock whose customers answer after
+// wait, and moves the data directory to demo/ inside the real one.
+func startDemo(cfg *Config, wait time.Duration) error {
+	dir, err := dataDir()
+	if err != nil {
+		return err
+	}
+	os.Setenv("CAMPAY_HOME", filepath.Join(dir, "demo"))
+
+	mock := newMockCampay(wait, 0)
+	mock.script = demoScript
+	// Left running until the process exits
+	server := httptest.NewServer(mock.routes())
+
+	cfg.Provider = "campay"
+	cfg.Env = "DEMO"
+	cfg.APIBaseURL = server.URL
+	cfg.Username, cfg.Password = "demo", "demo"
+	cfg.settings.replaced("demo", "provider", "environment", "username", "password")
+	cfg.Secrets = SecretsConfig{}
+	if cfg.SMS != nil {
+		cfg.SMS.sender = demoSMS{}
+	} else {
+		cfg.SMS = &smsReceipts{sender: demoSMS{}, merchant: "Demo shop"}
+	}
+	receiptSMS = cfg.SMS
+
+	fmt.Fprintln(os.Stderr, tr("demo.banner", wait))
+	return nil
+}
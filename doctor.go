@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ============================================================
+   ========================== DOCTOR ===========================
+   ============================================================ */
+
+// maxClockSkew is how far the local clock may drift from CamPay's before
+// webhook JWT expiry checks become unreliable.
+const maxClockSkew = time.Minute
+
+type checkResult struct {
+	Name   string
+	Level  string // pass, warn or fail
+	Detail string
+}
+
+type profileReport struct {
+	Profile string
+	Env     string
+	Checks  []checkResult
+}
+
+func (r *profileReport) add(name, level, format string, args ...any) {
+	r.Checks = append(r.Checks, checkResult{Name: name, Level: level, Detail: fmt.Sprintf(format, args...)})
+}
+
+// runDoctor checks every configured profile in parallel and prints a
+// pass/fail report.
+func runDoctor(cfg *Config, args []string) error {
+	names := make([]string, 0, len(cfg.Profiles))
+	for name := range cfg.Profiles {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	if cfg.Profile != "" || len(names) == 0 {
+		// Only the active configuration
+		names = []string{cfg.Profile}
+	}
+
+	reports := make([]profileReport, len(names))
+	var wg sync.WaitGroup
+	for i, name := range names {
+		pc := *cfg
+		if name != "" {
+			if err := applyProfile(&pc, name); err != nil {
+				return err
+			}
+		}
+		wg.Add(1)
+		go func(i int, pc Config) {
+			defer wg.Done()
+			reports[i] = checkProfile(&pc)
+		}(i, pc)
+	}
+	wg.Wait()
+
+	failed := 0
+	for _, r := range reports {
+		name := r.Profile
+		if name == "" {
+			name = "(environment)"
+		}
+		fmt.Printf("\nProfile: %s [%s]\n", name, r.Env)
+		for _, c := range r.Checks {
+			icon := map[string]string{"pass": "✓", "warn": "⚠", "fail": "❌"}[c.Level]
+			fmt.Printf("  %s %-15s %s\n", icon, c.Name, c.Detail)
+			if c.Level == "fail" {
+				failed++
+			}
+		}
+	}
+
+	fmt.Println()
+	if failed > 0 {
+		return fmt.Errorf("%d check(s) failed", failed)
+	}
+	fmt.Println("✓ All checks passed")
+	return nil
+}
+
+func checkProfile(cfg *Config) profileReport {
+	report := profileReport{Profile: cfg.Profile, Env: cfg.Env}
+
+	if p := cfg.Profiles[cfg.Profile]; p.Keychain && p.Password == "" {
+		if err := resolveKeychain(cfg); err != nil {
+			report.add("keychain", "fail", "%v", err)
+			return report
+		}
+		report.add("keychain", "pass", "password read from the %s keychain item", keychainService)
+	}
+
+	if cfg.Secrets.Provider != "" {
+		if err := resolveSecrets(cfg); err != nil {
+			report.add("secrets", "fail", "%v", err)
+			return report
+		}
+		report.add("secrets", "pass", "fetched %s from %s", cfg.Secrets.Name, cfg.Secrets.Provider)
+	}
+
+	if cfg.Username == "" || cfg.Password == "" {
+		report.add("credentials", "fail", "username or password missing")
+		return report
+	}
+	report.add("credentials", "pass", "configured")
+
+	checkWebhookKey(&report, cfg.WebhookKey)
+	if cfg.PreviousWebhookKey != "" {
+		report.add("previous webhook key", "warn", "still accepted; run `campay webhook drop-previous-key` once CamPay signs with the new key")
+	}
+
+	client, err := newClient(cfg)
+	if err != nil {
+		report.add("client", "fail", "%v", err)
+		return report
+	}
+
+	ctx := context.Background()
+	start := time.Now()
+	if err := client.Authenticate(ctx); err != nil {
+		report.add("authentication", "fail", "%v", err)
+		return report
+	}
+	report.add("authentication", "pass", "token issued in %s", time.Since(start).Round(time.Millisecond))
+
+	if balance, err := client.Balance(ctx); err != nil {
+		report.add("balance", "fail", "%v", err)
+	} else {
+		report.add("balance", "pass", "reachable (%s)", formatMoney(balance.TotalBalance, balance.Currency))
+	}
+
+	skew, haveSkew := client.ClockSkew()
+	switch {
+	case !haveSkew:
+		report.add("clock skew", "warn", "server sent no Date header")
+	case skew > maxClockSkew || skew < -maxClockSkew:
+		report.add("clock skew", "fail", "local clock is off by %s (max %s)", skew.Round(time.Second), maxClockSkew)
+	default:
+		report.add("clock skew", "pass", "%s", skew.Round(time.Second))
+	}
+	return report
+}
+
+func checkWebhookKey(report *profileReport, key string) {
+	switch {
+	case key == "":
+		report.add("webhook key", "warn", "not configured (webhooks cannot be verified)")
+	case strings.TrimSpace(key) != key || strings.ContainsAny(key, " \t\r\n"):
+		report.add("webhook key", "fail", "contains whitespace; check for copy/paste errors")
+	case len(key) < 16:
+		report.add("webhook key", "warn", "only %d characters; CamPay keys are usually longer", len(key))
+	default:
+		report.add("webhook key", "pass", "present (%d characters)", len(key))
+	}
+}
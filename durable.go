@@ -0,0 +1,61 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+)
+
+/* ============================================================
+   ======================= DURABLE WRITES ======================
+   ============================================================ */
+
+// Files that a crash must not leave half written (batch runs, results,
+// retry files and signatures, the rewritten ledger) are written next to
+// their destination, synced, then renamed over it: a reader sees the old
+// file or the new one, never a mix.
+
+// writeFileAtomic replaces path with data.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	f, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return err
+	}
+	tmp := f.Name()
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+	return commitFile(f, path, perm)
+}
+
+// commitFile syncs and closes f, a temporary file, and renames it to path
+// with perm. f is removed if any step fails.
+func commitFile(f *os.File, path string, perm os.FileMode) error {
+	tmp := f.Name()
+	err := f.Chmod(perm)
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if err == nil {
+		err = os.Rename(tmp, path)
+	}
+	if err != nil {
+		os.Remove(tmp)
+		return err
+	}
+	syncDir(filepath.Dir(path))
+	return nil
+}
+
+// syncDir makes a rename in dir durable. It is best effort: some systems
+// cannot sync a directory.
+func syncDir(dir string) {
+	if d, err := os.Open(dir); err == nil {
+		d.Sync()
+		d.Close()
+	}
+}
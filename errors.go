@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== EXIT CODES =========================
+   ============================================================ */
+
+// Exit codes are part of the CLI contract; keep README in sync.
+const (
+	exitOK                = 0
+	exitError             = 1
+	exitPaymentFailed     = 2
+	exitTimeout           = 3
+	exitAuth              = 4
+	exitValidation        = 5
+	exitAPI               = 6
+	exitInsufficientFunds = 7
+	exitCancelled         = 8
+	exitRiskBlocked       = 9
+	exitReadOnly          = 10
+)
+
+var exitCategories = map[int]string{
+	exitOK:                "ok",
+	exitError:             "error",
+	exitPaymentFailed:     "payment_failed",
+	exitTimeout:           "timeout",
+	exitAuth:              "auth",
+	exitValidation:        "validation",
+	exitAPI:               "api",
+	exitInsufficientFunds: "insufficient_funds",
+	exitCancelled:         "cancelled",
+	exitRiskBlocked:       "risk_blocked",
+	exitReadOnly:          "read_only",
+}
+
+// exitMeanings explains each exit code, for the man page.
+var exitMeanings = map[int]string{
+	exitOK:                "Success",
+	exitError:             "Unexpected error",
+	exitPaymentFailed:     "The payment (or at least one batch row) ended as FAILED",
+	exitTimeout:           "A request timed out, or the customer did not confirm before the deadline",
+	exitAuth:              "Missing or rejected credentials",
+	exitValidation:        "Invalid input, flags or files",
+	exitAPI:               "CamPay returned an error",
+	exitInsufficientFunds: "The account balance cannot cover the operation",
+	exitCancelled:         "The transaction was cancelled locally while waiting",
+	exitRiskBlocked:       "A risk rule or the fraud check blocked the operation",
+	exitReadOnly:          "The operation would move money and read-only mode is on",
+}
+
+// cliError attaches an exit code to an error.
+type cliError struct {
+	code int
+	err  error
+}
+
+func (e *cliError) Error() string { return e.err.Error() }
+func (e *cliError) Unwrap() error { return e.err }
+
+func exitErr(code int, err error) error {
+	return &cliError{code: code, err: err}
+}
+
+func invalidInput(format string, args ...any) error {
+	return exitErr(exitValidation, fmt.Errorf(format, args...))
+}
+
+// exitCode maps an error returned by a command to its exit code.
+func exitCode(err error) int {
+	if err == nil {
+		return exitOK
+	}
+
+	var ce *cliError
+	if errors.As(err, &ce) {
+		return ce.code
+	}
+
+	var te *campay.TimeoutError
+	if errors.As(err, &te) {
+		return exitTimeout
+	}
+
+	var ve *campay.ValidationError
+	if errors.As(err, &ve) {
+		return exitValidation
+	}
+
+	var re *campay.RejectedError
+	if errors.As(err, &re) || errors.Is(err, campay.ErrPreCollectFailed) {
+		return exitRiskBlocked
+	}
+
+	if errors.Is(err, campay.ErrReadOnly) {
+		return exitReadOnly
+	}
+
+	var ae *campay.APIError
+	if errors.As(err, &ae) {
+		if ae.StatusCode == http.StatusUnauthorized || ae.StatusCode == http.StatusForbidden {
+			return exitAuth
+		}
+		return exitAPI
+	}
+
+	return exitError
+}
+
+func reportError(err error) {
+	code := exitCode(err)
+	var out io.Writer = os.Stdout
+	if quiet {
+		out = os.Stderr
+		if noEmoji {
+			out = emojiFilter{os.Stderr}
+		}
+	}
+
+	if outputFormat != "json" {
+		fmt.Fprintln(out, tr("err.prefix"), err)
+		return
+	}
+
+	report := map[string]any{
+		"code":     code,
+		"category": exitCategories[code],
+		"message":  err.Error(),
+	}
+	var ve *campay.ValidationError
+	if errors.As(err, &ve) {
+		problems := make([]map[string]string, len(ve.Problems))
+		for i, p := range ve.Problems {
+			problems[i] = map[string]string{"field": p.Field, "problem": p.Problem}
+		}
+		report["problems"] = problems
+	}
+	data, _ := json.Marshal(map[string]any{"error": report})
+	fmt.Fprintln(out, string(data))
+}
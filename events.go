@@ -0,0 +1,149 @@
+package main
+
+import (
+	"sync"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== EVENTS ===========================
+   ============================================================ */
+
+// The ledger publishes a campay.TxEvent for every step of a transaction it
+// records: initiated when a payment is first recorded, status_changed and
+// terminal from UpdateStatus and MarkAbandoned, refunded when a refund
+// payout succeeds, and retried when the dashboard sends a payment again.
+// Components of the same process subscribe instead of rereading the
+// ledger: the on-final hook and SMS receipt, the metrics counters, expiry
+// callbacks and the payment page's event stream. Another process writing
+// the same ledger is not heard; the payment page still rereads it now and
+// then for that.
+//
+// The bus calls subscribers in the publisher's goroutine, often a batch
+// worker or a webhook handler, so subscribers that call out (hook scripts,
+// SMS gateways, callback URLs) only queue the work for afterEvents, which
+// runs it in order on a goroutine of its own. main waits for it before the
+// process exits.
+
+// Subscribe calls fn with the events of the transactions this ledger
+// records from now on, and returns a function that stops it.
+func (l *Ledger) Subscribe(fn func(campay.TxEvent)) (unsubscribe func()) {
+	return l.events.Subscribe(fn)
+}
+
+// publish sends the event of kind about e, whose status was from.
+func (l *Ledger) publish(kind campay.TxEventKind, from campay.Status, e LedgerEntry) {
+	l.events.Publish(campay.TxEvent{
+		Kind:              kind,
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Type:              e.Kind,
+		Amount:            e.Amount,
+		Currency:          e.Currency,
+		From:              from,
+		Status:            e.Status,
+		Reason:            e.StatusReason,
+		RefundOf:          e.RefundOf,
+	})
+}
+
+// statusEvent is the kind of event for a change to status.
+func statusEvent(status campay.Status) campay.TxEventKind {
+	if isFinal(status) {
+		return campay.EventTerminal
+	}
+	return campay.EventStatusChanged
+}
+
+// subscribeDefaults wires the subscribers every ledger has: the on-final
+// hook and SMS receipt, run by afterEvents, and the event counters of
+// /metrics.
+func (l *Ledger) subscribeDefaults() {
+	l.Subscribe(func(ev campay.TxEvent) {
+		txEvents.add(ev.Kind)
+		if ev.Kind != campay.EventTerminal {
+			return
+		}
+		afterEvents.run(func() {
+			if e, err := l.Get(ev.Reference); err == nil && e != nil {
+				runFinalHook(*e)
+				sendReceiptSMS(*e)
+			}
+		})
+	})
+}
+
+// subscribeExpiry tells the callback URL of each payment given up on by
+// the poller or the sweeper, see sendExpiry.
+func subscribeExpiry(ledger *Ledger, secrets relaySecrets) {
+	ledger.Subscribe(func(ev campay.TxEvent) {
+		if ev.Status != campay.StatusExpiredLocal {
+			return
+		}
+		afterEvents.run(func() {
+			if e, err := ledger.Get(ev.Reference); err == nil && e != nil {
+				sendExpiry(*e, secrets)
+			}
+		})
+	})
+}
+
+// eventWork runs the slow work of subscribers one piece after another, off
+// the publishing goroutine.
+type eventWork struct {
+	once    sync.Once
+	queue   chan func()
+	pending sync.WaitGroup
+}
+
+var afterEvents eventWork
+
+// run queues fn. It only blocks, the publisher included, once a thousand
+// pieces are waiting.
+func (w *eventWork) run(fn func()) {
+	w.once.Do(func() {
+		w.queue = make(chan func(), 1024)
+		go func() {
+			for fn := range w.queue {
+				fn()
+				w.pending.Done()
+			}
+		}()
+	})
+	w.pending.Add(1)
+	w.queue <- fn
+}
+
+// wait returns once the work queued so far is done.
+func (w *eventWork) wait() {
+	w.pending.Wait()
+}
+
+// eventCounter counts the events published in this process, by kind.
+type eventCounter struct {
+	mu     sync.Mutex
+	counts map[campay.TxEventKind]int
+}
+
+var txEvents eventCounter
+
+func (c *eventCounter) add(kind campay.TxEventKind) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = map[campay.TxEventKind]int{}
+	}
+	c.counts[kind]++
+}
+
+// snapshot returns the counts by kind name.
+func (c *eventCounter) snapshot() map[string]int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := map[string]int{}
+	for kind, n := range c.counts {
+		counts[string(kind)] = n
+	}
+	return counts
+}
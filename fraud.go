@@ -0,0 +1,114 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== FRAUD CHECK ========================
+   ============================================================ */
+
+// With fraud_check.url set, every collection is sent to the merchant's
+// fraud or risk service before CamPay is asked for the money, wherever it
+// starts: collect, sessions, plans, stdin, daemon jobs, dashboard retries
+// and transfers. The service approves, rejects or flags it (see
+// campay.HTTPPreCollect). A rejection fails the collection with the
+// risk_blocked exit code and cannot be forced; a flagged collection goes
+// ahead with the reason kept in its ledger entry. Rejections and flags are
+// written to the audit log.
+
+// FraudCheckConfig is the fraud_check section of the config file.
+type FraudCheckConfig struct {
+	URL      string `json:"url,omitempty"`
+	Secret   string `json:"secret,omitempty"`    // signs each check, or FRAUD_CHECK_SECRET
+	Timeout  string `json:"timeout,omitempty"`   // default 5s
+	FailOpen bool   `json:"fail_open,omitempty"` // flag instead of fail when the service is down
+
+	timeout time.Duration
+}
+
+// validate parses the timeout.
+func (f *FraudCheckConfig) validate() error {
+	if f.URL == "" {
+		return nil
+	}
+	if !strings.HasPrefix(f.URL, "http://") && !strings.HasPrefix(f.URL, "https://") {
+		return invalidInput("url must be an http(s) URL")
+	}
+	if f.Timeout == "" {
+		f.Timeout = "5s"
+	}
+	d, err := time.ParseDuration(f.Timeout)
+	if err != nil || d <= 0 {
+		return invalidInput("timeout must be a duration, e.g. 5s")
+	}
+	f.timeout = d
+	return nil
+}
+
+// hook returns the pre-collect hook of the config, or nil when no fraud
+// check is configured.
+func (f FraudCheckConfig) hook(cfg *Config) campay.PreCollectHook {
+	if f.URL == "" {
+		return nil
+	}
+	secret := f.Secret
+	if secret == "" {
+		secret = os.Getenv("FRAUD_CHECK_SECRET")
+	}
+	return auditedFraudCheck{cfg: cfg, next: &campay.HTTPPreCollect{
+		URL:      f.URL,
+		Secret:   secret,
+		Timeout:  f.timeout,
+		FailOpen: f.FailOpen,
+	}}
+}
+
+// auditedFraudCheck writes the rejections and flags of next to the audit
+// log and tells the operator about them.
+type auditedFraudCheck struct {
+	cfg  *Config
+	next campay.PreCollectHook
+}
+
+func (a auditedFraudCheck) CheckCollect(ctx context.Context, req campay.CollectRequest) (campay.Verdict, error) {
+	v, err := a.next.CheckCollect(ctx, req)
+	if err != nil || v.Decision == campay.DecisionApprove {
+		return v, err
+	}
+	if v.Decision == campay.DecisionFlag {
+		fmt.Printf("⚠ Flagged for review by the fraud check: %s\n", v.Reason)
+	}
+	aerr := appendAudit(AuditEvent{
+		Action:            "fraud_check",
+		Outcome:           string(v.Decision),
+		Credential:        a.cfg.Username,
+		Profile:           a.cfg.Profile,
+		Environment:       a.cfg.Env,
+		ExternalReference: req.ExternalReference,
+		Phone:             req.From,
+		Amount:            req.Amount,
+		Details:           map[string]any{"reason": v.Reason},
+	})
+	if aerr != nil {
+		fmt.Println("⚠ Failed to write audit log:", aerr)
+	}
+	return v, nil
+}
+
+// reviewReason is what the ledger keeps of a flagged collection.
+func reviewReason(resp *campay.CollectResponse) string {
+	if resp == nil || resp.Review == nil {
+		return ""
+	}
+	if resp.Review.Reason == "" {
+		return "flagged by the fraud check"
+	}
+	return resp.Review.Reason
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+/* ============================================================
+   ==================== CURRENCY CONVERSION ====================
+   ============================================================ */
+
+// ConversionConfig enables showing XAF amounts in a foreign currency.
+// Rate is the number of XAF per unit of Currency; when RateURL is set the
+// rate is fetched from it instead (JSON body: {"rate": 655.957}).
+type ConversionConfig struct {
+	Currency string  `json:"currency"`
+	Rate     float64 `json:"rate"`
+	RateURL  string  `json:"rate_url"`
+}
+
+// RateProvider returns how many XAF one unit of currency is worth.
+type RateProvider interface {
+	Rate(currency string) (float64, error)
+}
+
+type staticRate float64
+
+func (r staticRate) Rate(string) (float64, error) {
+	return float64(r), nil
+}
+
+// httpRateProvider fetches the rate once and reuses it for the rest of
+// the process.
+type httpRateProvider struct {
+	url string
+
+	once sync.Once
+	rate float64
+	err  error
+}
+
+func (p *httpRateProvider) Rate(currency string) (float64, error) {
+	p.once.Do(func() {
+		client := &http.Client{Timeout: 5 * time.Second}
+		resp, err := client.Get(strings.ReplaceAll(p.url, "{currency}", currency))
+		if err != nil {
+			p.err = err
+			return
+		}
+		defer resp.Body.Close()
+
+		if resp.StatusCode != 200 {
+			p.err = fmt.Errorf("rate provider answered %d", resp.StatusCode)
+			return
+		}
+
+		var body struct {
+			Rate float64 `json:"rate"`
+		}
+		if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+			p.err = err
+			return
+		}
+		p.rate = body.Rate
+	})
+	return p.rate, p.err
+}
+
+// fxDisplay formats XAF amounts with their foreign-currency equivalent.
+type fxDisplay struct {
+	currency string
+	provider RateProvider
+	rounding Rounding // to cents
+}
+
+func newFXDisplay(c *ConversionConfig, rounding Rounding) (*fxDisplay, error) {
+	if c == nil || c.Currency == "" {
+		return nil, nil
+	}
+
+	var provider RateProvider
+	switch {
+	case c.RateURL != "":
+		provider = &httpRateProvider{url: c.RateURL}
+	case c.Rate > 0:
+		provider = staticRate(c.Rate)
+	default:
+		return nil, fmt.Errorf("conversion: set either rate or rate_url for %s", c.Currency)
+	}
+
+	return &fxDisplay{currency: strings.ToUpper(c.Currency), provider: provider, rounding: rounding}, nil
+}
+
+// Convert returns e.g. "≈ 22.87 EUR", or "" when conversion is disabled
+// or the rate is unavailable.
+func (fx *fxDisplay) Convert(xaf float64) string {
+	if fx == nil {
+		return ""
+	}
+	rate, err := fx.provider.Rate(fx.currency)
+	if err != nil || rate <= 0 {
+		return ""
+	}
+	converted := new(big.Rat).Quo(floatRat(xaf), floatRat(rate))
+	return fmt.Sprintf("≈ %s %s", fx.rounding.RoundTo(converted, 2), fx.currency)
+}
@@ -2,4 +2,8 @@ module cohort5-go-api
 
 go 1.25.4
 
-require github.com/joho/godotenv v1.5.1
+require (
+	github.com/joho/godotenv v1.5.1
+	golang.org/x/sys v0.37.0
+	golang.org/x/term v0.36.0
+)
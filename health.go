@@ -0,0 +1,157 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+/* ============================================================
+   ========================== HEALTH ===========================
+   ============================================================ */
+
+// busyUntil is when CamPay last said it would accept calls again (unix
+// nanoseconds), set whenever it answers 429 or 503 with Retry-After.
+var busyUntil atomic.Int64
+
+// onProviderBusy is installed as campay.Options.OnBusy.
+func onProviderBusy(op string, status int, wait time.Duration) {
+	busyUntil.Store(time.Now().Add(wait).UnixNano())
+	fmt.Println(tr("api.busy", status, op, wait.Round(time.Second)))
+}
+
+// providerBusy returns how long CamPay asked us to wait, or 0.
+func providerBusy() time.Duration {
+	if d := time.Until(time.Unix(0, busyUntil.Load())); d > 0 {
+		return d
+	}
+	return 0
+}
+
+// healthStatus is the body of /healthz.
+type healthStatus struct {
+	Status string `json:"status"` // always ok
+}
+
+// handleHealthz is the liveness probe: it answers as long as the process
+// serves requests. Whether it should get traffic is /readyz.
+func handleHealthz(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, healthStatus{Status: "ok"})
+}
+
+// readyStatus is the body of /readyz. Checks maps each check (ledger,
+// token, provider) to "ok", "skipped" or what failed.
+type readyStatus struct {
+	Status     string            `json:"status"` // ready or not_ready
+	Checks     map[string]string `json:"checks"`
+	RetryAfter int               `json:"retry_after,omitempty"`
+}
+
+// readyCache is how long a readiness result is reused.
+const readyCache = 10 * time.Second
+
+// tokenExpirer is implemented by providers that know when their API token
+// expires.
+type tokenExpirer interface {
+	TokenExpiry() time.Time
+}
+
+// readiness is the readiness probe of serve and the daemon: the ledger is
+// writable, the API token is valid and the provider answers within sla.
+// Results are kept for cache, so frequent probes do not load CamPay.
+type readiness struct {
+	ledger   *Ledger
+	provider func(ctx context.Context) (Provider, error) // authenticated; nil without credentials
+	sla      time.Duration
+	cache    time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	last    readyStatus
+}
+
+func (rd *readiness) check() readyStatus {
+	rd.mu.Lock()
+	defer rd.mu.Unlock()
+	if time.Since(rd.checked) < rd.cache {
+		return rd.last
+	}
+
+	st := readyStatus{Status: "ready", Checks: map[string]string{}}
+	fail := func(name string, err error) {
+		st.Status = "not_ready"
+		st.Checks[name] = err.Error()
+	}
+
+	st.Checks["ledger"] = "ok"
+	if err := rd.ledger.Writable(); err != nil {
+		fail("ledger", err)
+	}
+
+	st.Checks["token"], st.Checks["provider"] = "skipped", "skipped"
+	if rd.provider != nil {
+		ctx, cancel := context.WithTimeout(context.Background(), rd.sla)
+		defer cancel()
+		start := time.Now()
+		p, err := rd.provider(ctx)
+		switch {
+		case err != nil:
+			fail("token", err)
+		case tokenExpired(p):
+			fail("token", errors.New("the API token has expired"))
+		default:
+			st.Checks["token"] = "ok"
+			if bp, ok := p.(balanceProvider); ok {
+				_, err = bp.Balance(ctx)
+			} else {
+				err = p.Authenticate(ctx)
+			}
+			if err == nil && time.Since(start) > rd.sla {
+				err = fmt.Errorf("answered in %s, more than %s", time.Since(start).Round(time.Millisecond), rd.sla)
+			}
+			if err != nil {
+				fail("provider", err)
+			} else {
+				st.Checks["provider"] = "ok"
+			}
+		}
+	}
+
+	// CamPay asked to wait: not an error of this replica, but no traffic
+	if wait := providerBusy(); wait > 0 {
+		st.Status = "not_ready"
+		st.Checks["provider"] = "busy"
+		st.RetryAfter = int(wait.Round(time.Second) / time.Second)
+	}
+
+	rd.checked, rd.last = time.Now(), st
+	return st
+}
+
+func tokenExpired(p Provider) bool {
+	te, ok := p.(tokenExpirer)
+	if !ok {
+		return false
+	}
+	expiry := te.TokenExpiry()
+	return !expiry.IsZero() && time.Now().After(expiry)
+}
+
+// handleReadyz answers 503 while a check fails or CamPay is busy or in
+// maintenance, so Kubernetes or a load balancer routes payments elsewhere.
+func (rd *readiness) handleReadyz(w http.ResponseWriter, r *http.Request) {
+	st := rd.check()
+	if st.Status != "ready" {
+		if st.RetryAfter > 0 {
+			w.Header().Set("Retry-After", strconv.Itoa(st.RetryAfter))
+		}
+		writeJSON(w, http.StatusServiceUnavailable, st)
+		return
+	}
+	writeJSON(w, http.StatusOK, st)
+}
@@ -0,0 +1,298 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= HISTORY EXPORT ======================
+   ============================================================ */
+
+// history export writes CamPay's transaction history to a CSV or JSON
+// lines file. The history endpoint has no pages of its own, so the period
+// is asked for a few days at a time, and each answer is decoded and
+// written as it arrives (campay.StreamHistory): memory use does not grow
+// with the account.
+//
+// After each window, a cursor next to the file (<file>.cursor) records
+// the next day to fetch and the size of the file so far. An export that
+// stops, on an error, Ctrl-C or --limit, continues with --resume: the file
+// is cut back to the last complete window, which is fetched again.
+
+// historyCursor is the state of an unfinished export.
+type historyCursor struct {
+	Since  string `json:"since"`
+	Until  string `json:"until"`
+	Format string `json:"format"`
+	Window int    `json:"window"`
+	Next   string `json:"next"`   // first day not written yet
+	Offset int64  `json:"offset"` // size of the file up to Next
+	Count  int    `json:"count"`  // transactions up to Next
+}
+
+var historyColumns = []string{"datetime", "reference", "external_reference", "type", "status", "amount", "currency",
+	"operator", "phone_number", "description"}
+
+// historyExportOptions are the flags of history export.
+type historyExportOptions struct {
+	out    string
+	format string
+	since  string
+	until  string
+	window int
+	limit  int
+	resume bool
+}
+
+// historyExportFlags defines the flags of history export on fs.
+func historyExportFlags(fs *flag.FlagSet, cfg *Config) *historyExportOptions {
+	opt := &historyExportOptions{}
+	fs.StringVar(&opt.out, "out", "", "file to write (required)")
+	fs.StringVar(&opt.format, "format", "csv", "csv or jsonl")
+	fs.StringVar(&opt.since, "since", "", "first day, like 2026-01-31 (default: 30 days ago)")
+	fs.StringVar(&opt.until, "until", "", "last day, inclusive (default: today)")
+	fs.IntVar(&opt.window, "window", 7, "days asked for in each history request")
+	fs.IntVar(&opt.limit, "limit", 100000, "stop after this many transactions, leaving the export resumable (0 for no limit)")
+	fs.BoolVar(&opt.resume, "resume", false, "continue the unfinished export into --out")
+	return opt
+}
+
+// runHistory works on CamPay's transaction history.
+func runHistory(cfg *Config, args []string) error {
+	if len(args) == 0 || args[0] != "export" {
+		return invalidInput("usage: campay history export --out <file> [flags]")
+	}
+	fs := newFlagSet("history export")
+	opt := historyExportFlags(fs, cfg)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+	if opt.out == "" {
+		return invalidInput("--out is required")
+	}
+	if opt.window < 1 {
+		return invalidInput("--window must be at least 1 day")
+	}
+	if opt.limit < 0 {
+		return invalidInput("--limit cannot be negative")
+	}
+	cursorPath := opt.out + ".cursor"
+
+	var cur historyCursor
+	if opt.resume {
+		data, err := os.ReadFile(cursorPath)
+		if errors.Is(err, os.ErrNotExist) {
+			return invalidInput("no unfinished export into %s", opt.out)
+		}
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, &cur); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", cursorPath, err)
+		}
+		fs.Visit(func(f *flag.Flag) {
+			if f.Name == "window" {
+				cur.Window = opt.window
+			}
+		})
+	} else {
+		if _, err := os.Stat(cursorPath); err == nil {
+			return invalidInput("%s holds an unfinished export; continue it with --resume or delete %s", opt.out, cursorPath)
+		}
+		if opt.format != "csv" && opt.format != "jsonl" {
+			return invalidInput("--format must be csv or jsonl")
+		}
+		now := inZone(time.Now())
+		cur = historyCursor{Since: now.AddDate(0, 0, -30).Format("2006-01-02"), Until: now.Format("2006-01-02"), Format: opt.format, Window: opt.window}
+		for _, d := range []struct {
+			flag  string
+			value string
+			dst   *string
+		}{{"--since", opt.since, &cur.Since}, {"--until", opt.until, &cur.Until}} {
+			if d.value == "" {
+				continue
+			}
+			if _, err := time.Parse("2006-01-02", d.value); err != nil {
+				return invalidInput("%s must be a date like 2026-01-31", d.flag)
+			}
+			*d.dst = d.value
+		}
+		if cur.Until < cur.Since {
+			return invalidInput("--until is before --since")
+		}
+		cur.Next = cur.Since
+	}
+
+	flags := os.O_CREATE | os.O_WRONLY | os.O_TRUNC
+	if opt.resume {
+		flags = os.O_WRONLY
+	}
+	f, err := os.OpenFile(opt.out, flags, 0600)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if err := f.Truncate(cur.Offset); err != nil {
+		return err
+	}
+	if _, err := f.Seek(cur.Offset, io.SeekStart); err != nil {
+		return err
+	}
+
+	client, err := authenticate(cfg)
+	if err != nil {
+		return err
+	}
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	w := newHistoryWriter(f, cur.Format)
+	if !opt.resume {
+		if err := w.header(); err != nil {
+			return err
+		}
+		if cur.Offset, err = f.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		if err := saveHistoryCursor(cursorPath, cur); err != nil {
+			return err
+		}
+	}
+	if cur.Count > 0 {
+		fmt.Fprintf(os.Stderr, "Resuming at %s with %d transactions written\n", cur.Next, cur.Count)
+	}
+
+	last, _ := time.Parse("2006-01-02", cur.Until)
+	tty := isTerminal(os.Stderr) && ansiStderr
+	for {
+		start, _ := time.Parse("2006-01-02", cur.Next)
+		if start.After(last) {
+			break
+		}
+		end := start.AddDate(0, 0, max(cur.Window, 1)-1)
+		if end.After(last) {
+			end = last
+		}
+
+		n := 0
+		err := client.StreamHistory(ctx, start, end, func(item campay.HistoryItem) error {
+			if opt.limit > 0 && cur.Count+n >= opt.limit {
+				return errHistoryLimit
+			}
+			if err := w.write(item); err != nil {
+				return err
+			}
+			n++
+			if tty && n%500 == 0 {
+				fmt.Fprintf(os.Stderr, "\r  %s to %s: %d transactions...", start.Format("2006-01-02"), end.Format("2006-01-02"), n)
+			}
+			return nil
+		})
+		if err == nil {
+			err = w.flush()
+		}
+		if tty {
+			fmt.Fprint(os.Stderr, "\r\033[K")
+		}
+		if err != nil {
+			w.flush()
+			if errors.Is(err, errHistoryLimit) {
+				fmt.Fprintf(os.Stderr, "⚠ Stopped at --limit %d during %s to %s\n", opt.limit, start.Format("2006-01-02"), end.Format("2006-01-02"))
+			} else {
+				fmt.Fprintf(os.Stderr, "❌ %s to %s: %v\n", start.Format("2006-01-02"), end.Format("2006-01-02"), err)
+			}
+			fmt.Fprintf(os.Stderr, "%d transactions up to %s are complete; continue with: campay history export --out %s --resume\n",
+				cur.Count, cur.Next, opt.out)
+			if errors.Is(err, errHistoryLimit) {
+				return exitErr(exitError, fmt.Errorf("export stopped at --limit %d", opt.limit))
+			}
+			return err
+		}
+
+		cur.Count += n
+		cur.Next = end.AddDate(0, 0, 1).Format("2006-01-02")
+		if cur.Offset, err = f.Seek(0, io.SeekCurrent); err != nil {
+			return err
+		}
+		if err := saveHistoryCursor(cursorPath, cur); err != nil {
+			return err
+		}
+		fmt.Fprintf(os.Stderr, "  %s to %s: %d transactions (%d in all)\n", start.Format("2006-01-02"), end.Format("2006-01-02"), n, cur.Count)
+	}
+
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Remove(cursorPath); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	fmt.Printf("✓ Exported %d transactions from %s to %s (days in %s) into %s\n", cur.Count, cur.Since, cur.Until, zoneLabel(time.Now()), opt.out)
+	return nil
+}
+
+var errHistoryLimit = errors.New("history limit reached")
+
+func saveHistoryCursor(path string, cur historyCursor) error {
+	data, err := json.MarshalIndent(cur, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp := path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+// historyWriter writes history items as CSV rows or JSON lines.
+type historyWriter struct {
+	csv  *csv.Writer
+	json *json.Encoder
+}
+
+func newHistoryWriter(w io.Writer, format string) *historyWriter {
+	if format == "jsonl" {
+		return &historyWriter{json: json.NewEncoder(w)}
+	}
+	return &historyWriter{csv: csv.NewWriter(w)}
+}
+
+func (w *historyWriter) header() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Write(historyColumns)
+	return w.flush()
+}
+
+func (w *historyWriter) write(item campay.HistoryItem) error {
+	if w.json != nil {
+		return w.json.Encode(item)
+	}
+	return w.csv.Write([]string{item.Datetime, item.Reference, item.ExternalReference, item.Type, item.Status,
+		item.Amount.String(), item.Currency, item.Operator, item.PhoneNumber, item.Description})
+}
+
+// flush writes out buffered CSV rows; JSON lines are not buffered.
+func (w *historyWriter) flush() error {
+	if w.csv == nil {
+		return nil
+	}
+	w.csv.Flush()
+	return w.csv.Error()
+}
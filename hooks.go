@@ -0,0 +1,70 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"time"
+)
+
+/* ============================================================
+   =========================== HOOKS ===========================
+   ============================================================ */
+
+// hookTimeout bounds how long a hook script may run.
+const hookTimeout = 30 * time.Second
+
+// runFinalHook executes ~/.campay/hooks/on-final, if present and
+// executable, with the ledger entry as JSON on stdin. Like git hooks, a
+// missing script is not an error; a failing one prints a warning and is
+// queued for the daemon to run again.
+func runFinalHook(e LedgerEntry) {
+	if err := execFinalHook(e); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠ Hook failed for %s: %v\n", e.Reference, err)
+		enqueueNotification(notifyHook, e.Reference, nil, err)
+	}
+}
+
+// execFinalHook runs the on-final hook once for e.
+func execFinalHook(e LedgerEntry) error {
+	dir, err := dataDir()
+	if err != nil {
+		return nil
+	}
+	path := filepath.Join(dir, "hooks", "on-final")
+	fi, err := os.Stat(path)
+	if err != nil || fi.IsDir() || fi.Mode()&0111 == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), hookTimeout)
+	defer cancel()
+
+	cmd := exec.CommandContext(ctx, path)
+	cmd.Stdin = bytes.NewReader(payload)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	cmd.Env = append(os.Environ(),
+		"CAMPAY_REFERENCE="+e.Reference,
+		"CAMPAY_EXTERNAL_REFERENCE="+e.ExternalReference,
+		"CAMPAY_STATUS="+string(e.Status),
+		"CAMPAY_KIND="+e.Kind,
+	)
+	if err := cmd.Run(); err != nil {
+		if errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			err = fmt.Errorf("timed out after %s", hookTimeout)
+		}
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
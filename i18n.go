@@ -0,0 +1,271 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"unicode/utf8"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= LOCALIZATION ========================
+   ============================================================ */
+
+// lang is the active message catalog, set by --lang (default from LANG).
+var lang = detectLang()
+
+var catalogs = map[string]map[string]string{
+	"en": {
+		"banner":                 "=== CamPay Mobile Money Payment System ===",
+		"environment":            "Environment: %s",
+		"auth.start":             "🔐 Authenticating...",
+		"auth.ok":                "✓ Authentication successful",
+		"auth.missing":           "no CamPay credentials: run `campay setup`, or set CAMPAY_USERNAME and CAMPAY_PASSWORD",
+		"auth.prompt":            "No CamPay credentials are configured; enter them to continue (`campay setup` stores them for good).",
+		"auth.failed":            "authentication failed",
+		"warn.clock_skew":        "⚠ Local clock is off by %s from CamPay's (max %s); webhook signatures may fail verification",
+		"duplicate.warning":      "⚠ Possible duplicate: %s from %s was requested %s ago (%s, %s)",
+		"duplicate.confirm":      "Continue anyway? [y/N]: ",
+		"prompt.phone":           "Enter mobile money number (e.g., 670123456, 237670123456 or @contact): ",
+		"prompt.amount":          "Enter amount (XAF): ",
+		"prompt.description":     "Enter description: ",
+		"amount.converted":       "Amount: %s (%s)",
+		"description":            "Description: %s",
+		"collect.initiating":     "📲 Initiating payment...",
+		"collect.initiated":      "✓ Payment initiated",
+		"collect.reference":      "Reference: %s",
+		"collect.check":          "Please check your phone for USSD popup...",
+		"collect.dial":           "If no popup appears, dial %s and follow the prompts to confirm",
+		"operator.ask":           "Which network is %s on, MTN or Orange? ",
+		"operator.ported":        "Note: %s has a %s prefix but is on %s (ported number)",
+		"operator.push":          "The payment prompt will come from %s (%s)",
+		"operator.src.given":     "as chosen",
+		"operator.src.ported":    "from ported_numbers",
+		"operator.src.history":   "as on the last payment",
+		"operator.src.prefix":    "from the number prefix",
+		"poll.status":            "Status: %s (%s of %s)",
+		"api.busy":               "⏳ CamPay busy (%d on %s), retrying in %s",
+		"poll.progress":          "Status: %s · %s elapsed · %s left",
+		"err.prefix":             "❌ Error:",
+		"err.phone":              "invalid phone number format",
+		"err.phone.suggest":      "invalid phone number format (did you mean %s?)",
+		"phone.suggestions":      "⚠ %s is not a valid number. Did you mean:",
+		"prompt.suggestion":      "Pick a suggestion by its number, or type the phone again: ",
+		"err.amount":             "amount must be a positive integer",
+		"err.amount_format":      "invalid amount %q (e.g. 5000, 5k, 12.500 or 15000 XAF)",
+		"err.payment_failed":     "payment %s failed",
+		"err.expired":            "transaction %s was not confirmed within %s",
+		"err.unknown_status":     "transaction %s: CamPay answered status %q, which is not configured; stopped polling (see statuses in the config file)",
+		"err.cancelled":          "transaction %s was cancelled: %s",
+		"warning":                "⚠ Warning:",
+		"receipt.title":          "TRANSACTION FINAL STATUS",
+		"receipt.reference":      "Reference",
+		"receipt.external":       "External Reference",
+		"receipt.status":         "Status",
+		"receipt.amount":         "Amount",
+		"receipt.operator":       "Operator",
+		"receipt.desc":           "Description",
+		"receipt.code":           "Code",
+		"receipt.op_ref":         "Operator Reference",
+		"result.success":         "🎉 Payment successful!",
+		"result.failed":          "❌ Payment failed",
+		"result.unknown":         "⚠ Unknown status:",
+		"status.PENDING":         "PENDING",
+		"status.SUCCESSFUL":      "SUCCESSFUL",
+		"status.FAILED":          "FAILED",
+		"status.EXPIRED":         "EXPIRED",
+		"status.REVERSED":        "REVERSED",
+		"status.CANCELLED_LOCAL": "CANCELLED (LOCAL)",
+		"status.EXPIRED_LOCAL":   "EXPIRED (LOCAL)",
+		"page.title":             "Payment %s",
+		"page.pending":           "Check your phone and confirm the payment",
+		"page.dial":              "No prompt? Dial %s",
+		"page.success":           "Payment received, thank you!",
+		"page.failed":            "Payment failed",
+		"page.abandoned":         "Payment not confirmed",
+		"sms.receipt":            "%s: payment of %s received. Ref %s. Thank you!",
+		"demo.banner":            "🎓 DEMO MODE: fake money, no real phones. Customers answer after %s: numbers ending in 0 decline, in 9 never answer, all others approve.",
+		"outage.warning":         "⚠ %s confirmations failing at %d%% in the last %s (%d of %d collections); the customer may not get the prompt",
+		"session.start":          "Session started. Type q at the number prompt, or press Ctrl-D, to finish.",
+		"session.prompt.phone":   "Enter mobile money number, or q to finish: ",
+		"session.running":        "Session: %d payments, %s collected, %d failed",
+		"session.summary":        "SESSION SUMMARY",
+		"session.payments":       "Payments: %d (%d successful, %d failed, %d not completed)",
+		"session.total":          "Total collected: %s",
+		"session.duration":       "Duration: %s",
+		"session.pending":        "⚠ %s is still pending; check it later with `campay show %s`",
+	},
+	"fr": {
+		"banner":                 "=== Système de paiement Mobile Money CamPay ===",
+		"environment":            "Environnement : %s",
+		"auth.start":             "🔐 Authentification...",
+		"auth.ok":                "✓ Authentification réussie",
+		"auth.missing":           "aucun identifiant CamPay : lancez `campay setup`, ou définissez CAMPAY_USERNAME et CAMPAY_PASSWORD",
+		"auth.prompt":            "Aucun identifiant CamPay n'est configuré ; saisissez-les pour continuer (`campay setup` les enregistre durablement).",
+		"auth.failed":            "échec de l'authentification",
+		"warn.clock_skew":        "⚠ L'horloge locale diffère de %s de celle de CamPay (max %s) ; les signatures de webhook peuvent être rejetées",
+		"duplicate.warning":      "⚠ Doublon possible : %s de %s demandés il y a %s (%s, %s)",
+		"duplicate.confirm":      "Continuer quand même ? [y/N] : ",
+		"prompt.phone":           "Numéro mobile money (ex. 670123456, 237670123456 ou @contact) : ",
+		"prompt.amount":          "Montant (XAF) : ",
+		"prompt.description":     "Description : ",
+		"amount.converted":       "Montant : %s (%s)",
+		"description":            "Description : %s",
+		"collect.initiating":     "📲 Lancement du paiement...",
+		"collect.initiated":      "✓ Paiement lancé",
+		"collect.reference":      "Référence : %s",
+		"collect.check":          "Veuillez vérifier la fenêtre USSD sur votre téléphone...",
+		"collect.dial":           "Si aucune fenêtre n'apparaît, composez le %s et suivez les instructions pour confirmer",
+		"operator.ask":           "Sur quel réseau est le %s, MTN ou Orange ? ",
+		"operator.ported":        "Remarque : %s a un préfixe %s mais est chez %s (numéro porté)",
+		"operator.push":          "La demande de paiement viendra de %s (%s)",
+		"operator.src.given":     "choisi",
+		"operator.src.ported":    "d'après ported_numbers",
+		"operator.src.history":   "comme au dernier paiement",
+		"operator.src.prefix":    "d'après le préfixe",
+		"poll.status":            "Statut : %s (%s sur %s)",
+		"api.busy":               "⏳ CamPay occupé (%d sur %s), nouvel essai dans %s",
+		"poll.progress":          "Statut : %s · %s écoulées · %s restantes",
+		"err.prefix":             "❌ Erreur :",
+		"err.phone":              "format de numéro de téléphone invalide",
+		"err.phone.suggest":      "format de numéro de téléphone invalide (vouliez-vous dire %s ?)",
+		"phone.suggestions":      "⚠ %s n'est pas un numéro valide. Vouliez-vous dire :",
+		"prompt.suggestion":      "Choisissez une suggestion par son numéro, ou retapez le numéro : ",
+		"err.amount":             "le montant doit être un entier positif",
+		"err.amount_format":      "montant invalide %q (ex. 5000, 5k, 12.500 ou 15000 XAF)",
+		"err.payment_failed":     "le paiement %s a échoué",
+		"err.expired":            "la transaction %s n'a pas été confirmée en %s",
+		"err.unknown_status":     "transaction %s : CamPay a répondu le statut %q, qui n'est pas configuré ; suivi arrêté (voir statuses dans le fichier de configuration)",
+		"err.cancelled":          "la transaction %s a été annulée : %s",
+		"warning":                "⚠ Avertissement :",
+		"receipt.title":          "STATUT FINAL DE LA TRANSACTION",
+		"receipt.reference":      "Référence",
+		"receipt.external":       "Référence externe",
+		"receipt.status":         "Statut",
+		"receipt.amount":         "Montant",
+		"receipt.operator":       "Opérateur",
+		"receipt.desc":           "Description",
+		"receipt.code":           "Code",
+		"receipt.op_ref":         "Réf. opérateur",
+		"result.success":         "🎉 Paiement réussi !",
+		"result.failed":          "❌ Paiement échoué",
+		"result.unknown":         "⚠ Statut inconnu :",
+		"status.PENDING":         "EN ATTENTE",
+		"status.SUCCESSFUL":      "RÉUSSI",
+		"status.FAILED":          "ÉCHOUÉ",
+		"status.EXPIRED":         "EXPIRÉ",
+		"status.REVERSED":        "ANNULÉ PAR L'OPÉRATEUR",
+		"status.CANCELLED_LOCAL": "ANNULÉ (LOCAL)",
+		"status.EXPIRED_LOCAL":   "EXPIRÉ (LOCAL)",
+		"page.title":             "Paiement %s",
+		"page.pending":           "Vérifiez votre téléphone et confirmez le paiement",
+		"page.dial":              "Pas de demande ? Composez le %s",
+		"page.success":           "Paiement reçu, merci !",
+		"page.failed":            "Échec du paiement",
+		"page.abandoned":         "Paiement non confirmé",
+		"sms.receipt":            "%s : paiement de %s reçu. Réf %s. Merci !",
+		"demo.banner":            "🎓 MODE DÉMO : argent fictif, aucun vrai téléphone. Les clients répondent après %s : les numéros finissant par 0 refusent, par 9 ne répondent jamais, les autres acceptent.",
+		"outage.warning":         "⚠ Confirmations %s en échec à %d%% sur les dernières %s (%d sur %d encaissements) ; le client risque de ne pas recevoir la demande",
+		"session.start":          "Session ouverte. Tapez q au numéro, ou Ctrl-D, pour terminer.",
+		"session.prompt.phone":   "Numéro mobile money, ou q pour terminer : ",
+		"session.running":        "Session : %d paiements, %s encaissés, %d échoués",
+		"session.summary":        "RÉSUMÉ DE LA SESSION",
+		"session.payments":       "Paiements : %d (%d réussis, %d échoués, %d non aboutis)",
+		"session.total":          "Total encaissé : %s",
+		"session.duration":       "Durée : %s",
+		"session.pending":        "⚠ %s est toujours en attente ; vérifiez-le plus tard avec `campay show %s`",
+	},
+}
+
+// detectLang picks French when the locale says so, English otherwise.
+func detectLang() string {
+	for _, env := range []string{"LC_ALL", "LC_MESSAGES", "LANG"} {
+		if v := os.Getenv(env); v != "" {
+			if strings.HasPrefix(strings.ToLower(v), "fr") {
+				return "fr"
+			}
+			return "en"
+		}
+	}
+	return "en"
+}
+
+// tr formats the message key in the active language, falling back to
+// English and then to the key itself.
+func tr(key string, args ...any) string {
+	msg, ok := catalogs[lang][key]
+	if !ok {
+		if msg, ok = catalogs["en"][key]; !ok {
+			msg = key
+		}
+	}
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// statusLabel translates a CamPay status for display. Statuses without a
+// translation, such as custom final ones, are shown as sent.
+func statusLabel(status string) string {
+	s := parseStatus(status)
+	if _, ok := catalogs["en"]["status."+string(s)]; !ok {
+		return strings.ToUpper(strings.TrimSpace(status))
+	}
+	return tr("status." + string(s))
+}
+
+// amountSeparators are the thousands and decimal separators of each
+// language. French groups with a plain space rather than a no-break one,
+// which SMS gateways would send as Unicode.
+var amountSeparators = map[string][2]string{
+	"en": {",", "."},
+	"fr": {" ", ","},
+}
+
+// formatAmount writes amount for people to read, grouped by thousands in
+// the active language and followed by its currency: "15,000 XAF" in
+// English, "15 000 XAF" in French. Files and JSON keep plain numbers.
+func formatAmount(amount int, currency string) string {
+	return formatMoney(campay.Amount(amount), currency)
+}
+
+// formatMoney is formatAmount for amounts from CamPay, which may have a
+// fraction. Without a currency only the number is written.
+func formatMoney(amount campay.Amount, currency string) string {
+	sep, ok := amountSeparators[lang]
+	if !ok {
+		sep = amountSeparators["en"]
+	}
+	whole, frac, _ := strings.Cut(amount.String(), ".")
+	sign := ""
+	if strings.HasPrefix(whole, "-") {
+		sign, whole = "-", whole[1:]
+	}
+	var b strings.Builder
+	b.WriteString(sign)
+	for i, d := range whole {
+		if i > 0 && (len(whole)-i)%3 == 0 {
+			b.WriteString(sep[0])
+		}
+		b.WriteRune(d)
+	}
+	if frac != "" {
+		b.WriteString(sep[1] + frac)
+	}
+	if currency != "" {
+		b.WriteString(" " + currency)
+	}
+	return b.String()
+}
+
+// center pads s to be centered in a line of width runes.
+func center(s string, width int) string {
+	pad := (width - utf8.RuneCountInString(s)) / 2
+	if pad <= 0 {
+		return s
+	}
+	return strings.Repeat(" ", pad) + s
+}
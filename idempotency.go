@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ===================== RETRY-SAFE COLLECT ====================
+   ============================================================ */
+
+// collectAttempts bounds how many times one collect is submitted.
+const collectAttempts = 3
+
+// externalRefFinder is implemented by providers that can look a
+// transaction of kind (collect or withdraw) up by the caller's external
+// reference.
+type externalRefFinder interface {
+	FindByExternalReference(ctx context.Context, kind, externalRef string, since time.Time) (*campay.TransactionResponse, error)
+}
+
+func (p *campayProvider) FindByExternalReference(ctx context.Context, kind, externalRef string, since time.Time) (*campay.TransactionResponse, error) {
+	items, err := p.client.History(ctx, since, time.Now())
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		if item.ExternalReference == externalRef && (historyKind(item.Type) == "withdraw") == (kind == "withdraw") {
+			return &campay.TransactionResponse{
+				Reference:         item.Reference,
+				ExternalReference: item.ExternalReference,
+				Status:            item.Status,
+				Amount:            item.Amount,
+				Currency:          item.Currency,
+				Operator:          item.Operator,
+				Description:       item.Description,
+			}, nil
+		}
+	}
+	return nil, nil
+}
+
+// collectOutcomeUnknown reports whether err leaves it open whether CamPay
+// created the transaction. A refused connection, a 4xx answer or a request
+// refused before sending means it did not; a response timeout, a dropped
+// connection or a 5xx may hide a transaction that was created anyway.
+func collectOutcomeUnknown(err error) bool {
+	if collectNeverSent(err) {
+		return false
+	}
+	var te *campay.TimeoutError
+	if errors.As(err, &te) {
+		return !te.Connect
+	}
+	var ae *campay.APIError
+	if errors.As(err, &ae) {
+		return ae.StatusCode >= 500
+	}
+	var ce *cliError
+	return !errors.As(err, &ce)
+}
+
+// collectNeverSent reports whether err stopped the collection before it was
+// sent, for a reason that sending it again cannot change: an invalid
+// request, read-only mode, or a rejection by the fraud check.
+func collectNeverSent(err error) bool {
+	var ve *campay.ValidationError
+	var re *campay.RejectedError
+	return errors.As(err, &ve) || errors.As(err, &re) ||
+		errors.Is(err, campay.ErrReadOnly) || errors.Is(err, campay.ErrPreCollectFailed)
+}
+
+// submitCollect sends req and retries after errors. Before resubmitting
+// after an ambiguous failure it asks the provider whether a transaction
+// with the same external reference already exists and, if so, returns it
+// instead of charging the customer twice. Providers that cannot look
+// transactions up are never resubmitted after an ambiguous failure.
+func submitCollect(provider Provider, req campay.CollectRequest) (*campay.CollectResponse, error) {
+	started := time.Now()
+	finder, canFind := provider.(externalRefFinder)
+
+	// findExisting returns the transaction created by an earlier attempt,
+	// or nil when there is none.
+	findExisting := func(lastErr error) (*campay.CollectResponse, error) {
+		if !canFind {
+			return nil, lastErr
+		}
+		fmt.Println("⚠ The last attempt may have reached CamPay; checking before retrying...")
+		// History is filtered by day, so include the previous one
+		existing, err := finder.FindByExternalReference(context.Background(), "collect", req.ExternalReference, started.Add(-24*time.Hour))
+		if err != nil {
+			return nil, fmt.Errorf("%w (and could not check for an existing transaction: %v)", lastErr, err)
+		}
+		if existing == nil {
+			return nil, nil
+		}
+		fmt.Printf("✓ Found transaction %s from the earlier attempt; resuming it\n", existing.Reference)
+		return &campay.CollectResponse{
+			Reference:         existing.Reference,
+			ExternalReference: existing.ExternalReference,
+			Status:            existing.Status,
+			Amount:            campay.Amount(req.Amount),
+			Currency:          existing.Currency,
+			Operator:          existing.Operator,
+		}, nil
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= collectAttempts; attempt++ {
+		if attempt > 1 {
+			if collectOutcomeUnknown(lastErr) {
+				if resp, err := findExisting(lastErr); err != nil || resp != nil {
+					return resp, err
+				}
+			}
+			delay := time.Duration(attempt-1) * 2 * time.Second
+			fmt.Printf("⚠ Collect failed (%v); retrying in %s (attempt %d/%d)\n", lastErr, delay, attempt, collectAttempts)
+			time.Sleep(delay)
+		}
+
+		resp, err := provider.Collect(context.Background(), req)
+		if err == nil {
+			return resp, nil
+		}
+		lastErr = err
+
+		var ae *campay.APIError
+		if errors.As(err, &ae) && ae.StatusCode < 500 {
+			// CamPay rejected the request; resending it will not help
+			return nil, err
+		}
+		if collectNeverSent(err) {
+			// Nothing was sent, and resending cannot change that; the
+			// fraud check decides again on a new run
+			return nil, err
+		}
+	}
+
+	if collectOutcomeUnknown(lastErr) {
+		if resp, err := findExisting(lastErr); err != nil || resp != nil {
+			return resp, err
+		}
+	}
+	return nil, lastErr
+}
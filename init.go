@@ -0,0 +1,139 @@
+package main
+
+import (
+	"embed"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"text/template"
+)
+
+/* ============================================================
+   ========================== SCAFFOLD =========================
+   ============================================================ */
+
+//go:embed scaffold/*.tmpl
+var scaffoldFS embed.FS
+
+// scaffoldData fills the scaffold templates.
+type scaffoldData struct {
+	Name   string // directory name, used in descriptions
+	Module string // Go module path of the new project
+	Lib    string // local path of this library for the replace directive
+}
+
+// scaffoldFile maps a template to the file it produces.
+type scaffoldFile struct {
+	template string
+	path     string
+}
+
+var (
+	projectFiles = []scaffoldFile{
+		{"go.mod.tmpl", "go.mod"},
+		{"main.go.tmpl", "main.go"},
+		{"webhook.go.tmpl", "webhook.go"},
+		{"main_test.go.tmpl", "main_test.go"},
+		{"env.tmpl", ".env.example"},
+	}
+	configFiles = []scaffoldFile{
+		{"env.tmpl", ".env.example"},
+		{"config.json.tmpl", "config.json"},
+	}
+)
+
+// initOptions are the flags of init.
+type initOptions struct {
+	module     string
+	lib        string
+	configOnly bool
+	force      bool
+}
+
+// initFlags defines the flags of init on fs.
+func initFlags(fs *flag.FlagSet, cfg *Config) *initOptions {
+	opt := &initOptions{}
+	fs.StringVar(&opt.module, "module", "", "module path of the new project (default: the directory name)")
+	fs.StringVar(&opt.lib, "lib", "", "path to a local checkout of this library, used in a replace directive")
+	fs.BoolVar(&opt.configOnly, "config-only", false, "only write .env.example and config.json")
+	fs.BoolVar(&opt.force, "force", false, "overwrite existing files")
+	return opt
+}
+
+// runInit writes a starter Go project using the library (a collect
+// program, a webhook handler and a test against a mock CamPay server), or
+// with --config-only just a .env template and a CLI config file.
+func runInit(cfg *Config, args []string) error {
+	fs := newFlagSet("init")
+	opt := initFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 1 {
+		return invalidInput("usage: campay init [flags] [directory]")
+	}
+	dir := "."
+	if fs.NArg() == 1 {
+		dir = fs.Arg(0)
+	}
+
+	abs, err := filepath.Abs(dir)
+	if err != nil {
+		return err
+	}
+	data := scaffoldData{Name: filepath.Base(abs), Module: opt.module, Lib: opt.lib}
+	if data.Module == "" {
+		data.Module = data.Name
+	}
+	if data.Lib != "" {
+		if data.Lib, err = filepath.Abs(data.Lib); err != nil {
+			return err
+		}
+	}
+
+	files := projectFiles
+	if opt.configOnly {
+		files = configFiles
+	}
+	if !opt.force {
+		for _, f := range files {
+			if _, err := os.Stat(filepath.Join(dir, f.path)); err == nil {
+				return invalidInput("%s already exists (use --force to overwrite)", filepath.Join(dir, f.path))
+			}
+		}
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return err
+	}
+
+	tmpl, err := template.ParseFS(scaffoldFS, "scaffold/*.tmpl")
+	if err != nil {
+		return err
+	}
+	for _, f := range files {
+		out, err := os.Create(filepath.Join(dir, f.path))
+		if err != nil {
+			return err
+		}
+		err = errors.Join(tmpl.ExecuteTemplate(out, f.template, data), out.Close())
+		if err != nil {
+			return fmt.Errorf("failed to write %s: %w", f.path, err)
+		}
+		fmt.Println("  created", filepath.Join(dir, f.path))
+	}
+
+	fmt.Println()
+	if opt.configOnly {
+		fmt.Println("Next: fill in .env.example, save it as .env, and point CAMPAY_CONFIG at config.json.")
+		return nil
+	}
+	fmt.Printf("Next:\n  cd %s\n", dir)
+	if opt.lib == "" {
+		fmt.Println("  edit the replace directive in go.mod to point at this library")
+	}
+	fmt.Println("  go mod tidy && go test ./...")
+	fmt.Println("  cp .env.example .env  # add your CamPay app credentials")
+	return nil
+}
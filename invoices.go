@@ -0,0 +1,304 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= INVOICES ==========================
+   ============================================================ */
+
+// Invoice is a total collected in one or more partial payments that share
+// its external reference. What has been paid is always computed from the
+// ledger; SettledAt only records when the total was first reached.
+type Invoice struct {
+	ExternalReference string     `json:"external_reference"`
+	Total             int        `json:"total"`
+	Currency          string     `json:"currency"`
+	Description       string     `json:"description,omitempty"`
+	Installments      []int      `json:"installments,omitempty"`
+	CreatedAt         time.Time  `json:"created_at"`
+	SettledAt         *time.Time `json:"settled_at,omitempty"`
+}
+
+// Invoices maps an external reference to its invoice.
+type Invoices map[string]Invoice
+
+// invoiceBalance sums the collections made against an invoice.
+type invoiceBalance struct {
+	Paid     int
+	Pending  int
+	Payments []LedgerEntry
+}
+
+func (b invoiceBalance) Remaining(inv Invoice) int {
+	if b.Paid >= inv.Total {
+		return 0
+	}
+	return inv.Total - b.Paid
+}
+
+func invoicesPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "invoices.json"), nil
+}
+
+func loadInvoices() (Invoices, error) {
+	path, err := invoicesPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return Invoices{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	invoices := Invoices{}
+	if err := json.Unmarshal(data, &invoices); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return invoices, nil
+}
+
+func saveInvoices(invoices Invoices) error {
+	path, err := invoicesPath()
+	if err != nil {
+		return err
+	}
+
+	data, err := json.MarshalIndent(invoices, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+func balanceOf(ledger *Ledger, externalRef string) (invoiceBalance, error) {
+	entries, err := ledger.FindByExternalRef(externalRef)
+	if err != nil {
+		return invoiceBalance{}, err
+	}
+
+	var b invoiceBalance
+	for _, e := range entries {
+		if e.Kind != "collect" {
+			continue
+		}
+		b.Payments = append(b.Payments, e)
+		switch e.Status {
+		case campay.StatusSuccessful:
+			b.Paid += e.Amount
+		case campay.StatusPending, campay.StatusUnknown:
+			b.Pending += e.Amount
+		}
+	}
+	return b, nil
+}
+
+// markSettled stamps SettledAt once the invoice is fully paid and reports
+// whether that happened now.
+func markSettled(ledger *Ledger, externalRef string) (bool, error) {
+	invoices, err := loadInvoices()
+	if err != nil {
+		return false, err
+	}
+	inv, ok := invoices[externalRef]
+	if !ok || inv.SettledAt != nil {
+		return false, nil
+	}
+
+	b, err := balanceOf(ledger, externalRef)
+	if err != nil {
+		return false, err
+	}
+	if b.Paid < inv.Total {
+		return false, nil
+	}
+
+	now := time.Now().UTC()
+	inv.SettledAt = &now
+	invoices[externalRef] = inv
+	return true, saveInvoices(invoices)
+}
+
+// printInvoiceProgress reports the invoice balance after a payment and
+// marks it settled when the total is reached.
+func printInvoiceProgress(ledger *Ledger, inv Invoice) {
+	b, err := balanceOf(ledger, inv.ExternalReference)
+	if err != nil {
+		fmt.Println("⚠ Failed to read invoice balance:", err)
+		return
+	}
+	settled, err := markSettled(ledger, inv.ExternalReference)
+	if err != nil {
+		fmt.Println("⚠ Failed to update invoice:", err)
+	}
+	if settled || b.Paid >= inv.Total {
+		fmt.Printf("✓ Invoice %s settled (%s paid)\n", inv.ExternalReference, formatAmount(b.Paid, "XAF"))
+		return
+	}
+	fmt.Printf("Invoice %s: paid %s of %s, remaining %s\n", inv.ExternalReference, formatAmount(b.Paid, ""), formatAmount(inv.Total, "XAF"), formatAmount(b.Remaining(inv), ""))
+}
+
+// invoiceCreateOptions are the flags of invoice create.
+type invoiceCreateOptions struct {
+	installments int
+}
+
+// invoiceCreateFlags defines the flags of invoice create on fs.
+func invoiceCreateFlags(fs *flag.FlagSet, cfg *Config) *invoiceCreateOptions {
+	opt := &invoiceCreateOptions{}
+	fs.IntVar(&opt.installments, "installments", 0, "split the total into this many installments")
+	return opt
+}
+
+func runInvoice(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	invoices, err := loadInvoices()
+	if err != nil {
+		return err
+	}
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	switch args[0] {
+	case "create":
+		fs := newFlagSet("invoice create")
+		opt := invoiceCreateFlags(fs, cfg)
+		if err := fs.Parse(args[1:]); err != nil {
+			return exitErr(exitValidation, err)
+		}
+		if fs.NArg() < 2 || opt.installments < 0 {
+			return invalidInput("usage: campay invoice create [--installments N] <external-ref> <total> [description]")
+		}
+		ref := fs.Arg(0)
+		if _, ok := invoices[ref]; ok {
+			return invalidInput("invoice %s already exists", ref)
+		}
+		total, err := parseAmount(fs.Arg(1))
+		if err != nil {
+			return err
+		}
+		if opt.installments > total {
+			return invalidInput("%d XAF cannot be split into %d installments", total, opt.installments)
+		}
+		inv := Invoice{
+			ExternalReference: ref,
+			Total:             total,
+			Currency:          "XAF",
+			Description:       strings.Join(fs.Args()[2:], " "),
+			CreatedAt:         time.Now().UTC(),
+		}
+		if opt.installments > 1 {
+			inv.Installments = cfg.Rounding.Installments(total, opt.installments)
+		}
+		invoices[ref] = inv
+		if err := saveInvoices(invoices); err != nil {
+			return err
+		}
+		fmt.Printf("✓ Created invoice %s for %s\n", ref, formatAmount(total, "XAF"))
+		for i, amount := range inv.Installments {
+			fmt.Printf("  Installment %d: %s\n", i+1, formatAmount(amount, "XAF"))
+		}
+		fmt.Printf("  Collect installments with: campay collect --external-ref %s\n", ref)
+		return nil
+
+	case "list":
+		refs := make([]string, 0, len(invoices))
+		for ref := range invoices {
+			refs = append(refs, ref)
+		}
+		sort.Strings(refs)
+		tbl := newTable("No invoices",
+			tableColumn{Name: "Invoice"},
+			tableColumn{Name: "State"},
+			tableColumn{Name: "Paid", Amount: true},
+			tableColumn{Name: "Total", Amount: true},
+			tableColumn{Name: "Remaining", Amount: true},
+		)
+		for _, ref := range refs {
+			inv := invoices[ref]
+			b, err := balanceOf(ledger, ref)
+			if err != nil {
+				return err
+			}
+			state := "open"
+			if b.Paid >= inv.Total {
+				state = "settled"
+			}
+			tbl.Row(ref, state, b.Paid, inv.Total, b.Remaining(inv))
+		}
+		return tbl.Print()
+
+	case "show":
+		if len(args) != 2 {
+			return invalidInput("usage: campay invoice show <external-ref>")
+		}
+		inv, ok := invoices[args[1]]
+		if !ok {
+			return invalidInput("unknown invoice %q", args[1])
+		}
+		b, err := balanceOf(ledger, inv.ExternalReference)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Invoice:   %s\n", inv.ExternalReference)
+		if inv.Description != "" {
+			fmt.Printf("Note:      %s\n", inv.Description)
+		}
+		fmt.Printf("Total:     %s\n", formatAmount(inv.Total, inv.Currency))
+		fmt.Printf("Paid:      %s\n", formatAmount(b.Paid, inv.Currency))
+		if b.Pending > 0 {
+			fmt.Printf("Pending:   %s\n", formatAmount(b.Pending, inv.Currency))
+		}
+		fmt.Printf("Remaining: %s\n", formatAmount(b.Remaining(inv), inv.Currency))
+		if inv.SettledAt != nil {
+			fmt.Printf("Settled:   %s\n", inZone(*inv.SettledAt).Format("2006-01-02 15:04 MST"))
+		}
+		if len(inv.Installments) > 0 {
+			// Payments cover the installments in order
+			fmt.Println("\nInstallments:")
+			due := 0
+			for i, amount := range inv.Installments {
+				due += amount
+				state := "due"
+				if b.Paid >= due {
+					state = "paid"
+				}
+				fmt.Printf("  %2d  %8d  %s\n", i+1, amount, state)
+			}
+		}
+		if len(b.Payments) > 0 {
+			fmt.Println("\nPayments:")
+			for _, e := range b.Payments {
+				fmt.Printf("  %s  %-38s %8d  %s\n", inZone(e.CreatedAt).Format("2006-01-02 15:04 MST"), e.Reference, e.Amount, statusLabel(string(e.Status)))
+			}
+		}
+		return nil
+
+	default:
+		return invalidInput("unknown invoice command %q (use list, create or show)", args[0])
+	}
+}
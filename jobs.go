@@ -0,0 +1,380 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   =========================== JOBS ============================
+   ============================================================ */
+
+// Job states
+const (
+	jobQueued      = "queued"
+	jobRunning     = "running"
+	jobDone        = "done"
+	jobFailed      = "failed"
+	jobInterrupted = "interrupted" // the daemon stopped before CamPay answered
+)
+
+// Job is a payment handed to the daemon. Reference and Status are filled in
+// once CamPay accepts it; the transaction itself is tracked in the ledger.
+type Job struct {
+	ID                string    `json:"id"`
+	Kind              string    `json:"kind"` // collect or withdraw
+	Phone             string    `json:"phone"`
+	Amount            int       `json:"amount"`
+	Description       string    `json:"description"`
+	ExternalReference string    `json:"external_reference"`
+	CallbackURL       string    `json:"callback_url,omitempty"` // receives an EXPIRED event if the payment times out
+	RefundOf          string    `json:"refund_of,omitempty"`    // withdraw paying back this collection (reference or external reference)
+	Operator          string    `json:"operator,omitempty"`     // set by the daemon from what is known of the phone, e.g. when ported
+	Key               string    `json:"key,omitempty"`          // name of the API key that submitted it
+	State             string    `json:"state"`
+	Reference         string    `json:"reference,omitempty"`
+	Status            string    `json:"status,omitempty"`
+	USSDCode          string    `json:"ussd_code,omitempty"` // confirms a pending collection when the prompt does not arrive
+	DialURI           string    `json:"dial_uri,omitempty"`  // tel: link of USSDCode, for mobile apps to open the dialer
+	Warning           string    `json:"warning,omitempty"`   // the payer's operator looked down when the job was accepted
+	Error             string    `json:"error,omitempty"`
+	CreatedAt         time.Time `json:"created_at"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+func newJobID() string {
+	var b [8]byte
+	rand.Read(b[:])
+	return "job_" + hex.EncodeToString(b[:])
+}
+
+// jobStore keeps every job in memory and mirrors it to jobs.json so that
+// a restarted daemon can pick up where it stopped. Phone numbers are
+// encrypted on disk like the ledger's.
+type jobStore struct {
+	path string
+	aead cipher.AEAD
+	mu   sync.Mutex
+	jobs map[string]*Job
+}
+
+func openJobStore(aead cipher.AEAD) (*jobStore, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	s := &jobStore{path: filepath.Join(dir, "jobs.json"), aead: aead, jobs: map[string]*Job{}}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(data, &s.jobs); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", s.path, err)
+	}
+	for _, j := range s.jobs {
+		if err := openPhones(aead, &j.Phone); err != nil {
+			return nil, fmt.Errorf("%s: %w", s.path, err)
+		}
+	}
+	return s, nil
+}
+
+// update applies fn to the job and persists the store.
+func (s *jobStore) update(id string, fn func(j *Job)) (Job, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, fmt.Errorf("unknown job %s", id)
+	}
+	fn(j)
+	j.UpdatedAt = time.Now().UTC()
+	return *j, s.saveLocked()
+}
+
+func (s *jobStore) add(j *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.jobs[j.ID] = j
+	return s.saveLocked()
+}
+
+func (s *jobStore) saveLocked() error {
+	stored := make(map[string]Job, len(s.jobs))
+	for id, j := range s.jobs {
+		sj := *j
+		if err := sealPhones(s.aead, &sj.Phone); err != nil {
+			return err
+		}
+		stored[id] = sj
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+func (s *jobStore) get(id string) (Job, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	j, ok := s.jobs[id]
+	if !ok {
+		return Job{}, false
+	}
+	return *j, true
+}
+
+// list returns every job, oldest first.
+func (s *jobStore) list() []Job {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	jobs := make([]Job, 0, len(s.jobs))
+	for _, j := range s.jobs {
+		jobs = append(jobs, *j)
+	}
+	sort.Slice(jobs, func(i, k int) bool { return jobs[i].CreatedAt.Before(jobs[k].CreatedAt) })
+	return jobs
+}
+
+// =============================================================
+// Client side
+// =============================================================
+
+func defaultSocketPath() string {
+	dir, err := dataDir()
+	if err != nil {
+		return "daemon.sock"
+	}
+	return filepath.Join(dir, "daemon.sock")
+}
+
+// daemonClient talks to `campay daemon` over its Unix socket, or over TCP
+// when addr is set, with key as its API key when the daemon has keys.
+type daemonClient struct {
+	http *http.Client
+	base string
+	key  string
+}
+
+func newDaemonClient(socket, addr, key string) *daemonClient {
+	if addr != "" {
+		return &daemonClient{http: &http.Client{Timeout: 10 * time.Second}, base: "http://" + addr, key: key}
+	}
+	transport := &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", socket)
+		},
+	}
+	return &daemonClient{http: &http.Client{Transport: transport, Timeout: 10 * time.Second}, base: "http://campay", key: key}
+}
+
+func (c *daemonClient) call(method, path string, in, out any) error {
+	var body io.Reader
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return err
+		}
+		body = bytes.NewReader(data)
+	}
+	req, err := http.NewRequest(method, c.base+path, body)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	if c.key != "" {
+		req.Header.Set("Authorization", "Bearer "+c.key)
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return fmt.Errorf("daemon not reachable (is `campay daemon` running?): %w", err)
+	}
+	defer resp.Body.Close()
+
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode >= 400 {
+		var e struct {
+			Error string `json:"error"`
+		}
+		if json.Unmarshal(data, &e) == nil && e.Error != "" {
+			if resp.StatusCode == http.StatusUnauthorized || resp.StatusCode == http.StatusForbidden {
+				return exitErr(exitAuth, errors.New(e.Error))
+			}
+			if resp.StatusCode < 500 {
+				return invalidInput("%s", e.Error)
+			}
+			return errors.New(e.Error)
+		}
+		return fmt.Errorf("daemon answered %d", resp.StatusCode)
+	}
+	return json.Unmarshal(data, out)
+}
+
+// jobsOptions are the flags of jobs submit, list and show.
+type jobsOptions struct {
+	socket      string
+	addr        string
+	phone       string
+	amount      string
+	description string
+	externalRef string
+	callbackURL string
+	refundOf    string
+	apiKey      string
+}
+
+// jobsFlags defines the flags of jobs submit, list and show on fs.
+func jobsFlags(fs *flag.FlagSet, cfg *Config) *jobsOptions {
+	opt := &jobsOptions{}
+	fs.StringVar(&opt.socket, "socket", defaultSocketPath(), "daemon Unix socket")
+	fs.StringVar(&opt.addr, "addr", "", "daemon TCP address, when it listens with --addr")
+	fs.StringVar(&opt.phone, "phone", "", "phone number or @contact (submit)")
+	fs.StringVar(&opt.amount, "amount", "", "amount, e.g. 5000 or 5k (submit)")
+	fs.StringVar(&opt.description, "description", "", "description (submit)")
+	fs.StringVar(&opt.externalRef, "external-ref", "", "your own reference (submit, default: JOB-<unix time>)")
+	fs.StringVar(&opt.callbackURL, "callback-url", "", "URL sent an EXPIRED event if the payment times out (submit)")
+	fs.StringVar(&opt.refundOf, "refund-of", "", "pay back this collection, by reference or external reference (submit withdraw; phone and amount default to what is left of it)")
+	fs.StringVar(&opt.apiKey, "api-key", os.Getenv("CAMPAY_API_KEY"), "daemon API key, once the daemon has keys (see campay apikey)")
+	return opt
+}
+
+// runJobs enqueues, lists and inspects jobs of a running daemon.
+func runJobs(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		args = []string{"list"}
+	}
+
+	fs := newFlagSet("jobs " + args[0])
+	opt := jobsFlags(fs, cfg)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	client := newDaemonClient(opt.socket, opt.addr, opt.apiKey)
+
+	switch args[0] {
+	case "submit":
+		if fs.NArg() != 1 || (fs.Arg(0) != "collect" && fs.Arg(0) != "withdraw") {
+			return invalidInput("usage: campay jobs submit [flags] collect|withdraw")
+		}
+		if err := refuseReadOnly(cfg, "jobs submit"); err != nil {
+			return err
+		}
+		if opt.refundOf != "" && fs.Arg(0) != "withdraw" {
+			return invalidInput("--refund-of is only for withdraw jobs")
+		}
+		var p string
+		var amt int
+		var err error
+		if opt.phone != "" || opt.refundOf == "" {
+			if p, err = resolvePhone(opt.phone); err != nil {
+				return err
+			}
+		}
+		if opt.amount != "" || opt.refundOf == "" {
+			if amt, err = parseAmount(opt.amount); err != nil {
+				return err
+			}
+		}
+		switch {
+		case opt.description != "":
+		case opt.refundOf != "":
+			opt.description = "Refund of " + opt.refundOf
+		default:
+			opt.description = "Payment"
+		}
+		ledger, err := openLedger()
+		if err != nil {
+			return err
+		}
+		refs, err := newRefAllocator(cfg, ledger)
+		if err != nil {
+			return err
+		}
+		if opt.externalRef == "" {
+			if opt.externalRef, err = refs.Generate("JOB"); err != nil {
+				return err
+			}
+		}
+
+		var job Job
+		err = client.call("POST", "/jobs", Job{
+			Kind:              fs.Arg(0),
+			Phone:             p,
+			Amount:            amt,
+			Description:       opt.description,
+			ExternalReference: opt.externalRef,
+			CallbackURL:       opt.callbackURL,
+			RefundOf:          opt.refundOf,
+		}, &job)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("✓ Queued %s (%s %s, %s)\n", job.ID, job.Kind, formatAmount(job.Amount, "XAF"), displayPhone(job.Phone))
+		fmt.Printf("  Follow it with: campay jobs show %s\n", job.ID)
+		if job.Warning != "" {
+			fmt.Println(job.Warning)
+		}
+		return nil
+
+	case "list":
+		var jobs []Job
+		if err := client.call("GET", "/jobs", nil, &jobs); err != nil {
+			return err
+		}
+		tbl := newTable("No jobs",
+			tableColumn{Name: "ID"},
+			tableColumn{Name: "Kind"},
+			tableColumn{Name: "State"},
+			tableColumn{Name: "Amount", Amount: true},
+			tableColumn{Name: "Phone"},
+			tableColumn{Name: "Status"},
+			tableColumn{Name: "Reference"},
+		)
+		for _, j := range jobs {
+			tbl.Row(j.ID, j.Kind, j.State, j.Amount, displayPhone(j.Phone), campay.Status(j.Status), j.Reference)
+		}
+		return tbl.Print()
+
+	case "show":
+		if fs.NArg() != 1 {
+			return invalidInput("usage: campay jobs show <job-id>")
+		}
+		var j Job
+		if err := client.call("GET", "/jobs/"+fs.Arg(0), nil, &j); err != nil {
+			return err
+		}
+		j.Phone = displayPhone(j.Phone)
+		out, _ := json.MarshalIndent(j, "", "  ")
+		fmt.Println(string(out))
+		return nil
+
+	default:
+		return invalidInput("unknown jobs command %q (use submit, list or show)", args[0])
+	}
+}
@@ -0,0 +1,112 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+/* ============================================================
+   ========================== KEYCHAIN =========================
+   ============================================================ */
+
+// A profile with "keychain": true keeps its password in the OS keychain
+// rather than in the config file, under the service "campay" and the
+// profile name as account. The keychain is reached through the tools the
+// OS ships: security on macOS and secret-tool (libsecret) elsewhere.
+// Windows has no such tool that can read a password back.
+
+const keychainService = "campay"
+
+// keychainTool returns the command used to reach the keychain, or an
+// error saying why there is none.
+func keychainTool() (string, error) {
+	tool := "secret-tool"
+	switch runtime.GOOS {
+	case "darwin":
+		tool = "security"
+	case "windows":
+		return "", errors.New("the keychain is not supported on Windows")
+	}
+	if _, err := exec.LookPath(tool); err != nil {
+		return "", fmt.Errorf("the keychain needs %s, which was not found", tool)
+	}
+	return tool, nil
+}
+
+// keychainGet returns the password stored for account.
+func keychainGet(account string) (string, error) {
+	tool, err := keychainTool()
+	if err != nil {
+		return "", err
+	}
+	var cmd *exec.Cmd
+	if tool == "security" {
+		cmd = exec.Command(tool, "find-generic-password", "-s", keychainService, "-a", account, "-w")
+	} else {
+		cmd = exec.Command(tool, "lookup", "service", keychainService, "account", account)
+	}
+	out, err := runKeychain(cmd, "")
+	if err != nil {
+		return "", err
+	}
+	password := strings.TrimRight(out, "\r\n")
+	if password == "" {
+		return "", fmt.Errorf("no password for %q in the keychain", account)
+	}
+	return password, nil
+}
+
+// keychainSet stores password for account, replacing any previous one.
+// The password goes through stdin so that it never shows in the process
+// list.
+func keychainSet(account, password string) error {
+	tool, err := keychainTool()
+	if err != nil {
+		return err
+	}
+	if tool == "security" {
+		quote := strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+		line := fmt.Sprintf("add-generic-password -U -s %s -a \"%s\" -w \"%s\"\n",
+			keychainService, quote.Replace(account), quote.Replace(password))
+		_, err = runKeychain(exec.Command(tool, "-i"), line)
+		return err
+	}
+	cmd := exec.Command(tool, "store", "--label", "CamPay "+account, "service", keychainService, "account", account)
+	_, err = runKeychain(cmd, password)
+	return err
+}
+
+func runKeychain(cmd *exec.Cmd, stdin string) (string, error) {
+	var stdout, stderr bytes.Buffer
+	cmd.Stdin = strings.NewReader(stdin)
+	cmd.Stdout, cmd.Stderr = &stdout, &stderr
+	if err := cmd.Run(); err != nil {
+		if msg := strings.TrimSpace(stderr.String()); msg != "" {
+			return "", fmt.Errorf("%s: %s", cmd.Args[0], msg)
+		}
+		return "", fmt.Errorf("%s: %w", cmd.Args[0], err)
+	}
+	return stdout.String(), nil
+}
+
+// resolveKeychain reads the password of the active profile from the
+// keychain when the profile keeps it there. Like the secret managers, it
+// runs once, when a command first needs credentials.
+func resolveKeychain(cfg *Config) error {
+	p, ok := cfg.Profiles[cfg.Profile]
+	if !ok || !p.Keychain || p.Password != "" || cfg.keychainLoaded {
+		return nil
+	}
+	password, err := keychainGet(cfg.Profile)
+	if err != nil {
+		return exitErr(exitAuth, fmt.Errorf("profile %s: %w", cfg.Profile, err))
+	}
+	cfg.Password = password
+	cfg.settings.replaced("keychain", "password")
+	cfg.keychainLoaded = true
+	return nil
+}
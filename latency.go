@@ -0,0 +1,223 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= LATENCY REPORT ======================
+   ============================================================ */
+
+// The latency report measures, from the ledger, how long customers take to
+// answer: from a payment's creation to the first final status CamPay
+// reported (final_at). Entries written before final_at existed fall back
+// to their last update. Imported history (sync) has no creation time of
+// its own and cancelled payments have no answer, so both are left out.
+
+// runReport prints reports computed from the ledger.
+func runReport(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return invalidInput("usage: campay report latency [flags]")
+	}
+	switch args[0] {
+	case "latency":
+		return runLatencyReport(cfg, args[1:])
+	default:
+		return invalidInput("unknown report %q (use latency)", args[0])
+	}
+}
+
+// latencyGroup is one row of the report.
+type latencyGroup struct {
+	total, successful, failed, expired int
+	times                              []time.Duration // to an answer, expired payments excluded
+}
+
+func (g *latencyGroup) add(e LedgerEntry) {
+	g.total++
+	switch {
+	case e.Status == campay.StatusExpired || e.Status == campay.StatusExpiredLocal:
+		g.expired++
+		return
+	case unsuccessful(e.Status):
+		g.failed++
+	default:
+		g.successful++ // or reversed since
+	}
+	final := e.UpdatedAt
+	if e.FinalAt != nil {
+		final = *e.FinalAt
+	}
+	if d := final.Sub(e.CreatedAt); d >= 0 {
+		g.times = append(g.times, d)
+	}
+}
+
+// quantiles returns the given percentiles of the answer times, and the
+// longest, or false when there is none.
+func (g *latencyGroup) quantiles(ps ...float64) ([]time.Duration, time.Duration, bool) {
+	if len(g.times) == 0 {
+		return nil, 0, false
+	}
+	sort.Slice(g.times, func(i, j int) bool { return g.times[i] < g.times[j] })
+	q := make([]time.Duration, len(ps))
+	for i, p := range ps {
+		q[i] = percentile(g.times, p)
+	}
+	return q, g.times[len(g.times)-1], true
+}
+
+// latencyKey groups entries by operator, hour of day (of creation, in the
+// reporting zone) or both.
+func latencyKey(by string, e LedgerEntry) string {
+	operator := strings.ToUpper(e.Operator)
+	if operator == "" {
+		operator = operatorFor(e.Phone)
+	}
+	if operator == "" {
+		operator = "unknown"
+	}
+	hour := fmt.Sprintf("%02d:00", inZone(e.CreatedAt).Hour())
+	switch by {
+	case "hour":
+		return hour
+	case "operator,hour":
+		return operator + " " + hour
+	}
+	return operator
+}
+
+// reportLatencyOptions are the flags of report latency.
+type reportLatencyOptions struct {
+	since string
+	until string
+	kind  string
+	by    string
+}
+
+// reportLatencyFlags defines the flags of report latency on fs.
+func reportLatencyFlags(fs *flag.FlagSet, cfg *Config) *reportLatencyOptions {
+	opt := &reportLatencyOptions{}
+	fs.StringVar(&opt.since, "since", "30d", "payments created after: 7d, 12h or a date like 2026-01-31")
+	fs.StringVar(&opt.until, "until", "", "payments created before: 7d, 12h or a date")
+	fs.StringVar(&opt.kind, "kind", "collect", "collect or withdraw")
+	fs.StringVar(&opt.by, "by", "operator", "group by operator, hour (of day) or operator,hour")
+	return opt
+}
+
+func runLatencyReport(cfg *Config, args []string) error {
+	fs := newFlagSet("report latency")
+	opt := reportLatencyFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+	if opt.kind != "collect" && opt.kind != "withdraw" {
+		return invalidInput("--kind must be collect or withdraw")
+	}
+	if opt.by != "operator" && opt.by != "hour" && opt.by != "operator,hour" {
+		return invalidInput("--by must be operator, hour or operator,hour")
+	}
+
+	var from, to time.Time
+	var err error
+	if opt.since != "" {
+		if from, err = parseSince(opt.since); err != nil {
+			return err
+		}
+	}
+	if opt.until != "" {
+		if to, err = parseSince(opt.until); err != nil {
+			return err
+		}
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	entries, err := ledger.Entries()
+	if err != nil {
+		return err
+	}
+
+	groups := map[string]*latencyGroup{}
+	overall := &latencyGroup{}
+	for _, e := range entries {
+		if e.Kind != opt.kind || e.Source != "" || !(isFinal(e.Status) || e.Status == campay.StatusExpiredLocal) {
+			continue
+		}
+		if e.CreatedAt.Before(from) || (!to.IsZero() && !e.CreatedAt.Before(to)) {
+			continue
+		}
+		key := latencyKey(opt.by, e)
+		if groups[key] == nil {
+			groups[key] = &latencyGroup{}
+		}
+		groups[key].add(e)
+		overall.add(e)
+	}
+	keys := make([]string, 0, len(groups))
+	for k := range groups {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	name := map[string]string{"operator": "Operator", "hour": "Hour", "operator,hour": "Operator and hour"}[opt.by]
+	if opt.by != "operator" {
+		name += " (" + inZone(time.Now()).Format("MST") + ")"
+	}
+	tbl := newTable("No answered payment in this period",
+		tableColumn{Name: name},
+		tableColumn{Name: "Payments", Right: true},
+		tableColumn{Name: "Successful", Right: true},
+		tableColumn{Name: "Failed", Right: true},
+		tableColumn{Name: "Expired", Right: true},
+		tableColumn{Name: "Success rate", Right: true},
+		tableColumn{Name: "p50", Right: true},
+		tableColumn{Name: "p90", Right: true},
+		tableColumn{Name: "p95", Right: true},
+		tableColumn{Name: "Max", Right: true},
+		tableColumn{Name: "Note"},
+	)
+	all, _, _ := overall.quantiles(90)
+	for _, k := range keys {
+		g := groups[k]
+		p50, p90, p95, longest, note := "", "", "", "", ""
+		if q, m, ok := g.quantiles(50, 90, 95); ok {
+			p50, p90, p95, longest = roundLatency(q[0]), roundLatency(q[1]), roundLatency(q[2]), roundLatency(m)
+			// A group is slow when enough payments show it, not one straggler
+			if len(g.times) >= 5 && q[1] > all[0]*3/2 {
+				note = "slow"
+			}
+		}
+		tbl.Row(k, g.total, g.successful, g.failed, g.expired, fmt.Sprintf("%.1f%%", 100*float64(g.successful)/float64(g.total)),
+			p50, p90, p95, longest, note)
+	}
+
+	if q, _, ok := overall.quantiles(95, 99); ok {
+		tbl.Footer("95%% of answers came within %s, 99%% within %s (%d payments); --confirm-deadline is %s",
+			roundLatency(q[0]), roundLatency(q[1]), overall.total, cfg.Deadline)
+		if q[0] > cfg.Deadline {
+			tbl.Footer("⚠ Customers answering after the deadline are marked EXPIRED_LOCAL; consider --confirm-deadline %s",
+				q[1].Truncate(30*time.Second)+30*time.Second)
+		}
+	}
+	return tbl.Print()
+}
+
+// roundLatency formats d to the second, or to the millisecond below one.
+func roundLatency(d time.Duration) string {
+	if d < time.Second {
+		return d.Round(time.Millisecond).String()
+	}
+	return d.Round(time.Second).String()
+}
@@ -0,0 +1,461 @@
+package main
+
+import (
+	"bufio"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== LEDGER ===========================
+   ============================================================ */
+
+// LedgerEntry is the local record of a transaction started by this tool.
+type LedgerEntry struct {
+	Reference         string        `json:"reference"`
+	ExternalReference string        `json:"external_reference"`
+	Kind              string        `json:"kind"` // collect or withdraw
+	Phone             string        `json:"phone"`
+	Amount            int           `json:"amount"`
+	Currency          string        `json:"currency"`
+	Description       string        `json:"description"`
+	Status            campay.Status `json:"status"`
+	StatusReason      string        `json:"status_reason,omitempty"`
+	Operator          string        `json:"operator,omitempty"`
+	Environment       string        `json:"environment"`
+	Source            string        `json:"source,omitempty"`       // "sync" for entries imported from history
+	Settlement        string        `json:"settlement,omitempty"`   // groups a split collect with its payouts
+	Refund            bool          `json:"refund,omitempty"`       // a payout returning a collection
+	RefundOf          string        `json:"refund_of,omitempty"`    // reference or external reference of that collection
+	Batch             string        `json:"batch,omitempty"`        // withdraw-batch run that made the payout
+	CallbackURL       string        `json:"callback_url,omitempty"` // told when the payment expires (daemon jobs)
+	Campaign          string        `json:"campaign,omitempty"`     // campaign the collection counts towards
+	DialCode          string        `json:"dial_code,omitempty"`    // USSD code that confirms a pending collection
+	Review            string        `json:"review,omitempty"`       // why the fraud check flagged the collection
+	Notes             []LedgerNote  `json:"notes,omitempty"`        // support history, see notes.go
+	CreatedAt         time.Time     `json:"created_at"`
+	UpdatedAt         time.Time     `json:"updated_at"`
+	FinalAt           *time.Time    `json:"final_at,omitempty"` // when CamPay first reported a final status
+}
+
+// Transaction presents the entry in the API's response shape.
+func (e LedgerEntry) Transaction() *campay.TransactionResponse {
+	return &campay.TransactionResponse{
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Status:            string(e.Status),
+		Amount:            campay.Amount(e.Amount),
+		Currency:          e.Currency,
+		Operator:          e.Operator,
+		Description:       e.Description,
+	}
+}
+
+// Ledger is an append-only JSON lines file. Every change appends the full
+// entry; when reading, the last line for a reference wins, except that its
+// first final status is kept (see UpdateStatus). When CAMPAY_LEDGER_KEY is
+// set, phone numbers are encrypted at rest.
+type Ledger struct {
+	path string
+	aead cipher.AEAD
+	mu   sync.Mutex
+
+	// statusMu and the status leases of coord serialize status changes
+	statusMu  sync.Mutex
+	coord     Coordinator
+	coordOnce sync.Once
+
+	events campay.EventBus // see events.go
+}
+
+// A status change waits up to statusLockWait for the reference's lease,
+// which expires after statusLockTTL if its holder dies.
+const (
+	statusLockWait = 5 * time.Second
+	statusLockTTL  = 30 * time.Second
+)
+
+func openLedger() (*Ledger, error) {
+	path := os.Getenv("CAMPAY_LEDGER")
+	if path == "" {
+		dir, err := dataDir()
+		if err != nil {
+			return nil, err
+		}
+		path = filepath.Join(dir, "ledger.jsonl")
+	}
+	aead, err := ledgerCipher()
+	if err != nil {
+		return nil, err
+	}
+	l := &Ledger{path: path, aead: aead}
+	l.subscribeDefaults()
+	return l, nil
+}
+
+// Record appends e, stamping UpdatedAt (and CreatedAt for new entries).
+// A new entry, one without UpdatedAt, is published as initiated unless it
+// was imported by sync.
+func (l *Ledger) Record(e LedgerEntry) error {
+	initiated := e.UpdatedAt.IsZero() && e.Source != "sync"
+	now := time.Now().UTC()
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = now
+	}
+	e.UpdatedAt = now
+
+	if l.aead != nil {
+		var err error
+		if e.Phone, err = sealField(l.aead, e.Phone); err != nil {
+			return err
+		}
+	}
+
+	line, err := json.Marshal(e)
+	if err != nil {
+		return err
+	}
+
+	l.mu.Lock()
+	err = l.appendLocked(append(line, '\n'))
+	l.mu.Unlock()
+	if err != nil {
+		return err
+	}
+	if initiated {
+		l.publish(campay.EventInitiated, "", e)
+	}
+	return nil
+}
+
+// appendLocked adds whole lines to the ledger as one transaction: a single
+// write, synced before it returns, so that an entry is either on disk in
+// full or not at all once Record returns, whatever the number of workers
+// recording at once. A line cut short by a crash is ended first so the new
+// ones do not run into it; readers skip it (see tornLine). l.mu is held.
+func (l *Ledger) appendLocked(data []byte) error {
+	unlock, err := l.lockForWrite(false)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	if fi, err := f.Stat(); err == nil && fi.Size() > 0 {
+		last := make([]byte, 1)
+		if _, err := f.ReadAt(last, fi.Size()-1); err == nil && last[0] != '\n' {
+			data = append([]byte{'\n'}, data...)
+		}
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// lockForWrite takes the lock that orders appends and rewrites of the ledger
+// across processes: appenders share it, and a rewrite holds it alone, so
+// no line is written to a file about to be replaced. It returns the
+// release.
+func (l *Ledger) lockForWrite(exclusive bool) (func(), error) {
+	f, err := os.OpenFile(l.path+".lock", os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+	if err := lockFile(f, exclusive); err != nil {
+		f.Close()
+		return nil, fmt.Errorf("failed to lock the ledger: %w", err)
+	}
+	return func() { f.Close() }, nil
+}
+
+// tornLine reports whether a line failed to parse because a crash cut it
+// short while it was written. Such a line never became a transaction.
+func tornLine(err error) bool {
+	var syntax *json.SyntaxError
+	return errors.As(err, &syntax) && syntax.Error() == "unexpected end of JSON input"
+}
+
+// Writable checks that entries can be appended, for readiness probes.
+func (l *Ledger) Writable() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.OpenFile(l.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	return f.Close()
+}
+
+// Entries returns the current state of every transaction, oldest first.
+func (l *Ledger) Entries() ([]LedgerEntry, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	f, err := os.Open(l.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := map[string]LedgerEntry{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var e LedgerEntry
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			if tornLine(err) {
+				continue
+			}
+			return nil, fmt.Errorf("%s:%d: %w", l.path, n, err)
+		}
+		if e.Phone, err = openField(l.aead, e.Phone); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", l.path, n, err)
+		}
+		// A line written from a stale read cannot undo a final status
+		if prev, ok := latest[e.Reference]; ok {
+			if kept, _ := statusPolicy.Transition(prev.Status, e.Status); kept != e.Status {
+				e.Status, e.StatusReason = prev.Status, prev.StatusReason
+			}
+		}
+		latest[e.Reference] = e
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	entries := make([]LedgerEntry, 0, len(latest))
+	for _, e := range latest {
+		entries = append(entries, e)
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		return entries[i].CreatedAt.Before(entries[j].CreatedAt)
+	})
+	return entries, nil
+}
+
+func (l *Ledger) Get(reference string) (*LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		if e.Reference == reference {
+			return &e, nil
+		}
+	}
+	return nil, nil
+}
+
+func (l *Ledger) FindByExternalRef(externalRef string) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []LedgerEntry
+	for _, e := range entries {
+		if e.ExternalReference == externalRef {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// FindBySettlement returns the collect and payouts of a split settlement.
+func (l *Ledger) FindBySettlement(id string) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []LedgerEntry
+	for _, e := range entries {
+		if e.Settlement == id {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// FindByBatch returns the payouts of a withdraw-batch run.
+func (l *Ledger) FindByBatch(id string) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []LedgerEntry
+	for _, e := range entries {
+		if e.Batch == id {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// FindByCampaign returns the collections attached to a campaign.
+func (l *Ledger) FindByCampaign(id string) ([]LedgerEntry, error) {
+	entries, err := l.Entries()
+	if err != nil {
+		return nil, err
+	}
+	var found []LedgerEntry
+	for _, e := range entries {
+		if e.Campaign == id {
+			found = append(found, e)
+		}
+	}
+	return found, nil
+}
+
+// UpdateStatus applies an observed status to an existing entry following
+// the status policy (see campay.Transition). Unknown references and stale
+// observations are ignored. When a webhook and a poller both learn the
+// outcome, the first final status recorded wins: the update holds the
+// reference's lock from reading to writing, and a final status
+// contradicting it is not recorded but logged as a status_conflict alert
+// in the audit log, and returns campay.ErrInvalidTransition. The change is
+// published as status_changed or terminal, and a refund payout reaching
+// SUCCESSFUL also as refunded; reaching a final status, including a
+// reversal after a success, thereby runs the on-final hook and, for a
+// successful collection, sends the payer's SMS receipt (see events.go).
+// Events are published once the status lock is released.
+func (l *Ledger) UpdateStatus(reference string, status campay.Status, operator string) error {
+	unlock := l.lockStatus(reference)
+	e, from, err := l.setStatus(reference, status, operator)
+	unlock()
+	if err != nil || e == nil {
+		return err
+	}
+	l.publish(statusEvent(e.Status), from, *e)
+	if e.Refund && e.Status == campay.StatusSuccessful {
+		l.publish(campay.EventRefunded, from, *e)
+	}
+	return nil
+}
+
+// setStatus is UpdateStatus under the status lock. It returns the updated
+// entry and its former status, or a nil entry when nothing changed.
+func (l *Ledger) setStatus(reference string, status campay.Status, operator string) (*LedgerEntry, campay.Status, error) {
+	e, err := l.Get(reference)
+	if err != nil || e == nil {
+		return nil, "", err
+	}
+	next, err := statusPolicy.Transition(e.Status, status)
+	if err != nil {
+		auditStatusConflict(*e, status)
+		return nil, "", fmt.Errorf("%s: %w", reference, err)
+	}
+	if next == e.Status {
+		return nil, "", nil
+	}
+	from := e.Status
+	e.Status = next
+	e.StatusReason = ""
+	if operator != "" {
+		e.Operator = operator
+	}
+	if isFinal(next) && e.FinalAt == nil {
+		now := time.Now().UTC()
+		e.FinalAt = &now
+	}
+	if err := l.Record(*e); err != nil {
+		return nil, "", err
+	}
+	return e, from, nil
+}
+
+// lockStatus serializes status changes of reference within this process
+// and, through a lease, with the other processes sharing the data
+// directory. It returns the unlock function. When the lease cannot be had
+// in time the change goes ahead, since Entries still keeps the first final
+// status.
+func (l *Ledger) lockStatus(reference string) func() {
+	l.statusMu.Lock()
+	l.coordOnce.Do(func() {
+		if coord, err := openCoordinator(); err == nil {
+			l.coord = coord
+		}
+	})
+	if l.coord == nil {
+		return l.statusMu.Unlock
+	}
+	key := statusLease(reference)
+	deadline := time.Now().Add(statusLockWait)
+	for {
+		ok, err := l.coord.Acquire(key, statusLockTTL)
+		if ok {
+			return func() {
+				l.coord.Release(key)
+				l.statusMu.Unlock()
+			}
+		}
+		if err != nil || time.Now().After(deadline) {
+			if err == nil {
+				err = errors.New("held by another process")
+			}
+			fmt.Printf("⚠ Updating %s without its lock: %v\n", reference, err)
+			return l.statusMu.Unlock
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+}
+
+// MarkAbandoned records that the client gave up on a transaction, with
+// status campay.StatusCancelledLocal or campay.StatusExpiredLocal and a
+// reason. It returns the updated entry, or an error if the transaction is
+// unknown, already final or already in that status.
+func (l *Ledger) MarkAbandoned(reference string, status campay.Status, reason string) (*LedgerEntry, error) {
+	unlock := l.lockStatus(reference)
+	e, from, err := l.abandon(reference, status, reason)
+	unlock()
+	if err != nil {
+		return nil, err
+	}
+	l.publish(statusEvent(status), from, *e)
+	return e, nil
+}
+
+// abandon is MarkAbandoned under the status lock.
+func (l *Ledger) abandon(reference string, status campay.Status, reason string) (*LedgerEntry, campay.Status, error) {
+	e, err := l.Get(reference)
+	if err != nil {
+		return nil, "", err
+	}
+	if e == nil {
+		return nil, "", invalidInput("transaction %s is not in the local ledger", reference)
+	}
+	next, _ := statusPolicy.Transition(e.Status, status)
+	if next != status || e.Status == status {
+		return nil, "", invalidInput("transaction %s is already %s", reference, e.Status)
+	}
+	from := e.Status
+	e.Status = status
+	e.StatusReason = reason
+	if err := l.Record(*e); err != nil {
+		return nil, "", err
+	}
+	return e, from, nil
+}
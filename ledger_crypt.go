@@ -0,0 +1,103 @@
+package main
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+)
+
+/* ============================================================
+   ===================== LEDGER ENCRYPTION =====================
+   ============================================================ */
+
+// encPrefix marks a ledger field sealed with AES-256-GCM. The rest of the
+// value is base64(nonce || ciphertext).
+const encPrefix = "enc:v1:"
+
+// ledgerCipher loads the key from CAMPAY_LEDGER_KEY (32 bytes, base64 or
+// hex). It returns nil when no key is configured.
+func ledgerCipher() (cipher.AEAD, error) {
+	raw := strings.TrimSpace(os.Getenv("CAMPAY_LEDGER_KEY"))
+	if raw == "" {
+		return nil, nil
+	}
+
+	key, err := base64.StdEncoding.DecodeString(raw)
+	if err != nil || len(key) != 32 {
+		if key, err = hex.DecodeString(raw); err != nil || len(key) != 32 {
+			return nil, invalidInput("CAMPAY_LEDGER_KEY must be 32 bytes, base64 or hex encoded")
+		}
+	}
+
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func sealField(aead cipher.AEAD, value string) (string, error) {
+	if value == "" || strings.HasPrefix(value, encPrefix) {
+		return value, nil
+	}
+	nonce := make([]byte, aead.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := aead.Seal(nonce, nonce, []byte(value), nil)
+	return encPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+func openField(aead cipher.AEAD, value string) (string, error) {
+	if !strings.HasPrefix(value, encPrefix) {
+		return value, nil
+	}
+	if aead == nil {
+		return "", errors.New("ledger contains encrypted fields; set CAMPAY_LEDGER_KEY")
+	}
+	data, err := base64.StdEncoding.DecodeString(strings.TrimPrefix(value, encPrefix))
+	if err != nil || len(data) < aead.NonceSize() {
+		return "", errors.New("malformed encrypted field")
+	}
+	nonce, ciphertext := data[:aead.NonceSize()], data[aead.NonceSize():]
+	plain, err := aead.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", fmt.Errorf("cannot decrypt field (wrong CAMPAY_LEDGER_KEY?): %w", err)
+	}
+	return string(plain), nil
+}
+
+// sealPhones seals each of phones in place when aead is set, and openPhones
+// opens them. The files kept next to the ledger (the audit log, daemon
+// jobs, plan states, settlements and campaigns) use them, so that
+// CAMPAY_LEDGER_KEY covers every phone number on disk.
+func sealPhones(aead cipher.AEAD, phones ...*string) error {
+	if aead == nil {
+		return nil
+	}
+	for _, p := range phones {
+		sealed, err := sealField(aead, *p)
+		if err != nil {
+			return err
+		}
+		*p = sealed
+	}
+	return nil
+}
+
+func openPhones(aead cipher.AEAD, phones ...*string) error {
+	for _, p := range phones {
+		opened, err := openField(aead, *p)
+		if err != nil {
+			return err
+		}
+		*p = opened
+	}
+	return nil
+}
@@ -0,0 +1,190 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   =========================== LOGIN ===========================
+   ============================================================ */
+
+// loginOptions are the flags of login.
+type loginOptions struct {
+	save bool
+	name string
+}
+
+// loginFlags defines the flags of login on fs.
+func loginFlags(fs *flag.FlagSet, cfg *Config) *loginOptions {
+	opt := &loginOptions{}
+	fs.Bool("check", true, "only verify the credentials (the default)")
+	fs.BoolVar(&opt.save, "save", false, "store the verified credentials as a profile in the config file")
+	fs.StringVar(&opt.name, "name", cfg.Profile, "profile name used by --save (default: the active profile or \"default\")")
+	return opt
+}
+
+// runLogin validates credentials with a token exchange before they are
+// needed for a payment. Nothing is written unless --save is given.
+func runLogin(cfg *Config, args []string) error {
+	fs := newFlagSet("login")
+	opt := loginFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
+	var err error
+	if cfg.Username == "" {
+		if cfg.Username, err = promptUser("CamPay app username: "); err != nil {
+			return err
+		}
+	}
+	if cfg.Password == "" {
+		if cfg.Password, err = promptSecret("CamPay app password: "); err != nil {
+			return err
+		}
+	}
+
+	fmt.Printf("%s (%s)\n", tr("environment", cfg.Env), cfg.APIBaseURL)
+	client, err := authenticate(cfg)
+	if err != nil {
+		return err
+	}
+
+	if info := client.TokenInfo(); info != nil {
+		if info.ExpiresIn > 0 {
+			fmt.Printf("  Token valid for %s\n", (time.Duration(info.ExpiresIn) * time.Second).String())
+		}
+		// CamPay may describe the app (name, permissions) next to the token
+		keys := make([]string, 0, len(info.Raw))
+		for k := range info.Raw {
+			keys = append(keys, k)
+		}
+		sort.Strings(keys)
+		for _, k := range keys {
+			fmt.Printf("  %s: %s\n", k, strings.Trim(string(info.Raw[k]), `"`))
+		}
+	}
+
+	// Read-only probe; collect and withdraw are not tried since they move money
+	if balance, err := client.Balance(context.Background()); err != nil {
+		fmt.Println("  ⚠ Balance: not available:", err)
+	} else {
+		fmt.Printf("  ✓ Balance: %s\n", formatMoney(balance.TotalBalance, balance.Currency))
+	}
+
+	if !opt.save {
+		fmt.Println("\nNothing was saved (use --save to store these credentials).")
+		return nil
+	}
+	return saveLoginProfile(cfg, opt.name, false)
+}
+
+// saveLoginProfile writes the credentials of cfg to the named profile,
+// with the password in the keychain rather than the file if asked.
+func saveLoginProfile(cfg *Config, name string, keychain bool) error {
+	if name == "" {
+		name = "default"
+	}
+
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	if fc.Profiles == nil {
+		fc.Profiles = map[string]Profile{}
+	}
+	p := fc.Profiles[name]
+	p.Username = cfg.Username
+	p.Password, p.Keychain = cfg.Password, false
+	if keychain {
+		if err := keychainSet(name, cfg.Password); err != nil {
+			return fmt.Errorf("failed to store the password in the keychain: %w", err)
+		}
+		p.Password, p.Keychain = "", true
+	}
+	p.Environment = cfg.Env
+	fc.Profiles[name] = p
+
+	// Like with setup, the first profile saved becomes the default
+	_, hasDefault := fc.Other["profile"]
+	if !hasDefault {
+		if fc.Other == nil {
+			fc.Other = map[string]json.RawMessage{}
+		}
+		fc.Other["profile"], _ = json.Marshal(name)
+	}
+
+	if err := saveFileConfig(fc); err != nil {
+		return err
+	}
+	path, _ := configPath()
+	fmt.Printf("\n✓ Saved profile %q to %s\n", name, path)
+	if !hasDefault {
+		fmt.Println("  It is the default profile.")
+	} else {
+		fmt.Printf("  Use it with --profile %s or CAMPAY_PROFILE=%s\n", name, name)
+	}
+	return nil
+}
+
+// askCredentials prompts for the credentials that are still missing when
+// someone is at the terminal, rather than failing with auth.missing. The
+// password is not echoed. Once they work, offerSaveCredentials asks
+// whether to keep them.
+func askCredentials(cfg *Config) error {
+	if (cfg.Username != "" && cfg.Password != "") || !isTerminal(os.Stdin) || outputFormat != "text" {
+		return nil
+	}
+	fmt.Println(tr("auth.prompt"))
+	var err error
+	if cfg.Username == "" {
+		if cfg.Username, err = promptUser("CamPay app username: "); err != nil {
+			return err
+		}
+		cfg.settings.replaced("prompt", "username")
+	}
+	if cfg.Password == "" {
+		if cfg.Password, err = promptSecret("CamPay app password: "); err != nil {
+			return err
+		}
+		cfg.settings.replaced("prompt", "password")
+	}
+	cfg.credentialsTyped = true
+	return nil
+}
+
+// offerSaveCredentials asks, once, whether credentials typed at the prompt
+// and accepted by CamPay should be saved to the active profile (default
+// "default"), with the password in the keychain when there is one.
+func offerSaveCredentials(cfg *Config) {
+	if !cfg.credentialsTyped {
+		return
+	}
+	cfg.credentialsTyped = false
+	name := cfg.Profile
+	if name == "" {
+		name = "default"
+	}
+	answer, err := promptUser(fmt.Sprintf("Save these credentials to profile %q? [y/N]: ", name))
+	if err != nil || !isYes(answer) {
+		return
+	}
+	keychain := false
+	if _, err := keychainTool(); err == nil {
+		answer, err := promptUser("Keep the password in the OS keychain instead of the config file? [y/N]: ")
+		keychain = err == nil && isYes(answer)
+	}
+	if err := saveLoginProfile(cfg, name, keychain); err != nil {
+		fmt.Println("⚠ Credentials not saved:", err)
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+)
+
+/* ============================================================
+   ========================== LOOKUP ===========================
+   ============================================================ */
+
+// lookupOptions are the flags of lookup.
+type lookupOptions struct {
+	externalRef string
+	refresh     bool
+	since       string
+}
+
+// lookupFlags defines the flags of lookup on fs.
+func lookupFlags(fs *flag.FlagSet, cfg *Config) *lookupOptions {
+	opt := &lookupOptions{}
+	fs.StringVar(&opt.externalRef, "external-ref", "", "external reference (order ID) to resolve")
+	fs.BoolVar(&opt.refresh, "refresh", false, "query the API even for final statuses")
+	fs.StringVar(&opt.since, "since", "30d", "how far back CamPay's history is searched when the ledger has no match: 7d or a date like 2026-01-31")
+	return opt
+}
+
+// runLookup resolves an external reference (e.g. an ERP order ID) to the
+// CamPay transactions recorded for it, refreshing non-final statuses from
+// the API. When the ledger has none, CamPay's history is searched.
+func runLookup(cfg *Config, args []string) error {
+	fs := newFlagSet("lookup")
+	opt := lookupFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if opt.externalRef == "" {
+		return invalidInput("usage: campay lookup --external-ref <id>")
+	}
+	since, err := parseSince(opt.since)
+	if err != nil {
+		return invalidInput("invalid --since %q (use e.g. 7d or 2026-01-31)", opt.since)
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	entries, err := ledger.FindByExternalRef(opt.externalRef)
+	if err != nil {
+		return err
+	}
+	var provider Provider
+	fromHistory := len(entries) == 0
+	if fromHistory {
+		if provider, err = connectProvider(cfg); err != nil {
+			return err
+		}
+		if entries, err = findInHistory(provider, opt.externalRef, since); err != nil {
+			return err
+		}
+		if len(entries) == 0 {
+			return fmt.Errorf("no transaction with external reference %q in the local ledger or in CamPay's history since %s",
+				opt.externalRef, inZone(since).Format("2006-01-02"))
+		}
+		fmt.Printf("⚠ %q is not in the local ledger; found in CamPay's history (campay sync records it)\n", opt.externalRef)
+	}
+
+	for i, e := range entries {
+		if fromHistory || isFinal(e.Status) && !opt.refresh {
+			continue
+		}
+
+		if provider == nil {
+			if provider, err = connectProvider(cfg); err != nil {
+				return err
+			}
+		}
+
+		txn, err := provider.Status(context.Background(), e.Reference)
+		if err != nil {
+			fmt.Printf("⚠ Could not refresh %s: %v\n", e.Reference, err)
+			continue
+		}
+		printWarnings(txn.Warnings)
+
+		if err := ledger.UpdateStatus(e.Reference, parseStatus(txn.Status), txn.Operator); err != nil {
+			fmt.Println("⚠", err)
+			continue
+		}
+		entries[i].Status, _ = statusPolicy.Transition(e.Status, parseStatus(txn.Status))
+	}
+
+	tbl := newTable("",
+		tableColumn{Name: "Reference"},
+		tableColumn{Name: "Kind"},
+		tableColumn{Name: "Amount", Amount: true},
+		tableColumn{Name: "Currency"},
+		tableColumn{Name: "Status"},
+		tableColumn{Name: "Created"},
+	)
+	for _, e := range entries {
+		tbl.Row(e.Reference, e.Kind, e.Amount, e.Currency, e.Status, e.CreatedAt)
+	}
+	if tableFormat() == "table" {
+		fmt.Printf("\nExternal reference: %s\n", opt.externalRef)
+	}
+	return tbl.Print()
+}
+
+// findInHistory looks externalRef up in CamPay's history since the given
+// time, for each kind, when the provider can. The entries it returns are
+// not recorded in the ledger.
+func findInHistory(provider Provider, externalRef string, since time.Time) ([]LedgerEntry, error) {
+	finder, ok := provider.(externalRefFinder)
+	if !ok {
+		return nil, nil
+	}
+	var entries []LedgerEntry
+	for _, kind := range []string{"collect", "withdraw"} {
+		txn, err := finder.FindByExternalReference(context.Background(), kind, externalRef, since)
+		if err != nil {
+			return nil, fmt.Errorf("could not search CamPay's history: %w", err)
+		}
+		if txn != nil {
+			entries = append(entries, LedgerEntry{
+				Reference:         txn.Reference,
+				ExternalReference: txn.ExternalReference,
+				Kind:              kind,
+				Amount:            txn.Amount.Int(),
+				Currency:          txn.Currency,
+				Status:            parseStatus(txn.Status),
+			})
+		}
+	}
+	return entries, nil
+}
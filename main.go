@@ -1,384 +1,1019 @@
 package main
 
 import (
-	"bufio"
-	"bytes"
-	"encoding/json"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"flag"
 	"fmt"
-	"io"
+	"log"
 	"net/http"
+	"net/url"
 	"os"
+	"path/filepath"
 	"strconv"
 	"strings"
+	"text/template"
 	"time"
 
 	"github.com/joho/godotenv"
+
+	"cohort5-go-api/campay"
 )
 
 /* ============================================================
-   ===============  REQUEST / RESPONSE MODELS  =================
+   ========================= MAIN ==============================
    ============================================================ */
 
-type TokenRequest struct {
-	Username string `json:"username"`
-	Password string `json:"password"`
+// outputFormat is "text" or "json", set by the --output global flag.
+var outputFormat = "text"
+
+func main() {
+	err := run()
+	afterEvents.wait() // hooks, SMS receipts and callbacks still running
+	if err != nil {
+		reportError(err)
+	}
+	flushOutput()
+	os.Exit(exitCode(err))
 }
 
-type TokenResponse struct {
-	Token string `json:"token"`
+// Config holds the settings shared by every command.
+type Config struct {
+	Username   string
+	Password   string
+	Env        string
+	BaseURL    string // replaces the URL of Env when set
+	APIBaseURL string
+	Endpoints  map[string]string
+	Timeouts   campay.Timeouts
+	WebhookKey string
+	// PreviousWebhookKey is accepted besides WebhookKey during a rotation
+	PreviousWebhookKey string
+	Verbose            bool
+	StatusTTL          time.Duration
+	Deadline           time.Duration // how long the customer has to confirm
+	Profile            string
+	Profiles           map[string]Profile
+	Provider           string
+
+	Proxy         string
+	CACert        string
+	TLSMinVersion string
+	Headers       map[string]string
+
+	DescriptionTemplate string
+	FX                  *fxDisplay
+	Risk                RiskRules
+	OperatorLimits      map[string]AmountLimits
+	Routing             RoutingRules
+	Splits              map[string][]SplitCut
+	Secrets             SecretsConfig
+	TreasuryPhone       string
+	RefFormat           string              // external reference template, see refs.go
+	RefGenerator        campay.RefGenerator // nil for prefixed ULIDs
+	Rounding            Rounding            // of derived amounts, see rounding.go
+	Timezone            string              // where days start, see timezone.go
+	Update              UpdateConfig
+	PortedNumbers       map[string]string // normalized number → MTN or ORANGE
+	Retention           RetentionConfig
+	Accounting          AccountingConfig
+	Outage              OutageConfig
+	FraudCheck          FraudCheckConfig
+	SMS                 *smsReceipts    // nil unless the config file sets up a gateway
+	ASCIIDescriptions   map[string]bool // operators (or "*") sent transliterated descriptions
+	Statuses            *campay.StatusPolicy
+	RefGeneratorSpec    string       // ref_generator setting, resolved into RefGenerator
+	RelaySecrets        relaySecrets // per relay destination, see relay.go
+	ReadOnly            bool         // see readonly.go
+	Demo                bool
+	DemoWait            time.Duration
+
+	file           *FileConfig
+	settings       *settings
+	secretsLoaded  bool
+	keychainLoaded bool
+
+	// credentialsTyped is set when the credentials were typed at a prompt
+	// and have not been offered for saving yet (see askCredentials).
+	credentialsTyped bool
 }
 
-type CollectRequest struct {
-	Amount            int    `json:"amount"`
-	Currency          string `json:"currency"`
-	From              string `json:"from"`
-	Description       string `json:"description"`
-	ExternalReference string `json:"external_reference"`
+type command struct {
+	Name    string
+	Summary string
+	Run     func(cfg *Config, args []string) error
+
+	// For completion and man pages (see completion.go): the subcommands,
+	// what the positional arguments are, and the flags, declared by the
+	// same function as in Run (see flagsOf). Nil Flags means none.
+	Sub   []subcommand
+	Args  argKind
+	Flags func(cfg *Config) *flag.FlagSet
 }
 
-type CollectResponse struct {
-	Reference         string `json:"reference"`
-	ExternalReference string `json:"external_reference"`
-	Status            string `json:"status"`
-	Amount            int    `json:"amount"`
-	Currency          string `json:"currency"`
-	Operator          string `json:"operator"`
-	Code              string `json:"code"`
-	OperatorReference string `json:"operator_reference"`
+var commands = []command{
+	{Name: "collect", Summary: "Collect a payment interactively (default)", Run: runCollect, Flags: flagsOf("collect", collectFlags)},
+	{Name: "session", Summary: "Take payments one after another with a running total and a summary at the end", Run: runSession, Flags: flagsOf("session", sessionFlags)},
+	{Name: "withdraw-batch", Summary: "Pay out to every row of a CSV file", Run: runWithdrawBatch, Flags: flagsOf("withdraw-batch", withdrawBatchFlags), Args: argFile},
+	{Name: "batch", Summary: "List, show and resume withdraw-batch runs", Run: runBatch,
+		Sub: []subcommand{{Name: "list"}, {Name: "show"}, {Name: "resume", Flags: flagsOf("batch resume", batchResumeFlags)}}},
+	{Name: "run", Summary: "Run a payment plan file (collect, then withdraw or notify)", Run: runPlan, Flags: flagsOf("run", planFlags), Args: argFile},
+	{Name: "split", Summary: "Collect a payment and pay out configured cuts (show <settlement>)", Run: runSplit, Flags: flagsOf("split", splitFlags),
+		Sub: []subcommand{{Name: "show"}}},
+	{Name: "transfer", Summary: "Move balance between two apps through a treasury wallet", Run: runTransfer, Flags: flagsOf("transfer", transferFlags)},
+	{Name: "contacts", Summary: "Manage saved phone numbers (list, add, remove)", Run: runContacts,
+		Sub: []subcommand{{Name: "list"}, {Name: "add"}, {Name: "remove", Args: argContact}}},
+	{Name: "invoice", Summary: "Track invoices paid in installments (list, create, show)", Run: runInvoice,
+		Sub: []subcommand{{Name: "list"}, {Name: "create", Flags: flagsOf("invoice create", invoiceCreateFlags)}, {Name: "show"}}},
+	{Name: "campaign", Summary: "Group collections towards a target (list, create, status, attach, export)", Run: runCampaign,
+		Sub: []subcommand{{Name: "list"}, {Name: "create", Flags: flagsOf("campaign create", campaignCreateFlags)}, {Name: "status"}, {Name: "attach", Args: argReference}, {Name: "export", Flags: flagsOf("campaign export", campaignExportFlags)}}},
+	{Name: "search", Summary: "Filter and sort transactions in the local ledger", Run: runSearch, Flags: flagsOf("search", searchFlags)},
+	{Name: "report", Summary: "Report confirmation times per operator and hour of day (latency)", Run: runReport, Sub: []subcommand{{Name: "latency", Flags: flagsOf("report latency", reportLatencyFlags)}}},
+	{Name: "revenue", Summary: "Report collections net of their refunds, flagging odd refunds", Run: runRevenue, Flags: flagsOf("revenue", revenueFlags)},
+	{Name: "config", Summary: "Show the config file, or every setting in effect and its source (show [--resolved])", Run: runConfig,
+		Sub: []subcommand{{Name: "show", Flags: flagsOf("config show", configShowFlags)}}},
+	{Name: "api", Summary: "Call any CamPay endpoint and print the JSON answer (api GET /balance/)", Run: runAPI, Flags: flagsOf("api", apiFlags)},
+	{Name: "deadletter", Summary: "List, retry and purge notifications the queue gave up on (list, retry, purge)", Run: runDeadLetter,
+		Sub: []subcommand{{Name: "list", Flags: flagsOf("deadletter list", deadletterListFlags)}, {Name: "retry", Flags: flagsOf("deadletter retry", deadletterRetryFlags)}, {Name: "purge", Flags: flagsOf("deadletter purge", deadletterPurgeFlags)}}},
+	{Name: "ledger", Summary: "Archive old transactions, restore archives and export journals for accounting (archive, archives, restore, export)", Run: runLedgerCmd,
+		Sub: []subcommand{{Name: "archive", Flags: flagsOf("ledger archive", ledgerArchiveFlags)}, {Name: "archives"}, {Name: "restore", Args: argFile}, {Name: "export", Flags: flagsOf("ledger export", ledgerExportFlags)}}},
+	{Name: "show", Summary: "Show one transaction of the ledger with its notes", Run: runShow, Args: argReference},
+	{Name: "note", Summary: "Add a timestamped note to a transaction (add <reference> <text>)", Run: runNote,
+		Sub: []subcommand{{Name: "add", Args: argReference}}},
+	{Name: "lookup", Summary: "Find transactions by external reference", Run: runLookup, Flags: flagsOf("lookup", lookupFlags)},
+	{Name: "cancel", Summary: "Abandon a pending transaction", Run: runCancel, Flags: flagsOf("cancel", cancelFlags), Args: argReference},
+	{Name: "history", Summary: "Export CamPay transaction history to CSV or JSON lines, resumably (export)", Run: runHistory,
+		Sub: []subcommand{{Name: "export", Flags: flagsOf("history export", historyExportFlags)}}},
+	{Name: "sync", Summary: "Import CamPay history into the local ledger", Run: runSync, Flags: flagsOf("sync", syncFlags)},
+	{Name: "status", Summary: "Show balances, limits and today's usage (--app)", Run: runStatus, Flags: flagsOf("status", statusFlags)},
+	{Name: "setup", Summary: "Walk through credentials, environment and currency, and save them as a profile", Run: runSetup, Flags: flagsOf("setup", setupFlags)},
+	{Name: "login", Summary: "Verify credentials with a token exchange (--save stores them)", Run: runLogin, Flags: flagsOf("login", loginFlags)},
+	{Name: "debug-bundle", Summary: "Zip scrubbed settings, logs, ledger entries and cassettes for a support ticket", Run: runDebugBundle, Flags: flagsOf("debug-bundle", debugBundleFlags)},
+	{Name: "doctor", Summary: "Check credentials, connectivity and clock skew for each profile", Run: runDoctor},
+	{Name: "healthcheck", Summary: "Alias for doctor", Run: runDoctor},
+	{Name: "daemon", Summary: "Run payment jobs in the background (see jobs)", Run: runDaemon, Flags: flagsOf("daemon", daemonFlags)},
+	{Name: "jobs", Summary: "Submit, list and inspect daemon jobs", Run: runJobs, Sub: []subcommand{{Name: "submit", Flags: flagsOf("jobs submit", jobsFlags)}, {Name: "list", Flags: flagsOf("jobs list", jobsFlags)}, {Name: "show", Flags: flagsOf("jobs show", jobsFlags)}}},
+	{Name: "apikey", Summary: "Create, list and revoke scoped keys for the daemon API (create, list, revoke)", Run: runAPIKey,
+		Sub: []subcommand{{Name: "create", Flags: flagsOf("apikey create", apikeyCreateFlags)}, {Name: "list"}, {Name: "revoke"}}},
+	{Name: "dashboard", Summary: "Serve a local web dashboard over the ledger", Run: runDashboard, Flags: flagsOf("dashboard", dashboardFlags)},
+	{Name: "webhook", Summary: "Rotate the webhook signing key of a profile (rotate-key, drop-previous-key)", Run: runWebhook,
+		Sub: []subcommand{{Name: "rotate-key", Flags: flagsOf("webhook rotate-key", webhookRotateKeyFlags)}, {Name: "drop-previous-key", Flags: flagsOf("webhook drop-previous-key", webhookDropPreviousKeyFlags)}}},
+	{Name: "serve", Summary: "Receive CamPay webhooks and relay them to internal services", Run: runServe, Flags: flagsOf("serve", serveFlags)},
+	{Name: "init", Summary: "Scaffold a starter Go project (or config files) using the library", Run: runInit, Flags: flagsOf("init", initFlags), Args: argFile},
+	{Name: "mock", Summary: "Serve a mock CamPay API for tests and benchmarks", Run: runMock, Flags: flagsOf("mock", mockFlags)},
+	{Name: "bench", Summary: "Drive simulated payments against the mock API and report throughput", Run: runBench, Flags: flagsOf("bench", benchFlags)},
+	{Name: "version", Summary: "Print the build version", Run: runVersion, Flags: flagsOf("version", versionFlags)},
+	{Name: "self-update", Summary: "Install the latest release of a channel (--channel stable|beta)", Run: runSelfUpdate, Flags: flagsOf("self-update", selfUpdateFlags)},
 }
 
-type TransactionResponse struct {
-	Reference         string  `json:"reference"`
-	ExternalReference string  `json:"external_reference"`
-	Status            string  `json:"status"`
-	Amount            float64 `json:"amount"`
-	Currency          string  `json:"currency"`
-	Operator          string  `json:"operator"`
-	Code              string  `json:"code"`
-	OperatorReference string  `json:"operator_reference"`
-	Description       string  `json:"description"`
+func run() error {
+	cfg, err := loadConfig()
+	if err != nil {
+		return err
+	}
+
+	if len(os.Args) > 1 && os.Args[1] == completeCommand {
+		return runComplete(cfg, os.Args[2:])
+	}
+
+	global, record, replay := globalFlags(cfg)
+	global.Usage = func() { printUsage(global) }
+	if err := cfg.settings.load(cfg.file.Other); err != nil {
+		return err
+	}
+	if err := global.Parse(os.Args[1:]); err != nil {
+		if errors.Is(err, flag.ErrHelp) {
+			return nil
+		}
+		return exitErr(exitValidation, err)
+	}
+	cfg.settings.parsed(global)
+	if err := finishSettings(cfg); err != nil {
+		return err
+	}
+	if cfg.Demo && (*record != "" || *replay != "") {
+		return invalidInput("--demo cannot be combined with --record or --replay")
+	}
+	if err := setupOutput(); err != nil {
+		return err
+	}
+	receiptSMS = cfg.SMS
+	statusPolicy = cfg.Statuses
+	if err := openCassette(cfg, *record, *replay); err != nil {
+		return err
+	}
+	defer saveCassette()
+	if cfg.Profile != "" {
+		if err := applyProfile(cfg, cfg.Profile); err != nil {
+			return err
+		}
+	}
+	if cfg.Demo {
+		if err := startDemo(cfg, cfg.DemoWait); err != nil {
+			return err
+		}
+	}
+
+	args := global.Args()
+	if len(args) == 0 {
+		return runCollect(cfg, nil)
+	}
+
+	if args[0] == "help" {
+		printUsage(global)
+		return nil
+	}
+
+	for _, c := range commands {
+		if c.Name == args[0] {
+			err := c.Run(cfg, args[1:])
+			if errors.Is(err, flag.ErrHelp) {
+				return nil // --help: the usage was printed
+			}
+			return err
+		}
+	}
+
+	printUsage(global)
+	return invalidInput("unknown command %q", args[0])
 }
 
-type ErrorResponse struct {
-	Code    string `json:"code"`
-	Message string `json:"message"`
+// globalFlags defines the flags that come before the command: every
+// setting, and the cassette flags.
+func globalFlags(cfg *Config) (global *flag.FlagSet, record, replay *string) {
+	global = flag.NewFlagSet("campay", flag.ContinueOnError)
+	cfg.settings = defineSettings(cfg, global)
+	record = global.String("record", "", "save the API calls of this run, sanitized, to a cassette file")
+	replay = global.String("replay", "", "answer API calls from a cassette file instead of the network")
+	return global, record, replay
 }
 
-/* ============================================================
-   ========================= MAIN ==============================
-   ============================================================ */
+// newFlagSet is flag.NewFlagSet for the flags of a command.
+func newFlagSet(name string) *flag.FlagSet {
+	return flag.NewFlagSet(name, flag.ContinueOnError)
+}
 
-func main() {
-	if err := run(); err != nil {
-		fmt.Println("❌ Error:", err)
-		os.Exit(1)
+// flagsOf makes the Flags of a commands table entry from the function that
+// declares the flags of the command, without running the command.
+func flagsOf[T any](name string, declare func(fs *flag.FlagSet, cfg *Config) T) func(cfg *Config) *flag.FlagSet {
+	return func(cfg *Config) *flag.FlagSet {
+		fs := newFlagSet(name)
+		declare(fs, cfg)
+		return fs
 	}
 }
 
-func run() error {
+func printUsage(global *flag.FlagSet) {
+	fmt.Println("Usage: campay [global flags] [command] [flags]")
+	fmt.Println("\nCommands:")
+	for _, c := range commands {
+		fmt.Printf("  %-16s %s\n", c.Name, c.Summary)
+	}
+	fmt.Println("\nGlobal flags:")
+	global.SetOutput(os.Stdout)
+	global.PrintDefaults()
+}
+
+func loadConfig() (*Config, error) {
 	// Load .env values
 	if _, err := os.Stat(".env"); err == nil {
 		if err := godotenv.Load(); err != nil {
-			return fmt.Errorf("failed to load .env: %w", err)
+			return nil, fmt.Errorf("failed to load .env: %w", err)
 		}
 	}
 
-	username := os.Getenv("APP_USERNAME")
-	password := os.Getenv("APP_PASSWORD")
-	env := os.Getenv("ENVIRONMENT")
-
-	if username == "" || password == "" {
-		return fmt.Errorf("APP_USERNAME and APP_PASSWORD must be set")
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, err
+	}
+	// Scalar settings are resolved by run, see settings.go
+	cfg := &Config{file: fc}
+	cfg.Profiles = fc.Profiles
+	cfg.Risk = fc.Risk
+	cfg.OperatorLimits = operatorLimits(fc.OperatorLimits)
+	cfg.Routing = fc.Routing
+	cfg.Splits = fc.Splits
+	cfg.Secrets = fc.Secrets
+	cfg.Update = fc.Update
+	if cfg.PortedNumbers, err = portedNumbers(fc.PortedNumbers); err != nil {
+		return nil, err
 	}
-	if env == "" {
-		env = "DEV"
+	if fc.Retention.ArchiveAfter != "" {
+		if _, err := retentionCutoff(fc.Retention.ArchiveAfter, time.Now()); err != nil {
+			return nil, fmt.Errorf("retention.archive_after: %w", err)
+		}
 	}
+	cfg.Retention = fc.Retention
+	cfg.Accounting = fc.Accounting
+	if err := cfg.Accounting.validate(); err != nil {
+		return nil, fmt.Errorf("accounting: %w", err)
+	}
+	cfg.Outage = fc.Outage
+	if err := cfg.Outage.validate(); err != nil {
+		return nil, fmt.Errorf("outage: %w", err)
+	}
+	cfg.FraudCheck = fc.FraudCheck
+	if err := cfg.FraudCheck.validate(); err != nil {
+		return nil, fmt.Errorf("fraud_check: %w", err)
+	}
+	cfg.ASCIIDescriptions = map[string]bool{}
+	for _, op := range fc.ASCIIDescriptions {
+		if op != "*" {
+			if op, err = parseOperator(op); err != nil {
+				return nil, fmt.Errorf("ascii_descriptions: %w", err)
+			}
+		}
+		cfg.ASCIIDescriptions[op] = true
+	}
+	if err := fc.Statuses.Validate(); err != nil {
+		return nil, fmt.Errorf("statuses: %w", err)
+	}
+	cfg.Statuses = &fc.Statuses
+	if cfg.SMS, err = newSMSReceipts(fc.SMS); err != nil {
+		return nil, err
+	}
+	if cfg.RelaySecrets, err = newRelaySecrets(fc.RelaySecrets); err != nil {
+		return nil, err
+	}
+	if err := campay.ValidateEndpoints(fc.Endpoints); err != nil {
+		return nil, fmt.Errorf("endpoints: %w", err)
+	}
+	cfg.Endpoints = fc.Endpoints
+	cfg.Headers = fc.Headers
+	return cfg, nil
+}
 
-	apiBaseURL := map[bool]string{
-		true:  "https://www.campay.net/api",
-		false: "https://demo.campay.net/api",
-	}[env == "PROD"]
+// apiBaseURL returns the base_url setting, or the URL of the environment.
+func apiBaseURL(cfg *Config) string {
+	if cfg.BaseURL != "" {
+		return strings.TrimRight(cfg.BaseURL, "/")
+	}
+	return baseURLFor(cfg.Env)
+}
 
-	fmt.Println("=== CamPay Mobile Money Payment System ===")
-	fmt.Printf("Environment: %s\n\n", env)
+func baseURLFor(env string) string {
+	return map[bool]string{
+		true:  campay.ProdBaseURL,
+		false: campay.DemoBaseURL,
+	}[env == "PROD"]
+}
 
-	// Authenticate
-	fmt.Println("🔐 Authenticating...")
-	token, err := getAuthToken(apiBaseURL, username, password)
-	if err != nil {
-		return err
+// applyProfile overrides the environment credentials with those of the
+// named profile.
+func applyProfile(cfg *Config, name string) error {
+	p, ok := cfg.Profiles[name]
+	if !ok {
+		return invalidInput("unknown profile %q", name)
 	}
-	fmt.Println("✓ Authentication successful")
 
-	// User Input
-	phone, err := promptPhone()
-	if err != nil {
-		return err
+	cfg.Profile = name
+	source := "profile " + name
+	if p.Username != "" {
+		cfg.Username = p.Username
+		cfg.settings.replaced(source, "username")
 	}
-
-	amount, err := promptAmount()
-	if err != nil {
-		return err
+	if p.Password != "" {
+		cfg.Password = p.Password
+		cfg.settings.replaced(source, "password")
+	}
+	if p.Environment != "" {
+		cfg.Env = p.Environment
+		cfg.settings.replaced(source, "environment")
 	}
+	if p.WebhookKey != "" {
+		cfg.WebhookKey = p.WebhookKey
+		cfg.PreviousWebhookKey = p.PreviousWebhookKey
+		cfg.settings.replaced(source, "webhook_key", "previous_webhook_key")
+	}
+	if p.RefFormat != "" {
+		cfg.RefFormat = p.RefFormat
+		cfg.settings.replaced(source, "ref_format")
+	}
+	if p.BaseURL != "" {
+		if err := checkBaseURL(p.BaseURL); err != nil {
+			return invalidInput("profile %s: %v", name, err)
+		}
+		cfg.BaseURL = p.BaseURL
+		cfg.settings.replaced(source, "base_url")
+	}
+	cfg.APIBaseURL = apiBaseURL(cfg)
+	return nil
+}
 
-	description, err := promptUser("Enter description: ")
-	if err != nil {
-		return err
+// newClient builds an unauthenticated client from cfg.
+func newClient(cfg *Config) (*campay.Client, error) {
+	if err := resolveSecrets(cfg); err != nil {
+		return nil, err
+	}
+	if err := askCredentials(cfg); err != nil {
+		return nil, err
+	}
+	opts := campay.Options{
+		BaseURL:      cfg.APIBaseURL,
+		Username:     cfg.Username,
+		Password:     cfg.Password,
+		Timeouts:     cfg.Timeouts,
+		Headers:      http.Header{},
+		UserAgent:    userAgent(),
+		OnBusy:       onProviderBusy,
+		RefGenerator: cfg.RefGenerator,
+		Endpoints:    cfg.Endpoints,
+		PreCollect:   cfg.FraudCheck.hook(cfg),
+		ReadOnly:     cfg.ReadOnly,
+	}
+	for name, value := range cfg.Headers {
+		opts.Headers.Set(name, value)
+	}
+
+	if cfg.Proxy != "" {
+		proxy, err := url.Parse(cfg.Proxy)
+		if err != nil || proxy.Host == "" {
+			return nil, invalidInput("invalid proxy URL %q", cfg.Proxy)
+		}
+		opts.Proxy = proxy
 	}
 
-	externalRef := fmt.Sprintf("TXN-%d", time.Now().Unix())
+	if cfg.CACert != "" {
+		pem, err := os.ReadFile(cfg.CACert)
+		if err != nil {
+			return nil, exitErr(exitValidation, fmt.Errorf("failed to read CA certificate: %w", err))
+		}
+		pool, err := x509.SystemCertPool()
+		if err != nil {
+			pool = x509.NewCertPool()
+		}
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, invalidInput("no certificates found in %s", cfg.CACert)
+		}
+		opts.RootCAs = pool
+	}
 
-	collectReq := CollectRequest{
-		Amount:            amount,
-		Currency:          "XAF",
-		From:              phone,
-		Description:       description,
-		ExternalReference: externalRef,
+	switch cfg.TLSMinVersion {
+	case "", "1.2":
+		opts.TLSMinVersion = tls.VersionTLS12
+	case "1.3":
+		opts.TLSMinVersion = tls.VersionTLS13
+	default:
+		return nil, invalidInput("--tls-min-version must be 1.2 or 1.3")
 	}
 
-	fmt.Println("\n📲 Initiating payment...")
+	client := campay.NewClient(opts)
+	if cfg.Verbose {
+		logger := log.New(os.Stderr, "[campay] ", log.LstdFlags)
+		client.Use(campay.LogRequests(logger.Printf))
+	}
+	if cfg.StatusTTL > 0 {
+		client.Use(campay.CacheStatus(cfg.StatusTTL))
+	}
+	useCassette(client)
+	return client, nil
+}
 
-	// Collect request
-	reference, err := collectPayment(apiBaseURL, token, collectReq)
+// authenticate returns a CamPay client holding a fresh API token, for
+// commands that use CamPay-only endpoints (history, balance).
+func authenticate(cfg *Config) (*campay.Client, error) {
+	pc := *cfg
+	pc.Provider = "campay"
+	p, err := connectProvider(&pc)
 	if err != nil {
-		return err
+		return nil, err
 	}
+	return p.(*campayProvider).client, nil
+}
+
+// collectOptions are the flags of collect.
+type collectOptions struct {
+	phone           string
+	descTemplate    string
+	vars            templateVars
+	externalRef     string
+	force           bool
+	duplicateWindow time.Duration
+	receiptTemplate string
+	stdin           bool
+	concurrency     int
+	onExpiry        string
+	operator        string
+	campaign        string
+}
 
-	fmt.Printf("\n✓ Payment initiated\nReference: %s\n", reference)
-	fmt.Println("Please check your phone for USSD popup...")
+// collectFlags defines the flags of collect on fs.
+func collectFlags(fs *flag.FlagSet, cfg *Config) *collectOptions {
+	opt := &collectOptions{}
+	fs.StringVar(&opt.phone, "phone", "", "payer number or @contact (prompted if empty)")
+	fs.StringVar(&opt.descTemplate, "description-template", cfg.DescriptionTemplate, "description template, e.g. \"Order {{.OrderID}} - {{.Date}}\"")
+	opt.vars = templateVars{}
+	fs.Var(opt.vars, "var", "template variable as key=value (repeatable)")
+	fs.StringVar(&opt.externalRef, "external-ref", "", "your own reference for this payment, e.g. an order ID (default: from ref_format, or TXN-<unix time>)")
+	fs.BoolVar(&opt.force, "force", false, "override risk rules (recorded in the audit log)")
+	fs.DurationVar(&opt.duplicateWindow, "duplicate-window", defaultDuplicateWindow, "ask before collecting the same amount from the same number again within this time (0 disables)")
+	fs.StringVar(&opt.receiptTemplate, "template", "", "Go template file for the final summary, e.g. receipt.tmpl")
+	fs.BoolVar(&opt.stdin, "stdin", false, "read JSON-lines payment requests from stdin and write JSON results to stdout")
+	fs.IntVar(&opt.concurrency, "concurrency", 1, "requests processed in parallel with --stdin")
+	fs.DurationVar(&cfg.Deadline, "confirm-deadline", cfg.Deadline, "time the customer has to confirm, e.g. 3m")
+	fs.StringVar(&opt.onExpiry, "on-expiry", "expire", "after the deadline: expire, cancel or retry (resubmit once)")
+	fs.StringVar(&opt.operator, "operator", "", "payer's network, MTN or ORANGE, for ported numbers (default: from ported_numbers, the last payment or the prefix)")
+	fs.StringVar(&opt.campaign, "campaign", "", "campaign the collection counts towards (see campaign list)")
+	return opt
+}
 
-	// Wait for status
-	finalStatus, err := pollTransactionStatus(apiBaseURL, token, reference)
+func runCollect(cfg *Config, args []string) error {
+	fs := newFlagSet("collect")
+	opt := collectFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "collect"); err != nil {
+		return err
+	}
+	given, err := parseOperator(opt.operator)
 	if err != nil {
 		return err
 	}
+	if opt.onExpiry != "expire" && opt.onExpiry != "cancel" && opt.onExpiry != "retry" {
+		return invalidInput("--on-expiry must be expire, cancel or retry")
+	}
+	if cfg.Deadline <= 0 {
+		return invalidInput("--confirm-deadline must be positive")
+	}
 
-	displayFinalStatus(finalStatus)
-	return nil
-}
+	if opt.stdin {
+		if opt.concurrency < 1 {
+			return invalidInput("concurrency must be at least 1")
+		}
+		return runCollectStdin(cfg, opt.concurrency, opt.force)
+	}
 
-/* ============================================================
-   ====================== HELPER FUNCTIONS =====================
-   ============================================================ */
+	var receipt *template.Template
+	if opt.receiptTemplate != "" {
+		var err error
+		if receipt, err = loadReceiptTemplate(opt.receiptTemplate); err != nil {
+			return err
+		}
+	}
 
-var httpClient = &http.Client{Timeout: 30 * time.Second}
+	fmt.Println(tr("banner"))
+	fmt.Printf("%s\n\n", tr("environment", cfg.Env))
 
-// =============================================================
-// Authentication
-// =============================================================
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
 
-func getAuthToken(baseURL, username, password string) (string, error) {
-	reqBody, _ := json.Marshal(TokenRequest{Username: username, Password: password})
-	req, err := http.NewRequest("POST", baseURL+"/token/", bytes.NewBuffer(reqBody))
+	// Authenticate
+	provider, err := connectProvider(cfg)
 	if err != nil {
-		return "", err
+		return err
 	}
-	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := httpClient.Do(req)
+	// User Input
+	var phone string
+	if opt.phone != "" {
+		phone, err = resolvePhone(opt.phone)
+		if err != nil && !strings.HasPrefix(opt.phone, "@") && isTerminal(os.Stdin) && outputFormat == "text" {
+			phone, err = choosePhoneSuggestion(opt.phone, err)
+		}
+	} else {
+		phone, err = promptPhone()
+	}
 	if err != nil {
-		return "", err
+		return err
 	}
-	defer resp.Body.Close()
+	operator, err := chooseOperator(cfg, ledger, phone, given)
+	if err != nil {
+		return err
+	}
+	warnOutage(cfg, ledger, operator)
 
-	body, _ := io.ReadAll(resp.Body)
+	// Installments of an invoice may not exceed what is left to pay
+	invoices, err := loadInvoices()
+	if err != nil {
+		return err
+	}
+	invoice, isInvoice := invoices[opt.externalRef]
+	refs, err := newRefAllocator(cfg, ledger)
+	if err != nil {
+		return err
+	}
+	if opt.externalRef != "" && !isInvoice {
+		if err := refs.Check(opt.externalRef); err != nil {
+			return err
+		}
+	}
+	var open int
+	if isInvoice {
+		b, err := balanceOf(ledger, invoice.ExternalReference)
+		if err != nil {
+			return err
+		}
+		open = b.Remaining(invoice) - b.Pending
+		fmt.Printf("Invoice %s: paid %s of %s, remaining %s", invoice.ExternalReference, formatAmount(b.Paid, ""), formatAmount(invoice.Total, "XAF"), formatAmount(b.Remaining(invoice), ""))
+		if b.Pending > 0 {
+			fmt.Printf(" (%s pending)", formatAmount(b.Pending, ""))
+		}
+		fmt.Println()
+		if open <= 0 {
+			return invalidInput("invoice %s has nothing left to collect", invoice.ExternalReference)
+		}
+	}
 
-	if resp.StatusCode != 200 {
-		return "", formatAPIError(resp.StatusCode, body)
+	var campaign Campaign
+	if opt.campaign != "" {
+		if campaign, err = lookupCampaign(opt.campaign); err != nil {
+			return err
+		}
+		printCampaignProgress(ledger, campaign)
 	}
 
-	var tokenResp TokenResponse
-	if err := json.Unmarshal(body, &tokenResp); err != nil {
-		return "", err
+	amount, err := promptAmount()
+	if err != nil {
+		return err
+	}
+	if isInvoice && amount > open {
+		return invalidInput("amount %d exceeds the %d XAF left on invoice %s", amount, open, invoice.ExternalReference)
+	}
+	if err := checkLimitsFor(cfg.OperatorLimits, operator, amount); err != nil {
+		return err
+	}
+	if converted := cfg.FX.Convert(float64(amount)); converted != "" {
+		fmt.Println(tr("amount.converted", formatAmount(amount, "XAF"), converted))
 	}
-	return tokenResp.Token, nil
-}
 
-// =============================================================
-// User Input
-// =============================================================
+	risk, err := newRiskCheck(cfg.Risk, ledger, "collect")
+	if err != nil {
+		return err
+	}
+	if err := risk.Enforce(phone, amount, opt.force); err != nil {
+		return err
+	}
+	if err := confirmDuplicate(ledger, phone, amount, opt.duplicateWindow); err != nil {
+		return err
+	}
 
-func promptUser(prompt string) (string, error) {
-	fmt.Print(prompt)
-	reader := bufio.NewReader(os.Stdin)
+	externalRef := opt.externalRef
+	if externalRef == "" {
+		if externalRef, err = refs.Generate("TXN"); err != nil {
+			return err
+		}
+	}
 
-	input, err := reader.ReadString('\n')
+	var description string
+	if opt.descTemplate != "" {
+		opt.vars["Phone"] = phone
+		opt.vars["Amount"] = strconv.Itoa(amount)
+		opt.vars["ExternalReference"] = externalRef
+		description, err = renderDescription(opt.descTemplate, opt.vars)
+		if err == nil {
+			fmt.Println(tr("description", description))
+		}
+	} else {
+		description, err = promptUser(tr("prompt.description"))
+	}
 	if err != nil {
-		return "", err
+		return err
 	}
 
-	input = strings.TrimSpace(input)
-	if input == "" {
-		return promptUser(prompt)
+	collectReq := campay.CollectRequest{
+		Amount:            amount,
+		Currency:          "XAF",
+		From:              phone,
+		Description:       description,
+		ExternalReference: externalRef,
+	}
+	// Only sent when chosen or when the prefix is not the whole story
+	if given != "" || operator != operatorFor(phone) {
+		collectReq.Operator = operator
 	}
-	return input, nil
-}
 
-func promptPhone() (string, error) {
-	phone, err := promptUser("Enter mobile money number (e.g., 670123456 or 237670123456): ")
-	if err != nil {
-		return "", err
+	audited := LedgerEntry{ExternalReference: externalRef, Phone: phone, Amount: amount}
+	if err := auditMoney(cfg, "collect", auditRequested, audited); err != nil {
+		return err
 	}
 
-	// Normalize
-	phone = strings.TrimSpace(phone)
-	phone = strings.ReplaceAll(phone, " ", "")
+	started := time.Now()
+	var reference, retryOf string
+	var finalStatus *campay.TransactionResponse
+	for try := 0; ; try++ {
+		fmt.Println("\n" + tr("collect.initiating"))
 
-	// Local number
-	if len(phone) == 9 && phone[0] == '6' {
-		phone = "237" + phone
+		// Collect request
+		var collectResp *campay.CollectResponse
+		collectResp, err = submitCollect(provider, collectReq)
+		if err != nil {
+			auditMoney(cfg, "collect", "error: "+err.Error(), audited)
+			return err
+		}
+		reference = collectResp.Reference
+		audited.Reference = reference
+		auditMoney(cfg, "collect", auditInitiated, audited)
+
+		fmt.Printf("\n%s\n%s\n", tr("collect.initiated"), tr("collect.reference", reference))
+		fmt.Println(tr("collect.check"))
+		printDialHint(collectResp)
+
+		recordLedger(ledger, LedgerEntry{
+			Reference:         reference,
+			ExternalReference: externalRef,
+			Kind:              "collect",
+			Phone:             phone,
+			Amount:            amount,
+			Currency:          collectReq.Currency,
+			Description:       description,
+			Status:            campay.StatusPending,
+			Environment:       cfg.Env,
+			Campaign:          campaign.ID,
+			DialCode:          collectResp.DialCode(),
+			Review:            reviewReason(collectResp),
+		})
+		if retryOf != "" {
+			if first, err := ledger.Get(retryOf); err == nil && first != nil {
+				markRetried(ledger, *first, reference)
+			}
+		}
+
+		// Wait for status
+		progress := newPollProgress(cfg.Deadline)
+		finalStatus, err = pollTransactionStatus(provider, ledger, reference, cfg.Deadline, progress.Update)
+		progress.Stop()
+		if err == nil {
+			break
+		}
+		auditMoney(cfg, "collect", "error: "+err.Error(), audited)
+		var expired *expiredError
+		if !errors.As(err, &expired) {
+			return err
+		}
+
+		if opt.onExpiry == "retry" && try == 0 {
+			// The customer may have confirmed just after the deadline
+			last, serr := provider.Status(context.Background(), reference)
+			if serr != nil {
+				return fmt.Errorf("%w; not sent again, as its status could not be checked: %v", err, serr)
+			}
+			if isFinal(parseStatus(last.Status)) {
+				finalStatus = last
+				break
+			}
+			// A new external reference, so that CamPay does not take it for the first
+			if externalRef, err = refs.Generate("TXN"); err != nil {
+				return err
+			}
+			fmt.Printf("⚠ %v; sending a new request as %s\n", expired, externalRef)
+			retryOf, collectReq.ExternalReference = reference, externalRef
+			audited = LedgerEntry{ExternalReference: externalRef, Phone: phone, Amount: amount}
+			if err := auditMoney(cfg, "collect", auditRequested, audited); err != nil {
+				return err
+			}
+			continue
+		}
+		if opt.onExpiry == "cancel" {
+			reason := fmt.Sprintf("not confirmed within %s", cfg.Deadline)
+			if e, cerr := ledger.MarkAbandoned(reference, campay.StatusCancelledLocal, reason); cerr == nil {
+				auditMoney(cfg, "cancel", reason, *e)
+			}
+			return exitErr(exitCancelled, errors.New(tr("err.cancelled", reference, reason)))
+		}
+		return err
 	}
+	auditMoney(cfg, "collect", string(parseStatus(finalStatus.Status)), audited)
 
-	if !strings.HasPrefix(phone, "237") || len(phone) != 12 {
-		return "", fmt.Errorf("invalid phone number format")
+	if err := ledger.UpdateStatus(reference, parseStatus(finalStatus.Status), finalStatus.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
 	}
-	return phone, nil
-}
 
-func promptAmount() (int, error) {
-	amtStr, err := promptUser("Enter amount (XAF): ")
-	if err != nil {
-		return 0, err
+	printWarnings(finalStatus.Warnings)
+	if receipt != nil {
+		if err := receipt.Execute(os.Stdout, newReceiptData(finalStatus, cfg.FX, phone, started)); err != nil {
+			fmt.Println("⚠ Receipt template failed:", err)
+			displayFinalStatus(finalStatus, cfg.FX)
+		}
+	} else {
+		displayFinalStatus(finalStatus, cfg.FX)
 	}
 
-	amount, err := strconv.Atoi(amtStr)
-	if err != nil || amount <= 0 {
-		return 0, fmt.Errorf("amount must be a positive integer")
+	if isInvoice {
+		printInvoiceProgress(ledger, invoice)
+	}
+	if campaign.ID != "" {
+		printCampaignProgress(ledger, campaign)
 	}
+	printResult(reference, finalStatus.Status)
 
-	return amount, nil
+	if unsuccessful(parseStatus(finalStatus.Status)) {
+		return exitErr(exitPaymentFailed, errors.New(tr("err.payment_failed", reference)))
+	}
+	return nil
 }
 
-// =============================================================
-// Payment Collect
-// =============================================================
-
-func collectPayment(baseURL, token string, collect CollectRequest) (string, error) {
-	reqBody, _ := json.Marshal(collect)
-
-	req, err := http.NewRequest("POST", baseURL+"/collect/", bytes.NewBuffer(reqBody))
-	if err != nil {
-		return "", err
+// printDialHint tells the customer which USSD code confirms the payment
+// when the operator's push prompt does not show up.
+func printDialHint(resp *campay.CollectResponse) {
+	if code := resp.DialCode(); code != "" {
+		fmt.Println(tr("collect.dial", code))
 	}
+}
 
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", "Token "+token)
+/* ============================================================
+   ====================== HELPER FUNCTIONS =====================
+   ============================================================ */
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return "", err
-	}
-	defer resp.Body.Close()
+// =============================================================
+// Phone Numbers
+// =============================================================
 
-	body, _ := io.ReadAll(resp.Body)
-	if resp.StatusCode != 200 {
-		return "", formatAPIError(resp.StatusCode, body)
-	}
+// normalizePhone turns a local or international Cameroonian number into
+// the 237XXXXXXXXX form expected by the API.
+func normalizePhone(phone string) (string, error) {
+	phone = strings.TrimSpace(phone)
+	phone = strings.ReplaceAll(phone, " ", "")
 
-	var collectResp CollectResponse
-	if err := json.Unmarshal(body, &collectResp); err != nil {
-		return "", err
+	// Local number
+	if len(phone) == 9 && phone[0] == '6' {
+		phone = "237" + phone
 	}
 
-	return collectResp.Reference, nil
+	if !mobileNumber.MatchString(phone) {
+		if suggestions := phoneSuggestions(phone); len(suggestions) > 0 {
+			return "", invalidInput("%s", tr("err.phone.suggest", strings.Join(suggestions, ", ")))
+		}
+		return "", invalidInput("%s", tr("err.phone"))
+	}
+	return phone, nil
 }
 
 // =============================================================
 // Poll for Status
 // =============================================================
 
-func pollTransactionStatus(baseURL, token, reference string) (*TransactionResponse, error) {
-	const maxAttempts = 40
-	const interval = 5 * time.Second
+// A transaction is polled every pollInterval until it is final or the
+// confirmation deadline passes. defaultConfirmDeadline keeps the former
+// budget of 40 checks.
+const (
+	pollInterval           = 5 * time.Second
+	defaultConfirmDeadline = 200 * time.Second
+)
 
-	for attempt := 1; attempt <= maxAttempts; attempt++ {
-		status, err := checkTransactionStatus(baseURL, token, reference)
+// pollTransactionStatus waits for the transaction to reach a terminal
+// status. onPending, if non-nil, is called after every non-terminal check.
+// Polling stops early if the ledger entry is cancelled with `campay cancel`
+// or reaches a final status by other means (e.g. a webhook). Once deadline
+// has passed the entry is marked EXPIRED_LOCAL and an exitTimeout error
+// wrapping an *expiredError is returned. With the "stop" policy for
+// unknown statuses, an unrecognized answer ends polling at once with an
+// *unknownStatusError.
+func pollTransactionStatus(provider Provider, ledger *Ledger, reference string, deadline time.Duration, onPending func(status string, elapsed, deadline time.Duration)) (*campay.TransactionResponse, error) {
+	if deadline <= 0 {
+		deadline = defaultConfirmDeadline
+	}
+	started := time.Now()
+	for {
+		if e, err := ledger.Get(reference); err == nil && e != nil && e.Status == campay.StatusCancelledLocal {
+			return nil, exitErr(exitCancelled, errors.New(tr("err.cancelled", reference, e.StatusReason)))
+		}
+
+		status, err := fetchStatus(provider, ledger, reference)
 		if err != nil {
 			return nil, err
 		}
 
-		s := normalizeStatus(status.Status)
-
-		if s == "SUCCESSFUL" || s == "FAILED" {
+		parsed := parseStatus(status.Status)
+		if isFinal(parsed) {
+			// A webhook may have recorded another final status meanwhile;
+			// the first one recorded wins
+			if err := ledger.UpdateStatus(reference, parsed, status.Operator); errors.Is(err, campay.ErrInvalidTransition) {
+				if e, _ := ledger.Get(reference); e != nil {
+					return e.Transaction(), nil
+				}
+			}
 			return status, nil
 		}
+		if parsed == campay.StatusUnknown && statusPolicy.StopOnUnknown() {
+			if err := ledger.UpdateStatus(reference, parsed, status.Operator); err != nil {
+				fmt.Println("⚠ Failed to update ledger:", err)
+			}
+			return nil, exitErr(exitAPI, &unknownStatusError{reference: reference, status: status.Status})
+		}
 
-		fmt.Printf("Status: %s (attempt %d/%d)\n", s, attempt, maxAttempts)
-		time.Sleep(interval)
+		elapsed := time.Since(started)
+		if elapsed >= deadline {
+			break
+		}
+		if onPending != nil {
+			onPending(status.Status, elapsed, deadline)
+		}
+		time.Sleep(min(pollInterval, deadline-elapsed))
 	}
 
-	return nil, fmt.Errorf("transaction polling timed out")
+	reason := fmt.Sprintf("not confirmed within %s", deadline)
+	if _, err := ledger.MarkAbandoned(reference, campay.StatusExpiredLocal, reason); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	return nil, exitErr(exitTimeout, &expiredError{reference: reference, deadline: deadline})
 }
 
-func checkTransactionStatus(baseURL, token, reference string) (*TransactionResponse, error) {
-	req, err := http.NewRequest("GET", fmt.Sprintf("%s/transaction/%s/", baseURL, reference), nil)
-	if err != nil {
-		return nil, err
-	}
+// expiredError reports a transaction not confirmed before its deadline.
+type expiredError struct {
+	reference string
+	deadline  time.Duration
+}
 
-	req.Header.Set("Authorization", "Token "+token)
+func (e *expiredError) Error() string {
+	return tr("err.expired", e.reference, e.deadline)
+}
 
-	resp, err := httpClient.Do(req)
-	if err != nil {
-		return nil, err
-	}
-	defer resp.Body.Close()
+// unknownStatusError reports a status no policy recognized, when polling
+// stops on those.
+type unknownStatusError struct {
+	reference string
+	status    string
+}
 
-	body, _ := io.ReadAll(resp.Body)
+func (e *unknownStatusError) Error() string {
+	return tr("err.unknown_status", e.reference, e.status)
+}
 
-	if resp.StatusCode != 200 {
-		return nil, formatAPIError(resp.StatusCode, body)
-	}
+func printPollProgress(status string, elapsed, deadline time.Duration) {
+	fmt.Println(tr("poll.status", colorStatus(status), elapsed.Round(time.Second), deadline))
+}
 
-	var txn TransactionResponse
-	if err := json.Unmarshal(body, &txn); err != nil {
-		return nil, err
+// fetchStatus answers from the ledger when the transaction is already
+// final there and asks the API otherwise.
+func fetchStatus(provider Provider, ledger *Ledger, reference string) (*campay.TransactionResponse, error) {
+	if e, err := ledger.Get(reference); err == nil && e != nil && isFinal(e.Status) {
+		return e.Transaction(), nil
 	}
-
-	return &txn, nil
+	return provider.Status(context.Background(), reference)
 }
 
 // =============================================================
 // Helpers
 // =============================================================
 
-func normalizeStatus(s string) string {
-	return strings.ToUpper(strings.TrimSpace(s))
+// dataDir returns the directory holding local state (contacts, ...),
+// creating it if needed. CAMPAY_HOME overrides the default ~/.campay.
+func dataDir() (string, error) {
+	dir := os.Getenv("CAMPAY_HOME")
+	if dir == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", err
+		}
+		dir = filepath.Join(home, ".campay")
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return "", err
+	}
+	return dir, nil
+}
+
+// printWarnings reports response fields that could not be decoded.
+func printWarnings(warnings []string) {
+	for _, w := range warnings {
+		fmt.Println(tr("warning"), w)
+	}
 }
 
-func formatAPIError(status int, body []byte) error {
-	var er ErrorResponse
-	if json.Unmarshal(body, &er) == nil && er.Message != "" {
-		return fmt.Errorf("API error (%d): %s - %s", status, er.Code, er.Message)
+// recordLedger saves e, warning instead of failing: losing a local record
+// must not interrupt a payment that is already under way.
+func recordLedger(ledger *Ledger, e LedgerEntry) {
+	if err := ledger.Record(e); err != nil {
+		fmt.Println("⚠ Failed to write ledger:", err)
 	}
-	return fmt.Errorf("API error (%d): %s", status, string(body))
 }
 
 // =============================================================
 // Display Result
 // =============================================================
 
-func displayFinalStatus(s *TransactionResponse) {
+func displayFinalStatus(s *campay.TransactionResponse, fx *fxDisplay) {
 	fmt.Println("\n============================================================")
-	fmt.Println("                 TRANSACTION FINAL STATUS")
+	fmt.Println(center(tr("receipt.title"), 60))
 	fmt.Println("============================================================")
 
-	fmt.Printf("Reference:           %s\n", s.Reference)
-	fmt.Printf("External Reference:  %s\n", s.ExternalReference)
-	fmt.Printf("Status:              %s\n", s.Status)
-	fmt.Printf("Amount:              %.0f %s\n", s.Amount, s.Currency)
-	fmt.Printf("Operator:            %s\n", s.Operator)
-	fmt.Printf("Description:         %s\n", s.Description)
-	fmt.Printf("Code:                %s\n", s.Code)
-	fmt.Printf("Operator Reference:  %s\n", s.OperatorReference)
+	line := func(key, value string) {
+		fmt.Printf("%-21s%s\n", tr(key)+":", value)
+	}
+	line("receipt.reference", s.Reference)
+	line("receipt.external", s.ExternalReference)
+	line("receipt.status", colorStatus(s.Status))
+	line("receipt.amount", formatMoney(s.Amount, s.Currency))
+	if converted := fx.Convert(float64(s.Amount)); converted != "" {
+		fmt.Printf("%-21s%s\n", "", converted)
+	}
+	line("receipt.operator", s.Operator)
+	line("receipt.desc", s.Description)
+	line("receipt.code", s.Code)
+	line("receipt.op_ref", s.OperatorReference)
 	fmt.Println("============================================================")
 
-	switch normalizeStatus(s.Status) {
-	case "SUCCESSFUL":
-		fmt.Println("🎉 Payment successful!")
-	case "FAILED":
-		fmt.Println("❌ Payment failed")
+	switch status := parseStatus(s.Status); {
+	case status == campay.StatusSuccessful:
+		fmt.Println(tr("result.success"))
+	case unsuccessful(status):
+		fmt.Println(tr("result.failed"))
 	default:
-		fmt.Println("⚠ Unknown status:", s.Status)
+		fmt.Println(tr("result.unknown"), s.Status)
 	}
 }
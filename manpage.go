@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bytes"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+/* ============================================================
+   ========================= MAN PAGES =========================
+   ============================================================ */
+
+// Man pages are generated from the same table and flag sets as completion
+// and --help, so they cannot drift from the binary. They describe default
+// settings, not the values of the current config file or environment, and
+// carry the version instead of a date so that generating them twice gives
+// the same files.
+
+// manPageOptions are the flags of man.
+type manPageOptions struct {
+	dir string
+}
+
+// manPageFlags defines the flags of man on fs.
+func manPageFlags(fs *flag.FlagSet, cfg *Config) *manPageOptions {
+	opt := &manPageOptions{}
+	fs.StringVar(&opt.dir, "dir", "man", "directory to write campay.1 and campay-<command>.1 to")
+	return opt
+}
+
+func runMan(cfg *Config, args []string) error {
+	fs := newFlagSet("man")
+	opt := manPageFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	if fs.NArg() > 0 {
+		name := fs.Arg(0)
+		if name == "campay" {
+			_, err := os.Stdout.Write(manMain())
+			return err
+		}
+		c := findCommand(name)
+		if c == nil {
+			return invalidInput("unknown command %q", name)
+		}
+		_, err := os.Stdout.Write(manCommand(*c))
+		return err
+	}
+
+	if err := os.MkdirAll(opt.dir, 0755); err != nil {
+		return err
+	}
+	if err := writeFileAtomic(filepath.Join(opt.dir, "campay.1"), manMain(), 0644); err != nil {
+		return err
+	}
+	for _, c := range commands {
+		if err := writeFileAtomic(filepath.Join(opt.dir, "campay-"+c.Name+".1"), manCommand(c), 0644); err != nil {
+			return err
+		}
+	}
+	fmt.Printf("✓ Wrote %d man pages to %s\n", len(commands)+1, opt.dir)
+	return nil
+}
+
+// manMain is campay(1): the commands, global options, environment, exit
+// status and files.
+func manMain() []byte {
+	var b bytes.Buffer
+	cfg := &Config{file: &FileConfig{}}
+	global, _, _ := globalFlags(cfg)
+
+	manHeader(&b, "CAMPAY")
+	b.WriteString(".SH NAME\ncampay \\- command line client for the CamPay mobile money API\n")
+	b.WriteString(".SH SYNOPSIS\n.B campay\n[\\fIglobal options\\fR] \\fIcommand\\fR [\\fIoptions\\fR] [\\fIarguments\\fR]\n")
+	b.WriteString(".SH DESCRIPTION\n.B campay\ncollects and pays out mobile money through CamPay, keeps a local ledger of every transaction, and runs batches, invoices, campaigns and the services around them.\nWith no command it asks interactively what to do.\n")
+
+	b.WriteString(".SH COMMANDS\n")
+	for _, c := range commands {
+		fmt.Fprintf(&b, ".TP\n.BR campay\\-%s (1)\n%s\n", roff(c.Name), roff(c.Summary))
+	}
+
+	b.WriteString(".SH GLOBAL OPTIONS\nGlobal options go before the command.\n")
+	manFlags(&b, flagList(global))
+
+	b.WriteString(".SH ENVIRONMENT\nEach setting is read from, in order of precedence, its global option, its environment variable, the config file, then its default.\n")
+	for _, s := range cfg.settings.list {
+		f := global.Lookup(s.Flag())
+		if f == nil {
+			f = cfg.settings.hidden.Lookup(s.Flag())
+		}
+		usage := strings.ReplaceAll(s.Name, "_", " ")
+		if f != nil && f.Usage != "" {
+			_, usage = flag.UnquoteUsage(f)
+		}
+		fmt.Fprintf(&b, ".TP\n.B %s\n%s", roff(s.Env()), roff(usage))
+		if s.Legacy != "" {
+			fmt.Fprintf(&b, " (also \\fB%s\\fR)", roff(s.Legacy))
+		}
+		if s.Secret {
+			b.WriteString("; secret: it has no option, and config show masks it")
+		}
+		b.WriteString("\n")
+	}
+	b.WriteString(".TP\n.B CAMPAY_HOME\nthe data directory (default \\fI~/.campay\\fR)\n")
+	b.WriteString(".TP\n.B CAMPAY_CONFIG\nthe config file (default \\fI~/.campay/config.json\\fR)\n")
+
+	b.WriteString(".SH EXIT STATUS\n")
+	codes := make([]int, 0, len(exitCategories))
+	for code := range exitCategories {
+		codes = append(codes, code)
+	}
+	sort.Ints(codes)
+	for _, code := range codes {
+		fmt.Fprintf(&b, ".TP\n.B %d\n\\fB%s\\fR: %s\n", code, roff(exitCategories[code]), roff(exitMeanings[code]))
+	}
+
+	b.WriteString(".SH FILES\n")
+	for _, f := range [][2]string{
+		{"~/.campay/config.json", "settings and profiles"},
+		{"~/.campay/ledger.jsonl", "the local ledger, one transaction per line"},
+		{"~/.campay/contacts.json", "contact aliases, used as @alias in place of a phone number"},
+		{"~/.campay/batches/", "saved batch runs, for batch resume"},
+		{"~/.campay/hooks/on-final", "run when a transaction reaches a final status"},
+		{"~/.campay/audit.jsonl", "the audit log"},
+	} {
+		fmt.Fprintf(&b, ".TP\n.I %s\n%s\n", roff(f[0]), roff(f[1]))
+	}
+
+	b.WriteString(".SH SEE ALSO\n")
+	for i, c := range commands {
+		if i > 0 {
+			b.WriteString(",\n")
+		}
+		fmt.Fprintf(&b, ".BR campay\\-%s (1)", roff(c.Name))
+	}
+	b.WriteString("\n")
+	return b.Bytes()
+}
+
+// manCommand is campay-<command>(1).
+func manCommand(c command) []byte {
+	var b bytes.Buffer
+	manHeader(&b, "CAMPAY-"+strings.ToUpper(c.Name))
+	fmt.Fprintf(&b, ".SH NAME\ncampay\\-%s \\- %s\n", roff(c.Name), roff(c.Summary))
+
+	b.WriteString(".SH SYNOPSIS\n")
+	if len(c.Sub) > 0 {
+		for _, s := range c.Sub {
+			fmt.Fprintf(&b, ".B campay %s %s\n%s.br\n", roff(c.Name), roff(s.Name), manArgs(s.Args, s.Flags != nil))
+		}
+	} else {
+		fmt.Fprintf(&b, ".B campay %s\n%s", roff(c.Name), manArgs(c.Args, c.Flags != nil))
+	}
+
+	if flags := describeFlags(c, nil); len(flags) > 0 {
+		b.WriteString(".SH OPTIONS\n")
+		manFlags(&b, flags)
+	}
+	if len(c.Sub) > 0 {
+		b.WriteString(".SH SUBCOMMANDS\n")
+		for _, s := range c.Sub {
+			s := s
+			fmt.Fprintf(&b, ".SS %s\n", roff(s.Name))
+			if flags := describeFlags(c, &s); len(flags) > 0 {
+				manFlags(&b, flags)
+			}
+		}
+	}
+	b.WriteString(".SH SEE ALSO\n.BR campay (1)\n")
+	return b.Bytes()
+}
+
+func manHeader(b *bytes.Buffer, title string) {
+	fmt.Fprintf(b, ".TH %q 1 \"\" %q \"CamPay CLI\"\n", title, "campay "+buildVersion())
+}
+
+// manArgs is the synopsis line of the options and argument of a
+// command, empty when it takes neither.
+func manArgs(kind argKind, flags bool) string {
+	var parts []string
+	if flags {
+		parts = append(parts, "[\\fIoptions\\fR]")
+	}
+	if kind != argNone {
+		parts = append(parts, "\\fI"+string(kind)+"\\fR")
+	}
+	if len(parts) == 0 {
+		return ""
+	}
+	return strings.Join(parts, " ") + "\n"
+}
+
+func manFlags(b *bytes.Buffer, flags []*flag.Flag) {
+	for _, f := range flags {
+		name, usage := flag.UnquoteUsage(f)
+		fmt.Fprintf(b, ".TP\n.B \\-\\-%s", roff(f.Name))
+		if takesValue(f) {
+			if name == "" {
+				name = "value"
+			}
+			fmt.Fprintf(b, " \\fI%s\\fR", roff(name))
+		}
+		b.WriteString("\n" + roff(usage))
+		switch f.DefValue {
+		case "", "0", "false", "0s", "[]":
+		default:
+			fmt.Fprintf(b, " (default %s)", roff(f.DefValue))
+		}
+		b.WriteString("\n")
+	}
+}
+
+// roff escapes s for a line of a man page.
+func roff(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\e`)
+	s = strings.ReplaceAll(s, "-", `\-`)
+	s = strings.ReplaceAll(s, "\n", " ")
+	if strings.HasPrefix(s, ".") || strings.HasPrefix(s, "'") {
+		s = `\&` + s
+	}
+	return s
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== METRICS ==========================
+   ============================================================ */
+
+// GET /metrics on serve and the daemon answers in the Prometheus text
+// format. The counts are read from the files of the data directory on
+// every scrape, so all replicas sharing it report the same numbers; only
+// the transaction event counters (see events.go) are the process's own.
+
+// gauge writes one gauge with a value per label, in the order given.
+func gauge(sb *strings.Builder, name, help, label string, order []string, values map[string]int) {
+	fmt.Fprintf(sb, "# HELP %s %s\n# TYPE %s gauge\n", name, help, name)
+	for _, v := range order {
+		fmt.Fprintf(sb, "%s{%s=%q} %d\n", name, label, v, values[v])
+	}
+}
+
+// handleMetrics also reports the failure rate of each operator from the
+// ledger, see outage.go.
+func handleMetrics(cfg *Config, ledger *Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		writeMetrics(w, cfg, ledger)
+	}
+}
+
+func writeMetrics(w http.ResponseWriter, cfg *Config, ledger *Ledger) {
+	queued := map[string]int{}
+	dead := map[string]int{}
+	q, err := openNotifyQueue()
+	if err == nil {
+		var list []queuedNotification
+		if list, err = q.List(); err == nil {
+			for _, n := range list {
+				queued[n.State]++
+			}
+		}
+	}
+	if err == nil {
+		var store *deadLetters
+		if store, err = openDeadLetters(); err == nil {
+			var letters []deadLetter
+			if letters, err = store.Dead(); err == nil {
+				for _, l := range letters {
+					dead[l.Kind]++
+				}
+			}
+		}
+	}
+	var entries []LedgerEntry
+	if err == nil {
+		entries, err = ledger.Entries()
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	health := outageRates(entries, cfg.Outage, time.Now())
+
+	var sb strings.Builder
+	gauge(&sb, "campay_notifications", "Notifications in the retry queue, by state.",
+		"state", []string{notifyQueued, notifyDelivered, notifyDead}, queued)
+	gauge(&sb, "campay_dead_letters", "Notifications given up on and neither retried nor purged, by kind.",
+		"kind", []string{notifyRelay, notifyHook, notifySMS}, dead)
+
+	operators := make([]string, len(health))
+	ended, outage := map[string]int{}, map[string]int{}
+	for i, h := range health {
+		operators[i], ended[h.Operator] = h.Operator, h.Ended
+		if h.Outage {
+			outage[h.Operator] = 1
+		}
+	}
+	gauge(&sb, "campay_operator_collections", fmt.Sprintf("Collections created in the last %s that ended, by operator.", cfg.Outage.Window),
+		"operator", operators, ended)
+	fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s gauge\n", "campay_operator_failure_ratio",
+		"Share of those collections that failed or were not confirmed, by operator.", "campay_operator_failure_ratio")
+	for _, h := range health {
+		fmt.Fprintf(&sb, "campay_operator_failure_ratio{operator=%q} %g\n", h.Operator, h.Rate)
+	}
+	gauge(&sb, "campay_operator_outage", "1 while the operator's failure ratio is above the outage threshold.",
+		"operator", operators, outage)
+	fmt.Fprintf(&sb, "# HELP %s %s\n# TYPE %s counter\n", "campay_transaction_events_total",
+		"Transaction events published by this process since it started, by kind.", "campay_transaction_events_total")
+	events := txEvents.snapshot()
+	for _, kind := range []campay.TxEventKind{campay.EventInitiated, campay.EventStatusChanged,
+		campay.EventTerminal, campay.EventRetried, campay.EventRefunded} {
+		fmt.Fprintf(&sb, "campay_transaction_events_total{kind=%q} %d\n", kind, events[string(kind)])
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+	fmt.Fprint(w, sb.String())
+}
@@ -0,0 +1,505 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"hash/fnv"
+	mrand "math/rand/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== MOCK CAMPAY ========================
+   ============================================================ */
+
+const mockToken = "mock-token"
+
+// mockTxn is one transaction known to the mock server.
+type mockTxn struct {
+	campay.TransactionResponse
+	Kind    string
+	Phone   string
+	Created time.Time
+	polls   int // status checks after it became final
+}
+
+// mockCampay imitates the CamPay endpoints the CLI uses. Transactions stay
+// PENDING for confirmAfter, then become SUCCESSFUL, or FAILED for a
+// failRate share of them (chosen from the reference, so repeatable).
+// Tokens last tokenTTL. With a script, the payer's number decides the
+// outcome instead. chaos, if set, injects faults into the answers.
+type mockCampay struct {
+	confirmAfter time.Duration
+	failRate     float64
+	tokenTTL     time.Duration
+	script       func(phone string) demoOutcome
+	chaos        *mockChaos
+
+	mu      sync.Mutex
+	txns    map[string]*mockTxn
+	revoked map[string]bool // tokens expired early by chaos
+
+	requests atomic.Int64
+	polls    atomic.Int64
+	tokens   atomic.Int64
+}
+
+func newMockCampay(confirmAfter time.Duration, failRate float64) *mockCampay {
+	return &mockCampay{confirmAfter: confirmAfter, failRate: failRate, tokenTTL: time.Hour, txns: map[string]*mockTxn{}, revoked: map[string]bool{}}
+}
+
+func (m *mockCampay) routes() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /token/", m.handleToken)
+	mux.HandleFunc("POST /collect/", m.authorized(m.handleCollect))
+	mux.HandleFunc("POST /withdraw/", m.authorized(m.handleWithdraw))
+	mux.HandleFunc("GET /transaction/{ref}/", m.authorized(m.handleTransaction))
+	mux.HandleFunc("GET /balance/", m.authorized(m.handleBalance))
+	mux.HandleFunc("POST /history/", m.authorized(m.handleHistory))
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		m.requests.Add(1)
+		if m.chaos != nil {
+			m.chaos.serve(w, r, mux)
+			return
+		}
+		mux.ServeHTTP(w, r)
+	})
+}
+
+func mockJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func (m *mockCampay) authorized(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Token ")
+		if !ok || !strings.HasPrefix(token, mockToken) {
+			mockJSON(w, http.StatusUnauthorized, campay.ErrorResponse{Code: "ER401", Message: "Invalid token"})
+			return
+		}
+		m.mu.Lock()
+		expired := m.revoked[token]
+		if !expired && m.chaos.expireToken() {
+			m.revoked[token], expired = true, true
+			w.Header().Set(mockFaultHeader, "token-expired")
+			m.chaos.count("token-expired")
+		}
+		m.mu.Unlock()
+		if expired {
+			mockJSON(w, http.StatusUnauthorized, campay.ErrorResponse{Code: "ER401", Message: "Token expired"})
+			return
+		}
+		next(w, r)
+	}
+}
+
+func (m *mockCampay) handleToken(w http.ResponseWriter, r *http.Request) {
+	var req campay.TokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Username == "" || req.Password == "" {
+		mockJSON(w, http.StatusBadRequest, campay.ErrorResponse{Code: "ER400", Message: "username and password are required"})
+		return
+	}
+	n := m.tokens.Add(1)
+	mockJSON(w, http.StatusOK, map[string]any{"token": fmt.Sprintf("%s-%d", mockToken, n), "expires_in": max(int(m.tokenTTL/time.Second), 1)})
+}
+
+// create registers a new PENDING transaction.
+func (m *mockCampay) create(kind, phone string, amount int, currency, description, externalRef string) *mockTxn {
+	var b [16]byte
+	rand.Read(b[:])
+	b[6] = b[6]&0x0f | 0x40
+	b[8] = b[8]&0x3f | 0x80
+	t := &mockTxn{
+		TransactionResponse: campay.TransactionResponse{
+			Reference:         fmt.Sprintf("%x-%x-%x-%x-%x", b[0:4], b[4:6], b[6:8], b[8:10], b[10:16]),
+			ExternalReference: externalRef,
+			Status:            string(campay.StatusPending),
+			Amount:            campay.Amount(amount),
+			Currency:          currency,
+			Operator:          operatorFor(phone),
+			Description:       description,
+		},
+		Kind:    kind,
+		Phone:   phone,
+		Created: time.Now(),
+	}
+	m.mu.Lock()
+	m.txns[t.Reference] = t
+	m.mu.Unlock()
+	return t
+}
+
+func (m *mockCampay) handleCollect(w http.ResponseWriter, r *http.Request) {
+	var req campay.CollectRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 || req.From == "" {
+		mockJSON(w, http.StatusBadRequest, campay.ErrorResponse{Code: "ER400", Message: "invalid collect request"})
+		return
+	}
+	t := m.create("collect", req.From, req.Amount, req.Currency, req.Description, req.ExternalReference)
+	mockJSON(w, http.StatusOK, campay.CollectResponse{
+		Reference:         t.Reference,
+		ExternalReference: t.ExternalReference,
+		Status:            t.Status,
+		Amount:            campay.Amount(req.Amount),
+		Currency:          req.Currency,
+		Operator:          t.Operator,
+		USSDCode:          mockDialCode(t.Operator),
+	})
+}
+
+// mockDialCode is the code customers of operator dial to approve pending
+// payments.
+func mockDialCode(operator string) string {
+	if operator == "ORANGE" {
+		return "#150*50#"
+	}
+	return "*126#"
+}
+
+func (m *mockCampay) handleWithdraw(w http.ResponseWriter, r *http.Request) {
+	var req campay.WithdrawRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil || req.Amount <= 0 || req.To == "" {
+		mockJSON(w, http.StatusBadRequest, campay.ErrorResponse{Code: "ER400", Message: "invalid withdraw request"})
+		return
+	}
+	t := m.create("withdraw", req.To, req.Amount, req.Currency, req.Description, req.ExternalReference)
+	mockJSON(w, http.StatusOK, campay.WithdrawResponse{Reference: t.Reference, Status: t.Status})
+}
+
+// settle moves t to its final status once confirmAfter has passed.
+func (m *mockCampay) settle(t *mockTxn) {
+	if t.Status != string(campay.StatusPending) || time.Since(t.Created) < m.confirmAfter {
+		return
+	}
+	h := fnv.New32a()
+	h.Write([]byte(t.Reference))
+	switch {
+	case m.script != nil && m.script(t.Phone) == demoIgnore:
+		return
+	case m.script != nil && m.script(t.Phone) == demoReject,
+		m.script == nil && float64(h.Sum32()%10000)/10000 < m.failRate:
+		t.Status = string(campay.StatusFailed)
+	default:
+		t.Status = string(campay.StatusSuccessful)
+	}
+	t.OperatorReference = "MP" + strings.ToUpper(t.Reference[:8])
+}
+
+func (m *mockCampay) handleTransaction(w http.ResponseWriter, r *http.Request) {
+	m.polls.Add(1)
+	m.mu.Lock()
+	t, ok := m.txns[r.PathValue("ref")]
+	var resp campay.TransactionResponse
+	if ok {
+		m.settle(t)
+		resp = t.TransactionResponse
+		if resp.Status != string(campay.StatusPending) {
+			t.polls++
+			// Every other answer after the final one is stale
+			if t.polls%2 == 0 && m.chaos.reordered(t.Reference) {
+				resp.Status, resp.OperatorReference = string(campay.StatusPending), ""
+				w.Header().Set(mockFaultHeader, "out-of-order")
+				m.chaos.count("out-of-order")
+			}
+		}
+	}
+	m.mu.Unlock()
+	if !ok {
+		mockJSON(w, http.StatusNotFound, campay.ErrorResponse{Code: "ER404", Message: "Transaction not found"})
+		return
+	}
+	mockJSON(w, http.StatusOK, resp)
+}
+
+func (m *mockCampay) handleBalance(w http.ResponseWriter, r *http.Request) {
+	mockJSON(w, http.StatusOK, campay.BalanceResponse{
+		TotalBalance:  1000000,
+		MTNBalance:    600000,
+		OrangeBalance: 400000,
+		Currency:      "XAF",
+	})
+}
+
+func (m *mockCampay) handleHistory(w http.ResponseWriter, r *http.Request) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	var req campay.HistoryRequest
+	json.NewDecoder(r.Body).Decode(&req)
+	items := []campay.HistoryItem{}
+	for _, t := range m.txns {
+		// Both dates are inclusive days, local to the server
+		day := inZone(t.Created).Format("2006-01-02")
+		if (req.StartDate != "" && day < req.StartDate) || (req.EndDate != "" && day > req.EndDate) {
+			continue
+		}
+		m.settle(t)
+		items = append(items, campay.HistoryItem{
+			Reference:         t.Reference,
+			ExternalReference: t.ExternalReference,
+			Status:            t.Status,
+			Amount:            t.Amount,
+			Currency:          t.Currency,
+			Operator:          t.Operator,
+			PhoneNumber:       t.Phone,
+			Description:       t.Description,
+			Type:              t.Kind,
+			Datetime:          t.Created.UTC().Format("2006-01-02 15:04:05"),
+		})
+	}
+	mockJSON(w, http.StatusOK, campay.HistoryResponse{Data: items})
+}
+
+// mockOptions are the flags of mock.
+type mockOptions struct {
+	addr         string
+	confirmAfter time.Duration
+	failRate     float64
+	tokenTTL     time.Duration
+	chaos        *mockChaos
+}
+
+// mockFlags defines the flags of mock on fs.
+func mockFlags(fs *flag.FlagSet, cfg *Config) *mockOptions {
+	opt := &mockOptions{}
+	fs.StringVar(&opt.addr, "addr", "127.0.0.1:8099", "listen address")
+	fs.DurationVar(&opt.confirmAfter, "confirm-after", 3*time.Second, "how long transactions stay PENDING")
+	fs.Float64Var(&opt.failRate, "fail-rate", 0, "share of transactions that end FAILED (0 to 1)")
+	fs.DurationVar(&opt.tokenTTL, "token-ttl", time.Hour, "lifetime of the tokens handed out")
+	opt.chaos = chaosFlags(fs)
+	return opt
+}
+
+// runMock serves the mock API, for trying the CLI or an integration
+// without CamPay credentials.
+func runMock(cfg *Config, args []string) error {
+	fs := newFlagSet("mock")
+	opt := mockFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := opt.chaos.validate(); err != nil {
+		return err
+	}
+	if opt.failRate < 0 || opt.failRate > 1 {
+		return invalidInput("--fail-rate must be between 0 and 1")
+	}
+	if opt.tokenTTL < time.Second {
+		return invalidInput("--token-ttl must be at least 1s")
+	}
+
+	m := newMockCampay(opt.confirmAfter, opt.failRate)
+	m.tokenTTL = opt.tokenTTL
+	if opt.chaos.enabled() {
+		m.chaos = opt.chaos.start()
+	}
+	fmt.Printf("Mock CamPay API on http://%s (any username and password)\n", opt.addr)
+	if m.chaos != nil {
+		fmt.Printf("Injecting faults: %s\n", m.chaos)
+	}
+	server := &http.Server{Addr: opt.addr, Handler: m.routes(), ReadHeaderTimeout: 10 * time.Second}
+	return server.ListenAndServe()
+}
+
+/* ============================================================
+   ======================= FAULT INJECTION =====================
+   ============================================================ */
+
+// mockFaultHeader names the fault injected into an answer, so a test can
+// tell an injected failure from a real one.
+const mockFaultHeader = "X-Mock-Fault"
+
+// mockChaos makes the mock misbehave, to exercise a client's retries and
+// error handling: each request may be slowed down, refused with a 500 or
+// a 503 with Retry-After, or answered with truncated JSON; a token may
+// expire before its time; and a share of transactions report PENDING
+// again on every other status check after becoming final. Rates are
+// shares of requests (or of transactions) from 0 to 1. A seed makes the
+// choices repeatable for a given order of requests.
+type mockChaos struct {
+	ErrorRate       float64
+	BusyRate        float64
+	SlowRate        float64
+	Slow            time.Duration
+	MalformedRate   float64
+	TokenExpiryRate float64
+	ReorderRate     float64
+	Seed            uint64
+
+	mu       sync.Mutex
+	rng      *mrand.Rand
+	injected map[string]int64
+}
+
+// chaosFlags defines the fault injection flags of mock and bench.
+func chaosFlags(fs *flag.FlagSet) *mockChaos {
+	c := &mockChaos{}
+	fs.Float64Var(&c.ErrorRate, "error-rate", 0, "share of requests answered with a 500 error")
+	fs.Float64Var(&c.BusyRate, "busy-rate", 0, "share of requests answered with a 503 and Retry-After: 1")
+	fs.Float64Var(&c.SlowRate, "slow-rate", 0, "share of requests delayed by --slow")
+	fs.DurationVar(&c.Slow, "slow", 5*time.Second, "delay of slow requests")
+	fs.Float64Var(&c.MalformedRate, "malformed-rate", 0, "share of successful answers cut off in the middle of the JSON")
+	fs.Float64Var(&c.TokenExpiryRate, "token-expiry-rate", 0, "share of authorized requests on which the token expires early")
+	fs.Float64Var(&c.ReorderRate, "reorder-rate", 0, "share of transactions reported PENDING again after their final status")
+	fs.Uint64Var(&c.Seed, "seed", 0, "seed for the faults chosen (default random)")
+	return c
+}
+
+func (c *mockChaos) validate() error {
+	for _, r := range []struct {
+		flag string
+		rate float64
+	}{{"--error-rate", c.ErrorRate}, {"--busy-rate", c.BusyRate}, {"--slow-rate", c.SlowRate},
+		{"--malformed-rate", c.MalformedRate}, {"--token-expiry-rate", c.TokenExpiryRate}, {"--reorder-rate", c.ReorderRate}} {
+		if r.rate < 0 || r.rate > 1 {
+			return invalidInput("%s must be between 0 and 1", r.flag)
+		}
+	}
+	if c.ErrorRate+c.BusyRate > 1 {
+		return invalidInput("--error-rate and --busy-rate add up to more than 1")
+	}
+	if c.Slow < 0 {
+		return invalidInput("--slow cannot be negative")
+	}
+	return nil
+}
+
+func (c *mockChaos) enabled() bool {
+	return c.ErrorRate > 0 || c.BusyRate > 0 || c.SlowRate > 0 || c.MalformedRate > 0 || c.TokenExpiryRate > 0 || c.ReorderRate > 0
+}
+
+// start seeds c, returning it ready to serve.
+func (c *mockChaos) start() *mockChaos {
+	seed := c.Seed
+	if seed == 0 {
+		seed = mrand.Uint64()
+	}
+	c.rng = mrand.New(mrand.NewPCG(seed, seed))
+	c.injected = map[string]int64{}
+	return c
+}
+
+// roll reports true for a rate share of calls. A nil mockChaos never
+// rolls true.
+func (c *mockChaos) roll(rate float64) bool {
+	if c == nil || rate <= 0 {
+		return false
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.rng.Float64() < rate
+}
+
+// expireToken reports whether the token of a request expires early.
+func (c *mockChaos) expireToken() bool {
+	return c != nil && c.roll(c.TokenExpiryRate)
+}
+
+// reordered reports whether the transaction with this reference reports
+// its statuses out of order. The choice follows the reference, as for
+// failures, so it does not change between checks.
+func (c *mockChaos) reordered(reference string) bool {
+	if c == nil || c.ReorderRate <= 0 {
+		return false
+	}
+	h := fnv.New32a()
+	h.Write([]byte("reorder:" + reference))
+	return float64(h.Sum32()%10000)/10000 < c.ReorderRate
+}
+
+func (c *mockChaos) count(fault string) {
+	if c == nil {
+		return
+	}
+	c.mu.Lock()
+	c.injected[fault]++
+	c.mu.Unlock()
+}
+
+// faults returns how many faults of each kind were injected.
+func (c *mockChaos) faults() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	out := make(map[string]int64, len(c.injected))
+	for k, v := range c.injected {
+		out[k] = v
+	}
+	return out
+}
+
+func (c *mockChaos) String() string {
+	var parts []string
+	for _, r := range []struct {
+		name string
+		rate float64
+	}{{"500 errors", c.ErrorRate}, {"503 busy", c.BusyRate}, {"slow " + c.Slow.String(), c.SlowRate},
+		{"malformed JSON", c.MalformedRate}, {"token expiry", c.TokenExpiryRate}, {"out-of-order statuses", c.ReorderRate}} {
+		if r.rate > 0 {
+			parts = append(parts, fmt.Sprintf("%s %s%%", r.name, strconv.FormatFloat(r.rate*100, 'f', -1, 64)))
+		}
+	}
+	return strings.Join(parts, ", ")
+}
+
+// serve answers r through next, injecting the faults rolled for it.
+// Errors are returned before next runs, so the request has no effect;
+// malformed answers are cut from next's real one, whose effect stays.
+func (c *mockChaos) serve(w http.ResponseWriter, r *http.Request, next http.Handler) {
+	if c.roll(c.SlowRate) {
+		c.count("slow")
+		w.Header().Set(mockFaultHeader, "slow")
+		select {
+		case <-time.After(c.Slow):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	c.mu.Lock()
+	p := c.rng.Float64()
+	c.mu.Unlock()
+	switch {
+	case p < c.ErrorRate:
+		c.count("error")
+		w.Header().Set(mockFaultHeader, "error")
+		mockJSON(w, http.StatusInternalServerError, campay.ErrorResponse{Code: "ER500", Message: "Internal server error"})
+		return
+	case p < c.ErrorRate+c.BusyRate:
+		c.count("busy")
+		w.Header().Set(mockFaultHeader, "busy")
+		w.Header().Set("Retry-After", "1")
+		mockJSON(w, http.StatusServiceUnavailable, campay.ErrorResponse{Code: "ER503", Message: "Service temporarily unavailable"})
+		return
+	}
+
+	if !c.roll(c.MalformedRate) {
+		next.ServeHTTP(w, r)
+		return
+	}
+	rec := httptest.NewRecorder()
+	next.ServeHTTP(rec, r)
+	body := rec.Body.Bytes()
+	for k, v := range rec.Header() {
+		w.Header()[k] = v
+	}
+	if rec.Code/100 == 2 && len(body) > 1 {
+		c.count("malformed")
+		w.Header().Set(mockFaultHeader, "malformed")
+		body = bytes.TrimSpace(body)[:len(bytes.TrimSpace(body))/2]
+	}
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	w.WriteHeader(rec.Code)
+	w.Write(body)
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+/* ============================================================
+   ============================ NOTES ==========================
+   ============================================================ */
+
+// Notes keep the support history of a transaction, such as what the
+// customer said about a disputed payment, in its ledger entry. They are
+// shown by `campay show` and travel with the entry into search output,
+// archives and debug bundles.
+
+// LedgerNote is one timestamped remark on a transaction.
+type LedgerNote struct {
+	Time   time.Time `json:"time"`
+	Author string    `json:"author"` // OS user who wrote it
+	Text   string    `json:"text"`
+}
+
+const maxNoteLength = 1000
+
+// AddNote appends a note to the entry of reference and returns the entry.
+// It holds the reference's status lock, so that a status change recorded
+// at the same time cannot drop the note.
+func (l *Ledger) AddNote(reference, text string) (*LedgerEntry, error) {
+	defer l.lockStatus(reference)()
+	e, err := l.Get(reference)
+	if err != nil || e == nil {
+		return nil, err
+	}
+	e.Notes = append(e.Notes, LedgerNote{Time: time.Now().UTC(), Author: osUser(), Text: text})
+	if err := l.Record(*e); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// findEntry returns the entry of a reference or, when it names a single
+// transaction, of an external reference.
+func findEntry(ledger *Ledger, ref string) (*LedgerEntry, error) {
+	e, err := ledger.Get(ref)
+	if err != nil || e != nil {
+		return e, err
+	}
+	found, err := ledger.FindByExternalRef(ref)
+	if err != nil {
+		return nil, err
+	}
+	switch len(found) {
+	case 0:
+		return nil, invalidInput("no transaction %q in the local ledger", ref)
+	case 1:
+		return &found[0], nil
+	}
+	return nil, invalidInput("external reference %q has %d transactions; use the CamPay reference (see campay lookup --external-ref %s)", ref, len(found), ref)
+}
+
+// formatNotes joins notes on one line, for list columns.
+func formatNotes(notes []LedgerNote) string {
+	parts := make([]string, len(notes))
+	for i, n := range notes {
+		parts[i] = fmt.Sprintf("%s %s: %s", inZone(n.Time).Format("2006-01-02 15:04 MST"), n.Author, n.Text)
+	}
+	return strings.Join(parts, " | ")
+}
+
+// runNote adds a note to a transaction.
+func runNote(cfg *Config, args []string) error {
+	if len(args) < 3 || args[0] != "add" {
+		return invalidInput("usage: campay note add <reference> <text>")
+	}
+	text := strings.TrimSpace(strings.Join(args[2:], " "))
+	switch n := utf8.RuneCountInString(text); {
+	case n == 0:
+		return invalidInput("the note is empty")
+	case n > maxNoteLength:
+		return invalidInput("the note is %d characters long, at most %d are kept", n, maxNoteLength)
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	e, err := findEntry(ledger, args[1])
+	if err != nil {
+		return err
+	}
+	if e, err = ledger.AddNote(e.Reference, text); err != nil {
+		return err
+	}
+	err = appendAudit(AuditEvent{
+		Action:            "note",
+		Profile:           cfg.Profile,
+		Environment:       e.Environment,
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Details:           map[string]any{"text": text},
+	})
+	if err != nil {
+		fmt.Println("⚠ Failed to write audit log:", err)
+	}
+	fmt.Printf("✓ Added note %d to %s\n", len(e.Notes), e.Reference)
+	return nil
+}
+
+// runShow prints one transaction of the ledger with its notes.
+func runShow(cfg *Config, args []string) error {
+	if len(args) != 1 {
+		return invalidInput("usage: campay show <reference or external reference>")
+	}
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	e, err := findEntry(ledger, args[0])
+	if err != nil {
+		return err
+	}
+	if tableFormat() == "json" {
+		shown := *e
+		shown.Phone = displayPhone(e.Phone)
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(shown)
+	}
+
+	kind := e.Kind
+	if e.Refund {
+		kind = "refund of " + e.RefundOf
+	}
+	status := colorStatus(string(e.Status))
+	if e.StatusReason != "" {
+		status += " (" + e.StatusReason + ")"
+	}
+	fields := []struct{ name, value string }{
+		{"Reference", e.Reference},
+		{"External ref", e.ExternalReference},
+		{"Kind", kind},
+		{"Phone", displayPhone(e.Phone)},
+		{"Amount", formatAmount(e.Amount, e.Currency)},
+		{"Description", e.Description},
+		{"Status", status},
+		{"Operator", e.Operator},
+		{"Environment", e.Environment},
+		{"Source", e.Source},
+		{"Settlement", e.Settlement},
+		{"Batch", e.Batch},
+		{"Campaign", e.Campaign},
+		{"Review", e.Review},
+		{"Created", inZone(e.CreatedAt).Format("2006-01-02 15:04:05 MST")},
+		{"Updated", inZone(e.UpdatedAt).Format("2006-01-02 15:04:05 MST")},
+	}
+	if e.FinalAt != nil {
+		fields = append(fields, struct{ name, value string }{"Final", inZone(*e.FinalAt).Format("2006-01-02 15:04:05 MST")})
+	}
+	for _, f := range fields {
+		if f.value != "" {
+			fmt.Printf("%-13s %s\n", f.name+":", f.value)
+		}
+	}
+
+	if len(e.Notes) == 0 {
+		fmt.Printf("\nNo notes; add one with: campay note add %s \"...\"\n", e.Reference)
+		return nil
+	}
+	fmt.Printf("\nNotes (%d):\n", len(e.Notes))
+	for _, n := range e.Notes {
+		fmt.Printf("  %s  %s\n    %s\n", inZone(n.Time).Format("2006-01-02 15:04 MST"), n.Author, n.Text)
+	}
+	return nil
+}
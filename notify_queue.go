@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+)
+
+/* ============================================================
+   ==================== NOTIFICATION QUEUE =====================
+   ============================================================ */
+
+// Notifications that failed (relay deliveries after their immediate
+// retries, on-final hooks, SMS receipts) are kept in ~/.campay/notifications.jsonl and
+// retried by the daemon with exponential backoff. Like the ledger the file
+// is append-only, one JSON object per change, so serve and the daemon can
+// both write to it.
+
+const (
+	notifyRelay = "relay" // Destination is a URL, Body the signed event
+	notifyHook  = "hook"  // Destination is a ledger reference
+	notifySMS   = "sms"   // Destination is a ledger reference
+
+	notifyQueued    = "queued"
+	notifyDelivered = "delivered"
+	notifyDead      = "dead"
+
+	// notifyMaxAttempts retries span about seven hours before giving up.
+	notifyMaxAttempts = 12
+)
+
+// queuedNotification is the latest state of one queued notification.
+type queuedNotification struct {
+	ID          string          `json:"id"`
+	Kind        string          `json:"kind"`
+	Destination string          `json:"destination"`
+	Body        json.RawMessage `json:"body,omitempty"`
+	State       string          `json:"state"`
+	Attempts    int             `json:"attempts"`
+	Error       string          `json:"error,omitempty"`
+	NextAttempt time.Time       `json:"next_attempt"`
+	CreatedAt   time.Time       `json:"created_at"`
+	UpdatedAt   time.Time       `json:"updated_at"`
+}
+
+type notifyQueue struct {
+	path string
+	mu   sync.Mutex
+
+	// coord, if set, limits retries to one replica at a time.
+	coord Coordinator
+}
+
+func openNotifyQueue() (*notifyQueue, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return nil, err
+	}
+	return &notifyQueue{path: filepath.Join(dir, "notifications.jsonl")}, nil
+}
+
+// notifyBackoff is the wait before retry n (0-based): 1 minute, doubling
+// up to an hour.
+func notifyBackoff(n int) time.Duration {
+	wait := time.Minute << min(n, 6)
+	return min(wait, time.Hour)
+}
+
+// enqueueNotification queues a failed notification for the daemon. Errors
+// are printed, since there is nowhere else left to report them.
+func enqueueNotification(kind, destination string, body []byte, cause error) {
+	q, err := openNotifyQueue()
+	if err == nil {
+		err = q.Enqueue(kind, destination, body, cause)
+	}
+	if err != nil {
+		fmt.Printf("⚠ Failed to queue %s notification for %s: %v\n", kind, destination, err)
+		return
+	}
+	fmt.Printf("⏳ Queued %s notification for %s; `campay daemon` will retry it\n", kind, destination)
+}
+
+// Enqueue records a notification that just failed.
+func (q *notifyQueue) Enqueue(kind, destination string, body []byte, cause error) error {
+	var id [8]byte
+	rand.Read(id[:])
+	now := time.Now().UTC()
+	return q.write(queuedNotification{
+		ID:          hex.EncodeToString(id[:]),
+		Kind:        kind,
+		Destination: destination,
+		Body:        body,
+		State:       notifyQueued,
+		Error:       cause.Error(),
+		NextAttempt: now.Add(notifyBackoff(0)),
+		CreatedAt:   now,
+	})
+}
+
+func (q *notifyQueue) write(n queuedNotification) error {
+	n.UpdatedAt = time.Now().UTC()
+	line, err := json.Marshal(n)
+	if err != nil {
+		return err
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	f, err := os.OpenFile(q.path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0600)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(append(line, '\n')); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// List returns the latest state of every notification, oldest first.
+func (q *notifyQueue) List() ([]queuedNotification, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	f, err := os.Open(q.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	latest := map[string]queuedNotification{}
+	scanner := bufio.NewScanner(f)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+	for n := 1; scanner.Scan(); n++ {
+		if len(scanner.Bytes()) == 0 {
+			continue
+		}
+		var qn queuedNotification
+		if err := json.Unmarshal(scanner.Bytes(), &qn); err != nil {
+			return nil, fmt.Errorf("%s:%d: %w", q.path, n, err)
+		}
+		latest[qn.ID] = qn
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	list := make([]queuedNotification, 0, len(latest))
+	for _, qn := range latest {
+		list = append(list, qn)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].CreatedAt.Before(list[j].CreatedAt) })
+	return list, nil
+}
+
+// RetryDue sends every queued notification whose next attempt is due.
+// Failures are rescheduled, or marked dead and moved to the dead letters
+// after notifyMaxAttempts.
+func (q *notifyQueue) RetryDue(send func(n queuedNotification) error) (delivered, dead int, err error) {
+	list, err := q.List()
+	if err != nil {
+		return 0, 0, err
+	}
+	now := time.Now()
+	for _, n := range list {
+		if n.State != notifyQueued || now.Before(n.NextAttempt) {
+			continue
+		}
+		n.Attempts++
+		if sendErr := send(n); sendErr == nil {
+			n.State, n.Error = notifyDelivered, ""
+			delivered++
+		} else {
+			n.Error = sendErr.Error()
+			if n.Attempts >= notifyMaxAttempts {
+				n.State = notifyDead
+				dead++
+			} else {
+				n.NextAttempt = now.Add(notifyBackoff(n.Attempts)).UTC()
+			}
+		}
+		if err := q.write(n); err != nil {
+			return delivered, dead, err
+		}
+		if n.State == notifyDead {
+			buryNotification(n)
+		}
+	}
+	return delivered, dead, nil
+}
+
+// run retries due notifications every interval until ctx is done.
+func (q *notifyQueue) run(ctx context.Context, every time.Duration, send func(n queuedNotification) error) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if q.leader(2 * every) {
+			if delivered, dead, err := q.RetryDue(send); err != nil {
+				fmt.Println("⚠ Notification queue:", err)
+			} else if delivered > 0 || dead > 0 {
+				fmt.Printf("📬 Notification queue: %d delivered, %d moved to dead letters\n", delivered, dead)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// leader reports whether this replica holds the queue lease, taking or
+// renewing it for ttl.
+func (q *notifyQueue) leader(ttl time.Duration) bool {
+	if q.coord == nil {
+		return true
+	}
+	ok, err := q.coord.Acquire(leaseNotifications, ttl)
+	if err != nil {
+		fmt.Println("⚠ Notification queue:", err)
+	}
+	return ok
+}
+
+// sendQueuedNotification makes one delivery attempt for n. Relay bodies
+// are signed again with the secret of their destination; hooks run again
+// and SMS receipts are sent again with the current ledger entry.
+func sendQueuedNotification(ledger *Ledger, secrets relaySecrets) func(n queuedNotification) error {
+	return func(n queuedNotification) error {
+		switch n.Kind {
+		case notifyRelay:
+			if err := secrets.missing(n.Destination); err != nil {
+				return err
+			}
+			return newRelay(nil, secrets).post(n.Destination, n.Body)
+		case notifyHook, notifySMS:
+			e, err := ledger.Get(n.Destination)
+			if err != nil {
+				return err
+			}
+			if e == nil {
+				return fmt.Errorf("transaction %s is not in the ledger (archived?)", n.Destination)
+			}
+			if n.Kind == notifyHook {
+				return execFinalHook(*e)
+			}
+			if receiptSMS == nil {
+				return errors.New("SMS receipts are no longer configured")
+			}
+			return receiptSMS.Send(*e)
+		}
+		return fmt.Errorf("unknown notification kind %q", n.Kind)
+	}
+}
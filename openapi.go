@@ -0,0 +1,274 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ========================== OPENAPI ==========================
+   ============================================================ */
+
+// apiRoute is one endpoint of an HTTP API the CLI serves (serve, daemon).
+// Handlers are registered from the same list the OpenAPI document is
+// generated from, so the document cannot drift from the handlers.
+type apiRoute struct {
+	Method  string // empty accepts GET and POST
+	Path    string // ServeMux pattern path, e.g. /jobs/{id}
+	Summary string
+	Handler http.HandlerFunc
+
+	Request  any    // JSON request body, or nil
+	Params   any    // struct whose json tags name query/form parameters, or nil
+	Response any    // JSON response body (or event data with Produces), or nil
+	Status   int    // success status (default 200)
+	Produces string // response content type when not JSON, e.g. text/html
+	Errors   []int  // error statuses, answered with apiError for JSON routes
+
+	Scope apiScope // API key scope needed when the spec has Keys, "" for none
+}
+
+// apiError is the body of every JSON error response.
+type apiError struct {
+	Error string `json:"error"`
+}
+
+// apiSpec is an HTTP API served by the CLI and its OpenAPI description.
+type apiSpec struct {
+	Title       string
+	Description string
+	Routes      []apiRoute
+	Keys        *keyring // checks the Scope of routes, or nil
+}
+
+// register adds every route to mux, plus GET /openapi.json.
+func (s apiSpec) register(mux *http.ServeMux) {
+	for _, r := range s.Routes {
+		pattern := r.Path
+		if r.Method != "" {
+			pattern = r.Method + " " + r.Path
+		}
+		handler := r.Handler
+		if s.Keys != nil && r.Scope != "" {
+			handler = s.Keys.guard(r.Scope, handler)
+		}
+		mux.HandleFunc(pattern, handler)
+	}
+	doc, err := json.MarshalIndent(s.document(), "", "  ")
+	if err != nil {
+		panic(err) // only plain values are marshalled
+	}
+	mux.HandleFunc("GET /openapi.json", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write(doc)
+	})
+}
+
+var pathParam = regexp.MustCompile(`\{(\w+)\}`)
+
+// document builds the OpenAPI 3 document of s.
+func (s apiSpec) document() map[string]any {
+	sb := &schemaBuilder{components: map[string]any{}}
+	paths := map[string]any{}
+	for _, r := range s.Routes {
+		item, _ := paths[r.Path].(map[string]any)
+		if item == nil {
+			item = map[string]any{}
+			paths[r.Path] = item
+		}
+		methods := []string{r.Method}
+		if r.Method == "" {
+			methods = []string{"GET", "POST"}
+		}
+		for _, m := range methods {
+			op := sb.operation(r, m)
+			if s.Keys != nil && r.Scope != "" {
+				secure(op, r.Scope, sb)
+			}
+			item[strings.ToLower(m)] = op
+		}
+	}
+	paths["/openapi.json"] = map[string]any{"get": map[string]any{
+		"summary":   "This document",
+		"responses": map[string]any{"200": map[string]any{"description": "OpenAPI 3 document"}},
+	}}
+
+	components := map[string]any{"schemas": sb.components}
+	if s.Keys != nil {
+		components["securitySchemes"] = map[string]any{
+			"apiKey": map[string]any{"type": "http", "scheme": "bearer", "description": "Key from `campay apikey create`, needed once any key exists"},
+		}
+	}
+	return map[string]any{
+		"openapi": "3.0.3",
+		"info": map[string]any{
+			"title":       s.Title,
+			"description": s.Description,
+			"version":     buildVersion(),
+		},
+		"paths":      paths,
+		"components": components,
+	}
+}
+
+// secure marks op as needing an API key of scope, with its error answers.
+func secure(op map[string]any, scope apiScope, sb *schemaBuilder) {
+	op["security"] = []any{map[string]any{"apiKey": []any{}}}
+	op["description"] = "Needs an API key with scope " + string(scope) + " or above."
+	responses := op["responses"].(map[string]any)
+	for _, code := range []int{http.StatusUnauthorized, http.StatusForbidden, http.StatusTooManyRequests} {
+		responses[strconv.Itoa(code)] = map[string]any{
+			"description": http.StatusText(code),
+			"content":     map[string]any{"application/json": map[string]any{"schema": sb.schema(reflect.TypeOf(apiError{}))}},
+		}
+	}
+}
+
+func (sb *schemaBuilder) operation(r apiRoute, method string) map[string]any {
+	op := map[string]any{"summary": r.Summary}
+
+	var params []any
+	for _, m := range pathParam.FindAllStringSubmatch(r.Path, -1) {
+		params = append(params, map[string]any{
+			"name": m[1], "in": "path", "required": true, "schema": map[string]any{"type": "string"},
+		})
+	}
+	if r.Params != nil {
+		for _, f := range jsonFields(reflect.TypeOf(r.Params)) {
+			params = append(params, map[string]any{"name": f.name, "in": "query", "schema": sb.schema(f.typ)})
+		}
+	}
+	if len(params) > 0 {
+		op["parameters"] = params
+	}
+
+	if r.Request != nil {
+		op["requestBody"] = map[string]any{
+			"required": true,
+			"content":  map[string]any{"application/json": map[string]any{"schema": sb.schema(reflect.TypeOf(r.Request))}},
+		}
+	} else if r.Params != nil && method == "POST" {
+		op["requestBody"] = map[string]any{
+			"content": map[string]any{"application/x-www-form-urlencoded": map[string]any{"schema": sb.schema(reflect.TypeOf(r.Params))}},
+		}
+	}
+
+	status := r.Status
+	if status == 0 {
+		status = http.StatusOK
+	}
+	ok := map[string]any{"description": http.StatusText(status)}
+	switch {
+	case r.Produces != "" && r.Response != nil:
+		ok["content"] = map[string]any{r.Produces: map[string]any{"schema": sb.schema(reflect.TypeOf(r.Response))}}
+	case r.Produces != "":
+		ok["content"] = map[string]any{r.Produces: map[string]any{"schema": map[string]any{"type": "string"}}}
+	case r.Response != nil:
+		ok["content"] = map[string]any{"application/json": map[string]any{"schema": sb.schema(reflect.TypeOf(r.Response))}}
+	}
+	responses := map[string]any{strconv.Itoa(status): ok}
+	for _, code := range r.Errors {
+		resp := map[string]any{"description": http.StatusText(code)}
+		if r.Produces == "" {
+			resp["content"] = map[string]any{"application/json": map[string]any{"schema": sb.schema(reflect.TypeOf(apiError{}))}}
+		}
+		responses[strconv.Itoa(code)] = resp
+	}
+	op["responses"] = responses
+	return op
+}
+
+// schemaBuilder turns Go types into JSON schemas, named structs becoming
+// shared components.
+type schemaBuilder struct {
+	components map[string]any
+}
+
+var timeType = reflect.TypeOf(time.Time{})
+
+func (sb *schemaBuilder) schema(t reflect.Type) map[string]any {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	switch {
+	case t == timeType:
+		return map[string]any{"type": "string", "format": "date-time"}
+	case t == reflect.TypeOf(json.RawMessage(nil)):
+		return map[string]any{}
+	}
+
+	switch t.Kind() {
+	case reflect.String:
+		return map[string]any{"type": "string"}
+	case reflect.Bool:
+		return map[string]any{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]any{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]any{"type": "number"}
+	case reflect.Slice, reflect.Array:
+		return map[string]any{"type": "array", "items": sb.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]any{"type": "object", "additionalProperties": sb.schema(t.Elem())}
+	case reflect.Struct:
+		name := schemaName(t)
+		if _, done := sb.components[name]; !done {
+			sb.components[name] = nil // placeholder for recursive types
+			props := map[string]any{}
+			for _, f := range jsonFields(t) {
+				props[f.name] = sb.schema(f.typ)
+			}
+			sb.components[name] = map[string]any{"type": "object", "properties": props}
+		}
+		return map[string]any{"$ref": "#/components/schemas/" + name}
+	}
+	return map[string]any{}
+}
+
+// schemaName is the exported form of a type name, e.g. payStatus becomes
+// PayStatus and campay.WebhookEvent stays WebhookEvent.
+func schemaName(t reflect.Type) string {
+	name := t.Name()
+	if name == "" {
+		return "Object"
+	}
+	return strings.ToUpper(name[:1]) + name[1:]
+}
+
+type jsonField struct {
+	name string
+	typ  reflect.Type
+}
+
+// jsonFields lists the fields encoding/json would write for struct t.
+func jsonFields(t reflect.Type) []jsonField {
+	for t.Kind() == reflect.Pointer {
+		t = t.Elem()
+	}
+	var fields []jsonField
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			fields = append(fields, jsonFields(f.Type)...)
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields = append(fields, jsonField{name: name, typ: f.Type})
+	}
+	return fields
+}
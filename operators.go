@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+)
+
+/* ============================================================
+   ========================= OPERATORS =========================
+   ============================================================ */
+
+// The prefix of a number only tells its original network: numbers ported
+// between MTN and Orange keep their prefix. The operator of a payment is
+// therefore taken, in order, from --operator (or a batch operator column),
+// the config file's ported_numbers, the operator CamPay reported for the
+// number's last transaction, and finally the prefix. When none of them
+// knows, collect asks.
+
+// Operator sources, shown next to the network the prompt comes from.
+const (
+	operatorGiven   = "given"
+	operatorPorted  = "ported"
+	operatorHistory = "history"
+	operatorPrefix  = "prefix"
+)
+
+// parseOperator normalizes an operator name: MTN (also momo) or ORANGE
+// (also om). "" stays "".
+func parseOperator(s string) (string, error) {
+	switch strings.ToUpper(strings.TrimSpace(s)) {
+	case "":
+		return "", nil
+	case "MTN", "MOMO":
+		return "MTN", nil
+	case "ORANGE", "OM":
+		return "ORANGE", nil
+	}
+	return "", invalidInput("unknown operator %q (use MTN or ORANGE)", s)
+}
+
+// knownOperator returns what is known about the operator of phone, and
+// where it comes from, or "" when nothing is.
+func knownOperator(cfg *Config, ledger *Ledger, phone string) (operator, source string, err error) {
+	if op, ok := cfg.PortedNumbers[phone]; ok {
+		return op, operatorPorted, nil
+	}
+	if ledger != nil {
+		entries, err := ledger.Entries()
+		if err != nil {
+			return "", "", err
+		}
+		for i := len(entries) - 1; i >= 0; i-- {
+			if e := entries[i]; e.Phone == phone && e.Operator != "" {
+				if op, err := parseOperator(e.Operator); err == nil && op != "" {
+					return op, operatorHistory, nil
+				}
+			}
+		}
+	}
+	if op := operatorFor(phone); op != "" {
+		return op, operatorPrefix, nil
+	}
+	return "", "", nil
+}
+
+// sentOperator is the operator to send with a payment to phone whose
+// operator is known to be operator: none when the prefix already tells
+// CamPay, as it does for all but ported numbers.
+func sentOperator(phone, operator string) string {
+	if operator == operatorFor(phone) {
+		return ""
+	}
+	return operator
+}
+
+// chooseOperator settles the operator of an interactive payment: given
+// (from --operator) wins, then what is known, and otherwise the user is
+// asked.
+func chooseOperator(cfg *Config, ledger *Ledger, phone, given string) (string, error) {
+	if given != "" {
+		printOperator(given, operatorGiven)
+		return given, nil
+	}
+	op, source, err := knownOperator(cfg, ledger, phone)
+	if err != nil {
+		return "", err
+	}
+	if op == "" {
+		for {
+			answer, err := promptUser(tr("operator.ask", phone))
+			if err != nil {
+				return "", err
+			}
+			if op, err = parseOperator(answer); err == nil && op != "" {
+				break
+			}
+		}
+		source = operatorGiven
+	}
+	if prefix := operatorFor(phone); prefix != "" && prefix != op {
+		fmt.Println(tr("operator.ported", phone, operatorName(prefix), operatorName(op)))
+	}
+	printOperator(op, source)
+	return op, nil
+}
+
+func printOperator(op, source string) {
+	fmt.Println(tr("operator.push", operatorName(op), tr("operator.src."+source)))
+}
+
+// operatorName is the name customers know the network's wallet by.
+func operatorName(op string) string {
+	switch op {
+	case "MTN":
+		return "MTN Mobile Money"
+	case "ORANGE":
+		return "Orange Money"
+	}
+	return op
+}
+
+// portedNumbers normalizes the config file's ported_numbers.
+func portedNumbers(fc map[string]string) (map[string]string, error) {
+	ported := make(map[string]string, len(fc))
+	for number, name := range fc {
+		phone, err := normalizePhone(number)
+		if err != nil {
+			return nil, fmt.Errorf("ported_numbers: %w", err)
+		}
+		op, err := parseOperator(name)
+		if err != nil || op == "" {
+			return nil, fmt.Errorf("ported_numbers: %s: unknown operator %q", number, name)
+		}
+		ported[phone] = op
+	}
+	return ported, nil
+}
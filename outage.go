@@ -0,0 +1,173 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ====================== OPERATOR OUTAGES =====================
+   ============================================================ */
+
+// When an operator's network has trouble, its customers stop receiving
+// or confirming prompts and collections fail one after another. The
+// ledger shows it first: outageRates counts, per operator, the
+// collections created in the last window that ended, and how many of them
+// failed or were never confirmed. Collections cancelled locally are left
+// out: the cashier gave up, not the network. Above the threshold, collect
+// warns before sending a new request to that operator, and /metrics and
+// the dashboard report it.
+
+// OutageConfig is the "outage" section of the config file.
+type OutageConfig struct {
+	Threshold   float64 `json:"threshold,omitempty"`    // share of failures, default 0.5
+	Window      string  `json:"window,omitempty"`       // default 15m
+	MinPayments int     `json:"min_payments,omitempty"` // ended collections needed to judge, default 5
+	Disabled    bool    `json:"disabled,omitempty"`
+
+	window time.Duration
+}
+
+// validate fills in the defaults and parses the window.
+func (o *OutageConfig) validate() error {
+	if o.Threshold == 0 {
+		o.Threshold = 0.5
+	}
+	if o.Threshold < 0 || o.Threshold > 1 {
+		return invalidInput("threshold must be between 0 and 1, e.g. 0.5")
+	}
+	if o.Window == "" {
+		o.Window = "15m"
+	}
+	d, err := time.ParseDuration(o.Window)
+	if err != nil || d < time.Minute {
+		return invalidInput("window must be a duration of at least 1m, e.g. 15m")
+	}
+	o.window = d
+	if o.MinPayments == 0 {
+		o.MinPayments = 5
+	}
+	if o.MinPayments < 1 {
+		return invalidInput("min_payments must be at least 1")
+	}
+	return nil
+}
+
+// operatorHealth is the recent record of one operator.
+type operatorHealth struct {
+	Operator string  `json:"operator"`
+	Ended    int     `json:"ended"`  // collections in the window with a final status
+	Failed   int     `json:"failed"` // of which failed or not confirmed
+	Rate     float64 `json:"rate"`   // Failed / Ended, 0 without any
+	Outage   bool    `json:"outage"`
+}
+
+// outageRates returns the health of every operator with collections in
+// the window before now, MTN and Orange always included.
+func outageRates(entries []LedgerEntry, o OutageConfig, now time.Time) []operatorHealth {
+	byOp := map[string]*operatorHealth{"MTN": {Operator: "MTN"}, "ORANGE": {Operator: "ORANGE"}}
+	since := now.Add(-o.window)
+	for _, e := range entries {
+		ended := (isFinal(e.Status) && e.Status != campay.StatusCancelledLocal) || e.Status == campay.StatusExpiredLocal
+		if e.Kind != "collect" || e.Source == transferSource || e.CreatedAt.Before(since) || !ended {
+			continue
+		}
+		op := e.Operator
+		if op == "" {
+			op = operatorFor(e.Phone)
+		}
+		h := byOp[op]
+		if h == nil {
+			h = &operatorHealth{Operator: op}
+			byOp[op] = h
+		}
+		h.Ended++
+		if e.Status != campay.StatusSuccessful {
+			h.Failed++
+		}
+	}
+
+	list := make([]operatorHealth, 0, len(byOp))
+	for _, h := range byOp {
+		if h.Ended > 0 {
+			h.Rate = float64(h.Failed) / float64(h.Ended)
+		}
+		h.Outage = !o.Disabled && h.Ended >= o.MinPayments && h.Rate >= o.Threshold
+		list = append(list, *h)
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].Operator < list[j].Operator })
+	return list
+}
+
+// outageCacheTTL is how long the daemon and collect --stdin reuse the
+// rates, rather than reading the ledger for every payment.
+const outageCacheTTL = 30 * time.Second
+
+var outageCache struct {
+	sync.Mutex
+	path  string
+	at    time.Time
+	rates []operatorHealth
+}
+
+// currentOutages returns the rates of every operator now, reading the
+// ledger at most once per outageCacheTTL.
+func currentOutages(cfg *Config, ledger *Ledger) ([]operatorHealth, error) {
+	outageCache.Lock()
+	defer outageCache.Unlock()
+	if outageCache.path == ledger.path && time.Since(outageCache.at) < outageCacheTTL {
+		return outageCache.rates, nil
+	}
+	entries, err := ledger.Entries()
+	if err != nil {
+		return nil, err
+	}
+	outageCache.path, outageCache.at = ledger.path, time.Now()
+	outageCache.rates = outageRates(entries, cfg.Outage, outageCache.at)
+	return outageCache.rates, nil
+}
+
+// outageFor returns the health of operator when it looks down, or nil.
+func outageFor(cfg *Config, ledger *Ledger, operator string) *operatorHealth {
+	if cfg.Outage.Disabled {
+		return nil
+	}
+	rates, err := currentOutages(cfg, ledger)
+	if err != nil {
+		return nil
+	}
+	for _, h := range rates {
+		if h.Operator == operator && h.Outage {
+			return &h
+		}
+	}
+	return nil
+}
+
+// outageMessage describes an outage for people.
+func outageMessage(h operatorHealth, window time.Duration) string {
+	return tr("outage.warning", h.Operator, int(h.Rate*100+0.5), formatWindow(window), h.Failed, h.Ended)
+}
+
+// warnOutage prints a warning before a collection from an operator that
+// looks down. It never stops the payment.
+func warnOutage(cfg *Config, ledger *Ledger, operator string) {
+	if h := outageFor(cfg, ledger, operator); h != nil {
+		fmt.Println(outageMessage(*h, cfg.Outage.window))
+	}
+}
+
+// formatWindow writes a window the way people say it: 15 min, 2 h.
+func formatWindow(d time.Duration) string {
+	switch {
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%d h", d/time.Hour)
+	case d%time.Minute == 0:
+		return fmt.Sprintf("%d min", d/time.Minute)
+	}
+	return d.String()
+}
@@ -0,0 +1,206 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= OUTPUT MODES ========================
+   ============================================================ */
+
+// Output modes, set by the global --no-color, --no-emoji and --quiet flags.
+var (
+	noColor bool
+	noEmoji bool
+	quiet   bool
+)
+
+var (
+	// stdoutTTY is whether the real stdout is a terminal, captured before
+	// setupOutput replaces os.Stdout with a pipe.
+	stdoutTTY = isTerminal(os.Stdout)
+
+	// resultOut receives the reference/status lines printed in quiet mode.
+	resultOut io.Writer = os.Stdout
+
+	outputPipe *os.File
+	outputDone chan struct{}
+)
+
+// setupOutput applies the output modes. With --quiet everything written
+// to stdout is dropped except printResult lines; with --no-emoji stdout
+// goes through a pipe that replaces symbols with plain text. Prompts keep
+// writing to the real stdout. flushOutput must be called before exit.
+func setupOutput() error {
+	if os.Getenv("NO_COLOR") != "" || os.Getenv("TERM") == "dumb" {
+		noColor = true
+	}
+	if !quiet && !noEmoji {
+		return nil
+	}
+
+	real := os.Stdout
+	var dest io.Writer = real
+	if quiet {
+		dest = io.Discard
+	}
+	if noEmoji {
+		resultOut = emojiFilter{real}
+	} else {
+		resultOut = real
+	}
+
+	r, w, err := os.Pipe()
+	if err != nil {
+		return err
+	}
+	os.Stdout, outputPipe = w, w
+	outputDone = make(chan struct{})
+	go func() {
+		defer close(outputDone)
+		if noEmoji {
+			dest = emojiFilter{dest}
+		}
+		copyRunes(dest, r)
+	}()
+	return nil
+}
+
+// flushOutput waits until everything written to stdout has gone through
+// the output pipe, if there is one.
+func flushOutput() {
+	if outputDone == nil {
+		return
+	}
+	outputPipe.Close()
+	<-outputDone
+}
+
+// printResult prints the line kept by --quiet: the reference and its final
+// status.
+func printResult(reference, status string) {
+	if quiet {
+		fmt.Fprintf(resultOut, "%s %s\n", reference, status)
+	}
+}
+
+// copyRunes copies r to w without ever splitting a UTF-8 sequence, so
+// the filter sees whole characters even when a spinner writes partial
+// lines.
+func copyRunes(w io.Writer, r io.Reader) {
+	buf := make([]byte, 4096)
+	var carry []byte
+	for {
+		n, err := r.Read(buf)
+		data := append(carry, buf[:n]...)
+		cut := len(data)
+		if i := lastRuneStart(data); i >= 0 && !utf8.FullRune(data[i:]) {
+			cut = i
+		}
+		w.Write(data[:cut])
+		carry = append([]byte(nil), data[cut:]...)
+		if err != nil {
+			w.Write(carry)
+			return
+		}
+	}
+}
+
+func lastRuneStart(b []byte) int {
+	i := len(b) - 1
+	for i >= 0 && !utf8.RuneStart(b[i]) {
+		i--
+	}
+	return i
+}
+
+// emojiReplacements spell out the symbols whose meaning matters; any other
+// pictograph is dropped.
+var emojiReplacements = map[rune]string{
+	'✓': "OK",
+	'✔': "OK",
+	'✗': "x",
+	'❌': "ERROR",
+	'⚠': "WARNING:",
+	'•': "-",
+	'→': "->",
+}
+
+// stripEmoji replaces or removes pictographs, along with the space that
+// follows a removed one. A replacement already spelled out next to the
+// symbol ("❌ Error:") is not repeated.
+func stripEmoji(s string) string {
+	var b strings.Builder
+	skipSpace := false
+	for i, r := range s {
+		if r == '\uFE0F' || r == '\u200D' { // emoji variation selector and joiner
+			continue
+		}
+		if skipSpace {
+			skipSpace = false
+			if r == ' ' {
+				continue
+			}
+		}
+		if rep, ok := emojiReplacements[r]; ok {
+			next := strings.TrimLeft(s[i+utf8.RuneLen(r):], " \uFE0F")
+			if len(next) >= len(rep) && strings.EqualFold(next[:len(rep)], rep) {
+				skipSpace = true
+				continue
+			}
+			b.WriteString(rep)
+			continue
+		}
+		if unicode.Is(unicode.So, r) && !unicode.In(r, unicode.Braille) || r >= 0x1F000 {
+			skipSpace = true
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// emojiFilter writes through stripEmoji. Writes must hold whole runes.
+type emojiFilter struct{ w io.Writer }
+
+func (f emojiFilter) Write(p []byte) (int, error) {
+	if _, err := io.WriteString(f.w, stripEmoji(string(p))); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// =============================================================
+// Color
+// =============================================================
+
+const (
+	ansiReset  = "\033[0m"
+	ansiGreen  = "\033[32m"
+	ansiRed    = "\033[31m"
+	ansiYellow = "\033[33m"
+)
+
+// colorStatus returns the translated status label, colored when stdout is
+// a terminal that understands ANSI escapes and color is not disabled.
+func colorStatus(status string) string {
+	label := statusLabel(status)
+	if noColor || !stdoutTTY || !ansiStdout {
+		return label
+	}
+	color := ansiYellow
+	switch s := parseStatus(status); {
+	case s == campay.StatusSuccessful:
+		color = ansiGreen
+	case unsuccessful(s):
+		color = ansiRed
+	}
+	return color + label + ansiReset
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"net/http"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= PAYMENT PAGE ========================
+   ============================================================ */
+
+// The page's event stream hears status changes from the ledger's events
+// (the webhook handler and sweeper of the same process), and rereads the
+// ledger every payPageInterval for those recorded by other processes,
+// such as a running collect.
+const payPageInterval = 5 * time.Second
+
+// payStatus is the payload of each event sent to the payment page.
+type payStatus struct {
+	Status  string `json:"status"`
+	State   string `json:"state"` // pending, success, failed or abandoned
+	Message string `json:"message"`
+}
+
+func newPayStatus(s campay.Status) payStatus {
+	state := "pending"
+	switch {
+	case s == campay.StatusSuccessful:
+		state = "success"
+	case unsuccessful(s):
+		state = "failed"
+	case s.Abandoned():
+		state = "abandoned"
+	}
+	return payStatus{Status: statusLabel(string(s)), State: state, Message: tr("page." + state)}
+}
+
+var payPage = template.Must(template.New("pay").Parse(`<!DOCTYPE html>
+<html lang="{{.Lang}}">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+  body { font-family: system-ui, sans-serif; display: flex; min-height: 100vh; margin: 0;
+         align-items: center; justify-content: center; text-align: center; background: #f4f4f4; }
+  main { padding: 2rem; }
+  .amount { font-size: 3rem; font-weight: bold; }
+  .message { font-size: 1.6rem; margin: 1rem 0; }
+  .status { color: #666; }
+  .pending .message { color: #b07800; }
+  .success .message { color: #1a7f37; }
+  .failed .message, .abandoned .message { color: #c62828; }
+  .dial { display: none; margin-top: 1.5rem; font-size: 1.2rem; }
+  .pending .dial { display: inline-block; }
+</style>
+</head>
+<body>
+<main id="page" class="{{.Status.State}}">
+  <div class="amount">{{.Amount}}</div>
+  <div class="message" id="message">{{.Status.Message}}</div>
+  <div class="status" id="status">{{.Status.Status}} · {{.Reference}}</div>
+  {{if .DialURI}}<a class="dial" href="{{.DialURI}}">{{.DialLabel}}</a>{{end}}
+</main>
+<script>
+  const page = document.getElementById("page");
+  const events = new EventSource({{.EventsURL}});
+  events.addEventListener("status", (e) => {
+    const s = JSON.parse(e.data);
+    page.className = s.state;
+    document.getElementById("message").textContent = s.message;
+    document.getElementById("status").textContent = s.status + " · " + {{.Reference}};
+    if (s.state === "success" || s.state === "failed") events.close();
+  });
+</script>
+</body>
+</html>
+`))
+
+// handlePayPage serves the customer-facing status page of a transaction
+// recorded in the ledger.
+func handlePayPage(ledger *Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		e, err := ledger.Get(r.PathValue("ref"))
+		if err != nil {
+			http.Error(w, "ledger unavailable", http.StatusInternalServerError)
+			return
+		}
+		if e == nil {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Header().Set("Cache-Control", "no-store")
+		payPage.Execute(w, map[string]any{
+			"Lang":      lang,
+			"Title":     tr("page.title", e.Reference),
+			"Reference": e.Reference,
+			"Amount":    formatAmount(e.Amount, e.Currency),
+			"Status":    newPayStatus(e.Status),
+			"EventsURL": "/pay/" + e.Reference + "/events",
+			// Checked by DialURI to hold only digits, * and #
+			"DialURI":   template.URL(campay.DialURI(e.DialCode)),
+			"DialLabel": tr("page.dial", e.DialCode),
+		})
+	}
+}
+
+// handlePayEvents streams the transaction's status as server-sent events
+// until it is final or the client goes away.
+func handlePayEvents(ledger *Ledger) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		reference := r.PathValue("ref")
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+		e, err := ledger.Get(reference)
+		if err != nil || e == nil {
+			http.NotFound(w, r)
+			return
+		}
+		changed := make(chan campay.Status, 1) // latest status only
+		defer ledger.Subscribe(func(ev campay.TxEvent) {
+			if ev.Reference != reference {
+				return
+			}
+			select {
+			case <-changed:
+			default:
+			}
+			select {
+			case changed <- ev.Status:
+			default:
+			}
+		})()
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Accel-Buffering", "no")
+
+		ticker := time.NewTicker(payPageInterval)
+		defer ticker.Stop()
+		var last campay.Status = "-"
+		status := e.Status
+		for idle := 0; ; {
+			if status != last {
+				last = status
+				data, _ := json.Marshal(newPayStatus(status))
+				fmt.Fprintf(w, "event: status\ndata: %s\n\n", data)
+				flusher.Flush()
+				idle = 0
+				if isFinal(status) {
+					return
+				}
+			}
+
+			select {
+			case <-r.Context().Done():
+				return
+			case status = <-changed:
+			case <-ticker.C:
+				if e, err := ledger.Get(reference); err == nil && e != nil {
+					status = e.Status
+				}
+				if idle++; idle%3 == 0 && status == last {
+					fmt.Fprint(w, ": keep-alive\n\n") // stops proxies closing an idle stream
+					flusher.Flush()
+				}
+			}
+		}
+	}
+}
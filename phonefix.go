@@ -0,0 +1,108 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* ============================================================
+   ===================== PHONE SUGGESTIONS =====================
+   ============================================================ */
+
+// Most numbers rejected at the counter are near misses: pasted with
+// spaces, dashes or the country code twice, typed with a letter O for a
+// zero, missing the leading 6 or with a key pressed twice. phoneSuggestions
+// guesses the number meant, so that the cashier can pick it instead of
+// starting over, and batch and API errors can name it.
+
+var mobileNumber = regexp.MustCompile(`^2376[0-9]{8}$`)
+
+// lookalikes are letters typed for the digits they resemble.
+var lookalikes = map[rune]rune{'O': '0', 'o': '0', 'I': '1', 'l': '1', 'i': '1'}
+
+// phoneSuggestions returns the numbers input most likely meant, in the
+// 237XXXXXXXXX form and most likely first, or none.
+func phoneSuggestions(input string) []string {
+	var b strings.Builder
+	for _, r := range strings.TrimPrefix(strings.TrimSpace(input), "+") {
+		if d, ok := lookalikes[r]; ok {
+			r = d
+		}
+		switch {
+		case r >= '0' && r <= '9':
+			b.WriteRune(r)
+		case strings.ContainsRune(" -.()/", r):
+		default:
+			return nil
+		}
+	}
+	digits := strings.TrimPrefix(b.String(), "00")
+	for strings.HasPrefix(digits, "237237") {
+		digits = digits[3:]
+	}
+	local := digits
+	if strings.HasPrefix(digits, "237") && len(digits) >= 11 {
+		local = digits[3:]
+	}
+
+	var candidates []string
+	switch len(local) {
+	case 9:
+		candidates = append(candidates, local)
+	case 8:
+		candidates = append(candidates, "6"+local)
+	case 10:
+		// A key pressed twice is likelier than a stray one
+		var doubled, other []string
+		for i := range local {
+			c := local[:i] + local[i+1:]
+			if (i > 0 && local[i-1] == local[i]) || (i+1 < len(local) && local[i+1] == local[i]) {
+				doubled = append(doubled, c)
+			} else {
+				other = append(other, c)
+			}
+		}
+		candidates = append(doubled, other...)
+	}
+
+	var out []string
+	seen := map[string]bool{}
+	for _, c := range candidates {
+		phone := "237" + c
+		if mobileNumber.MatchString(phone) && !seen[phone] && phone != input {
+			seen[phone] = true
+			out = append(out, phone)
+		}
+	}
+	return out[:min(len(out), 5)]
+}
+
+// choosePhoneSuggestion lists suggestions for a rejected number and asks
+// for one of them or another number, which is checked again. It returns
+// the error of input when nothing can be suggested.
+func choosePhoneSuggestion(input string, err error) (string, error) {
+	for {
+		suggestions := phoneSuggestions(input)
+		if len(suggestions) == 0 {
+			return "", err
+		}
+		fmt.Println(tr("phone.suggestions", input))
+		for i, s := range suggestions {
+			fmt.Printf("  %d) %s\n", i+1, s)
+		}
+		answer, perr := promptUser(tr("prompt.suggestion"))
+		if perr != nil {
+			return "", perr
+		}
+		if n, nerr := strconv.Atoi(answer); nerr == nil && n >= 1 && n <= len(suggestions) {
+			return suggestions[n-1], nil
+		}
+		var phone string
+		if phone, err = resolvePhone(answer); err == nil {
+			return phone, nil
+		}
+		input = answer
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+/* ============================================================
+   ========================= PERSONAL DATA =====================
+   ============================================================ */
+
+// Lists, transaction details and the dashboard show payers' numbers and
+// names masked (2376******89), so they stay off screens seen over a
+// shoulder and off logs and terminal captures that get shared. --show-pii
+// shows them in full. The daemon's HTTP API shows them in full only to
+// admin keys (see maskJob). Prompts echoing what the cashier just typed,
+// files written for other systems (batch results, accounting exports) and
+// the ledger itself are not masked.
+
+// showPII is set by the global --show-pii flag.
+var showPII bool
+
+// maskPhoneDisplay keeps the country code and first digit, and the last two
+// digits, of a phone number: 237670000089 becomes 2376******89.
+func maskPhoneDisplay(phone string) string {
+	keep := 4
+	if !strings.HasPrefix(phone, "237") {
+		keep = 1
+	}
+	if len(phone) <= keep+2 {
+		return strings.Repeat("*", len(phone))
+	}
+	return phone[:keep] + strings.Repeat("*", len(phone)-keep-2) + phone[len(phone)-2:]
+}
+
+// maskName keeps the first letter of a name.
+func maskName(name string) string {
+	if name == "" {
+		return ""
+	}
+	r, _ := utf8.DecodeRuneInString(name)
+	return string(r) + "***"
+}
+
+// displayPhone is phone as shown in console output.
+func displayPhone(phone string) string {
+	if showPII || phone == "" {
+		return phone
+	}
+	return maskPhoneDisplay(phone)
+}
+
+// displayName is a payer's name as shown in console output.
+func displayName(name string) string {
+	if showPII {
+		return name
+	}
+	return maskName(name)
+}
+
+// maskJob masks the payer's number of a job answered by the daemon's API,
+// unless the request was made with an admin key or no key exists yet.
+func maskJob(r *http.Request, j Job) Job {
+	if !requestScope(r).allows(scopeAdmin) && j.Phone != "" {
+		j.Phone = maskPhoneDisplay(j.Phone)
+	}
+	return j
+}
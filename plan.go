@@ -0,0 +1,460 @@
+package main
+
+import (
+	"context"
+	"crypto/cipher"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= PAYMENT PLANS =======================
+   ============================================================ */
+
+// Plan is a sequence of payment steps run by `campay run`, e.g. collect
+// from a customer and, once paid, split the money between payees.
+type Plan struct {
+	Name       string     `json:"name"`
+	Settlement string     `json:"settlement,omitempty"` // recorded on every ledger entry of the plan
+	Steps      []PlanStep `json:"steps"`
+}
+
+// PlanStep is one operation of a plan. If, when set, is a condition on an
+// earlier step such as "pay == SUCCESSFUL" or "pay != SUCCESSFUL".
+type PlanStep struct {
+	ID     string `json:"id"`
+	Action string `json:"action"` // collect, withdraw or notify
+	If     string `json:"if,omitempty"`
+
+	// collect and withdraw
+	Phone             string `json:"phone,omitempty"`
+	Amount            string `json:"amount,omitempty"` // "5000", "5k", or "60%" of the step named in Of
+	Of                string `json:"of,omitempty"`
+	Description       string `json:"description,omitempty"`
+	ExternalReference string `json:"external_reference,omitempty"`
+
+	// notify
+	URL string `json:"url,omitempty"`
+}
+
+// Step outcomes besides the transaction statuses.
+const (
+	stepSkipped    = "SKIPPED"
+	stepSent       = "SENT"
+	stepSubmitting = "SUBMITTING" // the request may have reached CamPay
+)
+
+// planStepState is what `campay run` remembers about one step.
+type planStepState struct {
+	Status            string    `json:"status"`
+	Reference         string    `json:"reference,omitempty"`
+	ExternalReference string    `json:"external_reference,omitempty"`
+	Phone             string    `json:"phone,omitempty"`
+	Amount            int       `json:"amount,omitempty"`
+	Error             string    `json:"error,omitempty"`
+	UpdatedAt         time.Time `json:"updated_at"`
+}
+
+// done reports whether the step needs no more work on resume.
+func (s *planStepState) done() bool {
+	return s != nil && (s.Status == stepSkipped || s.Status == stepSent || isFinal(parseStatus(s.Status)))
+}
+
+// planState is saved next to the plan after every change, so an
+// interrupted run resumes where it stopped.
+type planState struct {
+	Plan  string                    `json:"plan"`
+	Steps map[string]*planStepState `json:"steps"`
+
+	path string
+	aead cipher.AEAD // encrypts phone numbers like the ledger's
+}
+
+func (s *planState) save() error {
+	stored := planState{Plan: s.Plan, Steps: make(map[string]*planStepState, len(s.Steps))}
+	for id, st := range s.Steps {
+		sst := *st
+		if err := sealPhones(s.aead, &sst.Phone); err != nil {
+			return err
+		}
+		stored.Steps[id] = &sst
+	}
+	data, err := json.MarshalIndent(stored, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(s.path, data, 0600)
+}
+
+// set updates a step and saves the state.
+func (s *planState) set(id string, fn func(st *planStepState)) {
+	st := s.Steps[id]
+	if st == nil {
+		st = &planStepState{}
+		s.Steps[id] = st
+	}
+	fn(st)
+	st.UpdatedAt = time.Now().UTC()
+	if err := s.save(); err != nil {
+		fmt.Println("⚠ Failed to save plan state:", err)
+	}
+}
+
+// loadPlan reads and checks a JSON plan file.
+func loadPlan(path string) (*Plan, error) {
+	if ext := strings.ToLower(filepath.Ext(path)); ext == ".yaml" || ext == ".yml" {
+		return nil, invalidInput("YAML plans are not supported; write %s as JSON", path)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var plan Plan
+	if err := json.Unmarshal(data, &plan); err != nil {
+		return nil, invalidInput("failed to parse %s: %v", path, err)
+	}
+	if plan.Name == "" {
+		plan.Name = strings.TrimSuffix(filepath.Base(path), filepath.Ext(path))
+	}
+	if len(plan.Steps) == 0 {
+		return nil, invalidInput("%s has no steps", path)
+	}
+
+	seen := map[string]bool{}
+	for i, st := range plan.Steps {
+		where := fmt.Sprintf("step %d (%s)", i+1, st.ID)
+		if st.ID == "" || seen[st.ID] {
+			return nil, invalidInput("step %d needs a unique id", i+1)
+		}
+		switch st.Action {
+		case "collect", "withdraw":
+			if st.Phone == "" || st.Amount == "" {
+				return nil, invalidInput("%s: phone and amount are required", where)
+			}
+			if strings.HasSuffix(st.Amount, "%") && !seen[st.Of] {
+				return nil, invalidInput("%s: a percentage amount needs \"of\" naming an earlier step", where)
+			}
+		case "notify":
+			if st.URL == "" {
+				return nil, invalidInput("%s: url is required", where)
+			}
+		default:
+			return nil, invalidInput("%s: action must be collect, withdraw or notify", where)
+		}
+		if st.If != "" {
+			ref, _, _, err := parseCondition(st.If)
+			if err != nil {
+				return nil, invalidInput("%s: %v", where, err)
+			}
+			if !seen[ref] {
+				return nil, invalidInput("%s: condition refers to %q, which is not an earlier step", where, ref)
+			}
+		}
+		seen[st.ID] = true
+	}
+	return &plan, nil
+}
+
+// parseCondition splits "pay == SUCCESSFUL" into its parts.
+func parseCondition(cond string) (step string, equal bool, status string, err error) {
+	for _, op := range []string{"==", "!="} {
+		if left, right, ok := strings.Cut(cond, op); ok {
+			return strings.TrimSpace(left), op == "==", strings.ToUpper(strings.TrimSpace(right)), nil
+		}
+	}
+	return "", false, "", fmt.Errorf("condition %q must look like \"step == STATUS\" or \"step != STATUS\"", cond)
+}
+
+func (s *planState) holds(cond string) bool {
+	if cond == "" {
+		return true
+	}
+	step, equal, status, _ := parseCondition(cond)
+	got := ""
+	if st := s.Steps[step]; st != nil {
+		got = st.Status
+	}
+	return (got == status) == equal
+}
+
+// planOptions are the flags of run.
+type planOptions struct {
+	statePath string
+	restart   bool
+}
+
+// planFlags defines the flags of run on fs.
+func planFlags(fs *flag.FlagSet, cfg *Config) *planOptions {
+	opt := &planOptions{}
+	fs.StringVar(&opt.statePath, "state", "", "execution state file (default: <plan>.state.json)")
+	fs.BoolVar(&opt.restart, "restart", false, "ignore the saved state and start from the first step")
+	return opt
+}
+
+// runPlan executes a plan file step by step.
+func runPlan(cfg *Config, args []string) error {
+	fs := newFlagSet("run")
+	opt := planFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "run"); err != nil {
+		return err
+	}
+	if fs.NArg() != 1 {
+		return invalidInput("usage: campay run [flags] <plan.json>")
+	}
+
+	plan, err := loadPlan(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	if opt.statePath == "" {
+		opt.statePath = strings.TrimSuffix(fs.Arg(0), filepath.Ext(fs.Arg(0))) + ".state.json"
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	for i := range plan.Steps {
+		// Settlements are written with encrypted numbers
+		if err := openPhones(ledger.aead, &plan.Steps[i].Phone); err != nil {
+			return fmt.Errorf("%s: %w", fs.Arg(0), err)
+		}
+	}
+
+	state := &planState{Plan: plan.Name, Steps: map[string]*planStepState{}, path: opt.statePath, aead: ledger.aead}
+	if data, err := os.ReadFile(opt.statePath); err == nil && !opt.restart {
+		if err := json.Unmarshal(data, state); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", opt.statePath, err)
+		}
+		if state.Steps == nil {
+			state.Steps = map[string]*planStepState{}
+		}
+		for _, st := range state.Steps {
+			if err := openPhones(ledger.aead, &st.Phone); err != nil {
+				return fmt.Errorf("%s: %w", opt.statePath, err)
+			}
+		}
+		fmt.Printf("Resuming %s from %s\n", plan.Name, opt.statePath)
+	} else if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	var provider Provider // connected on the first money step
+
+	failed := 0
+	for _, step := range plan.Steps {
+		st := state.Steps[step.ID]
+		if st.done() {
+			fmt.Printf("• %-12s %s (already done)\n", step.ID, st.Status)
+			if unsuccessful(parseStatus(st.Status)) {
+				failed++
+			}
+			continue
+		}
+		if !state.holds(step.If) {
+			state.set(step.ID, func(st *planStepState) { st.Status = stepSkipped })
+			fmt.Printf("• %-12s skipped (%s is false)\n", step.ID, step.If)
+			continue
+		}
+
+		if step.Action == "notify" {
+			if err := notifyPlan(cfg, plan, state, step); err != nil {
+				state.set(step.ID, func(st *planStepState) { st.Error = err.Error() })
+				return fmt.Errorf("step %s: %w", step.ID, err)
+			}
+			state.set(step.ID, func(st *planStepState) { st.Status, st.Error = stepSent, "" })
+			fmt.Printf("• %-12s notified %s\n", step.ID, step.URL)
+			continue
+		}
+
+		if provider == nil {
+			if provider, err = connectProvider(cfg); err != nil {
+				return err
+			}
+		}
+		status, err := runPlanStep(cfg, provider, ledger, plan, state, step)
+		if err != nil {
+			state.set(step.ID, func(st *planStepState) { st.Error = err.Error() })
+			return fmt.Errorf("step %s: %w (resume with `campay run %s`)", step.ID, err, fs.Arg(0))
+		}
+		fmt.Printf("• %-12s %s %s → %s\n", step.ID, step.Action, formatAmount(state.Steps[step.ID].Amount, "XAF"), colorStatus(status))
+		if unsuccessful(parseStatus(status)) {
+			failed++
+		}
+	}
+
+	fmt.Printf("\nPlan %s finished; state in %s\n", plan.Name, opt.statePath)
+	if failed > 0 {
+		return exitErr(exitPaymentFailed, fmt.Errorf("%d step(s) of %s failed", failed, plan.Name))
+	}
+	return nil
+}
+
+// runPlanStep submits a collect or withdraw step, or resumes polling one
+// submitted by an earlier run, and returns its final status.
+func runPlanStep(cfg *Config, provider Provider, ledger *Ledger, plan *Plan, state *planState, step PlanStep) (string, error) {
+	st := state.Steps[step.ID]
+	if st != nil && st.Status == stepSubmitting && st.Reference == "" {
+		return "", fmt.Errorf("an earlier run may have sent this %s; check `campay lookup --external-ref %s`, then remove the step from %s",
+			step.Action, st.ExternalReference, state.path)
+	}
+
+	if st == nil || st.Reference == "" {
+		phone, err := resolvePhone(step.Phone)
+		if err != nil {
+			return "", err
+		}
+		amount, err := planAmount(state, step, cfg.Rounding)
+		if err != nil {
+			return "", err
+		}
+		operator, _, err := knownOperator(cfg, ledger, phone)
+		if err != nil {
+			return "", err
+		}
+		if err := checkLimitsFor(cfg.OperatorLimits, operator, amount); err != nil {
+			return "", err
+		}
+		risk, err := newRiskCheck(cfg.Risk, ledger, step.Action)
+		if err != nil {
+			return "", err
+		}
+		if err := risk.Enforce(phone, amount, false); err != nil {
+			return "", err
+		}
+
+		externalRef := step.ExternalReference
+		if externalRef == "" {
+			externalRef = plan.Name + "-" + step.ID
+		}
+		description := step.Description
+		if description == "" {
+			description = "Payment"
+		}
+
+		audited := LedgerEntry{ExternalReference: externalRef, Phone: phone, Amount: amount}
+		if err := auditMoney(cfg, step.Action, auditRequested, audited); err != nil {
+			return "", err
+		}
+		state.set(step.ID, func(st *planStepState) {
+			st.Status, st.ExternalReference, st.Phone, st.Amount, st.Error = stepSubmitting, externalRef, phone, amount, ""
+		})
+
+		var reference, dialCode, review string
+		switch step.Action {
+		case "collect":
+			var resp *campay.CollectResponse
+			resp, err = submitCollect(provider, campay.CollectRequest{
+				Amount:            amount,
+				Currency:          "XAF",
+				From:              phone,
+				Description:       description,
+				ExternalReference: externalRef,
+				Operator:          sentOperator(phone, operator),
+			})
+			if err == nil {
+				reference, dialCode, review = resp.Reference, resp.DialCode(), reviewReason(resp)
+				printDialHint(resp)
+			}
+		case "withdraw":
+			var resp *campay.WithdrawResponse
+			resp, err = provider.Withdraw(context.Background(), campay.WithdrawRequest{
+				Amount:            amount,
+				Currency:          "XAF",
+				To:                phone,
+				Description:       description,
+				ExternalReference: externalRef,
+				Operator:          sentOperator(phone, operator),
+			})
+			if err == nil {
+				reference = resp.Reference
+			}
+		}
+		if err != nil {
+			auditMoney(cfg, step.Action, "error: "+err.Error(), audited)
+			if step.Action == "collect" || !collectOutcomeUnknown(err) {
+				// Nothing was sent, or submitCollect already checked
+				state.set(step.ID, func(st *planStepState) { st.Status = "" })
+			}
+			return "", err
+		}
+		audited.Reference = reference
+		auditMoney(cfg, step.Action, auditInitiated, audited)
+		state.set(step.ID, func(st *planStepState) {
+			st.Status, st.Reference = string(campay.StatusPending), reference
+		})
+		recordLedger(ledger, LedgerEntry{
+			Reference:         reference,
+			ExternalReference: externalRef,
+			Kind:              step.Action,
+			Phone:             phone,
+			Amount:            amount,
+			Currency:          "XAF",
+			Description:       description,
+			Status:            campay.StatusPending,
+			Environment:       cfg.Env,
+			Settlement:        plan.Settlement,
+			DialCode:          dialCode,
+			Review:            review,
+		})
+		st = state.Steps[step.ID]
+	}
+
+	status, err := pollTransactionStatus(provider, ledger, st.Reference, cfg.Deadline, nil)
+	if err != nil {
+		return "", err
+	}
+	final := parseStatus(status.Status)
+	if err := ledger.UpdateStatus(st.Reference, final, status.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	auditMoney(cfg, step.Action, string(final), LedgerEntry{
+		Reference: st.Reference, ExternalReference: st.ExternalReference, Phone: st.Phone, Amount: st.Amount,
+	})
+	state.set(step.ID, func(st *planStepState) { st.Status = string(final) })
+	return string(final), nil
+}
+
+// planAmount resolves a step amount, which may be a percentage of an
+// earlier step's amount, rounded to a whole franc by rounding.
+func planAmount(state *planState, step PlanStep, rounding Rounding) (int, error) {
+	pct, ok := strings.CutSuffix(strings.TrimSpace(step.Amount), "%")
+	if !ok {
+		return parseAmount(step.Amount)
+	}
+	p, ok := exactRat(strings.TrimSpace(pct))
+	if !ok || p.Sign() <= 0 || p.Cmp(big.NewRat(100, 1)) > 0 {
+		return 0, invalidInput("invalid percentage %q", step.Amount)
+	}
+	base := state.Steps[step.Of]
+	if base == nil || base.Amount == 0 {
+		return 0, invalidInput("step %s has no amount to take %s of", step.Of, step.Amount)
+	}
+	return rounding.PercentOf(base.Amount, p), nil
+}
+
+// notifyPlan posts the plan state to a notify step's URL, signed like the
+// webhook relay when the URL has a relay secret.
+func notifyPlan(cfg *Config, plan *Plan, state *planState, step PlanStep) error {
+	body, err := json.Marshal(map[string]any{
+		"type":  "plan.notify",
+		"plan":  plan.Name,
+		"step":  step.ID,
+		"steps": state.Steps,
+	})
+	if err != nil {
+		return err
+	}
+	return newRelay([]string{step.URL}, cfg.RelaySecrets.withFallback(os.Getenv("RELAY_SECRET"))).deliver(step.URL, body)
+}
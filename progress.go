@@ -0,0 +1,109 @@
+package main
+
+import (
+	"fmt"
+	"sync"
+	"time"
+)
+
+/* ============================================================
+   ========================= PROGRESS ==========================
+   ============================================================ */
+
+var (
+	spinnerFrames = []rune("⠋⠙⠹⠸⠼⠴⠦⠧⠇⠏")
+	asciiFrames   = []rune(`|/-\`)
+)
+
+// pollProgress shows polling as a single spinner line with elapsed time,
+// remaining budget and the last status. When stdout is not a terminal it
+// prints one plain line per check instead.
+type pollProgress struct {
+	tty     bool
+	started time.Time
+	budget  time.Duration
+
+	mu     sync.Mutex
+	status string
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// newPollProgress starts the spinner for a poll limited to deadline.
+func newPollProgress(deadline time.Duration) *pollProgress {
+	if deadline <= 0 {
+		deadline = defaultConfirmDeadline
+	}
+	p := &pollProgress{
+		tty:     stdoutTTY && ansiStdout && !quiet,
+		started: time.Now(),
+		budget:  deadline,
+
+		stop: make(chan struct{}),
+		done: make(chan struct{}),
+	}
+	if !p.tty {
+		close(p.done)
+		return p
+	}
+
+	go func() {
+		defer close(p.done)
+		ticker := time.NewTicker(100 * time.Millisecond)
+		defer ticker.Stop()
+		for frame := 0; ; frame++ {
+			select {
+			case <-p.stop:
+				fmt.Print("\r\033[K")
+				return
+			case <-ticker.C:
+				frames := spinnerFrames
+				if noEmoji {
+					frames = asciiFrames
+				}
+				p.render(frames[frame%len(frames)])
+			}
+		}
+	}()
+	return p
+}
+
+// Update records the result of a status check; it matches the onPending
+// callback of pollTransactionStatus.
+func (p *pollProgress) Update(status string, elapsed, deadline time.Duration) {
+	if !p.tty {
+		printPollProgress(status, elapsed, deadline)
+		return
+	}
+	p.mu.Lock()
+	p.status = status
+	p.mu.Unlock()
+}
+
+// Stop clears the spinner line. It is safe to call more than once.
+func (p *pollProgress) Stop() {
+	select {
+	case <-p.stop:
+	default:
+		close(p.stop)
+	}
+	<-p.done
+}
+
+func (p *pollProgress) render(frame rune) {
+	p.mu.Lock()
+	status := p.status
+	p.mu.Unlock()
+
+	elapsed := time.Since(p.started)
+	remaining := p.budget - elapsed
+	if remaining < 0 {
+		remaining = 0
+	}
+	if status == "" {
+		status = "PENDING"
+	}
+	fmt.Printf("\r\033[K%c %s", frame, tr("poll.progress", colorStatus(status),
+		elapsed.Round(time.Second), remaining.Round(time.Second)))
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+/* ============================================================
+   ========================== PROMPTS ==========================
+   ============================================================ */
+
+// Prompter asks the user for a line of input. Interactive commands go
+// through the package-level prompts, so tests and other front ends can
+// swap it for one reading from any io.Reader.
+type Prompter interface {
+	// Ask writes prompt and returns the next non-empty line, trimmed of
+	// spaces and of the \r that Windows consoles send before \n.
+	Ask(prompt string) (string, error)
+}
+
+// ioPrompter reads answers from in and writes prompts to out. It keeps one
+// buffered reader, so piped input is not lost between questions.
+type ioPrompter struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+func newPrompter(in io.Reader, out io.Writer) Prompter {
+	return &ioPrompter{in: bufio.NewReader(in), out: out}
+}
+
+func (p *ioPrompter) Ask(prompt string) (string, error) {
+	for {
+		fmt.Fprint(p.out, prompt)
+		input, err := p.in.ReadString('\n')
+		input = strings.TrimSpace(input)
+		if input != "" {
+			return input, nil
+		}
+		if err != nil {
+			return "", err
+		}
+	}
+}
+
+// prompts is the terminal by default.
+var prompts = newPrompter(os.Stdin, os.Stdout)
+
+func promptUser(prompt string) (string, error) {
+	return prompts.Ask(prompt)
+}
+
+func promptPhone() (string, error) {
+	input, err := promptUser(tr("prompt.phone"))
+	if err != nil {
+		return "", err
+	}
+	return resolveTypedPhone(input)
+}
+
+// resolveTypedPhone resolves a number or @contact typed at a prompt,
+// offering corrections for a mistyped number.
+func resolveTypedPhone(input string) (string, error) {
+	phone, err := resolvePhone(input)
+	if err != nil && !strings.HasPrefix(input, "@") {
+		return choosePhoneSuggestion(input, err)
+	}
+	return phone, err
+}
+
+func promptAmount() (int, error) {
+	amtStr, err := promptUser(tr("prompt.amount"))
+	if err != nil {
+		return 0, err
+	}
+	return parseAmount(amtStr)
+}
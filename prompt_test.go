@@ -0,0 +1,131 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+// scriptedPrompter answers prompts from a fixed list, then returns io.EOF
+// like a closed stdin. It records the prompts it was asked.
+type scriptedPrompter struct {
+	answers []string
+	asked   []string
+}
+
+func (p *scriptedPrompter) Ask(prompt string) (string, error) {
+	p.asked = append(p.asked, prompt)
+	if len(p.answers) == 0 {
+		return "", io.EOF
+	}
+	answer := p.answers[0]
+	p.answers = p.answers[1:]
+	return answer, nil
+}
+
+// withPrompts swaps the package prompter for the test.
+func withPrompts(t *testing.T, answers ...string) *scriptedPrompter {
+	t.Helper()
+	p := &scriptedPrompter{answers: answers}
+	saved := prompts
+	prompts = p
+	t.Cleanup(func() { prompts = saved })
+	return p
+}
+
+func TestIOPrompterSkipsBlankLines(t *testing.T) {
+	p := newPrompter(strings.NewReader("\n  \r\n 650000001 \r\n"), io.Discard)
+	got, err := p.Ask("? ")
+	if err != nil || got != "650000001" {
+		t.Fatalf("Ask = %q, %v; want %q", got, err, "650000001")
+	}
+	if _, err := p.Ask("? "); !errors.Is(err, io.EOF) {
+		t.Fatalf("Ask at end of input = %v; want io.EOF", err)
+	}
+}
+
+func TestPromptPhone(t *testing.T) {
+	t.Setenv("CAMPAY_HOME", t.TempDir())
+	if err := saveContacts(Contacts{"mama": "237670000001"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name    string
+		answers []string
+		want    string
+		wantErr bool
+	}{
+		{"full number", []string{"237650000001"}, "237650000001", false},
+		{"local number", []string{"650000001"}, "237650000001", false},
+		{"spaces", []string{"6 50 00 00 01"}, "237650000001", false},
+		{"contact", []string{"@Mama"}, "237670000001", false},
+		{"unknown contact", []string{"@papa"}, "", true},
+		{"landline", []string{"237212345678"}, "", true},
+		{"pick a suggestion", []string{"2376500000011", "2"}, "237650000001", false},
+		{"retype after a suggestion", []string{"65000000O1", "670000002"}, "237670000002", false},
+		{"no answer to a suggestion", []string{"65000000O1"}, "", true},
+		{"no input", nil, "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			withPrompts(t, tt.answers...)
+			got, err := promptPhone()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("promptPhone() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Fatalf("promptPhone() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPromptAmount(t *testing.T) {
+	tests := []struct {
+		answer  string
+		want    int
+		wantErr bool
+	}{
+		{"15000", 15000, false},
+		{"15 000", 15000, false},
+		{"15 000", 15000, false},
+		{"12.500", 12500, false},
+		{"12,500", 12500, false},
+		{"1'000'000", 1000000, false},
+		{"5k", 5000, false},
+		{"1.5k", 1500, false},
+		{"1,5K", 1500, false},
+		{"1.005k", 1005, false},
+		{"2m", 2000000, false},
+		{"2500 XAF", 2500, false},
+		{"2500fcfa", 2500, false},
+		{"1.0005k", 0, true},
+		{"12.50", 0, true},
+		{"1234,567", 0, true},
+		{"0", 0, true},
+		{"-100", 0, true},
+		{"3000000000", 0, true},
+		{"abc", 0, true},
+		{"XAF", 0, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.answer, func(t *testing.T) {
+			p := withPrompts(t, tt.answer)
+			got, err := promptAmount()
+			if len(p.asked) != 1 || p.asked[0] != tr("prompt.amount") {
+				t.Fatalf("asked %q, want one amount prompt", p.asked)
+			}
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("promptAmount() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && exitCode(err) != exitValidation {
+				t.Fatalf("exit code = %d, want %d", exitCode(err), exitValidation)
+			}
+			if got != tt.want {
+				t.Fatalf("promptAmount() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= PROVIDERS =========================
+   ============================================================ */
+
+// Provider is a payment aggregator the CLI can drive. CamPay is the built-in
+// one; others register themselves with RegisterProvider and are selected
+// with "provider" in the config file. Requests and responses use the
+// campay package types as the common shape.
+type Provider interface {
+	Name() string
+	Authenticate(ctx context.Context) error
+	Collect(ctx context.Context, req campay.CollectRequest) (*campay.CollectResponse, error)
+	Withdraw(ctx context.Context, req campay.WithdrawRequest) (*campay.WithdrawResponse, error)
+	Status(ctx context.Context, reference string) (*campay.TransactionResponse, error)
+	VerifyWebhook(r *http.Request) (*campay.WebhookEvent, error)
+}
+
+// balanceProvider is implemented by providers that can report the account
+// balance. Batch payouts skip the balance check for those that cannot.
+type balanceProvider interface {
+	Balance(ctx context.Context) (*campay.BalanceResponse, error)
+}
+
+// ProviderFactory builds an unauthenticated provider from the configuration.
+type ProviderFactory func(cfg *Config) (Provider, error)
+
+var providers = map[string]ProviderFactory{
+	"campay": newCampayProvider,
+}
+
+// RegisterProvider makes a provider available under name.
+func RegisterProvider(name string, factory ProviderFactory) {
+	providers[name] = factory
+}
+
+// newProvider builds the provider named by cfg.Provider (default campay).
+func newProvider(cfg *Config) (Provider, error) {
+	name := cfg.Provider
+	if name == "" {
+		name = "campay"
+	}
+	factory, ok := providers[name]
+	if !ok {
+		names := make([]string, 0, len(providers))
+		for n := range providers {
+			names = append(names, n)
+		}
+		sort.Strings(names)
+		return nil, invalidInput("unknown provider %q (available: %v)", name, names)
+	}
+	return factory(cfg)
+}
+
+// connectProvider builds the configured provider and authenticates it.
+func connectProvider(cfg *Config) (Provider, error) {
+	p, err := newProvider(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	fmt.Println(tr("auth.start"))
+	if err := p.Authenticate(context.Background()); err != nil {
+		var apiErr *campay.APIError
+		if errors.As(err, &apiErr) {
+			return nil, exitErr(exitAuth, fmt.Errorf("%s: %w", tr("auth.failed"), err))
+		}
+		return nil, err
+	}
+	fmt.Println(tr("auth.ok"))
+	return p, nil
+}
+
+// =============================================================
+// CamPay
+// =============================================================
+
+type campayProvider struct {
+	cfg    *Config
+	client *campay.Client
+}
+
+func newCampayProvider(cfg *Config) (Provider, error) {
+	client, err := newClient(cfg)
+	if err != nil {
+		return nil, err
+	}
+	return &campayProvider{cfg: cfg, client: client}, nil
+}
+
+func (p *campayProvider) Name() string { return "campay" }
+
+func (p *campayProvider) Authenticate(ctx context.Context) error {
+	if p.cfg.Username == "" || p.cfg.Password == "" {
+		return exitErr(exitAuth, errors.New(tr("auth.missing")))
+	}
+	if err := p.client.Authenticate(ctx); err != nil {
+		return err
+	}
+	offerSaveCredentials(p.cfg)
+	warnClockSkew(p.client)
+	return nil
+}
+
+func (p *campayProvider) TokenExpiry() time.Time { return p.client.TokenExpiry() }
+
+// warnClockSkew prints a warning when the local clock is far enough from
+// CamPay's to break webhook signature checks.
+func warnClockSkew(client *campay.Client) {
+	if skew, ok := client.ClockSkew(); ok && (skew > maxClockSkew || skew < -maxClockSkew) {
+		fmt.Println(tr("warn.clock_skew", skew.Round(time.Second), maxClockSkew))
+	}
+}
+
+// Collect and Withdraw send the description as the operator can show it;
+// callers keep the original text for the ledger.
+func (p *campayProvider) Collect(ctx context.Context, req campay.CollectRequest) (*campay.CollectResponse, error) {
+	req.Description = outgoingDescription(p.cfg, req.Description, requestOperator(req.Operator, req.From))
+	return p.client.Collect(ctx, req)
+}
+
+func (p *campayProvider) Withdraw(ctx context.Context, req campay.WithdrawRequest) (*campay.WithdrawResponse, error) {
+	req.Description = outgoingDescription(p.cfg, req.Description, requestOperator(req.Operator, req.To))
+	return p.client.Withdraw(ctx, req)
+}
+
+func (p *campayProvider) Status(ctx context.Context, reference string) (*campay.TransactionResponse, error) {
+	return p.client.Transaction(ctx, reference)
+}
+
+func (p *campayProvider) Balance(ctx context.Context) (*campay.BalanceResponse, error) {
+	return p.client.Balance(ctx)
+}
+
+func (p *campayProvider) VerifyWebhook(r *http.Request) (*campay.WebhookEvent, error) {
+	return campay.ParseWebhook(r, p.cfg.WebhookKey, p.cfg.PreviousWebhookKey)
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= READ-ONLY MODE ======================
+   ============================================================ */
+
+// With read_only set (--read-only, CAMPAY_READ_ONLY, or "read_only": true
+// in the config file or a profile), nothing moves money: collect, session,
+// withdraw-batch, batch resume, run, split, transfer and jobs submit stop
+// before they prompt or lock anything, with the read_only exit code. The
+// client itself is made read-only too (campay.Options.ReadOnly), so the
+// daemon, the dashboard and campay api cannot slip past. Status, history,
+// search, reports and exports work as usual.
+//
+// It is a safety catch for auditors and new staff, not access control:
+// whoever holds the credentials can turn it off. On the daemon API,
+// read-only API keys (apikey create --read-only) are.
+
+// refuseReadOnly fails the command what when read-only mode is on.
+func refuseReadOnly(cfg *Config, what string) error {
+	if !cfg.ReadOnly {
+		return nil
+	}
+	return exitErr(exitReadOnly, fmt.Errorf("%w: %s moves money and is refused; status, history, search, reports and exports still work", campay.ErrReadOnly, what))
+}
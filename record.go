@@ -0,0 +1,67 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ====================== RECORD AND REPLAY ====================
+   ============================================================ */
+
+// With --record, every client made in this run stores its API calls in
+// one cassette, saved when the command ends. With --replay, they answer
+// from a saved cassette instead of the network. See campay.Cassette.
+var (
+	cassette     *campay.Cassette
+	cassettePath string
+	replaying    bool
+)
+
+// openCassette sets up --record or --replay. A replay needs no
+// credentials, since the cassette has none.
+func openCassette(cfg *Config, record, replay string) error {
+	switch {
+	case record != "" && replay != "":
+		return invalidInput("--record and --replay cannot be combined")
+	case record != "":
+		cassette, cassettePath = campay.NewCassette(), record
+	case replay != "":
+		c, err := campay.LoadCassette(replay)
+		if err != nil {
+			return exitErr(exitValidation, err)
+		}
+		cassette, replaying = c, true
+		if cfg.Username == "" || cfg.Password == "" {
+			cfg.Username, cfg.Password = "REDACTED", "REDACTED"
+		}
+		fmt.Fprintf(os.Stderr, "Replaying %d recorded API calls from %s\n", len(c.Interactions), replay)
+	}
+	return nil
+}
+
+// useCassette installs the recorder or the replayer on client. It goes
+// last, closest to the network.
+func useCassette(client *campay.Client) {
+	switch {
+	case cassette == nil:
+	case replaying:
+		client.Use(campay.Replay(cassette))
+	default:
+		client.Use(campay.Record(cassette))
+	}
+}
+
+// saveCassette writes the recorded calls at the end of the run.
+func saveCassette() {
+	if cassette == nil || replaying {
+		return
+	}
+	if err := cassette.Save(cassettePath); err != nil {
+		fmt.Fprintln(os.Stderr, "⚠ Failed to save the cassette:", err)
+		return
+	}
+	fmt.Fprintf(os.Stderr, "Recorded %d API calls to %s (credentials redacted, phone numbers masked)\n", len(cassette.Interactions), cassettePath)
+}
@@ -0,0 +1,320 @@
+package main
+
+import (
+	"crypto/rand"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   =================== EXTERNAL REFERENCES =====================
+   ============================================================ */
+
+// A reference format makes the external references of one shop (profile)
+// recognizable in CamPay's dashboard, e.g. "SHOPA-{date}-{seq:4}". Literal
+// text is copied; placeholders are:
+//
+//	{date}     today as 20260131      {time}   now as 140509
+//	{unix}     Unix seconds           {profile} the active profile
+//	{seq}      counter, {seq:4} zero-padded to 4 digits
+//	{rand:N}   N random characters from 0-9 and A-Z
+//
+// A format needs {seq} or {rand:N} so that references stay unique.
+
+// refPart is a literal (placeholder "") or a placeholder with its width.
+type refPart struct {
+	literal     string
+	placeholder string
+	width       int
+}
+
+type refFormat struct {
+	raw     string
+	parts   []refPart
+	pattern *regexp.Regexp // matches rendered references; group "seq" if any
+}
+
+var refPlaceholder = regexp.MustCompile(`\{(\w+)(?::(\d+))?\}`)
+
+func parseRefFormat(raw, profile string) (*refFormat, error) {
+	f := &refFormat{raw: raw}
+	var expr strings.Builder
+	expr.WriteString("^")
+	unique := false
+	last := 0
+	for _, m := range refPlaceholder.FindAllStringSubmatchIndex(raw, -1) {
+		if m[0] > last {
+			f.parts = append(f.parts, refPart{literal: raw[last:m[0]]})
+			expr.WriteString(regexp.QuoteMeta(raw[last:m[0]]))
+		}
+		last = m[1]
+
+		p := refPart{placeholder: raw[m[2]:m[3]]}
+		if m[4] >= 0 {
+			p.width, _ = strconv.Atoi(raw[m[4]:m[5]])
+		}
+		switch p.placeholder {
+		case "date":
+			expr.WriteString(`\d{8}`)
+		case "time":
+			expr.WriteString(`\d{6}`)
+		case "unix":
+			expr.WriteString(`\d+`)
+		case "profile":
+			p = refPart{literal: profile}
+			expr.WriteString(regexp.QuoteMeta(profile))
+		case "seq":
+			if strings.Contains(expr.String(), "(?P<seq>") {
+				return nil, invalidInput("reference format %q: {seq} may appear once", raw)
+			}
+			expr.WriteString(fmt.Sprintf(`(?P<seq>\d{%d,})`, max(p.width, 1)))
+			unique = true
+		case "rand":
+			if p.width < 1 {
+				return nil, invalidInput("reference format %q: {rand} needs a length, e.g. {rand:6}", raw)
+			}
+			expr.WriteString(fmt.Sprintf(`[0-9A-Z]{%d}`, p.width))
+			unique = true
+		default:
+			return nil, invalidInput("reference format %q: unknown placeholder {%s}", raw, p.placeholder)
+		}
+		f.parts = append(f.parts, p)
+	}
+	if last < len(raw) {
+		f.parts = append(f.parts, refPart{literal: raw[last:]})
+		expr.WriteString(regexp.QuoteMeta(raw[last:]))
+	}
+	expr.WriteString("$")
+	if !unique {
+		return nil, invalidInput("reference format %q needs {seq} or {rand:N} to keep references unique", raw)
+	}
+	f.pattern = regexp.MustCompile(expr.String())
+	return f, nil
+}
+
+const refAlphabet = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZ"
+
+// render builds a reference for now and seq.
+func (f *refFormat) render(now time.Time, seq int) string {
+	var b strings.Builder
+	for _, p := range f.parts {
+		switch p.placeholder {
+		case "":
+			b.WriteString(p.literal)
+		case "date":
+			b.WriteString(now.Format("20060102"))
+		case "time":
+			b.WriteString(now.Format("150405"))
+		case "unix":
+			b.WriteString(strconv.FormatInt(now.Unix(), 10))
+		case "seq":
+			b.WriteString(fmt.Sprintf("%0*d", max(p.width, 1), seq))
+		case "rand":
+			buf := make([]byte, p.width)
+			rand.Read(buf)
+			for i := range buf {
+				buf[i] = refAlphabet[int(buf[i])%len(refAlphabet)]
+			}
+			b.Write(buf)
+		}
+	}
+	return b.String()
+}
+
+// seqStem returns ref with its counter replaced, so references that differ
+// only in the counter (same shop, same day) share a stem, and the counter.
+func (f *refFormat) seqStem(ref string) (stem string, seq int, ok bool) {
+	m := f.pattern.FindStringSubmatchIndex(ref)
+	i := f.pattern.SubexpIndex("seq")
+	if m == nil || i < 0 || m[2*i] < 0 {
+		return "", 0, false
+	}
+	seq, _ = strconv.Atoi(ref[m[2*i]:m[2*i+1]])
+	return ref[:m[2*i]] + "#" + ref[m[2*i+1]:], seq, true
+}
+
+// refAllocator generates and checks external references for one run.
+// Without a format, references come from the configured RefGenerator:
+// ULIDs prefixed with the command's kind (TXN-01J…) by default. A nil
+// allocator uses those defaults and accepts any reference.
+type refAllocator struct {
+	format    *refFormat
+	generator campay.RefGenerator // nil for prefixed ULIDs
+
+	mu      sync.Mutex
+	used    map[string]bool
+	lastSeq map[string]int // highest counter per stem
+}
+
+// newRefAllocator compiles the active profile's reference format and
+// loads the references already in the ledger, to avoid reusing them. ULIDs
+// need no such check.
+func newRefAllocator(cfg *Config, ledger *Ledger) (*refAllocator, error) {
+	a := &refAllocator{generator: cfg.RefGenerator, used: map[string]bool{}, lastSeq: map[string]int{}}
+	if cfg.RefFormat == "" && cfg.RefGenerator == nil {
+		return a, nil
+	}
+	if cfg.RefFormat != "" {
+		profile := cfg.Profile
+		if profile == "" {
+			profile = "default"
+		}
+		var err error
+		if a.format, err = parseRefFormat(cfg.RefFormat, profile); err != nil {
+			return nil, err
+		}
+	}
+
+	entries, err := ledger.Entries()
+	if err != nil {
+		return nil, err
+	}
+	for _, e := range entries {
+		a.reserve(e.ExternalReference)
+	}
+	return a, nil
+}
+
+func (a *refAllocator) reserve(ref string) {
+	if ref == "" {
+		return
+	}
+	a.used[ref] = true
+	if a.format == nil {
+		return
+	}
+	if stem, seq, ok := a.format.seqStem(ref); ok && seq > a.lastSeq[stem] {
+		a.lastSeq[stem] = seq
+	}
+}
+
+// Generate returns a new reference in the configured format, never one
+// already in the ledger or handed out by this run. Without a format the
+// reference comes from the generator; prefix (TXN, PAY, JOB) is put in
+// front of the default ULIDs.
+func (a *refAllocator) Generate(prefix string) (string, error) {
+	if a == nil {
+		return prefixedULID(prefix)
+	}
+	a.mu.Lock()
+	defer a.mu.Unlock()
+
+	if a.format == nil {
+		for attempt := 0; attempt < 3; attempt++ {
+			ref, err := prefixedULID(prefix)
+			if a.generator != nil {
+				ref, err = a.generator.NewRef()
+			}
+			if err != nil {
+				return "", fmt.Errorf("failed to generate an external reference: %w", err)
+			}
+			if !a.used[ref] {
+				a.reserve(ref)
+				return ref, nil
+			}
+		}
+		return "", errors.New("the reference generator keeps returning references already used")
+	}
+
+	now := time.Now()
+	stem, _, _ := a.format.seqStem(a.format.render(now, 0))
+	first := a.lastSeq[stem] + 1
+	for seq := first; seq < first+1000; seq++ {
+		ref := a.format.render(now, seq)
+		if !a.used[ref] {
+			a.reserve(ref)
+			return ref, nil
+		}
+	}
+	return "", fmt.Errorf("no unused reference left in the format %s; widen its {rand:N}", a.format.raw)
+}
+
+func prefixedULID(prefix string) (string, error) {
+	id, err := campay.ULID().NewRef()
+	return prefix + "-" + id, err
+}
+
+// Check rejects a reference given by hand that does not follow the
+// configured format.
+func (a *refAllocator) Check(ref string) error {
+	if a == nil || a.format == nil || a.format.pattern.MatchString(ref) {
+		return nil
+	}
+	return invalidInput("external reference %q does not follow the format %s of this profile", ref, a.format.raw)
+}
+
+// refGenerators are the generators "ref_generator" in the config file can
+// name, besides an http(s) URL.
+var refGenerators = map[string]campay.RefGenerator{
+	"ulid": nil, // the default, prefixed by each command
+}
+
+// RegisterRefGenerator makes a generator, e.g. backed by a database
+// sequence, available as "ref_generator": name.
+func RegisterRefGenerator(name string, g campay.RefGenerator) {
+	refGenerators[name] = g
+}
+
+// newRefGenerator resolves the "ref_generator" setting. nil means the
+// default prefixed ULIDs.
+func newRefGenerator(spec string) (campay.RefGenerator, error) {
+	if spec == "" {
+		return nil, nil
+	}
+	if strings.HasPrefix(spec, "http://") || strings.HasPrefix(spec, "https://") {
+		return &httpRefGenerator{url: spec}, nil
+	}
+	g, ok := refGenerators[spec]
+	if !ok {
+		return nil, invalidInput("unknown ref_generator %q (use ulid, a URL or a registered name)", spec)
+	}
+	return g, nil
+}
+
+// httpRefGenerator asks a sequence service for each reference: a POST to
+// url answered with the reference as plain text or {"reference": "…"}.
+type httpRefGenerator struct {
+	url string
+}
+
+func (g *httpRefGenerator) NewRef() (string, error) {
+	req, err := http.NewRequest(http.MethodPost, g.url, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	client := &http.Client{Timeout: 5 * time.Second}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	if err != nil {
+		return "", err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("%s answered %d", g.url, resp.StatusCode)
+	}
+	var obj struct {
+		Reference string `json:"reference"`
+	}
+	ref := strings.TrimSpace(string(body))
+	if json.Unmarshal(body, &obj) == nil {
+		ref = obj.Reference
+	}
+	if ref == "" {
+		return "", fmt.Errorf("%s returned no reference", g.url)
+	}
+	return ref, nil
+}
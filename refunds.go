@@ -0,0 +1,205 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== REFUNDS ==========================
+   ============================================================ */
+
+// A refund is a payout marked Refund in the ledger: a withdraw-batch row
+// with a refund_of column, or a refund or reversal imported by sync.
+// RefundOf names the collection it returns, by reference or external
+// reference. Only successful transactions count towards revenue.
+
+// refundedCollection is a collection with the refunds paired to it.
+type refundedCollection struct {
+	Collection LedgerEntry
+	Refunds    []LedgerEntry
+}
+
+func (c *refundedCollection) Refunded() int {
+	total := 0
+	for _, r := range c.Refunds {
+		total += r.Amount
+	}
+	return total
+}
+
+func (c *refundedCollection) Net() int {
+	return c.Collection.Amount - c.Refunded()
+}
+
+// Flag explains what finance should look at, or "".
+func (c *refundedCollection) Flag() string {
+	var flags []string
+	if len(c.Refunds) > 1 {
+		flags = append(flags, fmt.Sprintf("refunded %d times", len(c.Refunds)))
+	}
+	if excess := c.Refunded() - c.Collection.Amount; excess > 0 {
+		flags = append(flags, fmt.Sprintf("%d XAF more than collected", excess))
+	}
+	return strings.Join(flags, ", ")
+}
+
+// refundedAmounts totals the refunds that did not fail by the reference or
+// external reference they name, counting pending ones so the same amount
+// is not paid back twice.
+func refundedAmounts(entries []LedgerEntry) map[string]int {
+	refunded := map[string]int{}
+	for _, e := range entries {
+		if e.Refund && e.RefundOf != "" && !unsuccessful(e.Status) && !e.Status.Abandoned() {
+			refunded[e.RefundOf] += e.Amount
+		}
+	}
+	return refunded
+}
+
+// refundPairing is the result of pairRefunds.
+type refundPairing struct {
+	Collections []*refundedCollection // oldest first
+	Orphans     []LedgerEntry         // refunds whose collection is unknown
+}
+
+// pairRefunds pairs the successful refunds in entries with the successful
+// collections they return. When several collections share an external
+// reference (invoice installments), a refund naming it pairs with the
+// latest of them.
+func pairRefunds(entries []LedgerEntry) refundPairing {
+	var p refundPairing
+	byRef := map[string]*refundedCollection{}
+	byExternal := map[string]*refundedCollection{}
+	for _, e := range entries {
+		if e.Kind != "collect" || e.Status != campay.StatusSuccessful {
+			continue
+		}
+		c := &refundedCollection{Collection: e}
+		p.Collections = append(p.Collections, c)
+		byRef[e.Reference] = c
+		if e.ExternalReference != "" {
+			byExternal[e.ExternalReference] = c
+		}
+	}
+
+	for _, e := range entries {
+		if !e.Refund || e.Status != campay.StatusSuccessful {
+			continue
+		}
+		c := byRef[e.RefundOf]
+		if c == nil {
+			c = byExternal[e.RefundOf]
+		}
+		if e.RefundOf == "" || c == nil {
+			p.Orphans = append(p.Orphans, e)
+			continue
+		}
+		c.Refunds = append(c.Refunds, e)
+	}
+	return p
+}
+
+// revenueOptions are the flags of revenue.
+type revenueOptions struct {
+	since string
+	until string
+	all   bool
+}
+
+// revenueFlags defines the flags of revenue on fs.
+func revenueFlags(fs *flag.FlagSet, cfg *Config) *revenueOptions {
+	opt := &revenueOptions{}
+	fs.StringVar(&opt.since, "since", "30d", "collections created after: 7d, 12h or a date like 2026-01-31")
+	fs.StringVar(&opt.until, "until", "", "collections created before: 7d, 12h or a date")
+	fs.BoolVar(&opt.all, "all", false, "list every collection, not only refunded ones")
+	return opt
+}
+
+// runRevenue reports collections net of their refunds, so finance sees
+// revenue rather than gross flows.
+func runRevenue(cfg *Config, args []string) error {
+	fs := newFlagSet("revenue")
+	opt := revenueFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+
+	var from, to time.Time
+	var err error
+	if opt.since != "" {
+		if from, err = parseSince(opt.since); err != nil {
+			return err
+		}
+	}
+	if opt.until != "" {
+		if to, err = parseSince(opt.until); err != nil {
+			return err
+		}
+	}
+	inPeriod := func(t time.Time) bool {
+		return !t.Before(from) && (to.IsZero() || t.Before(to))
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	entries, err := ledger.Entries()
+	if err != nil {
+		return err
+	}
+	pairing := pairRefunds(entries)
+
+	tbl := newTable("No collection in this period",
+		tableColumn{Name: "Created"},
+		tableColumn{Name: "Reference"},
+		tableColumn{Name: "Phone"},
+		tableColumn{Name: "Collected", Amount: true},
+		tableColumn{Name: "Refunded", Amount: true},
+		tableColumn{Name: "Net", Amount: true},
+		tableColumn{Name: "Flag"},
+		tableColumn{Name: "External ref", Wide: true},
+	)
+	var gross, refunded, flagged int
+	for _, c := range pairing.Collections {
+		e := c.Collection
+		if !inPeriod(e.CreatedAt) {
+			continue
+		}
+		gross += e.Amount
+		refunded += c.Refunded()
+		if c.Flag() != "" {
+			flagged++
+		}
+		if opt.all || len(c.Refunds) > 0 {
+			tbl.Row(e.CreatedAt, e.Reference, displayPhone(e.Phone), e.Amount, c.Refunded(), c.Net(), c.Flag(), e.ExternalReference)
+		}
+	}
+	orphans := 0
+	for _, r := range pairing.Orphans {
+		if !inPeriod(r.CreatedAt) {
+			continue
+		}
+		orphans++
+		refunded += r.Amount
+		flag := "refund without origin"
+		if r.RefundOf != "" {
+			flag = fmt.Sprintf("refund of unknown %s", r.RefundOf)
+		}
+		tbl.Row(r.CreatedAt, r.Reference, displayPhone(r.Phone), 0, r.Amount, -r.Amount, flag, r.ExternalReference)
+	}
+
+	tbl.Footer("Gross %s, refunds %s, net %s", formatAmount(gross, "XAF"), formatAmount(refunded, "XAF"), formatAmount(gross-refunded, "XAF"))
+	if flagged > 0 || orphans > 0 {
+		tbl.Footer("⚠ %d collection(s) refunded more than once or in excess, %d refund(s) without a known origin", flagged, orphans)
+	}
+	return tbl.Print()
+}
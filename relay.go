@@ -0,0 +1,215 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= WEBHOOK RELAY =======================
+   ============================================================ */
+
+// RelayEvent is the normalized event forwarded to internal services.
+type RelayEvent struct {
+	ID                string        `json:"id"`
+	Type              string        `json:"type"`
+	Reference         string        `json:"reference"`
+	ExternalReference string        `json:"external_reference"`
+	Status            string        `json:"status"`
+	Amount            campay.Amount `json:"amount"`
+	Currency          string        `json:"currency"`
+	Operator          string        `json:"operator"`
+	Code              string        `json:"code"`
+	OperatorReference string        `json:"operator_reference"`
+	Phone             string        `json:"phone"`
+	ReceivedAt        time.Time     `json:"received_at"`
+
+	// Synthesized events, such as EXPIRED, were not sent by CamPay
+	Synthesized bool   `json:"synthesized,omitempty"`
+	Reason      string `json:"reason,omitempty"`
+}
+
+func newRelayEvent(ev *campay.WebhookEvent) RelayEvent {
+	amount, _ := campay.ParseAmount(ev.Amount)
+	status := string(parseStatus(ev.Status))
+	return RelayEvent{
+		ID:                ev.Reference + ":" + status,
+		Type:              "transaction.status",
+		Reference:         ev.Reference,
+		ExternalReference: ev.ExternalReference,
+		Status:            status,
+		Amount:            amount,
+		Currency:          ev.Currency,
+		Operator:          ev.Operator,
+		Code:              ev.Code,
+		OperatorReference: ev.OperatorReference,
+		Phone:             ev.PhoneNumber,
+		ReceivedAt:        time.Now().UTC(),
+	}
+}
+
+// ledgerRelayEvent builds the event for a status change found locally,
+// e.g. by the sweeper, rather than received from CamPay.
+func ledgerRelayEvent(e LedgerEntry) RelayEvent {
+	return RelayEvent{
+		ID:                e.Reference + ":" + string(e.Status),
+		Type:              "transaction.status",
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Status:            string(e.Status),
+		Amount:            campay.Amount(e.Amount),
+		Currency:          e.Currency,
+		Operator:          e.Operator,
+		Phone:             e.Phone,
+		ReceivedAt:        time.Now().UTC(),
+	}
+}
+
+// relaySecrets holds the HMAC secret of each relay destination: the
+// relay_secrets of the config file, keyed by URL prefix, the longest
+// match winning, and a fallback (--relay-secret or RELAY_SECRET) for the
+// other destinations.
+type relaySecrets struct {
+	byPrefix map[string]string
+	fallback string
+}
+
+// newRelaySecrets checks the relay_secrets of the config file.
+func newRelaySecrets(fc map[string]string) (relaySecrets, error) {
+	for prefix, secret := range fc {
+		if err := validCallbackURL(prefix); err != nil {
+			return relaySecrets{}, fmt.Errorf("relay_secrets: %q is not an http(s) URL", prefix)
+		}
+		if secret == "" {
+			return relaySecrets{}, fmt.Errorf("relay_secrets: %s has an empty secret", prefix)
+		}
+	}
+	return relaySecrets{byPrefix: fc}, nil
+}
+
+// withFallback returns s signing destinations it has no secret for with
+// fallback.
+func (s relaySecrets) withFallback(fallback string) relaySecrets {
+	s.fallback = fallback
+	return s
+}
+
+// For returns the secret of dest, or "" when it has none.
+func (s relaySecrets) For(dest string) string {
+	best, secret := -1, s.fallback
+	for prefix, v := range s.byPrefix {
+		if strings.HasPrefix(dest, prefix) && len(prefix) > best {
+			best, secret = len(prefix), v
+		}
+	}
+	return secret
+}
+
+// missing returns an error naming the first of dests without a secret.
+func (s relaySecrets) missing(dests ...string) error {
+	for _, dest := range dests {
+		if s.For(dest) == "" {
+			return fmt.Errorf("no relay secret for %s (relay_secrets in the config file, --relay-secret or RELAY_SECRET)", dest)
+		}
+	}
+	return nil
+}
+
+// Relay forwards events to downstream URLs, signing each body with the
+// HMAC-SHA256 secret of its destination and the time of sending (see
+// campay.VerifyRelaySignature). Bodies for destinations without a secret
+// are sent unsigned.
+type Relay struct {
+	destinations []string
+	secrets      relaySecrets
+	maxAttempts  int
+	http         *http.Client
+
+	wg sync.WaitGroup
+}
+
+func newRelay(destinations []string, secrets relaySecrets) *Relay {
+	return &Relay{
+		destinations: destinations,
+		secrets:      secrets,
+		maxAttempts:  5,
+		http:         &http.Client{Timeout: 10 * time.Second},
+	}
+}
+
+// Forward delivers ev to every destination in the background.
+func (r *Relay) Forward(ev RelayEvent) {
+	body, err := json.Marshal(ev)
+	if err != nil {
+		fmt.Println("⚠ Relay: failed to encode event:", err)
+		return
+	}
+
+	for _, dest := range r.destinations {
+		r.wg.Add(1)
+		go func(dest string) {
+			defer r.wg.Done()
+			if err := r.deliver(dest, body); err != nil {
+				fmt.Printf("❌ Relay: could not deliver %s to %s: %v\n", ev.ID, dest, err)
+				enqueueNotification(notifyRelay, dest, body, err)
+			}
+		}(dest)
+	}
+}
+
+// Wait blocks until in-flight deliveries finish.
+func (r *Relay) Wait() {
+	r.wg.Wait()
+}
+
+// deliver posts body to dest, retrying with exponential backoff.
+func (r *Relay) deliver(dest string, body []byte) error {
+	backoff := time.Second
+	var lastErr error
+	for attempt := 1; attempt <= r.maxAttempts; attempt++ {
+		if attempt > 1 {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+		if lastErr = r.post(dest, body); lastErr == nil {
+			return nil
+		}
+	}
+	return lastErr
+}
+
+// post makes a single signed delivery attempt.
+func (r *Relay) post(dest string, body []byte) error {
+	req, err := http.NewRequest("POST", dest, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	if secret := r.secrets.For(dest); secret != "" {
+		now := time.Now()
+		req.Header.Set(campay.RelayTimestampHeader, strconv.FormatInt(now.Unix(), 10))
+		req.Header.Set(campay.RelaySignatureHeader, campay.SignRelay(body, secret, now))
+	}
+
+	resp, err := r.http.Do(req)
+	if err != nil {
+		return err
+	}
+	io.Copy(io.Discard, resp.Body)
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("destination answered %d", resp.StatusCode)
+	}
+	return nil
+}
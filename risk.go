@@ -0,0 +1,171 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== RISK RULES =========================
+   ============================================================ */
+
+// RiskRules limit what a single run may move. Zero limits are disabled.
+// Daily limits count today's pending and successful ledger entries of the
+// same kind (collect or withdraw).
+type RiskRules struct {
+	MaxAmount         int      `json:"max_amount"`
+	MaxPerPhonePerDay int      `json:"max_per_phone_per_day"`
+	MaxTotalPerDay    int      `json:"max_total_per_day"`
+	Blocklist         []string `json:"blocklist"`
+}
+
+// riskCheck tracks today's running totals so that consecutive checks in
+// one run (e.g. batch rows) count against the same limits.
+type riskCheck struct {
+	rules   RiskRules
+	kind    string
+	blocked map[string]bool
+
+	mu         sync.Mutex
+	phoneToday map[string]int
+	totalToday int
+}
+
+func newRiskCheck(rules RiskRules, ledger *Ledger, kind string) (*riskCheck, error) {
+	entries, err := ledger.Entries()
+	if err != nil {
+		return nil, err
+	}
+	return riskCheckOf(rules, entries, kind), nil
+}
+
+// riskCheckOf is newRiskCheck with today's totals taken from entries.
+func riskCheckOf(rules RiskRules, entries []LedgerEntry, kind string) *riskCheck {
+	rc := &riskCheck{
+		rules:      rules,
+		kind:       kind,
+		blocked:    map[string]bool{},
+		phoneToday: map[string]int{},
+	}
+	for _, p := range rules.Blocklist {
+		if phone, err := normalizePhone(p); err == nil {
+			rc.blocked[phone] = true
+		}
+	}
+
+	now := time.Now()
+	for _, e := range entries {
+		if e.Kind != kind || e.Source == transferSource || !sameDay(e.CreatedAt, now) {
+			continue
+		}
+		if unsuccessful(e.Status) || e.Status.Abandoned() {
+			continue
+		}
+		rc.phoneToday[e.Phone] += e.Amount
+		rc.totalToday += e.Amount
+	}
+	return rc
+}
+
+// violations lists every rule phone/amount would break.
+func (rc *riskCheck) violations(phone string, amount int) []string {
+	var v []string
+	if rc.blocked[phone] {
+		v = append(v, fmt.Sprintf("%s is on the blocklist", phone))
+	}
+	if max := rc.rules.MaxAmount; max > 0 && amount > max {
+		v = append(v, fmt.Sprintf("amount %d exceeds the per-transaction limit of %d XAF", amount, max))
+	}
+	if max := rc.rules.MaxPerPhonePerDay; max > 0 && rc.phoneToday[phone]+amount > max {
+		v = append(v, fmt.Sprintf("%s would reach %d XAF today (limit %d)", phone, rc.phoneToday[phone]+amount, max))
+	}
+	if max := rc.rules.MaxTotalPerDay; max > 0 && rc.totalToday+amount > max {
+		v = append(v, fmt.Sprintf("today's %s total would reach %d XAF (limit %d)", rc.kind, rc.totalToday+amount, max))
+	}
+	return v
+}
+
+// Enforce returns an error if the operation breaks a rule, unless force is
+// set, in which case the override is written to the audit log. Allowed
+// amounts are added to the running totals.
+func (rc *riskCheck) Enforce(phone string, amount int, force bool) error {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+
+	if v := rc.violations(phone, amount); len(v) > 0 {
+		if !force {
+			return exitErr(exitRiskBlocked, fmt.Errorf("blocked by risk rules: %s (use --force to override)", strings.Join(v, "; ")))
+		}
+
+		fmt.Printf("⚠ Overriding risk rules: %s\n", strings.Join(v, "; "))
+		err := appendAudit(AuditEvent{
+			Action: "risk_override",
+			Details: map[string]any{
+				"kind":       rc.kind,
+				"phone":      phone,
+				"amount":     amount,
+				"violations": v,
+			},
+		})
+		if err != nil {
+			return fmt.Errorf("refusing to override without an audit entry: %w", err)
+		}
+	}
+
+	rc.phoneToday[phone] += amount
+	rc.totalToday += amount
+	return nil
+}
+
+// defaultDuplicateWindow is how far back collect looks for a possible
+// duplicate of the payment about to be requested.
+const defaultDuplicateWindow = 10 * time.Minute
+
+// recentDuplicate returns the latest pending or successful collection of
+// amount from phone created within window, or nil.
+func recentDuplicate(ledger *Ledger, phone string, amount int, window time.Duration) (*LedgerEntry, error) {
+	entries, err := ledger.Entries()
+	if err != nil {
+		return nil, err
+	}
+	since := time.Now().Add(-window)
+	var found *LedgerEntry
+	for i, e := range entries {
+		if e.Kind != "collect" || e.Phone != phone || e.Amount != amount || e.CreatedAt.Before(since) {
+			continue
+		}
+		if e.Status != campay.StatusPending && e.Status != campay.StatusSuccessful {
+			continue
+		}
+		if found == nil || e.CreatedAt.After(found.CreatedAt) {
+			found = &entries[i]
+		}
+	}
+	return found, nil
+}
+
+// confirmDuplicate asks before collecting amount from phone again when
+// the ledger shows the same collection within window. Declining cancels.
+func confirmDuplicate(ledger *Ledger, phone string, amount int, window time.Duration) error {
+	if window <= 0 {
+		return nil
+	}
+	dup, err := recentDuplicate(ledger, phone, amount, window)
+	if err != nil || dup == nil {
+		return err
+	}
+	ago := time.Since(dup.CreatedAt).Round(time.Second)
+	fmt.Println(tr("duplicate.warning", formatAmount(amount, "XAF"), phone, ago, dup.Reference, statusLabel(string(dup.Status))))
+	answer, err := promptUser(tr("duplicate.confirm"))
+	if err != nil {
+		return err
+	}
+	if a := strings.ToLower(answer); a != "y" && a != "yes" {
+		return exitErr(exitCancelled, fmt.Errorf("possible duplicate of %s not confirmed", dup.Reference))
+	}
+	return nil
+}
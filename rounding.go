@@ -0,0 +1,114 @@
+package main
+
+import (
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+/* ============================================================
+   ========================= ROUNDING ==========================
+   ============================================================ */
+
+// Rounding decides what happens to fractions of a franc wherever an
+// amount is derived rather than typed: percentage cuts of splits and
+// plans, installments of an invoice and converted amounts on display. The
+// arithmetic is exact (big.Rat), so the only francs gained or lost are
+// the ones the policy rounds away.
+//
+// The zero value is the default: francs are rounded down, as before the
+// setting existed, and converted amounts to the nearest cent.
+type Rounding string
+
+const (
+	roundDown     Rounding = "down"      // towards zero, never pays out more than the share
+	roundUp       Rounding = "up"        // away from zero
+	roundHalfEven Rounding = "half-even" // to the nearest, ties to even (banker's rounding)
+)
+
+func parseRounding(s string) (Rounding, error) {
+	switch r := Rounding(s); r {
+	case "", roundDown, roundUp, roundHalfEven:
+		return r, nil
+	}
+	return "", invalidInput("rounding must be down, up or half-even, not %q", s)
+}
+
+// roundRat rounds x to a whole number according to r.
+func (r Rounding) roundRat(x *big.Rat) *big.Int {
+	num, den := x.Num(), x.Denom()
+	q, m := new(big.Int).QuoRem(num, den, new(big.Int)) // truncated towards zero
+	if m.Sign() == 0 {
+		return q
+	}
+	away := big.NewInt(int64(x.Sign()))
+	switch r {
+	case roundUp:
+		return q.Add(q, away)
+	case roundHalfEven:
+		// Compare twice the remainder with the denominator
+		twice := new(big.Int).Abs(m)
+		twice.Lsh(twice, 1)
+		switch c := twice.Cmp(den); {
+		case c > 0, c == 0 && q.Bit(0) == 1:
+			return q.Add(q, away)
+		}
+	}
+	return q
+}
+
+// Round rounds x to a whole number of francs.
+func (r Rounding) Round(x *big.Rat) int {
+	return int(r.roundRat(x).Int64())
+}
+
+// RoundTo rounds x to the given number of decimals, for display.
+func (r Rounding) RoundTo(x *big.Rat, decimals int) string {
+	if r == "" {
+		r = roundHalfEven
+	}
+	scale := new(big.Rat).SetInt(new(big.Int).Exp(big.NewInt(10), big.NewInt(int64(decimals)), nil))
+	scaled := new(big.Rat).Mul(x, scale)
+	rounded := new(big.Rat).SetInt(r.roundRat(scaled))
+	return rounded.Quo(rounded, scale).FloatString(decimals)
+}
+
+// exactRat reads a decimal number ("12.5", "33.333") without going
+// through a binary float. Fractions and exponents are not accepted.
+func exactRat(s string) (*big.Rat, bool) {
+	if s == "" || strings.ContainsAny(s, "/eE") {
+		return nil, false
+	}
+	return new(big.Rat).SetString(s)
+}
+
+// floatRat is exactRat of the shortest decimal form of f, so a percentage
+// of 12.3 from a JSON config is 123/10 and not its binary approximation.
+func floatRat(f float64) *big.Rat {
+	x, _ := exactRat(strconv.FormatFloat(f, 'f', -1, 64))
+	return x
+}
+
+// PercentOf returns percent (e.g. 12.5 for 12.5%) of amount.
+func (r Rounding) PercentOf(amount int, percent *big.Rat) int {
+	x := new(big.Rat).Mul(big.NewRat(int64(amount), 100), percent)
+	return r.Round(x)
+}
+
+// Installments splits total into n parts that add up to total and differ
+// by at most a franc. Each cut point (the sum of the first i parts) is
+// rounded by r, which decides whether the extra francs come first (up) or
+// last (down).
+func (r Rounding) Installments(total, n int) []int {
+	if n < 1 {
+		return nil
+	}
+	parts := make([]int, n)
+	prev := 0
+	for i := range parts {
+		cut := r.Round(big.NewRat(int64(total)*int64(i+1), int64(n)))
+		parts[i] = cut - prev
+		prev = cut
+	}
+	return parts
+}
@@ -0,0 +1,130 @@
+package main
+
+import (
+	"fmt"
+	"math/big"
+	"slices"
+	"testing"
+)
+
+func TestRoundRat(t *testing.T) {
+	tests := []struct {
+		r        Rounding
+		num, den int64
+		want     int64
+	}{
+		{"", 5, 2, 2},
+		{"", -5, 2, -2},
+		{roundDown, 7, 3, 2},
+		{roundDown, -7, 3, -2},
+		{roundDown, 4, 1, 4},
+		{roundUp, 5, 2, 3},
+		{roundUp, -5, 2, -3},
+		{roundUp, 1, 3, 1},
+		{roundUp, -1, 3, -1},
+		{roundUp, 4, 1, 4},
+		{roundHalfEven, 1, 2, 0},
+		{roundHalfEven, 3, 2, 2},
+		{roundHalfEven, 5, 2, 2},
+		{roundHalfEven, 7, 2, 4},
+		{roundHalfEven, -1, 2, 0},
+		{roundHalfEven, -5, 2, -2},
+		{roundHalfEven, -7, 2, -4},
+		{roundHalfEven, 4, 3, 1},
+		{roundHalfEven, 5, 3, 2},
+		{roundHalfEven, -5, 3, -2},
+		{roundHalfEven, 0, 1, 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d/%d", tt.r, tt.num, tt.den), func(t *testing.T) {
+			got := tt.r.roundRat(big.NewRat(tt.num, tt.den))
+			if got.Int64() != tt.want {
+				t.Fatalf("roundRat(%d/%d) = %s, want %d", tt.num, tt.den, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestRoundTo(t *testing.T) {
+	tests := []struct {
+		r    Rounding
+		x    *big.Rat
+		want string
+	}{
+		{"", big.NewRat(1, 8), "0.12"}, // display defaults to half-even
+		{roundHalfEven, big.NewRat(3, 8), "0.38"},
+		{roundUp, big.NewRat(1, 8), "0.13"},
+		{roundDown, big.NewRat(-1, 8), "-0.12"},
+		{roundHalfEven, big.NewRat(2, 3), "0.67"},
+	}
+	for _, tt := range tests {
+		if got := tt.r.RoundTo(tt.x, 2); got != tt.want {
+			t.Errorf("%q.RoundTo(%s, 2) = %s, want %s", tt.r, tt.x, got, tt.want)
+		}
+	}
+}
+
+func TestInstallments(t *testing.T) {
+	tests := []struct {
+		r        Rounding
+		total, n int
+		want     []int
+	}{
+		{roundDown, 100, 3, []int{33, 33, 34}},
+		{roundUp, 100, 3, []int{34, 33, 33}},
+		{roundHalfEven, 100, 3, []int{33, 34, 33}},
+		{roundDown, 10, 4, []int{2, 3, 2, 3}},
+		{roundUp, 10, 4, []int{3, 2, 3, 2}},
+		{roundHalfEven, 10, 4, []int{2, 3, 3, 2}},
+		{roundDown, 2, 3, []int{0, 1, 1}},
+		{roundDown, 90, 3, []int{30, 30, 30}},
+		{roundDown, 99, 1, []int{99}},
+		{roundDown, 100, 0, nil},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %d/%d", tt.r, tt.total, tt.n), func(t *testing.T) {
+			got := tt.r.Installments(tt.total, tt.n)
+			if !slices.Equal(got, tt.want) {
+				t.Fatalf("Installments(%d, %d) = %v, want %v", tt.total, tt.n, got, tt.want)
+			}
+			sum := 0
+			for _, p := range got {
+				sum += p
+			}
+			if len(got) > 0 && (sum != tt.total || slices.Max(got)-slices.Min(got) > 1) {
+				t.Fatalf("Installments(%d, %d) = %v: parts must add up and differ by at most 1", tt.total, tt.n, got)
+			}
+		})
+	}
+}
+
+func TestPercentOf(t *testing.T) {
+	tests := []struct {
+		r       Rounding
+		amount  int
+		percent string
+		want    int
+	}{
+		{roundDown, 1000, "12.5", 125},
+		{roundDown, 999, "12.5", 124},
+		{roundUp, 999, "12.5", 125},
+		{roundHalfEven, 999, "12.5", 125},
+		{roundHalfEven, 100, "2.5", 2},
+		{roundHalfEven, 300, "2.5", 8},
+		{roundDown, 1000, "33.333", 333},
+		{roundUp, 1000, "33.333", 334},
+		{roundDown, 1000, "100", 1000},
+		{roundUp, 1000, "0", 0},
+	}
+	for _, tt := range tests {
+		t.Run(fmt.Sprintf("%s %s%% of %d", tt.r, tt.percent, tt.amount), func(t *testing.T) {
+			percent, ok := exactRat(tt.percent)
+			if !ok {
+				t.Fatalf("exactRat(%q) failed", tt.percent)
+			}
+			if got := tt.r.PercentOf(tt.amount, percent); got != tt.want {
+				t.Fatalf("PercentOf(%d, %s) = %d, want %d", tt.amount, tt.percent, got, tt.want)
+			}
+		})
+	}
+}
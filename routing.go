@@ -0,0 +1,144 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ====================== PAYOUT ROUTING =======================
+   ============================================================ */
+
+// Routing modes for payouts whose operator balance is too low.
+const (
+	routeNone     = "none"     // stop before paying anyone
+	routeFailover = "failover" // pay the whole row to the payee's alternate number
+	routeSplit    = "split"    // pay what the operator can cover, the rest to the alternate number
+)
+
+// RoutingRules is the payout_routing section of the config file.
+type RoutingRules struct {
+	Mode string `json:"mode"` // none, failover or split
+
+	// Reserve is kept untouched on each operator ("MTN", "ORANGE").
+	Reserve map[string]int `json:"reserve,omitempty"`
+}
+
+func validRouteMode(mode string) bool {
+	return mode == routeNone || mode == routeFailover || mode == routeSplit
+}
+
+// operatorBalances returns what each operator can pay out after the
+// configured reserve.
+func operatorBalances(b *campay.BalanceResponse, reserve map[string]int) map[string]int {
+	available := map[string]int{
+		"MTN":    int(b.MTNBalance) - reserve["MTN"],
+		"ORANGE": int(b.OrangeBalance) - reserve["ORANGE"],
+	}
+	for op, v := range available {
+		if v < 0 {
+			available[op] = 0
+		}
+	}
+	return available
+}
+
+// routePayouts assigns each row to an operator balance. Rows the payee's
+// own operator cannot cover are moved, in mode failover or split, to the
+// alternate number from the alt_phone column. It returns the rows to pay,
+// whether any were rerouted, and the operators still short. Rows with an
+// unknown operator are only checked against the total balance.
+func routePayouts(rows []batchRow, available map[string]int, mode string) (routed []batchRow, changed bool, short map[string]int) {
+	left := map[string]int{}
+	for op, v := range available {
+		left[op] = v
+	}
+
+	// Rows that cannot move are charged first, so rerouting only uses
+	// what they leave.
+	canMove := func(r batchRow) bool {
+		op, alt := r.operator(), operatorFor(r.AltPhone)
+		return mode != routeNone && op != "" && alt != "" && alt != op
+	}
+	for _, r := range rows {
+		if !canMove(r) {
+			left[r.operator()] -= r.Amount
+		}
+	}
+
+	for _, r := range rows {
+		op, alt := r.operator(), operatorFor(r.AltPhone)
+		first := 0
+		if mode == routeSplit {
+			first = max(left[op], 0)
+		}
+		if !canMove(r) || r.Amount <= left[op] || r.Amount-first > left[alt] {
+			if canMove(r) {
+				left[op] -= r.Amount
+			}
+			routed = append(routed, r)
+			continue
+		}
+
+		changed = true
+		moved := r
+		moved.Phone = r.AltPhone
+		moved.Operator = ""
+		moved.Amount = r.Amount - first
+		moved.Route = fmt.Sprintf("%s → %s", op, alt)
+		if first > 0 {
+			part := r
+			part.Amount = first
+			part.ExternalReference = r.ExternalReference + "-1"
+			part.Route = fmt.Sprintf("split %d of %d", first, r.Amount)
+			left[op] -= first
+			routed = append(routed, part)
+
+			moved.ExternalReference = r.ExternalReference + "-2"
+			moved.Route = fmt.Sprintf("split %d of %d, %s → %s", moved.Amount, r.Amount, op, alt)
+		}
+		left[alt] -= moved.Amount
+		routed = append(routed, moved)
+	}
+
+	short = map[string]int{}
+	for _, op := range []string{"MTN", "ORANGE"} {
+		if left[op] < 0 {
+			short[op] = -left[op]
+		}
+	}
+	return routed, changed, short
+}
+
+// printRoutingPlan lists the rerouted rows and the resulting use of each
+// operator balance.
+func printRoutingPlan(rows []batchRow, available map[string]int) {
+	fmt.Println("Payout routing (operator balance too low for some payees):")
+	need := map[string]int{}
+	for _, r := range rows {
+		need[r.operator()] += r.Amount
+		if r.Route != "" {
+			fmt.Printf("  line %-4d %-12s %8d XAF  %s\n", r.Line, displayPhone(r.Phone), r.Amount, r.Route)
+		}
+	}
+	for _, op := range []string{"MTN", "ORANGE"} {
+		fmt.Printf("  %-8s %s of %s\n", op, formatAmount(need[op], ""), formatAmount(available[op], "XAF"))
+	}
+}
+
+// confirmRouting asks before rerouting money, unless yes is set.
+func confirmRouting(yes bool) error {
+	if yes {
+		return nil
+	}
+	answer, err := promptUser("Pay out with this routing? [y/N]: ")
+	if err != nil {
+		return err
+	}
+	if a := strings.ToLower(answer); a != "y" && a != "yes" {
+		return exitErr(exitCancelled, fmt.Errorf("payout routing not confirmed"))
+	}
+	return nil
+}
@@ -0,0 +1,142 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ========================== RUN LOCKS ========================
+   ============================================================ */
+
+// A run lock keeps a second withdraw-batch or daemon off a ledger already
+// in use, e.g. when a cron entry is run twice. It is a file next to the
+// ledger naming the process holding it. Unlike a lease it does not expire,
+// since a batch can run for hours: a lock whose process is gone is
+// recognised on the same host and taken over, and one left by another host
+// is removed with --force-unlock.
+//
+// Replicas of the daemon may share a data directory (see Coordinator), so
+// the daemon's lock is per host: it stops two daemons on one machine, not
+// replicas on several.
+
+// runLock is the content of a run lock file.
+type runLock struct {
+	PID     int       `json:"pid"`
+	Host    string    `json:"host"`
+	Command string    `json:"command"`
+	Started time.Time `json:"started"`
+}
+
+// runLockPath is where the lock named name of the ledger is kept.
+func runLockPath(ledger *Ledger, name string) string {
+	return ledger.path + "." + strings.NewReplacer("/", "_", `\`, "_", ":", "_").Replace(name) + ".lock"
+}
+
+// daemonLockName is the name of the daemon's lock on this host.
+func daemonLockName() string {
+	host, _ := os.Hostname()
+	return "daemon-" + host
+}
+
+func readRunLock(path string) (*runLock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var l runLock
+	if err := json.Unmarshal(data, &l); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return &l, nil
+}
+
+// stale reports whether the process holding l is known to be gone: it ran
+// on this host and no longer exists, or has this process's pid, as after
+// a container restart.
+func (l *runLock) stale() bool {
+	host, _ := os.Hostname()
+	return l.Host == host && (l.PID == os.Getpid() || !processAlive(l.PID))
+}
+
+func (l *runLock) String() string {
+	return fmt.Sprintf("pid %d on %s since %s (%s)", l.PID, l.Host, inZone(l.Started).Format("2006-01-02 15:04:05"), zoneLabel(l.Started))
+}
+
+// acquireRunLock takes the lock named name for command, which is reported
+// to a second run, and returns the function releasing it. forceUnlock
+// removes a lock left behind first.
+func acquireRunLock(ledger *Ledger, name, command string, forceUnlock bool) (func(), error) {
+	path := runLockPath(ledger, name)
+	host, _ := os.Hostname()
+	mine := runLock{PID: os.Getpid(), Host: host, Command: command, Started: time.Now().UTC()}
+	data, err := json.Marshal(mine)
+	if err != nil {
+		return nil, err
+	}
+
+	if forceUnlock {
+		held, err := readRunLock(path)
+		switch {
+		case errors.Is(err, os.ErrNotExist):
+		case err != nil:
+			fmt.Fprintf(os.Stderr, "⚠ Removing unreadable lock %s\n", path)
+		case !held.stale() && held.Host == host:
+			fmt.Fprintf(os.Stderr, "⚠ Removing the lock of %s, which looks alive (%s)\n", held.Command, held)
+		default:
+			fmt.Fprintf(os.Stderr, "Removing the lock of %s (%s)\n", held.Command, held)
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+
+	for attempt := 0; attempt < 2; attempt++ {
+		f, err := os.OpenFile(path, os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0600)
+		if err == nil {
+			_, err = f.Write(data)
+			if cerr := f.Close(); err == nil {
+				err = cerr
+			}
+			if err != nil {
+				os.Remove(path)
+				return nil, err
+			}
+			return func() { releaseRunLock(path, mine) }, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return nil, err
+		}
+
+		held, err := readRunLock(path)
+		if errors.Is(err, os.ErrNotExist) {
+			continue // released in between
+		}
+		if err != nil {
+			return nil, exitErr(exitError, fmt.Errorf("%w; if no %s is running, run again with --force-unlock", err, command))
+		}
+		if !held.stale() {
+			return nil, exitErr(exitError, fmt.Errorf("%s already running (%s); wait for it to finish or, if it is gone, run again with --force-unlock",
+				held.Command, held))
+		}
+		fmt.Fprintf(os.Stderr, "Taking over the lock left by %s (%s), which has exited\n", held.Command, held)
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return nil, err
+		}
+	}
+	return nil, exitErr(exitError, fmt.Errorf("another %s took the lock %s first", command, path))
+}
+
+// releaseRunLock removes the lock at path if it is still mine, and not one
+// another run took over with --force-unlock.
+func releaseRunLock(path string, mine runLock) {
+	held, err := readRunLock(path)
+	if err != nil || held.PID != mine.PID || held.Host != mine.Host || !held.Started.Equal(mine.Started) {
+		return
+	}
+	os.Remove(path)
+}
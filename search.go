@@ -0,0 +1,239 @@
+package main
+
+import (
+	"flag"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== SEARCH ===========================
+   ============================================================ */
+
+// searchFilter holds the combinable criteria of `campay search`; zero
+// values match everything.
+type searchFilter struct {
+	Statuses    []campay.Status
+	Phone       string // prefix
+	Kind        string
+	Operator    string
+	ExternalRef string
+	Text        string // substring of the description
+	MinAmount   int
+	MaxAmount   int
+	Since       time.Time
+	Until       time.Time
+}
+
+func (f searchFilter) match(e LedgerEntry) bool {
+	if len(f.Statuses) > 0 {
+		found := false
+		for _, s := range f.Statuses {
+			found = found || e.Status == s
+		}
+		if !found {
+			return false
+		}
+	}
+	switch {
+	case f.Phone != "" && !strings.HasPrefix(e.Phone, f.Phone):
+		return false
+	case f.Kind == "refund" && !e.Refund, f.Kind != "" && f.Kind != "refund" && e.Kind != f.Kind:
+		return false
+	case f.Operator != "" && !strings.EqualFold(e.Operator, f.Operator):
+		return false
+	case f.ExternalRef != "" && e.ExternalReference != f.ExternalRef:
+		return false
+	case f.Text != "" && !strings.Contains(strings.ToLower(e.Description), strings.ToLower(f.Text)):
+		return false
+	case f.MinAmount > 0 && e.Amount < f.MinAmount:
+		return false
+	case f.MaxAmount > 0 && e.Amount > f.MaxAmount:
+		return false
+	case !f.Since.IsZero() && e.CreatedAt.Before(f.Since):
+		return false
+	case !f.Until.IsZero() && !e.CreatedAt.Before(f.Until):
+		return false
+	}
+	return true
+}
+
+// searchColumns are the sortable columns, compared in ascending order.
+var searchColumns = map[string]func(a, b LedgerEntry) int{
+	"created":   func(a, b LedgerEntry) int { return a.CreatedAt.Compare(b.CreatedAt) },
+	"updated":   func(a, b LedgerEntry) int { return a.UpdatedAt.Compare(b.UpdatedAt) },
+	"amount":    func(a, b LedgerEntry) int { return a.Amount - b.Amount },
+	"status":    func(a, b LedgerEntry) int { return strings.Compare(string(a.Status), string(b.Status)) },
+	"phone":     func(a, b LedgerEntry) int { return strings.Compare(a.Phone, b.Phone) },
+	"kind":      func(a, b LedgerEntry) int { return strings.Compare(a.Kind, b.Kind) },
+	"operator":  func(a, b LedgerEntry) int { return strings.Compare(a.Operator, b.Operator) },
+	"reference": func(a, b LedgerEntry) int { return strings.Compare(a.Reference, b.Reference) },
+}
+
+// parseSince accepts a relative age such as 7d, 12h or 30m, or a date
+// like 2026-01-31 (its midnight in the reporting zone).
+func parseSince(s string) (time.Time, error) {
+	if t, err := time.ParseInLocation("2006-01-02", s, reportZone); err == nil {
+		return t, nil
+	}
+	if days, ok := strings.CutSuffix(s, "d"); ok {
+		if n, err := strconv.Atoi(days); err == nil && n >= 0 {
+			return time.Now().AddDate(0, 0, -n), nil
+		}
+	}
+	if d, err := time.ParseDuration(s); err == nil && d >= 0 {
+		return time.Now().Add(-d), nil
+	}
+	return time.Time{}, invalidInput("invalid time %q (use 7d, 12h or a date like 2026-01-31)", s)
+}
+
+// searchOptions are the flags of search.
+type searchOptions struct {
+	status      string
+	phone       string
+	kind        string
+	operator    string
+	externalRef string
+	text        string
+	minAmount   string
+	maxAmount   string
+	since       string
+	until       string
+	sortBy      string
+	limit       int
+}
+
+// searchFlags defines the flags of search on fs.
+func searchFlags(fs *flag.FlagSet, cfg *Config) *searchOptions {
+	opt := &searchOptions{}
+	fs.StringVar(&opt.status, "status", "", "comma-separated statuses, e.g. FAILED,EXPIRED_LOCAL")
+	fs.StringVar(&opt.phone, "phone", "", "phone number or prefix (e.g. 23767) or @contact")
+	fs.StringVar(&opt.kind, "kind", "", "collect, withdraw or refund")
+	fs.StringVar(&opt.operator, "operator", "", "operator, e.g. MTN or ORANGE")
+	fs.StringVar(&opt.externalRef, "external-ref", "", "external reference (order ID)")
+	fs.StringVar(&opt.text, "text", "", "text contained in the description")
+	fs.StringVar(&opt.minAmount, "min-amount", "", "minimum amount, e.g. 5000 or 5k")
+	fs.StringVar(&opt.maxAmount, "max-amount", "", "maximum amount")
+	fs.StringVar(&opt.since, "since", "", "created after: 7d, 12h or a date like 2026-01-31")
+	fs.StringVar(&opt.until, "until", "", "created before: 7d, 12h or a date")
+	fs.StringVar(&opt.sortBy, "sort", "-created", "column to sort by, prefixed with - for descending: created, updated, amount, status, phone, kind, operator, reference")
+	fs.IntVar(&opt.limit, "limit", 0, "show at most this many entries (0 for all)")
+	return opt
+}
+
+// runSearch lists ledger entries matching every given filter.
+func runSearch(cfg *Config, args []string) error {
+	fs := newFlagSet("search")
+	opt := searchFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+
+	var f searchFilter
+	var err error
+	for _, s := range strings.Split(opt.status, ",") {
+		if s = strings.TrimSpace(s); s != "" {
+			f.Statuses = append(f.Statuses, parseStatus(strings.ToUpper(s)))
+		}
+	}
+	switch {
+	case strings.HasPrefix(opt.phone, "@"):
+		if f.Phone, err = resolvePhone(opt.phone); err != nil {
+			return err
+		}
+	case opt.phone != "":
+		// A prefix is not a valid number on its own
+		if f.Phone, err = normalizePhone(opt.phone); err != nil {
+			f.Phone = strings.TrimPrefix(opt.phone, "+")
+		}
+	}
+	if opt.kind != "" && opt.kind != "collect" && opt.kind != "withdraw" && opt.kind != "refund" {
+		return invalidInput("--kind must be collect, withdraw or refund")
+	}
+	f.Kind, f.Operator, f.ExternalRef, f.Text = opt.kind, opt.operator, opt.externalRef, opt.text
+	if opt.minAmount != "" {
+		if f.MinAmount, err = parseAmount(opt.minAmount); err != nil {
+			return err
+		}
+	}
+	if opt.maxAmount != "" {
+		if f.MaxAmount, err = parseAmount(opt.maxAmount); err != nil {
+			return err
+		}
+	}
+	if opt.since != "" {
+		if f.Since, err = parseSince(opt.since); err != nil {
+			return err
+		}
+	}
+	if opt.until != "" {
+		if f.Until, err = parseSince(opt.until); err != nil {
+			return err
+		}
+	}
+
+	column, desc := strings.CutPrefix(opt.sortBy, "-")
+	compare, ok := searchColumns[column]
+	if !ok {
+		return invalidInput("unknown sort column %q", column)
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	entries, err := ledger.Entries()
+	if err != nil {
+		return err
+	}
+
+	var found []LedgerEntry
+	for _, e := range entries {
+		if f.match(e) {
+			found = append(found, e)
+		}
+	}
+	sort.SliceStable(found, func(i, j int) bool {
+		if desc {
+			return compare(found[j], found[i]) < 0
+		}
+		return compare(found[i], found[j]) < 0
+	})
+	if opt.limit > 0 && len(found) > opt.limit {
+		found = found[:opt.limit]
+	}
+
+	tbl := newTable("No matching transaction in the local ledger",
+		tableColumn{Name: "Created"},
+		tableColumn{Name: "Kind"},
+		tableColumn{Name: "Phone"},
+		tableColumn{Name: "Amount", Amount: true},
+		tableColumn{Name: "Operator"},
+		tableColumn{Name: "Status"},
+		tableColumn{Name: "Description", Max: 24},
+		tableColumn{Name: "Reference"},
+		tableColumn{Name: "External ref", Wide: true},
+		tableColumn{Name: "Updated", Wide: true},
+		tableColumn{Name: "Refund of", Wide: true},
+		tableColumn{Name: "Notes", Wide: true},
+	)
+	total := 0
+	for _, e := range found {
+		kind := e.Kind
+		if e.Refund {
+			kind = "refund"
+		}
+		tbl.Row(e.CreatedAt, kind, displayPhone(e.Phone), e.Amount, e.Operator, e.Status, e.Description, e.Reference,
+			e.ExternalReference, e.UpdatedAt, e.RefundOf, formatNotes(e.Notes))
+		total += e.Amount
+	}
+	tbl.Footer("%d transaction(s), %s", len(found), formatAmount(total, "XAF"))
+	return tbl.Print()
+}
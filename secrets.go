@@ -0,0 +1,388 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ====================== SECRET SOURCES =======================
+   ============================================================ */
+
+// SecretProvider fetches a secret holding CamPay credentials as key/value
+// pairs, from a secret manager rather than plaintext environment variables.
+type SecretProvider interface {
+	Name() string
+	Fetch(ctx context.Context, name string) (map[string]string, error)
+}
+
+// SecretsConfig is the secrets section of the config file.
+type SecretsConfig struct {
+	Provider string `json:"provider"` // vault, aws or gcp
+	Name     string `json:"name"`     // Vault path, AWS secret ID or GCP secret version
+
+	// Address overrides the service endpoint (default VAULT_ADDR for Vault,
+	// the public AWS and GCP endpoints otherwise).
+	Address string `json:"address,omitempty"`
+	Region  string `json:"region,omitempty"` // AWS region (default AWS_REGION)
+
+	// Fields maps username, password, webhook_key and previous_webhook_key
+	// to the keys used inside the secret (default APP_USERNAME,
+	// APP_PASSWORD, WEBHOOK_KEY, WEBHOOK_KEY_PREVIOUS).
+	Fields map[string]string `json:"fields,omitempty"`
+}
+
+// SecretProviderFactory builds a secret provider from its configuration.
+type SecretProviderFactory func(sc SecretsConfig) (SecretProvider, error)
+
+var secretProviders = map[string]SecretProviderFactory{
+	"vault": newVaultSecrets,
+	"aws":   newAWSSecrets,
+	"gcp":   newGCPSecrets,
+}
+
+// RegisterSecretProvider makes a secret provider available under name.
+func RegisterSecretProvider(name string, factory SecretProviderFactory) {
+	secretProviders[name] = factory
+}
+
+// secretsTimeout bounds one fetch from a secret manager.
+const secretsTimeout = 15 * time.Second
+
+var secretsHTTP = &http.Client{Timeout: secretsTimeout}
+
+// resolveSecrets fills the credentials from the keychain and the
+// configured secret provider, replacing values from the environment. It
+// runs once, when a command first needs credentials.
+func resolveSecrets(cfg *Config) error {
+	if err := resolveKeychain(cfg); err != nil {
+		return err
+	}
+	sc := cfg.Secrets
+	if sc.Provider == "" || cfg.secretsLoaded {
+		return nil
+	}
+	factory, ok := secretProviders[sc.Provider]
+	if !ok {
+		return invalidInput("unknown secrets provider %q (use vault, aws or gcp)", sc.Provider)
+	}
+	if sc.Name == "" {
+		return invalidInput("secrets.name is required for the %s secrets provider", sc.Provider)
+	}
+	sp, err := factory(sc)
+	if err != nil {
+		return exitErr(exitAuth, err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), secretsTimeout)
+	defer cancel()
+	values, err := sp.Fetch(ctx, sc.Name)
+	if err != nil {
+		return exitErr(exitAuth, fmt.Errorf("failed to fetch %s from %s: %w", sc.Name, sp.Name(), err))
+	}
+
+	field := func(name, def string) string {
+		if key, ok := sc.Fields[name]; ok {
+			return values[key]
+		}
+		return values[def]
+	}
+	// Credentials set by the active profile, or kept in the keychain for
+	// it, keep precedence
+	profile := cfg.Profiles[cfg.Profile]
+	source := "secrets " + sp.Name()
+	if v := field("username", "APP_USERNAME"); v != "" && profile.Username == "" {
+		cfg.Username = v
+		cfg.settings.replaced(source, "username")
+	}
+	if v := field("password", "APP_PASSWORD"); v != "" && profile.Password == "" && !profile.Keychain {
+		cfg.Password = v
+		cfg.settings.replaced(source, "password")
+	}
+	if v := field("webhook_key", "WEBHOOK_KEY"); v != "" && profile.WebhookKey == "" {
+		cfg.WebhookKey = v
+		cfg.PreviousWebhookKey = field("previous_webhook_key", "WEBHOOK_KEY_PREVIOUS")
+		cfg.settings.replaced(source, "webhook_key", "previous_webhook_key")
+	}
+	cfg.secretsLoaded = true
+	return nil
+}
+
+// decodeSecret parses a secret stored as a JSON object of strings.
+func decodeSecret(data []byte) (map[string]string, error) {
+	var raw map[string]any
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return nil, fmt.Errorf("secret is not a JSON object: %w", err)
+	}
+	values := map[string]string{}
+	for k, v := range raw {
+		if s, ok := v.(string); ok {
+			values[k] = s
+		}
+	}
+	return values, nil
+}
+
+// getJSON performs req and decodes a 2xx JSON answer into out.
+func getJSON(req *http.Request, out any) error {
+	resp, err := secretsHTTP.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("%s answered %d: %s", req.URL.Host, resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+	return json.Unmarshal(body, out)
+}
+
+// =============================================================
+// HashiCorp Vault
+// =============================================================
+
+// vaultSecrets reads a KV secret; name is the API path after /v1/, e.g.
+// "secret/data/campay" for KV version 2.
+type vaultSecrets struct {
+	addr, token, namespace string
+}
+
+func newVaultSecrets(sc SecretsConfig) (SecretProvider, error) {
+	addr := sc.Address
+	if addr == "" {
+		addr = os.Getenv("VAULT_ADDR")
+	}
+	if addr == "" {
+		return nil, fmt.Errorf("vault address is not set (secrets.address or VAULT_ADDR)")
+	}
+	token := os.Getenv("VAULT_TOKEN")
+	if token == "" {
+		if home, err := os.UserHomeDir(); err == nil {
+			if data, err := os.ReadFile(filepath.Join(home, ".vault-token")); err == nil {
+				token = strings.TrimSpace(string(data))
+			}
+		}
+	}
+	if token == "" {
+		return nil, fmt.Errorf("no vault token (VAULT_TOKEN or ~/.vault-token)")
+	}
+	return &vaultSecrets{addr: strings.TrimSuffix(addr, "/"), token: token, namespace: os.Getenv("VAULT_NAMESPACE")}, nil
+}
+
+func (v *vaultSecrets) Name() string { return "vault" }
+
+func (v *vaultSecrets) Fetch(ctx context.Context, name string) (map[string]string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", v.addr+"/v1/"+strings.TrimPrefix(name, "/"), nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("X-Vault-Token", v.token)
+	if v.namespace != "" {
+		req.Header.Set("X-Vault-Namespace", v.namespace)
+	}
+
+	var resp struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if err := getJSON(req, &resp); err != nil {
+		return nil, err
+	}
+	// KV version 2 nests the values under data.data
+	var kv2 struct {
+		Data json.RawMessage `json:"data"`
+	}
+	if json.Unmarshal(resp.Data, &kv2) == nil && len(kv2.Data) > 0 && kv2.Data[0] == '{' {
+		return decodeSecret(kv2.Data)
+	}
+	return decodeSecret(resp.Data)
+}
+
+// =============================================================
+// AWS Secrets Manager
+// =============================================================
+
+// awsSecrets calls GetSecretValue with a SigV4-signed request, using the
+// credentials in AWS_ACCESS_KEY_ID, AWS_SECRET_ACCESS_KEY and, for
+// temporary credentials, AWS_SESSION_TOKEN.
+type awsSecrets struct {
+	endpoint, region          string
+	keyID, secret, sessionKey string
+}
+
+func newAWSSecrets(sc SecretsConfig) (SecretProvider, error) {
+	region := sc.Region
+	if region == "" {
+		region = os.Getenv("AWS_REGION")
+	}
+	if region == "" {
+		region = os.Getenv("AWS_DEFAULT_REGION")
+	}
+	if region == "" {
+		return nil, fmt.Errorf("aws region is not set (secrets.region or AWS_REGION)")
+	}
+	a := &awsSecrets{
+		endpoint:   sc.Address,
+		region:     region,
+		keyID:      os.Getenv("AWS_ACCESS_KEY_ID"),
+		secret:     os.Getenv("AWS_SECRET_ACCESS_KEY"),
+		sessionKey: os.Getenv("AWS_SESSION_TOKEN"),
+	}
+	if a.keyID == "" || a.secret == "" {
+		return nil, fmt.Errorf("AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY must be set")
+	}
+	if a.endpoint == "" {
+		a.endpoint = "https://secretsmanager." + region + ".amazonaws.com"
+	}
+	return a, nil
+}
+
+func (a *awsSecrets) Name() string { return "aws" }
+
+func (a *awsSecrets) Fetch(ctx context.Context, name string) (map[string]string, error) {
+	body, _ := json.Marshal(map[string]string{"SecretId": name})
+	req, err := http.NewRequestWithContext(ctx, "POST", a.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "secretsmanager.GetSecretValue")
+	a.sign(req, body, time.Now().UTC())
+
+	var resp struct {
+		SecretString string `json:"SecretString"`
+	}
+	if err := getJSON(req, &resp); err != nil {
+		return nil, err
+	}
+	return decodeSecret([]byte(resp.SecretString))
+}
+
+// sign adds AWS Signature Version 4 headers for the secretsmanager service.
+func (a *awsSecrets) sign(req *http.Request, body []byte, now time.Time) {
+	amzDate := now.Format("20060102T150405Z")
+	day := now.Format("20060102")
+	req.Header.Set("X-Amz-Date", amzDate)
+	if a.sessionKey != "" {
+		req.Header.Set("X-Amz-Security-Token", a.sessionKey)
+	}
+
+	headers := map[string]string{"host": req.URL.Host}
+	for k := range req.Header {
+		headers[strings.ToLower(k)] = strings.TrimSpace(req.Header.Get(k))
+	}
+	names := make([]string, 0, len(headers))
+	for k := range headers {
+		names = append(names, k)
+	}
+	sort.Strings(names)
+	var canonicalHeaders strings.Builder
+	for _, k := range names {
+		canonicalHeaders.WriteString(k + ":" + headers[k] + "\n")
+	}
+	signedHeaders := strings.Join(names, ";")
+
+	bodyHash := sha256.Sum256(body)
+	canonical := strings.Join([]string{
+		req.Method, "/", req.URL.RawQuery, canonicalHeaders.String(), signedHeaders, hex.EncodeToString(bodyHash[:]),
+	}, "\n")
+	canonicalHash := sha256.Sum256([]byte(canonical))
+
+	scope := day + "/" + a.region + "/secretsmanager/aws4_request"
+	toSign := "AWS4-HMAC-SHA256\n" + amzDate + "\n" + scope + "\n" + hex.EncodeToString(canonicalHash[:])
+
+	mac := func(key []byte, data string) []byte {
+		h := hmac.New(sha256.New, key)
+		h.Write([]byte(data))
+		return h.Sum(nil)
+	}
+	key := mac([]byte("AWS4"+a.secret), day)
+	key = mac(key, a.region)
+	key = mac(key, "secretsmanager")
+	key = mac(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		a.keyID, scope, signedHeaders, hex.EncodeToString(mac(key, toSign))))
+}
+
+// =============================================================
+// GCP Secret Manager
+// =============================================================
+
+// gcpSecrets accesses a secret version such as
+// "projects/my-project/secrets/campay/versions/latest". The access token
+// comes from GOOGLE_OAUTH_ACCESS_TOKEN or the GCE/GKE metadata server.
+type gcpSecrets struct {
+	endpoint string
+}
+
+const gcpMetadataToken = "http://metadata.google.internal/computeMetadata/v1/instance/service-accounts/default/token"
+
+func newGCPSecrets(sc SecretsConfig) (SecretProvider, error) {
+	endpoint := sc.Address
+	if endpoint == "" {
+		endpoint = "https://secretmanager.googleapis.com"
+	}
+	return &gcpSecrets{endpoint: strings.TrimSuffix(endpoint, "/")}, nil
+}
+
+func (g *gcpSecrets) Name() string { return "gcp" }
+
+func (g *gcpSecrets) token(ctx context.Context) (string, error) {
+	if t := os.Getenv("GOOGLE_OAUTH_ACCESS_TOKEN"); t != "" {
+		return t, nil
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", gcpMetadataToken, nil)
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Metadata-Flavor", "Google")
+	var resp struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := getJSON(req, &resp); err != nil {
+		return "", fmt.Errorf("no GOOGLE_OAUTH_ACCESS_TOKEN and the metadata server is unavailable: %w", err)
+	}
+	return resp.AccessToken, nil
+}
+
+func (g *gcpSecrets) Fetch(ctx context.Context, name string) (map[string]string, error) {
+	token, err := g.token(ctx)
+	if err != nil {
+		return nil, err
+	}
+	req, err := http.NewRequestWithContext(ctx, "GET", g.endpoint+"/v1/"+strings.TrimPrefix(name, "/")+":access", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	var resp struct {
+		Payload struct {
+			Data string `json:"data"`
+		} `json:"payload"`
+	}
+	if err := getJSON(req, &resp); err != nil {
+		return nil, err
+	}
+	data, err := base64.StdEncoding.DecodeString(resp.Payload.Data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid secret payload: %w", err)
+	}
+	return decodeSecret(data)
+}
@@ -0,0 +1,324 @@
+package main
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strconv"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ======================== SELF-UPDATE ========================
+   ============================================================ */
+
+// Releases are described by a manifest, published next to the binaries:
+//
+//	{
+//	  "channels": {
+//	    "stable": {"version": "v1.4.0", "assets": {
+//	      "linux/amd64": {"url": "https://…/campay-linux-amd64", "sha256": "9f86d0…"}
+//	    }},
+//	    "beta": {…}
+//	  }
+//	}
+//
+// and signed with ed25519: <manifest URL>.sig holds the base64 signature
+// of the manifest bytes. The checksum of each binary is in the signed
+// manifest, so a binary that verifies was published by the key holder.
+// Without a key nothing is known of the publisher, and installing needs
+// --insecure.
+
+// The release manifest and the key it is signed with, set at build time:
+//
+//	go build -ldflags "-X main.updateURL=https://… -X main.updatePublicKey=<base64>"
+//
+// The config file's "update" section may set them as well.
+var (
+	updateURL       = ""
+	updatePublicKey = ""
+)
+
+// UpdateConfig overrides where `self-update` looks for releases.
+type UpdateConfig struct {
+	URL       string `json:"url,omitempty"`
+	Channel   string `json:"channel,omitempty"`    // stable (default) or beta
+	PublicKey string `json:"public_key,omitempty"` // base64 ed25519 key
+}
+
+type releaseAsset struct {
+	URL    string `json:"url"`
+	SHA256 string `json:"sha256"`
+}
+
+type release struct {
+	Version string                  `json:"version"`
+	Notes   string                  `json:"notes,omitempty"`
+	Assets  map[string]releaseAsset `json:"assets"`
+}
+
+type releaseManifest struct {
+	Channels map[string]release `json:"channels"`
+}
+
+var updateClient = &http.Client{Timeout: 5 * time.Minute}
+
+func fetchRelease(url string, limit int64) ([]byte, error) {
+	req, err := http.NewRequest(http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", userAgent())
+	resp, err := updateClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("%s answered %d", url, resp.StatusCode)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, limit+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > limit {
+		return nil, fmt.Errorf("%s is larger than %d bytes", url, limit)
+	}
+	return data, nil
+}
+
+// loadManifest fetches the manifest and checks its signature when a
+// public key is known.
+func loadManifest(url, publicKey string) (*releaseManifest, bool, error) {
+	data, err := fetchRelease(url, 1<<20)
+	if err != nil {
+		return nil, false, err
+	}
+	signed := false
+	if publicKey != "" {
+		key, err := base64.StdEncoding.DecodeString(publicKey)
+		if err != nil || len(key) != ed25519.PublicKeySize {
+			return nil, false, fmt.Errorf("the update public key is not a base64 ed25519 key")
+		}
+		sig, err := fetchRelease(url+".sig", 1<<10)
+		if err != nil {
+			return nil, false, fmt.Errorf("failed to fetch the manifest signature: %w", err)
+		}
+		sig, err = base64.StdEncoding.DecodeString(strings.TrimSpace(string(sig)))
+		if err != nil || !ed25519.Verify(key, data, sig) {
+			return nil, false, errors.New("the release manifest signature does not verify; not updating")
+		}
+		signed = true
+	}
+	var m releaseManifest
+	if err := json.Unmarshal(data, &m); err != nil {
+		return nil, false, fmt.Errorf("failed to parse the release manifest: %w", err)
+	}
+	return &m, signed, nil
+}
+
+// compareVersions compares two versions such as v1.4.0 and v1.5.0-beta.2:
+// numbers first, then a release sorts after its pre-releases.
+func compareVersions(a, b string) int {
+	split := func(v string) ([]int, string) {
+		v = strings.TrimPrefix(v, "v")
+		v, pre, _ := strings.Cut(v, "-")
+		var nums []int
+		for _, p := range strings.Split(v, ".") {
+			n, _ := strconv.Atoi(p)
+			nums = append(nums, n)
+		}
+		for len(nums) < 3 {
+			nums = append(nums, 0)
+		}
+		return nums, pre
+	}
+	an, ap := split(a)
+	bn, bp := split(b)
+	for i := 0; i < len(an) && i < len(bn); i++ {
+		if an[i] != bn[i] {
+			return an[i] - bn[i]
+		}
+	}
+	switch {
+	case ap == bp:
+		return 0
+	case ap == "":
+		return 1
+	case bp == "":
+		return -1
+	}
+	return strings.Compare(ap, bp)
+}
+
+// replaceExecutable swaps the running binary for data. The old binary is
+// moved aside first, which also works on Windows, where a running
+// executable cannot be overwritten but can be renamed.
+func replaceExecutable(data []byte) (string, error) {
+	exe, err := os.Executable()
+	if err != nil {
+		return "", err
+	}
+	if exe, err = filepath.EvalSymlinks(exe); err != nil {
+		return "", err
+	}
+	info, err := os.Stat(exe)
+	if err != nil {
+		return "", err
+	}
+
+	dir := filepath.Dir(exe)
+	tmp, err := os.CreateTemp(dir, ".campay-update-*")
+	if err != nil {
+		return "", fmt.Errorf("cannot write next to %s: %w", exe, err)
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return "", err
+	}
+	if err := tmp.Close(); err != nil {
+		return "", err
+	}
+	if err := os.Chmod(tmp.Name(), info.Mode().Perm()|0500); err != nil {
+		return "", err
+	}
+
+	old := exe + ".old"
+	os.Remove(old)
+	if err := os.Rename(exe, old); err != nil {
+		return "", err
+	}
+	if err := os.Rename(tmp.Name(), exe); err != nil {
+		os.Rename(old, exe)
+		return "", err
+	}
+	os.Remove(old) // fails on Windows while running; removed by the next update
+	return exe, nil
+}
+
+// selfUpdateOptions are the flags of self-update.
+type selfUpdateOptions struct {
+	channel  string
+	check    bool
+	force    bool
+	yes      bool
+	insecure bool
+}
+
+// selfUpdateFlags defines the flags of self-update on fs.
+func selfUpdateFlags(fs *flag.FlagSet, cfg *Config) *selfUpdateOptions {
+	opt := &selfUpdateOptions{}
+	fs.StringVar(&opt.channel, "channel", cfg.Update.Channel, "release channel: stable or beta")
+	fs.BoolVar(&opt.check, "check", false, "only report whether an update is available")
+	fs.BoolVar(&opt.force, "force", false, "install even if the release is not newer")
+	fs.BoolVar(&opt.yes, "yes", false, "update without asking")
+	fs.BoolVar(&opt.insecure, "insecure", false, "install without a verified signature when no update public key is configured (checksum only)")
+	return opt
+}
+
+// runSelfUpdate replaces the binary with the latest release of a channel,
+// after checking the manifest signature and the binary's checksum.
+func runSelfUpdate(cfg *Config, args []string) error {
+	fs := newFlagSet("self-update")
+	opt := selfUpdateFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if opt.channel == "" {
+		opt.channel = "stable"
+	}
+	if opt.channel != "stable" && opt.channel != "beta" {
+		return invalidInput("--channel must be stable or beta")
+	}
+
+	url, publicKey := updateURL, updatePublicKey
+	if cfg.Update.URL != "" {
+		url = cfg.Update.URL
+	}
+	if cfg.Update.PublicKey != "" {
+		publicKey = cfg.Update.PublicKey
+	}
+	if url == "" {
+		return invalidInput("no release manifest configured; set \"update\": {\"url\": …} in the config file")
+	}
+
+	manifest, signed, err := loadManifest(url, publicKey)
+	if err != nil {
+		return err
+	}
+	rel, ok := manifest.Channels[opt.channel]
+	if !ok || rel.Version == "" {
+		return fmt.Errorf("no %s release in %s", opt.channel, url)
+	}
+	current := buildVersion()
+	newer := current == "dev" || compareVersions(rel.Version, current) > 0
+	fmt.Printf("Installed: %s\nLatest %s: %s\n", current, opt.channel, rel.Version)
+	if rel.Notes != "" {
+		fmt.Println(rel.Notes)
+	}
+	if current == "dev" {
+		fmt.Println("⚠ This is a development build; its version cannot be compared")
+	}
+	if !newer && !opt.force {
+		fmt.Println("✓ Up to date")
+		return nil
+	}
+	if opt.check {
+		fmt.Printf("Update available: campay self-update --channel %s\n", opt.channel)
+		return nil
+	}
+
+	platform := runtime.GOOS + "/" + runtime.GOARCH
+	asset, ok := rel.Assets[platform]
+	if !ok {
+		return fmt.Errorf("release %s has no binary for %s", rel.Version, platform)
+	}
+	want, err := hex.DecodeString(asset.SHA256)
+	if err != nil || len(want) != sha256.Size {
+		return fmt.Errorf("release %s has no valid sha256 for %s", rel.Version, platform)
+	}
+	if !signed {
+		if !opt.insecure {
+			return invalidInput("no update public key configured, so the release cannot be verified; set \"update\": {\"public_key\": …} in the config file, or pass --insecure to trust the manifest's checksum alone")
+		}
+		fmt.Println("⚠ --insecure: no signature verified, only the checksum from the manifest")
+	}
+
+	if !opt.yes {
+		answer, err := promptUser(fmt.Sprintf("Install %s (%s)? [y/N]: ", rel.Version, opt.channel))
+		if err != nil {
+			return err
+		}
+		if a := strings.ToLower(answer); a != "y" && a != "yes" {
+			return exitErr(exitCancelled, errors.New("update cancelled"))
+		}
+	}
+
+	fmt.Printf("Downloading %s...\n", asset.URL)
+	data, err := fetchRelease(asset.URL, 256<<20)
+	if err != nil {
+		return err
+	}
+	if sum := sha256.Sum256(data); !bytes.Equal(sum[:], want) {
+		return fmt.Errorf("checksum mismatch for %s; not updating", asset.URL)
+	}
+	path, err := replaceExecutable(data)
+	if err != nil {
+		return fmt.Errorf("failed to replace the binary: %w", err)
+	}
+	fmt.Printf("✓ Updated %s to %s\n", path, rel.Version)
+	return nil
+}
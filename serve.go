@@ -0,0 +1,206 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   =========================== SERVE ===========================
+   ============================================================ */
+
+// stringList collects the values of a repeatable flag.
+type stringList []string
+
+func (l *stringList) String() string { return strings.Join(*l, ",") }
+
+func (l *stringList) Set(s string) error {
+	*l = append(*l, s)
+	return nil
+}
+
+// serveOptions are the flags of serve.
+type serveOptions struct {
+	addr        string
+	webhookPath string
+	webhookKey  string
+	previousKey string
+	relaySecret string
+	forward     stringList
+	sweepAfter  time.Duration
+	sweepEvery  time.Duration
+	readySLA    time.Duration
+}
+
+// serveFlags defines the flags of serve on fs.
+func serveFlags(fs *flag.FlagSet, cfg *Config) *serveOptions {
+	opt := &serveOptions{}
+	fs.StringVar(&opt.addr, "addr", ":8080", "listen address")
+	fs.StringVar(&opt.webhookPath, "webhook-path", "/webhook", "path CamPay calls back on")
+	fs.StringVar(&opt.webhookKey, "webhook-key", cfg.WebhookKey, "CamPay app webhook key used to verify callbacks")
+	fs.StringVar(&opt.previousKey, "previous-webhook-key", cfg.PreviousWebhookKey, "key being rotated out, still accepted on callbacks (see webhook rotate-key)")
+	fs.StringVar(&opt.relaySecret, "relay-secret", os.Getenv("RELAY_SECRET"), "HMAC secret used to sign forwarded events to destinations without one in relay_secrets")
+	fs.Var(&opt.forward, "forward", "URL to relay verified events to (repeatable)")
+	fs.DurationVar(&opt.sweepAfter, "sweep-after", 0, "expire ledger entries still pending after this long, after checking the API (0 disables)")
+	fs.DurationVar(&opt.sweepEvery, "sweep-every", 5*time.Minute, "how often to look for stale pending entries")
+	fs.DurationVar(&opt.readySLA, "ready-sla", 3*time.Second, "/readyz fails when CamPay takes longer than this to answer")
+	return opt
+}
+
+func runServe(cfg *Config, args []string) error {
+	if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
+	fs := newFlagSet("serve")
+	opt := serveFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	if opt.webhookKey == "" {
+		return invalidInput("a webhook key is required (--webhook-key or WEBHOOK_KEY)")
+	}
+	secrets := cfg.RelaySecrets.withFallback(opt.relaySecret)
+	if err := secrets.missing(opt.forward...); err != nil {
+		return invalidInput("--forward: %v", err)
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	subscribeExpiry(ledger, secrets)
+
+	pc := *cfg
+	pc.WebhookKey = opt.webhookKey
+	pc.PreviousWebhookKey = opt.previousKey
+	provider, err := newProvider(&pc)
+	if err != nil {
+		return err
+	}
+
+	var relay *Relay
+	if len(opt.forward) > 0 {
+		relay = newRelay(opt.forward, secrets)
+	}
+
+	handleWebhook := func(w http.ResponseWriter, r *http.Request) {
+		ev, err := provider.VerifyWebhook(r)
+		if err != nil {
+			fmt.Println("⚠ Rejected webhook:", err)
+			status := http.StatusBadRequest
+			if errors.Is(err, campay.ErrInvalidSignature) {
+				status = http.StatusUnauthorized
+			}
+			writeJSONError(w, status, err)
+			return
+		}
+
+		fmt.Printf("📩 Webhook: %s %s\n", ev.Reference, parseStatus(ev.Status))
+		if ev.PreviousKey {
+			fmt.Println("⚠ Signed with the previous webhook key; CamPay does not use the new key yet")
+		}
+		if err := ledger.UpdateStatus(ev.Reference, parseStatus(ev.Status), ev.Operator); err != nil {
+			fmt.Println("⚠ Failed to update ledger:", err)
+		}
+		if relay != nil {
+			relay.Forward(newRelayEvent(ev))
+		}
+		w.WriteHeader(http.StatusOK)
+	}
+
+	// Webhooks need no credentials; readiness checks CamPay only with them
+	ready := &readiness{ledger: ledger, sla: opt.readySLA, cache: readyCache}
+	if pc.Username != "" {
+		var mu sync.Mutex
+		authenticated := false
+		ready.provider = func(ctx context.Context) (Provider, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			if !authenticated {
+				if err := provider.Authenticate(ctx); err != nil {
+					return nil, err
+				}
+				authenticated = true
+			}
+			return provider, nil
+		}
+	}
+
+	api := apiSpec{
+		Title:       "CamPay webhook gateway",
+		Description: "Receives CamPay callbacks and serves payment status pages (campay serve).",
+		Routes: []apiRoute{
+			{Method: "GET", Path: "/healthz", Summary: "Liveness: the process is up", Handler: handleHealthz, Response: healthStatus{}},
+			{Method: "GET", Path: "/readyz", Summary: "Readiness: ledger writable, token valid, CamPay answering (503 and Retry-After while not)",
+				Handler: ready.handleReadyz, Response: readyStatus{}},
+			{Method: "GET", Path: "/metrics", Summary: "Prometheus metrics: notification queue, dead letters and operator failure rates", Handler: handleMetrics(cfg, ledger),
+				Produces: "text/plain", Errors: []int{http.StatusInternalServerError}},
+			{Method: "GET", Path: "/pay/{ref}", Summary: "Payment status page", Handler: handlePayPage(ledger),
+				Produces: "text/html", Errors: []int{http.StatusNotFound}},
+			{Method: "GET", Path: "/pay/{ref}/events", Summary: "Server-sent status events, each data line a PayStatus", Handler: handlePayEvents(ledger),
+				Produces: "text/event-stream", Response: payStatus{}, Errors: []int{http.StatusNotFound}},
+			{Path: opt.webhookPath, Summary: "CamPay payment callback", Handler: handleWebhook,
+				Params: campay.WebhookEvent{}, Errors: []int{http.StatusBadRequest, http.StatusUnauthorized}},
+		},
+	}
+	mux := http.NewServeMux()
+	api.register(mux)
+
+	server := &http.Server{Addr: opt.addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+
+	if opt.sweepAfter > 0 {
+		coord, err := openCoordinator()
+		if err != nil {
+			return err
+		}
+		sw := &sweeper{
+			ledger:   ledger,
+			grace:    opt.sweepAfter,
+			provider: func() (Provider, error) { return connectProvider(&pc) },
+			coord:    coord,
+		}
+		if relay != nil {
+			sw.notify = func(e LedgerEntry) { relay.Forward(ledgerRelayEvent(e)) }
+		}
+		go sw.run(ctx, opt.sweepEvery)
+	}
+
+	errCh := make(chan error, 1)
+	go func() { errCh <- server.ListenAndServe() }()
+	fmt.Printf("Listening on %s (webhook at %s, payment pages at /pay/<reference>)\n", opt.addr, opt.webhookPath)
+	if relay != nil {
+		fmt.Printf("Relaying events to %s\n", opt.forward.String())
+	}
+
+	select {
+	case err := <-errCh:
+		return err
+	case <-ctx.Done():
+	}
+
+	fmt.Println("\nShutting down...")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+	if err := server.Shutdown(shutdownCtx); err != nil {
+		return err
+	}
+	if relay != nil {
+		relay.Wait()
+	}
+	return nil
+}
@@ -0,0 +1,384 @@
+package main
+
+import (
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== SESSION ==========================
+   ============================================================ */
+
+// session lets a cashier take payments one after another with a single
+// authentication: after each final status it asks for the next number,
+// keeps a running total, and prints a summary of the session when the
+// cashier types q, presses Ctrl-D or Ctrl-C. A payment that fails or is
+// refused (risk rules, limits, a duplicate not confirmed) does not end
+// the session.
+
+// sessionPayment is one payment sent to CamPay during a session.
+type sessionPayment struct {
+	At        time.Time
+	Phone     string
+	Amount    int
+	Reference string        // empty when the request never reached CamPay
+	Status    campay.Status // as last recorded in the ledger
+}
+
+type cashierSession struct {
+	cfg             *Config
+	provider        Provider
+	ledger          *Ledger
+	refs            *refAllocator
+	descTemplate    string
+	duplicateWindow time.Duration
+	force           bool
+
+	mu       sync.Mutex
+	started  time.Time
+	payments []sessionPayment
+	inFlight string // reference being waited for
+}
+
+// sessionOptions are the flags of session.
+type sessionOptions struct {
+	descTemplate    string
+	force           bool
+	duplicateWindow time.Duration
+}
+
+// sessionFlags defines the flags of session on fs.
+func sessionFlags(fs *flag.FlagSet, cfg *Config) *sessionOptions {
+	opt := &sessionOptions{}
+	fs.StringVar(&opt.descTemplate, "description-template", cfg.DescriptionTemplate, "description template for every payment (prompted for each one if empty)")
+	fs.BoolVar(&opt.force, "force", false, "override risk rules (recorded in the audit log)")
+	fs.DurationVar(&opt.duplicateWindow, "duplicate-window", defaultDuplicateWindow, "ask before collecting the same amount from the same number again within this time (0 disables)")
+	fs.DurationVar(&cfg.Deadline, "confirm-deadline", cfg.Deadline, "time each customer has to confirm, e.g. 3m")
+	return opt
+}
+
+func runSession(cfg *Config, args []string) error {
+	fs := newFlagSet("session")
+	opt := sessionFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "session"); err != nil {
+		return err
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+	if outputFormat != "text" {
+		return invalidInput("session is interactive; use collect --stdin for JSON results")
+	}
+	if cfg.Deadline <= 0 {
+		return invalidInput("--confirm-deadline must be positive")
+	}
+
+	fmt.Println(tr("banner"))
+	fmt.Printf("%s\n\n", tr("environment", cfg.Env))
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	provider, err := connectProvider(cfg)
+	if err != nil {
+		return err
+	}
+	refs, err := newRefAllocator(cfg, ledger)
+	if err != nil {
+		return err
+	}
+	s := &cashierSession{cfg: cfg, provider: provider, ledger: ledger, refs: refs, descTemplate: opt.descTemplate,
+		duplicateWindow: opt.duplicateWindow, force: opt.force, started: time.Now()}
+
+	// Ctrl-C ends the session too, even while a customer is confirming
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+	go func() {
+		<-sig
+		fmt.Println()
+		code := s.printSummary()
+		flushOutput()
+		os.Exit(code)
+	}()
+
+	// Input that ends at any question ends the session, not a network
+	// error that happens to wrap io.EOF
+	input := &sessionPrompter{Prompter: prompts}
+	prompts = input
+	defer func() { prompts = input.Prompter }()
+
+	fmt.Println(tr("session.start"))
+	for {
+		fmt.Println()
+		answer, err := promptUser(tr("session.prompt.phone"))
+		if input.eof {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		if q := strings.ToLower(answer); q == "q" || q == "quit" || q == "exit" {
+			break
+		}
+		phone, err := resolveTypedPhone(answer)
+		if err == nil {
+			err = s.collect(phone)
+		}
+		if input.eof {
+			break
+		}
+		if err != nil {
+			reportError(err)
+		}
+		if count, _, failed, _, total := s.totals(); count > 0 {
+			fmt.Println(tr("session.running", count, formatAmount(total, "XAF"), failed))
+		}
+	}
+	fmt.Println()
+	s.printSummary()
+	return nil
+}
+
+// sessionPrompter notes when the input ends.
+type sessionPrompter struct {
+	Prompter
+	eof bool
+}
+
+func (p *sessionPrompter) Ask(prompt string) (string, error) {
+	answer, err := p.Prompter.Ask(prompt)
+	if errors.Is(err, io.EOF) {
+		p.eof = true
+	}
+	return answer, err
+}
+
+// collect takes one payment from phone, asking for the amount and, without
+// a template, the description.
+func (s *cashierSession) collect(phone string) error {
+	cfg, ledger := s.cfg, s.ledger
+	operator, err := chooseOperator(cfg, ledger, phone, "")
+	if err != nil {
+		return err
+	}
+	warnOutage(cfg, ledger, operator)
+
+	var amount int
+	for {
+		amount, err = promptAmount()
+		if err == nil {
+			err = checkLimitsFor(cfg.OperatorLimits, operator, amount)
+		}
+		if err == nil || exitCode(err) != exitValidation {
+			break
+		}
+		reportError(err)
+	}
+	if err != nil {
+		return err
+	}
+	if converted := cfg.FX.Convert(float64(amount)); converted != "" {
+		fmt.Println(tr("amount.converted", formatAmount(amount, "XAF"), converted))
+	}
+
+	// Today's totals change with every payment of the session
+	risk, err := newRiskCheck(cfg.Risk, ledger, "collect")
+	if err != nil {
+		return err
+	}
+	if err := risk.Enforce(phone, amount, s.force); err != nil {
+		return err
+	}
+	if err := confirmDuplicate(ledger, phone, amount, s.duplicateWindow); err != nil {
+		return err
+	}
+
+	externalRef, err := s.refs.Generate("TXN")
+	if err != nil {
+		return err
+	}
+	var description string
+	if s.descTemplate != "" {
+		vars := templateVars{"Phone": phone, "Amount": strconv.Itoa(amount), "ExternalReference": externalRef}
+		if description, err = renderDescription(s.descTemplate, vars); err == nil {
+			fmt.Println(tr("description", description))
+		}
+	} else {
+		description, err = promptUser(tr("prompt.description"))
+	}
+	if err != nil {
+		return err
+	}
+
+	req := campay.CollectRequest{
+		Amount:            amount,
+		Currency:          "XAF",
+		From:              phone,
+		Description:       description,
+		ExternalReference: externalRef,
+		Operator:          sentOperator(phone, operator),
+	}
+	audited := LedgerEntry{ExternalReference: externalRef, Phone: phone, Amount: amount}
+	if err := auditMoney(cfg, "collect", auditRequested, audited); err != nil {
+		return err
+	}
+
+	fmt.Println("\n" + tr("collect.initiating"))
+	payment := sessionPayment{At: time.Now(), Phone: phone, Amount: amount}
+	resp, err := submitCollect(s.provider, req)
+	if err != nil {
+		auditMoney(cfg, "collect", "error: "+err.Error(), audited)
+		s.add(payment)
+		return err
+	}
+	payment.Reference, payment.Status = resp.Reference, campay.StatusPending
+	i := s.add(payment)
+	audited.Reference = resp.Reference
+	auditMoney(cfg, "collect", auditInitiated, audited)
+
+	fmt.Printf("\n%s\n%s\n", tr("collect.initiated"), tr("collect.reference", resp.Reference))
+	fmt.Println(tr("collect.check"))
+	printDialHint(resp)
+	recordLedger(ledger, LedgerEntry{
+		Reference:         resp.Reference,
+		ExternalReference: externalRef,
+		Kind:              "collect",
+		Phone:             phone,
+		Amount:            amount,
+		Currency:          req.Currency,
+		Description:       description,
+		Status:            campay.StatusPending,
+		Environment:       cfg.Env,
+		DialCode:          resp.DialCode(),
+		Review:            reviewReason(resp),
+	})
+
+	s.mu.Lock()
+	s.inFlight = resp.Reference
+	s.mu.Unlock()
+	progress := newPollProgress(cfg.Deadline)
+	final, err := pollTransactionStatus(s.provider, ledger, resp.Reference, cfg.Deadline, progress.Update)
+	progress.Stop()
+	s.mu.Lock()
+	s.inFlight = ""
+	s.mu.Unlock()
+
+	if err != nil {
+		auditMoney(cfg, "collect", "error: "+err.Error(), audited)
+		if e, _ := ledger.Get(resp.Reference); e != nil {
+			s.setStatus(i, e.Status)
+		}
+		return err
+	}
+	status := parseStatus(final.Status)
+	auditMoney(cfg, "collect", string(status), audited)
+	if err := ledger.UpdateStatus(resp.Reference, status, final.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	s.setStatus(i, status)
+
+	printWarnings(final.Warnings)
+	displayFinalStatus(final, cfg.FX)
+	printResult(resp.Reference, final.Status)
+	return nil
+}
+
+// add records a payment and returns its index for setStatus.
+func (s *cashierSession) add(p sessionPayment) int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.payments = append(s.payments, p)
+	return len(s.payments) - 1
+}
+
+func (s *cashierSession) setStatus(i int, status campay.Status) {
+	s.mu.Lock()
+	s.payments[i].Status = status
+	s.mu.Unlock()
+}
+
+// totals counts the payments of the session by outcome and adds up the
+// successful ones.
+func (s *cashierSession) totals() (count, successful, failed, incomplete, total int) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, p := range s.payments {
+		switch {
+		case p.Status == campay.StatusSuccessful:
+			successful++
+			total += p.Amount
+		case unsuccessful(p.Status) && !p.Status.Abandoned():
+			failed++
+		default:
+			incomplete++
+		}
+	}
+	return len(s.payments), successful, failed, incomplete, total
+}
+
+// printSummary prints every payment of the session and the totals, and
+// returns the exit code: exitCancelled when a customer was still
+// confirming.
+func (s *cashierSession) printSummary() int {
+	count, successful, failed, incomplete, total := s.totals()
+	s.mu.Lock()
+	payments, inFlight := append([]sessionPayment(nil), s.payments...), s.inFlight
+	s.mu.Unlock()
+
+	fmt.Println("============================================================")
+	fmt.Println(center(tr("session.summary"), 60))
+	fmt.Println("============================================================")
+	if len(payments) > 0 {
+		tbl := newTable("",
+			tableColumn{Name: "Time"},
+			tableColumn{Name: "Phone"},
+			tableColumn{Name: "Amount", Amount: true},
+			tableColumn{Name: "Status"},
+			tableColumn{Name: "Reference"},
+		)
+		for _, p := range payments {
+			status := "ERROR"
+			if p.Reference != "" {
+				status = statusLabel(string(p.Status))
+			}
+			tbl.Row(inZone(p.At).Format("15:04:05"), displayPhone(p.Phone), p.Amount, status, p.Reference)
+		}
+		tbl.Footer("Times in %s", zoneLabel(payments[0].At))
+		if err := tbl.Print(); err != nil {
+			fmt.Println("⚠", err)
+		}
+		fmt.Println()
+	}
+	fmt.Println(tr("session.payments", count, successful, failed, incomplete))
+	fmt.Println(tr("session.total", formatAmount(total, "XAF")))
+	if converted := s.cfg.FX.Convert(float64(total)); converted != "" && total > 0 {
+		fmt.Printf("  %s\n", converted)
+	}
+	fmt.Println(tr("session.duration", time.Since(s.started).Round(time.Second)))
+
+	for _, p := range payments {
+		if p.Reference != "" && (!isFinal(p.Status) || p.Status.Abandoned()) {
+			fmt.Println(tr("session.pending", p.Reference, p.Reference))
+		}
+	}
+	if inFlight != "" {
+		return exitCancelled
+	}
+	return exitOK
+}
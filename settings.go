@@ -0,0 +1,346 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== SETTINGS =========================
+   ============================================================ */
+
+// The scalar settings of Config (credentials, timeouts, output options and
+// the plain keys of the config file) are resolved in one place, each from
+// the first of:
+//
+//  1. its global flag: --connect-timeout 5s
+//  2. its environment variable, CAMPAY_ and the upper-cased name, which
+//     .env may set: CAMPAY_CONNECT_TIMEOUT=5s
+//  3. its top-level key in the config file: "connect_timeout": "5s"
+//  4. its default
+//
+// Secrets have no flag, since other users of the machine can read command
+// lines. Settings that had an environment variable before the CAMPAY_
+// prefix still read it after the prefixed one. A selected profile, the
+// secret manager and --demo then replace what they hold.
+
+// Sources of a setting besides environment variables, which are named
+const (
+	sourceDefault = "default"
+	sourceFile    = "config file"
+	sourceFlag    = "flag"
+)
+
+// setting is one scalar setting, bound to a field of Config.
+type setting struct {
+	Name   string // config file key
+	Secret bool   // no flag, and masked by config show
+	Legacy string // environment variable read when the CAMPAY_ one is not set
+	Source string // where the value came from
+	value  flag.Value
+}
+
+// Env is the environment variable of s.
+func (s *setting) Env() string { return "CAMPAY_" + strings.ToUpper(s.Name) }
+
+// Flag is the name of the global flag of s.
+func (s *setting) Flag() string { return strings.ReplaceAll(s.Name, "_", "-") }
+
+type settings struct {
+	list   []*setting
+	hidden *flag.FlagSet // holds the values of secrets, which have no flag
+}
+
+// defineSettings binds every setting to its field of cfg (or output
+// variable), registering a flag on global for each that is not secret.
+func defineSettings(cfg *Config, global *flag.FlagSet) *settings {
+	ss := &settings{hidden: flag.NewFlagSet("settings", flag.ContinueOnError)}
+	add := func(fs *flag.FlagSet, s *setting) {
+		s.Source = sourceDefault
+		s.value = fs.Lookup(s.Flag()).Value
+		ss.list = append(ss.list, s)
+	}
+	str := func(p *string, name, def, usage string) {
+		global.StringVar(p, strings.ReplaceAll(name, "_", "-"), def, usage)
+		add(global, &setting{Name: name})
+	}
+	legacy := func(p *string, name, env, def, usage string) {
+		global.StringVar(p, strings.ReplaceAll(name, "_", "-"), def, usage)
+		add(global, &setting{Name: name, Legacy: env})
+	}
+	secret := func(p *string, name, env string) {
+		ss.hidden.StringVar(p, strings.ReplaceAll(name, "_", "-"), "", "")
+		add(ss.hidden, &setting{Name: name, Legacy: env, Secret: true})
+	}
+	dur := func(p *time.Duration, name string, def time.Duration, usage string) {
+		global.DurationVar(p, strings.ReplaceAll(name, "_", "-"), def, usage)
+		add(global, &setting{Name: name})
+	}
+	boolean := func(p *bool, name, usage string) {
+		global.BoolVar(p, strings.ReplaceAll(name, "_", "-"), false, usage)
+		add(global, &setting{Name: name})
+	}
+
+	legacy(&cfg.Username, "username", "APP_USERNAME", "", "CamPay app username")
+	secret(&cfg.Password, "password", "APP_PASSWORD")
+	legacy(&cfg.Env, "environment", "ENVIRONMENT", "DEV", "CamPay environment: DEV or PROD")
+	secret(&cfg.WebhookKey, "webhook_key", "WEBHOOK_KEY")
+	secret(&cfg.PreviousWebhookKey, "previous_webhook_key", "WEBHOOK_KEY_PREVIOUS")
+	legacy(&cfg.Profile, "profile", "", "", "profile from the config file to use")
+	str(&cfg.Provider, "provider", "", "payment provider registered in the CLI (default campay)")
+
+	t := campay.DefaultTimeouts()
+	dur(&cfg.Timeouts.Connect, "connect_timeout", t.Connect, "time allowed to open a connection")
+	dur(&cfg.Timeouts.Token, "token_timeout", t.Token, "timeout for the token exchange")
+	dur(&cfg.Timeouts.Collect, "collect_timeout", t.Collect, "timeout for collect requests")
+	dur(&cfg.Timeouts.Withdraw, "withdraw_timeout", t.Withdraw, "timeout for withdraw requests")
+	dur(&cfg.Timeouts.Status, "status_timeout", t.Status, "timeout for each status check")
+	dur(&cfg.Timeouts.Balance, "balance_timeout", t.Balance, "timeout for balance requests")
+	dur(&cfg.Timeouts.History, "history_timeout", t.History, "timeout for history requests")
+	dur(&cfg.Timeouts.Other, "other_timeout", t.Other, "timeout for other endpoints (campay api)")
+	str(&cfg.BaseURL, "base_url", "", "API base URL, for a gateway, mirror or `campay mock` (default: from the environment)")
+	str(&cfg.Proxy, "proxy", "", "proxy URL for API calls (default: HTTPS_PROXY)")
+	str(&cfg.CACert, "ca_cert", "", "PEM file with extra root CAs to trust")
+	str(&cfg.TLSMinVersion, "tls_min_version", "", "lowest TLS version to accept: 1.2 or 1.3")
+	dur(&cfg.StatusTTL, "status_cache_ttl", 3*time.Second, "reuse status responses for this long (0 disables)")
+	dur(&cfg.Deadline, "confirm_deadline", defaultConfirmDeadline, "time the customer has to confirm before the transaction expires locally")
+
+	str(&cfg.DescriptionTemplate, "description_template", "", "template of payment descriptions, e.g. \"Order {{.OrderID}}\"")
+	str(&cfg.TreasuryPhone, "treasury_phone", "", "wallet that transfer moves balance through")
+	str(&cfg.RefFormat, "ref_format", "", "template of generated external references")
+	str(&cfg.RefGeneratorSpec, "ref_generator", "", "generator of external references: ulid, a URL or a registered name")
+	str((*string)(&cfg.Rounding), "rounding", "", "rounding of derived amounts: down, up or half-even")
+	str(&cfg.Timezone, "timezone", defaultTimezone, "time zone whose midnight starts a day in reports and daily limits: a name like Africa/Douala, UTC or Local")
+
+	boolean(&cfg.Verbose, "verbose", "log every API call to stderr")
+	str(&lang, "lang", lang, "message language: en or fr (default from LANG)")
+	str(&outputFormat, "output", outputFormat, "output format for errors: text or json")
+	boolean(&noColor, "no_color", "do not color statuses (also NO_COLOR)")
+	boolean(&noEmoji, "no_emoji", "replace ✓, ❌ and other symbols with plain text")
+	boolean(&quiet, "quiet", "print only the reference and final status")
+	str(&listFormat, "format", "", "format of lists: table, csv or json (default: json with --output json, table otherwise)")
+	boolean(&wide, "wide", "show every column of tables without truncating")
+	boolean(&showPII, "show_pii", "show payers' phone numbers and names in full instead of masked")
+	boolean(&cfg.ReadOnly, "read_only", "refuse collections, payouts and refunds; reads, reports and exports still work (for audits)")
+	boolean(&cfg.Demo, "demo", "use a built-in mock API with fake money and scripted customers (for training)")
+	dur(&cfg.DemoWait, "demo_wait", 10*time.Second, "with --demo, how long customers take to answer")
+	return ss
+}
+
+func (ss *settings) get(name string) *setting {
+	for _, s := range ss.list {
+		if s.Name == name {
+			return s
+		}
+	}
+	return nil
+}
+
+// load applies the config file, then the environment, over the defaults.
+func (ss *settings) load(file map[string]json.RawMessage) error {
+	for _, s := range ss.list {
+		if raw, ok := file[s.Name]; ok {
+			var v string
+			if json.Unmarshal(raw, &v) != nil {
+				v = string(raw) // a number or boolean
+			}
+			if s.value.Set(v) != nil {
+				return invalidInput("config file: invalid %s %s", s.Name, raw)
+			}
+			s.Source = sourceFile
+		}
+		for _, env := range []string{s.Env(), s.Legacy} {
+			if v := os.Getenv(env); env != "" && v != "" {
+				if s.value.Set(v) != nil {
+					return invalidInput("invalid %s %q", env, v)
+				}
+				s.Source = env
+				break
+			}
+		}
+	}
+	return nil
+}
+
+// parsed records the settings given as flags.
+func (ss *settings) parsed(global *flag.FlagSet) {
+	global.Visit(func(f *flag.Flag) {
+		for _, s := range ss.list {
+			if !s.Secret && s.Flag() == f.Name {
+				s.Source = sourceFlag
+			}
+		}
+	})
+}
+
+// replaced records that source changed the named settings after they
+// were resolved, when they are defined.
+func (ss *settings) replaced(source string, names ...string) {
+	if ss == nil {
+		return
+	}
+	for _, name := range names {
+		if s := ss.get(name); s != nil {
+			s.Source = source
+		}
+	}
+}
+
+// finishSettings validates the resolved settings and derives what depends
+// on them.
+func finishSettings(cfg *Config) error {
+	cfg.Env = strings.ToUpper(strings.TrimSpace(cfg.Env))
+	if cfg.Env != "DEV" && cfg.Env != "PROD" {
+		return invalidInput("environment must be DEV or PROD, not %q", cfg.Env)
+	}
+	if outputFormat != "text" && outputFormat != "json" {
+		return invalidInput("--output must be text or json")
+	}
+	if listFormat != "" && listFormat != "table" && listFormat != "csv" && listFormat != "json" {
+		return invalidInput("--format must be table, csv or json")
+	}
+	if _, ok := catalogs[lang]; !ok {
+		return invalidInput("--lang must be en or fr")
+	}
+	if cfg.TLSMinVersion != "" && cfg.TLSMinVersion != "1.2" && cfg.TLSMinVersion != "1.3" {
+		return invalidInput("tls_min_version must be 1.2 or 1.3")
+	}
+	for _, s := range cfg.settings.list {
+		if d, ok := s.value.(flag.Getter).Get().(time.Duration); ok && d < 0 {
+			return invalidInput("%s cannot be negative", s.Name)
+		}
+	}
+
+	var err error
+	if _, err = parseRounding(string(cfg.Rounding)); err != nil {
+		return err
+	}
+	if reportZone, err = loadTimezone(cfg.Timezone); err != nil {
+		return err
+	}
+	if cfg.RefGenerator, err = newRefGenerator(cfg.RefGeneratorSpec); err != nil {
+		return err
+	}
+	if cfg.FX, err = newFXDisplay(cfg.file.Conversion, cfg.Rounding); err != nil {
+		return err
+	}
+	if cfg.BaseURL != "" {
+		if err := checkBaseURL(cfg.BaseURL); err != nil {
+			return invalidInput("base_url: %v", err)
+		}
+	}
+	cfg.APIBaseURL = apiBaseURL(cfg)
+	return nil
+}
+
+// checkBaseURL checks that s is an absolute http or https URL.
+func checkBaseURL(s string) error {
+	u, err := url.Parse(s)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http or https URL", s)
+	}
+	if u.RawQuery != "" || u.Fragment != "" {
+		return fmt.Errorf("%q cannot have a query or fragment", s)
+	}
+	return nil
+}
+
+// =============================================================
+// config show
+// =============================================================
+
+// configShowOptions are the flags of config show.
+type configShowOptions struct {
+	resolved bool
+}
+
+// configShowFlags defines the flags of config show on fs.
+func configShowFlags(fs *flag.FlagSet, cfg *Config) *configShowOptions {
+	opt := &configShowOptions{}
+	fs.BoolVar(&opt.resolved, "resolved", false, "show every setting in effect, after flags, environment, profile and secret manager")
+	return opt
+}
+
+// runConfig shows the config file or, with --resolved, the settings in
+// effect and where each comes from.
+func runConfig(cfg *Config, args []string) error {
+	if len(args) == 0 || args[0] != "show" {
+		return invalidInput("usage: campay config show [--resolved]")
+	}
+	fs := newFlagSet("config show")
+	opt := configShowFlags(fs, cfg)
+	if err := fs.Parse(args[1:]); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	if !opt.resolved {
+		path, err := configPath()
+		if err != nil {
+			return err
+		}
+		data, err := os.ReadFile(path)
+		if errors.Is(err, os.ErrNotExist) {
+			fmt.Printf("No config file at %s; every setting comes from flags, the environment or its default\n", path)
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		var doc any
+		if err := json.Unmarshal(data, &doc); err != nil {
+			return fmt.Errorf("failed to parse %s: %w", path, err)
+		}
+		out, _ := json.MarshalIndent(maskSecrets(doc), "", "  ")
+		fmt.Println("# " + path)
+		fmt.Println(string(out))
+		return nil
+	}
+
+	if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
+	tbl := newTable("No settings",
+		tableColumn{Name: "Setting"},
+		tableColumn{Name: "Value", Max: 60},
+		tableColumn{Name: "Source"},
+		tableColumn{Name: "Variable"},
+	)
+	for _, s := range cfg.settings.list {
+		value := s.value.String()
+		if s.Secret && value != "" {
+			value = "****"
+		}
+		tbl.Row(s.Name, value, s.Source, s.Env())
+	}
+	return tbl.Print()
+}
+
+// maskSecrets replaces the values of keys that hold secrets, at any
+// depth of a decoded JSON document.
+func maskSecrets(v any) any {
+	switch v := v.(type) {
+	case map[string]any:
+		for k, child := range v {
+			name := strings.ToLower(k)
+			if s, ok := child.(string); ok && s != "" && (strings.Contains(name, "password") || strings.Contains(name, "secret") ||
+				strings.Contains(name, "token") || strings.HasSuffix(name, "key")) {
+				v[k] = "****"
+				continue
+			}
+			v[k] = maskSecrets(child)
+		}
+	case []any:
+		for i := range v {
+			v[i] = maskSecrets(v[i])
+		}
+	}
+	return v
+}
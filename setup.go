@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+/* ============================================================
+   ============================ SETUP ==========================
+   ============================================================ */
+
+// setupOptions are the flags of setup.
+type setupOptions struct {
+	name string
+}
+
+// setupFlags defines the flags of setup on fs.
+func setupFlags(fs *flag.FlagSet, cfg *Config) *setupOptions {
+	opt := &setupOptions{}
+	fs.StringVar(&opt.name, "name", "", "profile to write (prompted if empty)")
+	return opt
+}
+
+// runSetup walks a new user through the settings needed to take a first
+// payment and saves them as a profile of the config file, after checking
+// the credentials with CamPay. Nothing is written if the check fails.
+func runSetup(cfg *Config, args []string) error {
+	fs := newFlagSet("setup")
+	opt := setupFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if fs.NArg() > 0 {
+		return invalidInput("unexpected argument %q", fs.Arg(0))
+	}
+
+	fc, err := loadFileConfig()
+	if err != nil {
+		return err
+	}
+	path, _ := configPath()
+	fmt.Printf("This writes a CamPay profile to %s.\n", path)
+	fmt.Println("Find the app username and password under Apps in the CamPay dashboard (demo.campay.net for DEV).")
+	fmt.Println()
+
+	if opt.name == "" {
+		if opt.name, err = promptUser("Profile name, e.g. default or shop-a: "); err != nil {
+			return err
+		}
+	}
+	if _, ok := fc.Profiles[opt.name]; ok {
+		answer, err := promptUser(fmt.Sprintf("Profile %q exists. Replace it? [y/N]: ", opt.name))
+		if err != nil {
+			return err
+		}
+		if !isYes(answer) {
+			return exitErr(exitCancelled, fmt.Errorf("setup not confirmed"))
+		}
+	}
+
+	// Credentials from the keychain or a secret manager must not replace
+	// the ones typed below when authenticating
+	cfg.keychainLoaded = true
+	if err := resolveSecrets(cfg); err != nil {
+		return err
+	}
+	if cfg.Username, err = promptUser("CamPay app username: "); err != nil {
+		return err
+	}
+	if cfg.Password, err = promptSecret("CamPay app password: "); err != nil {
+		return err
+	}
+	for {
+		env, err := promptUser("Environment, DEV (test money) or PROD: ")
+		if err != nil {
+			return err
+		}
+		if cfg.Env = strings.ToUpper(env); cfg.Env == "DEV" || cfg.Env == "PROD" {
+			break
+		}
+		fmt.Println("  ⚠ Enter DEV or PROD")
+	}
+	if !cfg.Demo {
+		cfg.APIBaseURL = apiBaseURL(cfg)
+	}
+
+	fmt.Printf("\nChecking the credentials with %s...\n", cfg.APIBaseURL)
+	client, err := authenticate(cfg)
+	if err != nil {
+		fmt.Println("  ❌ Nothing was saved; check the username, password and environment, then run setup again.")
+		return err
+	}
+	if balance, err := client.Balance(context.Background()); err == nil {
+		fmt.Printf("  ✓ Balance: %s\n", formatMoney(balance.TotalBalance, balance.Currency))
+	}
+	fmt.Println()
+
+	p := Profile{Username: cfg.Username, Password: cfg.Password, Environment: cfg.Env}
+	if _, err := keychainTool(); err != nil {
+		fmt.Printf("The password will be stored in the config file (%v).\n", err)
+	} else {
+		answer, err := promptUser("Store the password in the OS keychain instead of the config file? [y/N]: ")
+		if err != nil {
+			return err
+		}
+		if isYes(answer) {
+			if err := keychainSet(opt.name, cfg.Password); err != nil {
+				return fmt.Errorf("failed to store the password in the keychain: %w", err)
+			}
+			p.Password, p.Keychain = "", true
+			fmt.Println("  ✓ Password stored in the keychain")
+		}
+	}
+
+	if fc.Conversion, err = promptConversion(fc.Conversion); err != nil {
+		return err
+	}
+
+	if fc.Profiles == nil {
+		fc.Profiles = map[string]Profile{}
+	}
+	p.WebhookKey = fc.Profiles[opt.name].WebhookKey
+	p.PreviousWebhookKey = fc.Profiles[opt.name].PreviousWebhookKey
+	p.RefFormat = fc.Profiles[opt.name].RefFormat
+	p.BaseURL = fc.Profiles[opt.name].BaseURL
+	fc.Profiles[opt.name] = p
+
+	// The first profile becomes the default; later ones only if asked
+	var current string
+	if raw, ok := fc.Other["profile"]; ok {
+		json.Unmarshal(raw, &current)
+	}
+	makeDefault := current == "" || current == opt.name
+	if !makeDefault {
+		answer, err := promptUser(fmt.Sprintf("Use %q by default instead of %q? [y/N]: ", opt.name, current))
+		if err != nil {
+			return err
+		}
+		makeDefault = isYes(answer)
+	}
+	if makeDefault {
+		if fc.Other == nil {
+			fc.Other = map[string]json.RawMessage{}
+		}
+		fc.Other["profile"], _ = json.Marshal(opt.name)
+	}
+
+	if err := saveFileConfig(fc); err != nil {
+		return err
+	}
+	fmt.Printf("\n✓ Saved profile %q to %s\n", opt.name, path)
+	if makeDefault {
+		fmt.Println("  It is the default profile; try `campay status` or `campay collect`.")
+	} else {
+		fmt.Printf("  Use it with --profile %s or CAMPAY_PROFILE=%s\n", opt.name, opt.name)
+	}
+	return nil
+}
+
+// xafPerEUR is the fixed parity of the CFA franc to the euro.
+const xafPerEUR = 655.957
+
+var currencyCode = regexp.MustCompile(`^[A-Z]{3}$`)
+
+// promptConversion asks which currency amounts are also shown in, besides
+// XAF, the only one CamPay accepts.
+func promptConversion(current *ConversionConfig) (*ConversionConfig, error) {
+	hint := "none"
+	if current != nil && current.Currency != "" {
+		hint = current.Currency
+	}
+	for {
+		answer, err := promptUser(fmt.Sprintf("Payments are in XAF. Also show amounts in another currency? Its code, e.g. EUR, or none (now: %s): ", hint))
+		if err != nil {
+			return nil, err
+		}
+		currency := strings.ToUpper(answer)
+		switch {
+		case currency == "NONE" || currency == "XAF":
+			return nil, nil
+		case currency == hint:
+			return current, nil
+		case !currencyCode.MatchString(currency):
+			fmt.Println("  ⚠ Enter a three-letter code such as EUR or USD, or none")
+			continue
+		case currency == "EUR":
+			return &ConversionConfig{Currency: currency, Rate: xafPerEUR}, nil
+		}
+		for {
+			answer, err := promptUser(fmt.Sprintf("How many XAF is 1 %s? ", currency))
+			if err != nil {
+				return nil, err
+			}
+			if rate, err := strconv.ParseFloat(answer, 64); err == nil && rate > 0 {
+				return &ConversionConfig{Currency: currency, Rate: rate}, nil
+			}
+			fmt.Println("  ⚠ Enter a positive number, e.g. 600")
+		}
+	}
+}
+
+func isYes(answer string) bool {
+	a := strings.ToLower(answer)
+	return a == "y" || a == "yes"
+}
@@ -0,0 +1,183 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"strings"
+	"text/template"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================== SMS RECEIPTS =======================
+   ============================================================ */
+
+// When the config file has an "sms" section, the payer of every collection
+// that succeeds gets a confirmation SMS with the amount, the merchant name
+// and the reference. It is sent when the ledger records the success, so
+// collect, the daemon and serve all send it, once per transaction. A
+// failed send is queued like a failed hook and retried by the daemon.
+
+// SMSConfig is the "sms" section of the config file.
+type SMSConfig struct {
+	Provider string `json:"provider,omitempty"` // "http"; empty disables receipts
+	URL      string `json:"url,omitempty"`      // gateway endpoint (http)
+	Token    string `json:"token,omitempty"`    // bearer token, or SMS_TOKEN
+	Sender   string `json:"sender,omitempty"`   // sender ID shown to the payer
+	Merchant string `json:"merchant,omitempty"` // name in the message
+	Template string `json:"template,omitempty"` // Go template replacing the default message
+}
+
+// SMSSender delivers a text message. Gateways plug in through
+// newSMSSender.
+type SMSSender interface {
+	SendSMS(ctx context.Context, to, text string) error
+}
+
+// httpSMSGateway posts {"to", "from", "message"} as JSON to a URL, the
+// shape most HTTP SMS gateways accept or can be mapped to. Any 2xx answer
+// is a success.
+type httpSMSGateway struct {
+	url    string
+	token  string
+	sender string
+	client *http.Client
+}
+
+func (g *httpSMSGateway) SendSMS(ctx context.Context, to, text string) error {
+	body, err := json.Marshal(map[string]string{"to": to, "from": g.sender, "message": text})
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, "POST", g.url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", userAgent())
+	if g.token != "" {
+		req.Header.Set("Authorization", "Bearer "+g.token)
+	}
+	resp, err := g.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 != 2 {
+		msg, _ := io.ReadAll(io.LimitReader(resp.Body, 200))
+		return fmt.Errorf("SMS gateway answered %d: %s", resp.StatusCode, strings.TrimSpace(string(msg)))
+	}
+	return nil
+}
+
+// newSMSSender returns the gateway named by c.Provider, or nil when SMS
+// receipts are off.
+func newSMSSender(c SMSConfig) (SMSSender, error) {
+	switch c.Provider {
+	case "":
+		return nil, nil
+	case "http":
+		if c.Merchant == "" {
+			return nil, invalidInput("sms.merchant is required to send SMS receipts")
+		}
+		if !strings.HasPrefix(c.URL, "http://") && !strings.HasPrefix(c.URL, "https://") {
+			return nil, invalidInput("sms.url must be an http(s) URL")
+		}
+		token := c.Token
+		if token == "" {
+			token = os.Getenv("SMS_TOKEN")
+		}
+		return &httpSMSGateway{url: c.URL, token: token, sender: c.Sender, client: &http.Client{Timeout: 15 * time.Second}}, nil
+	default:
+		return nil, invalidInput("unknown sms.provider %q (use http)", c.Provider)
+	}
+}
+
+// smsData is what an SMS template sees.
+type smsData struct {
+	Merchant          string
+	Amount            string // grouped by thousands as for --lang, e.g. "15 000"
+	Currency          string
+	Reference         string
+	ExternalReference string
+	Phone             string
+}
+
+// smsReceipts sends the receipt of successful collections.
+type smsReceipts struct {
+	sender   SMSSender
+	merchant string
+	tmpl     *template.Template
+}
+
+// receiptSMS is set by run from the config file; nil sends nothing.
+var receiptSMS *smsReceipts
+
+func newSMSReceipts(c SMSConfig) (*smsReceipts, error) {
+	sender, err := newSMSSender(c)
+	if err != nil || sender == nil {
+		return nil, err
+	}
+	r := &smsReceipts{sender: sender, merchant: c.Merchant}
+	if c.Template != "" {
+		if r.tmpl, err = template.New("sms").Option("missingkey=error").Parse(c.Template); err != nil {
+			return nil, invalidInput("invalid sms.template: %v", err)
+		}
+	}
+	return r, nil
+}
+
+// Message renders the receipt text of e.
+func (r *smsReceipts) Message(e LedgerEntry) (string, error) {
+	d := smsData{
+		Merchant:          r.merchant,
+		Amount:            formatMoney(campay.Amount(e.Amount), ""),
+		Currency:          e.Currency,
+		Reference:         e.Reference,
+		ExternalReference: e.ExternalReference,
+		Phone:             e.Phone,
+	}
+	if r.tmpl == nil {
+		return tr("sms.receipt", d.Merchant, formatAmount(e.Amount, d.Currency), d.Reference), nil
+	}
+	var sb strings.Builder
+	if err := r.tmpl.Execute(&sb, d); err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// Send delivers the receipt of e to the payer.
+func (r *smsReceipts) Send(e LedgerEntry) error {
+	text, err := r.Message(e)
+	if err != nil {
+		return err
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	return r.sender.SendSMS(ctx, "+"+e.Phone, text)
+}
+
+// wantsReceipt reports whether e is a collection whose payer gets an SMS.
+func wantsReceipt(e LedgerEntry) bool {
+	return e.Kind == "collect" && e.Status == campay.StatusSuccessful && e.Phone != ""
+}
+
+// sendReceiptSMS sends the receipt of a collection that just succeeded,
+// queuing it for the daemon if the gateway fails.
+func sendReceiptSMS(e LedgerEntry) {
+	if receiptSMS == nil || !wantsReceipt(e) {
+		return
+	}
+	if err := receiptSMS.Send(e); err != nil {
+		fmt.Fprintf(os.Stderr, "⚠ SMS receipt failed for %s: %v\n", e.Reference, err)
+		enqueueNotification(notifySMS, e.Reference, nil, err)
+	}
+}
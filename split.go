@@ -0,0 +1,221 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ====================== SPLIT PAYMENTS =======================
+   ============================================================ */
+
+// SplitCut is one recipient of a split rule: a percentage of the
+// collected amount or a fixed amount.
+type SplitCut struct {
+	Phone       string  `json:"phone"`
+	Percent     float64 `json:"percent,omitempty"`
+	Fixed       int     `json:"fixed,omitempty"`
+	Description string  `json:"description,omitempty"`
+}
+
+func settlementsDir() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	dir = filepath.Join(dir, "settlements")
+	return dir, os.MkdirAll(dir, 0700)
+}
+
+// splitPlan turns a split rule into a plan: collect amount, then pay each
+// cut once the collection succeeded. Every entry carries the settlement ID.
+// Percentage cuts are rounded as the plan will round them when it runs.
+func splitPlan(id, phone string, amount int, description string, cuts []SplitCut, rounding Rounding) (*Plan, error) {
+	plan := &Plan{Name: id, Settlement: id}
+	plan.Steps = append(plan.Steps, PlanStep{
+		ID:          "collect",
+		Action:      "collect",
+		Phone:       phone,
+		Amount:      strconv.Itoa(amount),
+		Description: description,
+	})
+
+	total := 0
+	for i, c := range cuts {
+		if c.Phone == "" || (c.Percent > 0) == (c.Fixed > 0) {
+			return nil, invalidInput("cut %d needs a phone and either percent or fixed", i+1)
+		}
+		if c.Percent > 100 {
+			return nil, invalidInput("cut %d: percent must be at most 100", i+1)
+		}
+		step := PlanStep{
+			ID:          fmt.Sprintf("cut%d", i+1),
+			Action:      "withdraw",
+			Phone:       c.Phone,
+			Amount:      strconv.Itoa(c.Fixed),
+			If:          "collect == SUCCESSFUL",
+			Description: c.Description,
+		}
+		if c.Percent > 0 {
+			step.Amount = strconv.FormatFloat(c.Percent, 'f', -1, 64) + "%"
+			step.Of = "collect"
+			total += rounding.PercentOf(amount, floatRat(c.Percent))
+		} else {
+			total += c.Fixed
+		}
+		if step.Description == "" {
+			step.Description = "Split " + id
+		}
+		plan.Steps = append(plan.Steps, step)
+	}
+	if total > amount {
+		return nil, invalidInput("the cuts add up to %d XAF, more than the %d XAF collected", total, amount)
+	}
+	return plan, nil
+}
+
+// splitOptions are the flags of split.
+type splitOptions struct {
+	rule        string
+	phone       string
+	amount      string
+	description string
+	id          string
+	resume      string
+}
+
+// splitFlags defines the flags of split on fs.
+func splitFlags(fs *flag.FlagSet, cfg *Config) *splitOptions {
+	opt := &splitOptions{}
+	fs.StringVar(&opt.rule, "rule", "", "split rule from the config file's splits section")
+	fs.StringVar(&opt.phone, "phone", "", "payer number or @contact")
+	fs.StringVar(&opt.amount, "amount", "", "amount to collect, e.g. 10000 or 10k")
+	fs.StringVar(&opt.description, "description", "Payment", "description of the collection")
+	fs.StringVar(&opt.id, "settlement", "", "settlement ID (default: STL-<unix time>)")
+	fs.StringVar(&opt.resume, "resume", "", "resume an interrupted settlement by ID")
+	return opt
+}
+
+// runSplit collects a payment and disburses the cuts of a configured
+// split rule, tracking all of it under one settlement ID. The generated
+// plan is kept in settlements/, so an interrupted split is resumed with
+// --resume (or `campay run`).
+func runSplit(cfg *Config, args []string) error {
+	if len(args) > 0 && args[0] == "show" {
+		return showSettlement(args[1:])
+	}
+
+	fs := newFlagSet("split")
+	opt := splitFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "split"); err != nil {
+		return err
+	}
+
+	dir, err := settlementsDir()
+	if err != nil {
+		return err
+	}
+	if opt.resume != "" {
+		return runPlan(cfg, []string{filepath.Join(dir, opt.resume+".json")})
+	}
+
+	cuts, ok := cfg.Splits[opt.rule]
+	if !ok {
+		return invalidInput("unknown split rule %q (define it under \"splits\" in the config file)", opt.rule)
+	}
+	if opt.phone == "" || opt.amount == "" {
+		return invalidInput("usage: campay split --rule <name> --phone <payer> --amount <amount>")
+	}
+	payer, err := resolvePhone(opt.phone)
+	if err != nil {
+		return err
+	}
+	amt, err := parseAmount(opt.amount)
+	if err != nil {
+		return err
+	}
+	if opt.id == "" {
+		opt.id = fmt.Sprintf("STL-%d", time.Now().Unix())
+	}
+
+	path := filepath.Join(dir, opt.id+".json")
+	if _, err := os.Stat(path); err == nil {
+		return invalidInput("settlement %s already exists (use --resume %s)", opt.id, opt.id)
+	}
+	plan, err := splitPlan(opt.id, payer, amt, opt.description, cuts, cfg.Rounding)
+	if err != nil {
+		return err
+	}
+	// Phone numbers are encrypted like the ledger's; run opens them
+	aead, err := ledgerCipher()
+	if err != nil {
+		return err
+	}
+	for i := range plan.Steps {
+		if err := sealPhones(aead, &plan.Steps[i].Phone); err != nil {
+			return err
+		}
+	}
+	data, err := json.MarshalIndent(plan, "", "  ")
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+
+	fmt.Printf("Settlement %s: collect %s from %s, then %d payout(s)\n", opt.id, formatAmount(amt, "XAF"), payer, len(cuts))
+	return runPlan(cfg, []string{path})
+}
+
+// showSettlement prints the ledger entries of a settlement and what is
+// left of the collected amount.
+func showSettlement(args []string) error {
+	if len(args) != 1 {
+		return invalidInput("usage: campay split show <settlement-id>")
+	}
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	entries, err := ledger.FindBySettlement(args[0])
+	if err != nil {
+		return err
+	}
+	if len(entries) == 0 {
+		return fmt.Errorf("no transaction for settlement %q in the local ledger", args[0])
+	}
+
+	collected, paid := 0, 0
+	tbl := newTable("",
+		tableColumn{Name: "Kind"},
+		tableColumn{Name: "Phone"},
+		tableColumn{Name: "Amount", Amount: true},
+		tableColumn{Name: "Currency"},
+		tableColumn{Name: "Reference"},
+		tableColumn{Name: "Status"},
+	)
+	for _, e := range entries {
+		tbl.Row(e.Kind, displayPhone(e.Phone), e.Amount, e.Currency, e.Reference, e.Status)
+		if e.Status != campay.StatusSuccessful {
+			continue
+		}
+		if e.Kind == "collect" {
+			collected += e.Amount
+		} else {
+			paid += e.Amount
+		}
+	}
+	tbl.Footer("Settlement %s: collected %s, paid out %s, kept %s", args[0], formatAmount(collected, "XAF"), formatAmount(paid, "XAF"), formatAmount(collected-paid, "XAF"))
+	return tbl.Print()
+}
@@ -0,0 +1,248 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= APP OVERVIEW ========================
+   ============================================================ */
+
+// operatorUsage is today's ledger activity for one operator.
+type operatorUsage struct {
+	Collected int
+	PaidOut   int
+	Refunded  int // part of PaidOut returning collections
+}
+
+// usageToday sums today's pending and successful ledger entries per
+// operator, the same way the risk rules count them. Transfers between apps
+// are summed apart, under transferSource.
+func usageToday(ledger *Ledger) (map[string]*operatorUsage, error) {
+	entries, err := ledger.Entries()
+	if err != nil {
+		return nil, err
+	}
+	usage := map[string]*operatorUsage{}
+	now := time.Now()
+	for _, e := range entries {
+		if !sameDay(e.CreatedAt, now) || unsuccessful(e.Status) || e.Status.Abandoned() {
+			continue
+		}
+		op := operatorFor(e.Phone)
+		if e.Source == transferSource {
+			op = transferSource
+		}
+		if usage[op] == nil {
+			usage[op] = &operatorUsage{}
+		}
+		switch e.Kind {
+		case "collect":
+			usage[op].Collected += e.Amount
+		case "withdraw":
+			usage[op].PaidOut += e.Amount
+			if e.Refund {
+				usage[op].Refunded += e.Amount
+			}
+		}
+	}
+	return usage, nil
+}
+
+// statusOptions are the flags of status.
+type statusOptions struct {
+	payouts string
+}
+
+// statusFlags defines the flags of status on fs.
+func statusFlags(fs *flag.FlagSet, cfg *Config) *statusOptions {
+	opt := &statusOptions{}
+	fs.Bool("app", true, "show the app overview (the default)")
+	fs.StringVar(&opt.payouts, "payouts", "", "payout CSV to check against today's headroom")
+	return opt
+}
+
+// runStatus prints balances, limits and today's usage in one screen so a
+// payout run can be checked before it starts.
+func runStatus(cfg *Config, args []string) error {
+	fs := newFlagSet("status")
+	opt := statusFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if opt.payouts != "" && tableFormat() != "table" {
+		return invalidInput("--payouts needs the table format")
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+
+	var need map[string]int
+	if opt.payouts != "" {
+		rows, err := readBatchFile(opt.payouts, "", nil)
+		if err != nil {
+			return err
+		}
+		need = map[string]int{}
+		for _, r := range rows {
+			need[r.operator()] += r.Amount
+		}
+	}
+
+	client, err := authenticate(cfg)
+	if err != nil {
+		return err
+	}
+
+	// Fetch the balance while the ledger is scanned
+	type balanceResult struct {
+		resp *campay.BalanceResponse
+		err  error
+	}
+	balanceCh := make(chan balanceResult, 1)
+	go func() {
+		resp, err := client.Balance(context.Background())
+		balanceCh <- balanceResult{resp, err}
+	}()
+
+	usage, err := usageToday(ledger)
+	if err != nil {
+		return err
+	}
+	b := <-balanceCh
+	if b.err != nil {
+		return fmt.Errorf("failed to fetch balance: %w", b.err)
+	}
+	printWarnings(b.resp.Warnings)
+
+	balances := map[string]campay.Amount{"MTN": b.resp.MTNBalance, "ORANGE": b.resp.OrangeBalance}
+	tbl := newTable("",
+		tableColumn{Name: "Operator"},
+		tableColumn{Name: "Balance", Amount: true},
+		tableColumn{Name: "Collected", Amount: true},
+		tableColumn{Name: "Paid out", Amount: true},
+		tableColumn{Name: "Min per txn", Amount: true},
+		tableColumn{Name: "Max per txn", Amount: true},
+	)
+	total := operatorUsage{}
+	for _, op := range []string{"MTN", "ORANGE", ""} {
+		u := usage[op]
+		if u == nil {
+			u = &operatorUsage{}
+		}
+		total.Collected += u.Collected
+		total.PaidOut += u.PaidOut
+		total.Refunded += u.Refunded
+		if op == "" && u.Collected == 0 && u.PaidOut == 0 {
+			continue
+		}
+
+		var label, balance any = op, balances[op].Int()
+		if op == "" {
+			label, balance = "other", "-"
+		}
+		limits, ok := cfg.OperatorLimits[op]
+		if !ok {
+			limits = cfg.OperatorLimits["default"]
+		}
+		tbl.Row(label, balance, u.Collected, u.PaidOut, limitText(limits.Min), limitText(limits.Max))
+	}
+	tbl.Row("Total", b.resp.TotalBalance.Int(), total.Collected, total.PaidOut, "", "")
+	if u := usage[transferSource]; u != nil {
+		tbl.Row("transfers", "-", u.Collected, u.PaidOut, "", "")
+	}
+
+	// Other formats carry the breakdown only
+	if tableFormat() != "table" {
+		return tbl.Print()
+	}
+	name := cfg.Profile
+	if name == "" {
+		name = "(environment)"
+	}
+	now := time.Now()
+	fmt.Printf("\nApp: %s [%s]    %s, day in %s\n\n", name, cfg.Env, inZone(now).Format("2006-01-02 15:04"), zoneLabel(now))
+	if err := tbl.Print(); err != nil {
+		return err
+	}
+	if total.Refunded > 0 {
+		fmt.Printf("Refunds: %s of the payouts, net collected %s (see campay revenue)\n",
+			formatAmount(total.Refunded, "XAF"), formatAmount(total.Collected-total.Refunded, "XAF"))
+	}
+	fmt.Println()
+
+	payoutLeft := -1 // unlimited
+	fmt.Println("Daily limits (risk rules):")
+	if max := cfg.Risk.MaxTotalPerDay; max > 0 {
+		fmt.Printf("  Collections  %s of %s used, %s left\n", formatAmount(total.Collected, ""), formatAmount(max, "XAF"), formatAmount(headroom(max, total.Collected), ""))
+		fmt.Printf("  Payouts      %s of %s used, %s left\n", formatAmount(total.PaidOut, ""), formatAmount(max, "XAF"), formatAmount(headroom(max, total.PaidOut), ""))
+		payoutLeft = headroom(max, total.PaidOut)
+	} else {
+		fmt.Println("  No daily total limit configured")
+	}
+	if cfg.Risk.MaxPerPhonePerDay > 0 {
+		fmt.Printf("  Per phone    %s per day\n", formatAmount(cfg.Risk.MaxPerPhonePerDay, "XAF"))
+	}
+	if cfg.Risk.MaxAmount > 0 {
+		fmt.Printf("  Per txn      %s\n", formatAmount(cfg.Risk.MaxAmount, "XAF"))
+	}
+
+	canPay := b.resp.TotalBalance.Int()
+	if payoutLeft >= 0 && payoutLeft < canPay {
+		canPay = payoutLeft
+	}
+	fmt.Printf("\nPayout headroom today: %s\n", formatAmount(canPay, b.resp.Currency))
+
+	if need == nil {
+		return nil
+	}
+
+	fmt.Printf("\nPayout run %s:\n", opt.payouts)
+	ok := true
+	needTotal := 0
+	for _, op := range []string{"MTN", "ORANGE", ""} {
+		if need[op] == 0 {
+			continue
+		}
+		needTotal += need[op]
+		label := op
+		if op == "" {
+			label = "other"
+		}
+		line := fmt.Sprintf("  %-8s needs %s", label, formatAmount(need[op], "XAF"))
+		if op != "" && campay.Amount(need[op]) > balances[op] {
+			line += fmt.Sprintf("  ⚠ only %s available", formatMoney(balances[op], ""))
+			ok = false
+		}
+		fmt.Println(line)
+	}
+	if needTotal > canPay {
+		ok = false
+	}
+	if !ok {
+		return exitErr(exitInsufficientFunds, fmt.Errorf("payout run needs %s, headroom is %s", formatAmount(needTotal, "XAF"), formatAmount(canPay, "")))
+	}
+	fmt.Printf("✓ Run of %s fits today's headroom\n", formatAmount(needTotal, "XAF"))
+	return nil
+}
+
+func headroom(limit, used int) int {
+	if used >= limit {
+		return 0
+	}
+	return limit - used
+}
+
+func limitText(v int) string {
+	if v <= 0 {
+		return "-"
+	}
+	return fmt.Sprint(v)
+}
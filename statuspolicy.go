@@ -0,0 +1,35 @@
+package main
+
+import (
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ======================= STATUS POLICY =======================
+   ============================================================ */
+
+// Some CamPay flows send statuses besides PENDING, SUCCESSFUL and FAILED.
+// The "statuses" section of the config file says how to read them (see
+// campay.StatusPolicy): aliases, further final statuses, which final
+// statuses may be retried and what to do with unknown ones. run sets
+// statusPolicy from it, and every status from the API or the ledger is
+// read through it.
+
+// statusPolicy is the config file's status policy.
+var statusPolicy = &campay.StatusPolicy{}
+
+// parseStatus normalizes an API status under statusPolicy.
+func parseStatus(s string) campay.Status {
+	return statusPolicy.Parse(s)
+}
+
+// isFinal reports whether s will not change again.
+func isFinal(s campay.Status) bool {
+	return statusPolicy.IsTerminal(s)
+}
+
+// unsuccessful reports whether s is final without the money having moved
+// for good: failed, expired, reversed or a custom final status.
+func unsuccessful(s campay.Status) bool {
+	return isFinal(s) && s != campay.StatusSuccessful
+}
@@ -0,0 +1,132 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== SWEEPER ==========================
+   ============================================================ */
+
+// sweeper keeps the ledger free of transactions stuck in PENDING when no
+// poller or webhook finished them: entries older than grace are checked
+// against the API once more and, if still not final, marked EXPIRED_LOCAL.
+type sweeper struct {
+	ledger   *Ledger
+	grace    time.Duration
+	provider func() (Provider, error)
+
+	// notify, if set, is called for every entry the sweeper changed.
+	notify func(e LedgerEntry)
+	// coord, if set, limits sweeping to one replica at a time.
+	coord Coordinator
+}
+
+// run sweeps every interval until ctx is done.
+func (s *sweeper) run(ctx context.Context, every time.Duration) {
+	ticker := time.NewTicker(every)
+	defer ticker.Stop()
+	for {
+		if s.leader(2 * every) {
+			if n, err := s.sweep(); err != nil {
+				fmt.Println("⚠ Sweeper:", err)
+			} else if n > 0 {
+				fmt.Printf("🧹 Sweeper settled %d stale transaction(s)\n", n)
+			}
+		}
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// leader reports whether this replica holds the sweeper lease, taking or
+// renewing it for ttl.
+func (s *sweeper) leader(ttl time.Duration) bool {
+	if s.coord == nil {
+		return true
+	}
+	ok, err := s.coord.Acquire(leaseSweeper, ttl)
+	if err != nil {
+		fmt.Println("⚠ Sweeper:", err)
+	}
+	return ok
+}
+
+// sweep handles every stale entry once and returns how many changed.
+func (s *sweeper) sweep() (int, error) {
+	entries, err := s.ledger.Entries()
+	if err != nil {
+		return 0, err
+	}
+
+	var provider Provider
+	changed := 0
+	for _, e := range entries {
+		if (e.Status != campay.StatusPending && e.Status != campay.StatusUnknown) || time.Since(e.CreatedAt) < s.grace {
+			continue
+		}
+		if provider == nil {
+			if provider, err = s.provider(); err != nil {
+				return changed, err
+			}
+		}
+
+		if s.coord != nil {
+			if ok, err := s.coord.Acquire(txnLease(e.Reference), time.Minute); err != nil || !ok {
+				continue // another replica is polling it
+			}
+		}
+		if s.settle(provider, e.Reference) {
+			changed++
+		}
+		if s.coord != nil {
+			s.coord.Release(txnLease(e.Reference))
+		}
+	}
+	return changed, nil
+}
+
+// settle checks one stale reference against the API and finalizes or
+// expires it, reporting whether the entry changed. The entry is read again
+// first, since a poller or webhook may have finished it meanwhile.
+func (s *sweeper) settle(provider Provider, reference string) bool {
+	current, err := s.ledger.Get(reference)
+	if err != nil || current == nil || (current.Status != campay.StatusPending && current.Status != campay.StatusUnknown) {
+		return false
+	}
+	e := *current
+
+	txn, err := provider.Status(context.Background(), e.Reference)
+	if err != nil {
+		fmt.Printf("⚠ Sweeper: could not check %s: %v\n", e.Reference, err)
+		return false
+	}
+	if status := parseStatus(txn.Status); isFinal(status) {
+		if err := s.ledger.UpdateStatus(e.Reference, status, txn.Operator); err != nil {
+			fmt.Println("⚠ Sweeper:", err)
+			return false
+		}
+		e.Status = status
+	} else {
+		reason := fmt.Sprintf("still %s after %s", status, s.grace)
+		updated, err := s.ledger.MarkAbandoned(e.Reference, campay.StatusExpiredLocal, reason)
+		if err != nil {
+			fmt.Println("⚠ Sweeper:", err)
+			return false
+		}
+		e = *updated
+	}
+
+	fmt.Printf("  %s → %s\n", e.Reference, e.Status)
+	if s.notify != nil {
+		s.notify(e)
+	}
+	return true
+}
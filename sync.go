@@ -0,0 +1,210 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   =========================== SYNC ============================
+   ============================================================ */
+
+// syncWatermarks maps "<environment>/<profile>" to the time the last
+// successful sync started.
+type syncWatermarks map[string]time.Time
+
+func watermarksPath() (string, error) {
+	dir, err := dataDir()
+	if err != nil {
+		return "", err
+	}
+	return filepath.Join(dir, "sync.json"), nil
+}
+
+func loadWatermarks() (syncWatermarks, error) {
+	path, err := watermarksPath()
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return syncWatermarks{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	w := syncWatermarks{}
+	if err := json.Unmarshal(data, &w); err != nil {
+		return nil, fmt.Errorf("failed to parse %s: %w", path, err)
+	}
+	return w, nil
+}
+
+func saveWatermarks(w syncWatermarks) error {
+	path, err := watermarksPath()
+	if err != nil {
+		return err
+	}
+	data, err := json.MarshalIndent(w, "", "  ")
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(path, data, 0600)
+}
+
+// syncOptions are the flags of sync.
+type syncOptions struct {
+	since string
+	days  int
+}
+
+// syncFlags defines the flags of sync on fs.
+func syncFlags(fs *flag.FlagSet, cfg *Config) *syncOptions {
+	opt := &syncOptions{}
+	fs.StringVar(&opt.since, "since", "", "start date (YYYY-MM-DD), overriding the stored watermark")
+	fs.IntVar(&opt.days, "days", 30, "days to import on the first sync")
+	return opt
+}
+
+// runSync pulls CamPay history since the last sync and upserts it into the
+// ledger, so transactions started elsewhere show up in local reports.
+func runSync(cfg *Config, args []string) error {
+	fs := newFlagSet("sync")
+	opt := syncFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	watermarks, err := loadWatermarks()
+	if err != nil {
+		return err
+	}
+
+	key := cfg.Env + "/" + cfg.Profile
+	started := inZone(time.Now())
+
+	var start time.Time
+	switch last, ok := watermarks[key]; {
+	case opt.since != "":
+		if start, err = time.ParseInLocation("2006-01-02", opt.since, reportZone); err != nil {
+			return invalidInput("--since must be a date like 2026-01-31")
+		}
+	case ok:
+		// History is filtered by day, so re-read the watermark's day
+		start = inZone(last.Add(-24 * time.Hour))
+	default:
+		start = started.AddDate(0, 0, -opt.days)
+	}
+
+	client, err := authenticate(cfg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("🔄 Fetching history from %s to %s (days in %s)...\n", start.Format("2006-01-02"), started.Format("2006-01-02"), zoneLabel(started))
+	items, err := client.History(context.Background(), start, started)
+	if err != nil {
+		return err
+	}
+
+	entries, err := ledger.Entries()
+	if err != nil {
+		return err
+	}
+	known := map[string]LedgerEntry{}
+	for _, e := range entries {
+		known[e.Reference] = e
+	}
+
+	inserted, updated := 0, 0
+	for _, item := range items {
+		printWarnings(item.Warnings)
+		status := parseStatus(item.Status)
+
+		if e, ok := known[item.Reference]; ok {
+			next, err := statusPolicy.Transition(e.Status, status)
+			if err != nil {
+				fmt.Println("⚠", item.Reference+":", err)
+				continue
+			}
+			if next != e.Status {
+				if err := ledger.UpdateStatus(item.Reference, status, item.Operator); err != nil {
+					return err
+				}
+				updated++
+			}
+			continue
+		}
+
+		phone, err := normalizePhone(item.PhoneNumber)
+		if err != nil {
+			phone = item.PhoneNumber
+		}
+		created, err := item.Time()
+		if err != nil {
+			fmt.Printf("⚠ %s: %v; using the sync time\n", item.Reference, err)
+			created = time.Now().UTC()
+		}
+		err = ledger.Record(LedgerEntry{
+			Reference:         item.Reference,
+			ExternalReference: item.ExternalReference,
+			Kind:              historyKind(item.Type),
+			Phone:             phone,
+			Amount:            item.Amount.Int(),
+			Currency:          item.Currency,
+			Description:       item.Description,
+			Status:            status,
+			Operator:          item.Operator,
+			Environment:       cfg.Env,
+			Source:            "sync",
+			Refund:            historyRefund(item.Type),
+			CreatedAt:         created,
+		})
+		if err != nil {
+			return err
+		}
+		inserted++
+	}
+
+	watermarks[key] = started
+	if err := saveWatermarks(watermarks); err != nil {
+		return err
+	}
+
+	fmt.Printf("✓ Synced %d transactions (%d new, %d updated)\n", len(items), inserted, updated)
+	return nil
+}
+
+// historyKind maps the history type to the ledger's collect/withdraw.
+func historyKind(t string) string {
+	t = strings.ToLower(t)
+	switch {
+	case historyRefund(t):
+		return "withdraw"
+	case strings.Contains(t, "withdraw"), strings.Contains(t, "payout"), strings.Contains(t, "debit"):
+		return "withdraw"
+	case strings.Contains(t, "collect"), strings.Contains(t, "credit"):
+		return "collect"
+	default:
+		return "remote"
+	}
+}
+
+// historyRefund reports whether the history type is a refund or reversal.
+// CamPay does not say which collection it returns, so synced refunds are
+// reported without an origin.
+func historyRefund(t string) bool {
+	t = strings.ToLower(t)
+	return strings.Contains(t, "refund") || strings.Contains(t, "revers")
+}
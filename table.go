@@ -0,0 +1,253 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+	"unicode/utf8"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   =========================== TABLES ==========================
+   ============================================================ */
+
+// List output, set by the global --format and --wide flags. An empty
+// listFormat means json with --output json, table otherwise.
+var (
+	listFormat string
+	wide       bool
+)
+
+// tableFormat returns the effective list format: table, csv or json.
+func tableFormat() string {
+	if listFormat != "" {
+		return listFormat
+	}
+	if outputFormat == "json" {
+		return "json"
+	}
+	return "table"
+}
+
+// tableColumn describes one column of a list.
+type tableColumn struct {
+	Name   string // header; lowercased with underscores as the CSV/JSON key
+	Right  bool   // right-align, e.g. for counts
+	Amount bool   // right-align and group the numbers by thousands
+	Max    int    // truncate longer cells in table mode unless --wide (0: never)
+	Wide   bool   // only shown in table mode with --wide; always in CSV/JSON
+}
+
+func (c tableColumn) key() string {
+	return strings.ReplaceAll(strings.ToLower(c.Name), " ", "_")
+}
+
+// table collects rows and renders them as an aligned table, CSV or JSON,
+// so every list-style command prints the same way.
+type table struct {
+	cols   []tableColumn
+	rows   [][]any
+	empty  string
+	footer []string
+}
+
+// newTable starts a list. empty is printed in table mode when no row is
+// added.
+func newTable(empty string, cols ...tableColumn) *table {
+	return &table{cols: cols, empty: empty}
+}
+
+// Row adds one row, with a value per column. Cells are printed with
+// fmt.Sprint; a campay.Status is translated and colored in table mode,
+// and times are shown in the reporting zone (see inZone).
+func (t *table) Row(cells ...any) {
+	t.rows = append(t.rows, cells)
+}
+
+// Footer adds a line printed under the table, in table mode only.
+func (t *table) Footer(format string, args ...any) {
+	t.footer = append(t.footer, fmt.Sprintf(format, args...))
+}
+
+// Print writes the list to stdout in the selected format.
+func (t *table) Print() error {
+	return t.render(os.Stdout, tableFormat())
+}
+
+func (t *table) render(w io.Writer, format string) error {
+	switch format {
+	case "json":
+		list := make([]map[string]any, 0, len(t.rows))
+		for _, row := range t.rows {
+			obj := map[string]any{}
+			for i, c := range t.cols {
+				obj[c.key()] = jsonCell(row[i])
+			}
+			list = append(list, obj)
+		}
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(list)
+
+	case "csv":
+		cw := csv.NewWriter(w)
+		header := make([]string, len(t.cols))
+		for i, c := range t.cols {
+			header[i] = c.key()
+		}
+		cw.Write(header)
+		for _, row := range t.rows {
+			record := make([]string, len(t.cols))
+			for i := range t.cols {
+				record[i] = fmt.Sprint(jsonCell(row[i]))
+			}
+			cw.Write(record)
+		}
+		cw.Flush()
+		return cw.Error()
+	}
+
+	if len(t.rows) == 0 {
+		if t.empty != "" {
+			fmt.Fprintln(w, t.empty)
+		}
+		return nil
+	}
+
+	var shown []int
+	for i, c := range t.cols {
+		if !c.Wide || wide {
+			shown = append(shown, i)
+		}
+	}
+	cells := make([][]string, len(t.rows))
+	widths := make([]int, len(t.cols))
+	for _, i := range shown {
+		widths[i] = utf8.RuneCountInString(t.cols[i].Name)
+	}
+	for r, row := range t.rows {
+		cells[r] = make([]string, len(t.cols))
+		for _, i := range shown {
+			s := tableCell(row[i])
+			if t.cols[i].Amount {
+				s = groupedCell(row[i], s)
+			}
+			if limit := t.cols[i].Max; limit > 0 && !wide {
+				s = truncate(s, limit)
+			}
+			cells[r][i] = s
+			widths[i] = max(widths[i], visibleWidth(s))
+		}
+	}
+
+	line := func(values []string) {
+		var b strings.Builder
+		for n, i := range shown {
+			pad := strings.Repeat(" ", widths[i]-visibleWidth(values[i]))
+			switch {
+			case t.cols[i].Right || t.cols[i].Amount:
+				b.WriteString(pad + values[i])
+			case n == len(shown)-1:
+				b.WriteString(values[i]) // no trailing spaces
+			default:
+				b.WriteString(values[i] + pad)
+			}
+			if n < len(shown)-1 {
+				b.WriteString("  ")
+			}
+		}
+		fmt.Fprintln(w, b.String())
+	}
+
+	header := make([]string, len(t.cols))
+	for i, c := range t.cols {
+		header[i] = strings.ToUpper(c.Name)
+	}
+	line(header)
+	for _, row := range cells {
+		line(row)
+	}
+	if len(t.footer) > 0 {
+		fmt.Fprintln(w)
+		for _, f := range t.footer {
+			fmt.Fprintln(w, f)
+		}
+	}
+	return nil
+}
+
+// tableCell formats a value for the aligned table.
+func tableCell(v any) string {
+	switch v := v.(type) {
+	case campay.Status:
+		return colorStatus(string(v))
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return inZone(v).Format("2006-01-02 15:04 MST")
+	case nil:
+		return ""
+	}
+	return fmt.Sprint(v)
+}
+
+// groupedCell writes the numbers of amount columns with the thousands
+// separator of --lang, leaving other cells as formatted.
+func groupedCell(v any, s string) string {
+	switch v := v.(type) {
+	case int:
+		return formatAmount(v, "")
+	case int64:
+		return formatAmount(int(v), "")
+	case campay.Amount:
+		return formatMoney(v, "")
+	}
+	return s
+}
+
+// jsonCell keeps numbers and booleans typed and formats times as RFC 3339,
+// with the offset of the reporting zone.
+func jsonCell(v any) any {
+	switch v := v.(type) {
+	case campay.Status:
+		return string(v)
+	case time.Time:
+		if v.IsZero() {
+			return ""
+		}
+		return inZone(v).Format(time.RFC3339)
+	}
+	return v
+}
+
+// truncate shortens s to n runes, marking the cut with an ellipsis.
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-1]) + "…"
+}
+
+// visibleWidth counts the runes of s, ignoring ANSI color sequences.
+func visibleWidth(s string) int {
+	n := 0
+	for i := 0; i < len(s); {
+		if s[i] == '\033' {
+			if end := strings.IndexByte(s[i:], 'm'); end >= 0 {
+				i += end + 1
+				continue
+			}
+		}
+		_, size := utf8.DecodeRuneInString(s[i:])
+		i += size
+		n++
+	}
+	return n
+}
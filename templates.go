@@ -0,0 +1,145 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"text/template"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= TEMPLATES =========================
+   ============================================================ */
+
+// templateVars collects key=value pairs from repeated --var flags.
+type templateVars map[string]string
+
+func (v templateVars) String() string {
+	pairs := make([]string, 0, len(v))
+	for k, val := range v {
+		pairs = append(pairs, k+"="+val)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (v templateVars) Set(s string) error {
+	key, value, ok := strings.Cut(s, "=")
+	if !ok || strings.TrimSpace(key) == "" {
+		return fmt.Errorf("expected key=value, got %q", s)
+	}
+	v[strings.TrimSpace(key)] = value
+	return nil
+}
+
+// renderDescription executes a text/template such as
+// "Order {{.OrderID}} - {{.Date}}". Date and Time are always available;
+// vars adds or overrides values. Unknown variables are an error so typos
+// don't end up in CamPay's dashboard.
+func renderDescription(tmpl string, vars map[string]string) (string, error) {
+	t, err := template.New("description").Option("missingkey=error").Parse(tmpl)
+	if err != nil {
+		return "", invalidInput("invalid description template: %v", err)
+	}
+
+	now := inZone(time.Now())
+	data := map[string]string{
+		"Date": now.Format("2006-01-02"),
+		"Time": now.Format("15:04"),
+	}
+	for k, v := range vars {
+		data[k] = v
+	}
+
+	var sb strings.Builder
+	if err := t.Execute(&sb, data); err != nil {
+		return "", invalidInput("description template: %v", err)
+	}
+	return strings.TrimSpace(sb.String()), nil
+}
+
+// outgoingDescription prepares a description for CamPay: whitespace is
+// normalized, the text is transliterated to ASCII when the operator is
+// listed in ascii_descriptions, and it is shortened to what CamPay accepts
+// with a warning.
+func outgoingDescription(cfg *Config, description, operator string) string {
+	out := campay.NormalizeDescription(description)
+	if cfg.ASCIIDescriptions[operator] || cfg.ASCIIDescriptions["*"] {
+		out = campay.Transliterate(out)
+	}
+	out, cut := campay.FitDescription(out, campay.MaxDescriptionLength)
+	if cut {
+		fmt.Printf("⚠ Description shortened to %d characters: %q\n", campay.MaxDescriptionLength, out)
+	}
+	return out
+}
+
+// requestOperator is the operator a request goes through: the one given,
+// or the one of the number's prefix.
+func requestOperator(given, phone string) string {
+	if given != "" {
+		return given
+	}
+	return operatorFor(phone)
+}
+
+// =============================================================
+// Receipt templates
+// =============================================================
+
+// receiptData is what a --template receipt sees: every TransactionResponse
+// field plus values computed by the CLI.
+type receiptData struct {
+	*campay.TransactionResponse
+	StatusLabel string        // translated status
+	Fee         campay.Amount // from the response when CamPay reports one
+	Converted   string        // e.g. "≈ 22.87 EUR", empty without conversion
+	Duration    time.Duration // from initiation to the final status
+	LocalTime   time.Time
+	Phone       string
+}
+
+var receiptFuncs = template.FuncMap{
+	"upper": strings.ToUpper,
+	"lower": strings.ToLower,
+	"money": func(v float64) string { return strconv.FormatFloat(v, 'f', 0, 64) },
+	"date":  func(t time.Time, layout string) string { return t.Format(layout) },
+}
+
+// loadReceiptTemplate parses a receipt template file up front, so a typo
+// is reported before any money moves.
+func loadReceiptTemplate(path string) (*template.Template, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, exitErr(exitValidation, fmt.Errorf("failed to read receipt template: %w", err))
+	}
+	t, err := template.New(filepath.Base(path)).Funcs(receiptFuncs).Option("missingkey=error").Parse(string(data))
+	if err != nil {
+		return nil, invalidInput("invalid receipt template: %v", err)
+	}
+	return t, nil
+}
+
+func newReceiptData(s *campay.TransactionResponse, fx *fxDisplay, phone string, started time.Time) receiptData {
+	d := receiptData{
+		TransactionResponse: s,
+		StatusLabel:         statusLabel(s.Status),
+		Converted:           fx.Convert(float64(s.Amount)),
+		Duration:            time.Since(started).Round(time.Second),
+		LocalTime:           time.Now(),
+		Phone:               phone,
+	}
+	for _, key := range []string{"fee", "app_fee", "charges"} {
+		if raw, ok := s.Raw[key]; ok {
+			if err := json.Unmarshal(raw, &d.Fee); err == nil {
+				break
+			}
+		}
+	}
+	return d
+}
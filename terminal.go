@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"os/signal"
+	"strings"
+
+	"golang.org/x/term"
+)
+
+/* ============================================================
+   ========================== TERMINAL =========================
+   ============================================================ */
+
+// The differences between Unix terminals and Windows consoles stay here:
+// how a terminal is recognized, whether it understands the ANSI escapes
+// used for colors and the progress line (terminal_windows.go turns them on
+// where the console supports them), and reading a secret without echo.
+// Answers typed on Windows end in \r\n; the Prompter trims both.
+
+// isTerminal reports whether f is an interactive terminal rather than a
+// pipe or file (or the NUL device on Windows).
+func isTerminal(f *os.File) bool {
+	return term.IsTerminal(int(f.Fd()))
+}
+
+// ansiStdout and ansiStderr are whether escape sequences written to the
+// real stdout and stderr are interpreted rather than printed. Without
+// them, statuses are not colored and progress is printed line by line.
+var (
+	ansiStdout = enableANSI(os.Stdout)
+	ansiStderr = enableANSI(os.Stderr)
+)
+
+// promptSecret asks for a password or key. On a terminal the answer is not
+// echoed; otherwise, e.g. when answers are piped, it is read like any other.
+func promptSecret(prompt string) (string, error) {
+	if _, ok := prompts.(*ioPrompter); !ok || !isTerminal(os.Stdin) {
+		return promptUser(prompt)
+	}
+	fd := int(os.Stdin.Fd())
+	state, err := term.GetState(fd)
+	if err != nil {
+		return promptUser(prompt)
+	}
+
+	// Ctrl-C would otherwise leave the terminal without echo
+	interrupted := make(chan os.Signal, 1)
+	signal.Notify(interrupted, os.Interrupt)
+	go func() {
+		if _, ok := <-interrupted; ok {
+			term.Restore(fd, state)
+			fmt.Println()
+			os.Exit(exitCancelled)
+		}
+	}()
+	defer func() {
+		signal.Stop(interrupted)
+		close(interrupted)
+	}()
+
+	for {
+		fmt.Print(prompt)
+		secret, err := term.ReadPassword(fd)
+		fmt.Println()
+		if err != nil {
+			return "", err
+		}
+		if s := strings.TrimSpace(string(secret)); s != "" {
+			return s, nil
+		}
+	}
+}
@@ -0,0 +1,11 @@
+//go:build !windows
+
+package main
+
+import "os"
+
+// enableANSI reports whether escapes written to f are interpreted, which
+// every terminal outside Windows does unless it declares itself dumb.
+func enableANSI(f *os.File) bool {
+	return os.Getenv("TERM") != "dumb"
+}
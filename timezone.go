@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"time"
+	_ "time/tzdata" // Africa/Douala on machines without a zone database
+)
+
+/* ============================================================
+   ========================= TIME ZONE =========================
+   ============================================================ */
+
+// A day starts at midnight in Cameroon (Africa/Douala, UTC+1), where the
+// bank and CamPay's dashboard cut theirs, whatever zone the machine runs
+// in: a server on UTC would otherwise put a payment made at 00:30 on the
+// day before. The timezone setting picks another zone (UTC, Local or any
+// IANA name). Daily totals and risk limits, --since dates, the dashboard
+// charts, accounting periods, history and sync dates all use it, and
+// times shown or exported carry its name or offset.
+
+const defaultTimezone = "Africa/Douala"
+
+// reportZone is the zone of days, set from the timezone setting.
+var reportZone = mustLoadZone(defaultTimezone)
+
+func mustLoadZone(name string) *time.Location {
+	loc, err := time.LoadLocation(name)
+	if err != nil {
+		panic(err)
+	}
+	return loc
+}
+
+// loadTimezone reads the timezone setting.
+func loadTimezone(name string) (*time.Location, error) {
+	switch strings.ToLower(strings.TrimSpace(name)) {
+	case "":
+		name = defaultTimezone
+	case "local":
+		return time.Local, nil
+	case "utc":
+		return time.UTC, nil
+	}
+	loc, err := time.LoadLocation(strings.TrimSpace(name))
+	if err != nil {
+		return nil, invalidInput("unknown timezone %q (use a name like Africa/Douala, UTC or Local)", name)
+	}
+	return loc, nil
+}
+
+// inZone returns t in the reporting zone.
+func inZone(t time.Time) time.Time { return t.In(reportZone) }
+
+// sameDay reports whether a and b fall on the same day of the reporting
+// zone.
+func sameDay(a, b time.Time) bool {
+	ay, am, ad := inZone(a).Date()
+	by, bm, bd := inZone(b).Date()
+	return ay == by && am == bm && ad == bd
+}
+
+// ianaZone is the name of the reporting zone for browsers, "" for the
+// machine's own zone.
+func ianaZone() string {
+	if reportZone == time.Local {
+		return ""
+	}
+	return reportZone.String()
+}
+
+// zoneLabel names the reporting zone with its offset at t, for headers:
+// Africa/Douala UTC+01:00.
+func zoneLabel(t time.Time) string {
+	name := reportZone.String()
+	if reportZone == time.Local {
+		name = "local time"
+	}
+	if reportZone == time.UTC {
+		return "UTC"
+	}
+	return fmt.Sprintf("%s UTC%s", name, inZone(t).Format("-07:00"))
+}
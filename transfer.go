@@ -0,0 +1,227 @@
+package main
+
+import (
+	"context"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================= TRANSFERS =========================
+   ============================================================ */
+
+// CamPay's API has no endpoint moving balance between two apps of the
+// same account, so a transfer goes through a treasury wallet: a payout
+// from the source app to that number, then a collection into the target
+// app from it, confirmed on the treasury handset. Both legs are recorded
+// in the ledger with Source "transfer" and the transfer ID as settlement,
+// and are left out of the collection and payout totals and risk rules.
+const transferSource = "transfer"
+
+// transferApp is one side of a transfer.
+type transferApp struct {
+	name     string
+	cfg      *Config
+	provider Provider
+}
+
+func openTransferApp(cfg *Config, profile string) (*transferApp, error) {
+	c := *cfg
+	if err := applyProfile(&c, profile); err != nil {
+		return nil, err
+	}
+	provider, err := connectProvider(&c)
+	if err != nil {
+		return nil, err
+	}
+	return &transferApp{name: profile, cfg: &c, provider: provider}, nil
+}
+
+// transferOptions are the flags of transfer.
+type transferOptions struct {
+	from   string
+	to     string
+	amount string
+	via    string
+	id     string
+	yes    bool
+}
+
+// transferFlags defines the flags of transfer on fs.
+func transferFlags(fs *flag.FlagSet, cfg *Config) *transferOptions {
+	opt := &transferOptions{}
+	fs.StringVar(&opt.from, "from", "", "profile of the app to move balance from")
+	fs.StringVar(&opt.to, "to", "", "profile of the app to move balance to")
+	fs.StringVar(&opt.amount, "amount", "", "amount to move, e.g. 50000 or 50k")
+	fs.StringVar(&opt.via, "via", cfg.TreasuryPhone, "treasury wallet the money passes through (number or @contact)")
+	fs.StringVar(&opt.id, "id", "", "transfer ID (default: TRF-<unix time>)")
+	fs.BoolVar(&opt.yes, "yes", false, "do not ask for confirmation")
+	return opt
+}
+
+// runTransfer moves balance from one configured app (profile) to another.
+func runTransfer(cfg *Config, args []string) error {
+	fs := newFlagSet("transfer")
+	opt := transferFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if err := refuseReadOnly(cfg, "transfer"); err != nil {
+		return err
+	}
+	if opt.from == "" || opt.to == "" || opt.amount == "" {
+		return invalidInput("usage: campay transfer --from <profile> --to <profile> --amount <amount> [--via <treasury phone>]")
+	}
+	if opt.from == opt.to {
+		return invalidInput("--from and --to must be different apps")
+	}
+	if opt.via == "" {
+		return invalidInput("a treasury wallet is required (--via or treasury_phone in the config file)")
+	}
+	treasury, err := resolvePhone(opt.via)
+	if err != nil {
+		return err
+	}
+	amt, err := parseAmount(opt.amount)
+	if err != nil {
+		return err
+	}
+	if opt.id == "" {
+		opt.id = fmt.Sprintf("TRF-%d", time.Now().Unix())
+	}
+
+	ledger, err := openLedger()
+	if err != nil {
+		return err
+	}
+	src, err := openTransferApp(cfg, opt.from)
+	if err != nil {
+		return err
+	}
+	dst, err := openTransferApp(cfg, opt.to)
+	if err != nil {
+		return err
+	}
+
+	if bp, ok := src.provider.(balanceProvider); ok {
+		balance, err := bp.Balance(context.Background())
+		if err != nil {
+			return fmt.Errorf("failed to fetch the balance of %s: %w", src.name, err)
+		}
+		printWarnings(balance.Warnings)
+		if campay.Amount(amt) > balance.TotalBalance {
+			return exitErr(exitInsufficientFunds, fmt.Errorf("%s holds %.0f %s, less than the %d XAF to move",
+				src.name, balance.TotalBalance, balance.Currency, amt))
+		}
+	}
+
+	fmt.Printf("Transfer %s: %s from %s to %s via %s\n", opt.id, formatAmount(amt, "XAF"), src.name, dst.name, treasury)
+	fmt.Printf("  1. payout from %s to %s\n", src.name, treasury)
+	fmt.Printf("  2. collection into %s from %s, to confirm on the treasury handset\n", dst.name, treasury)
+	if !opt.yes {
+		answer, err := promptUser("Move the balance? [y/N]: ")
+		if err != nil {
+			return err
+		}
+		if a := strings.ToLower(answer); a != "y" && a != "yes" {
+			return exitErr(exitCancelled, fmt.Errorf("transfer not confirmed"))
+		}
+	}
+
+	description := fmt.Sprintf("Transfer %s %s to %s", opt.id, src.name, dst.name)
+	out := LedgerEntry{
+		ExternalReference: opt.id + "-out",
+		Kind:              "withdraw",
+		Phone:             treasury,
+		Amount:            amt,
+		Currency:          "XAF",
+		Description:       description,
+		Source:            transferSource,
+		Settlement:        opt.id,
+	}
+	if err := transferLeg(src, ledger, &out); err != nil {
+		return fmt.Errorf("transfer %s: payout from %s did not complete: %w", opt.id, src.name, err)
+	}
+
+	in := out
+	in.ExternalReference, in.Kind = opt.id+"-in", "collect"
+	if err := transferLeg(dst, ledger, &in); err != nil {
+		fmt.Printf("⚠ %s left %s but are still on %s. Finish with:\n", formatAmount(amt, "XAF"), src.name, treasury)
+		fmt.Printf("  campay --profile %s collect --phone %s --amount %d --external-ref %s\n", dst.name, treasury, amt, in.ExternalReference)
+		return fmt.Errorf("transfer %s: collection into %s failed: %w", opt.id, dst.name, err)
+	}
+
+	fmt.Printf("✓ Moved %s from %s to %s (%s, %s)\n", formatAmount(amt, "XAF"), src.name, dst.name, out.Reference, in.Reference)
+	return nil
+}
+
+// transferLeg submits one side of a transfer, records it and waits until
+// it is final; anything but SUCCESSFUL is an error.
+func transferLeg(app *transferApp, ledger *Ledger, e *LedgerEntry) error {
+	operator, _, err := knownOperator(app.cfg, ledger, e.Phone)
+	if err != nil {
+		return err
+	}
+	if err := auditMoney(app.cfg, e.Kind, auditRequested, *e); err != nil {
+		return err
+	}
+
+	switch e.Kind {
+	case "withdraw":
+		var resp *campay.WithdrawResponse
+		resp, err = app.provider.Withdraw(context.Background(), campay.WithdrawRequest{
+			Amount:            e.Amount,
+			Currency:          e.Currency,
+			To:                e.Phone,
+			Description:       e.Description,
+			ExternalReference: e.ExternalReference,
+			Operator:          sentOperator(e.Phone, operator),
+		})
+		if err == nil {
+			e.Reference = resp.Reference
+		}
+	case "collect":
+		var resp *campay.CollectResponse
+		resp, err = submitCollect(app.provider, campay.CollectRequest{
+			Amount:            e.Amount,
+			Currency:          e.Currency,
+			From:              e.Phone,
+			Description:       e.Description,
+			ExternalReference: e.ExternalReference,
+			Operator:          sentOperator(e.Phone, operator),
+		})
+		if err == nil {
+			e.Reference, e.Review = resp.Reference, reviewReason(resp)
+			printDialHint(resp)
+		}
+	}
+	if err != nil {
+		auditMoney(app.cfg, e.Kind, "error: "+err.Error(), *e)
+		return err
+	}
+	auditMoney(app.cfg, e.Kind, auditInitiated, *e)
+
+	e.Status = campay.StatusPending
+	e.Environment = app.cfg.Env
+	recordLedger(ledger, *e)
+	fmt.Printf("• %s %s: %s\n", app.name, e.Kind, e.Reference)
+
+	status, err := pollTransactionStatus(app.provider, ledger, e.Reference, app.cfg.Deadline, nil)
+	if err != nil {
+		return err
+	}
+	final := parseStatus(status.Status)
+	if err := ledger.UpdateStatus(e.Reference, final, status.Operator); err != nil {
+		fmt.Println("⚠ Failed to update ledger:", err)
+	}
+	auditMoney(app.cfg, e.Kind, string(final), *e)
+	e.Status = final
+	if final != campay.StatusSuccessful {
+		return exitErr(exitPaymentFailed, fmt.Errorf("%s ended %s", e.Reference, final))
+	}
+	return nil
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"runtime"
+	"runtime/debug"
+
+	"cohort5-go-api/campay"
+)
+
+/* ============================================================
+   ========================== VERSION ==========================
+   ============================================================ */
+
+// version is set at build time:
+//
+//	go build -ldflags "-X main.version=v1.4.0"
+//
+// Without it, the module version from `go install` is used, or "dev".
+var version = "dev"
+
+// buildVersion returns the version of this binary.
+func buildVersion() string {
+	if version != "dev" {
+		return version
+	}
+	if info, ok := debug.ReadBuildInfo(); ok && info.Main.Version != "" && info.Main.Version != "(devel)" {
+		return info.Main.Version
+	}
+	return version
+}
+
+// buildCommit returns the VCS revision the binary was built from, if the
+// toolchain recorded one.
+func buildCommit() string {
+	info, ok := debug.ReadBuildInfo()
+	if !ok {
+		return ""
+	}
+	var revision, modified string
+	for _, s := range info.Settings {
+		switch s.Key {
+		case "vcs.revision":
+			revision = s.Value
+		case "vcs.modified":
+			modified = s.Value
+		}
+	}
+	if len(revision) > 12 {
+		revision = revision[:12]
+	}
+	if revision != "" && modified == "true" {
+		revision += "-dirty"
+	}
+	return revision
+}
+
+// userAgent identifies the CLI to CamPay and to relay destinations, e.g.
+// "campay-cli/v1.4.0 campay-go (go1.25.4; linux/amd64)".
+func userAgent() string {
+	return "campay-cli/" + buildVersion() + " " + campay.DefaultUserAgent()
+}
+
+// versionOptions are the flags of version.
+type versionOptions struct {
+	short bool
+}
+
+// versionFlags defines the flags of version on fs.
+func versionFlags(fs *flag.FlagSet, cfg *Config) *versionOptions {
+	opt := &versionOptions{}
+	fs.BoolVar(&opt.short, "short", false, "print only the version")
+	return opt
+}
+
+// runVersion prints the build version, for bug reports and support.
+func runVersion(cfg *Config, args []string) error {
+	fs := newFlagSet("version")
+	opt := versionFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+	if opt.short {
+		fmt.Println(buildVersion())
+		return nil
+	}
+	fmt.Println("campay", buildVersion())
+	if commit := buildCommit(); commit != "" {
+		fmt.Println("Commit:    ", commit)
+	}
+	fmt.Printf("Go:         %s %s/%s\n", runtime.Version(), runtime.GOOS, runtime.GOARCH)
+	fmt.Println("User-Agent:", userAgent())
+	return nil
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"strings"
+	"time"
+)
+
+/* ============================================================
+   ==================== WEBHOOK KEY ROTATION ===================
+   ============================================================ */
+
+// A webhook key is rotated in two steps, so no callback is dropped while
+// CamPay switches to the new key:
+//
+//  1. `webhook rotate-key` stores the new key of a profile and keeps the
+//     old one as previous_webhook_key; callbacks signed with either verify.
+//  2. Once callbacks only come with the new key (serve warns about those
+//     signed with the previous one), `webhook drop-previous-key` removes it.
+//
+// Both steps are written to the audit log with key fingerprints, never the
+// keys.
+
+// keyFingerprint identifies a key in logs without revealing it.
+func keyFingerprint(key string) string {
+	if key == "" {
+		return ""
+	}
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:4])
+}
+
+// auditRotation logs a step of a rotation. The config file is already
+// written, so a failure only warns.
+func auditRotation(ev AuditEvent) {
+	ev.Action = "webhook_key_rotate"
+	if err := appendAudit(ev); err != nil {
+		fmt.Println("⚠ Failed to write the audit log:", err)
+	}
+}
+
+func runWebhook(cfg *Config, args []string) error {
+	if len(args) == 0 {
+		return invalidInput("usage: campay webhook rotate-key|drop-previous-key [flags]")
+	}
+	switch args[0] {
+	case "rotate-key":
+		return rotateWebhookKey(cfg, args[1:])
+	case "drop-previous-key":
+		return dropPreviousWebhookKey(cfg, args[1:])
+	default:
+		return invalidInput("unknown webhook command %q (use rotate-key or drop-previous-key)", args[0])
+	}
+}
+
+// webhookProfile returns the config file and the name of the profile a
+// webhook command changes.
+func webhookProfile(name string) (*FileConfig, string, error) {
+	if name == "" {
+		name = "default"
+	}
+	fc, err := loadFileConfig()
+	if err != nil {
+		return nil, "", err
+	}
+	if fc.Profiles == nil {
+		fc.Profiles = map[string]Profile{}
+	}
+	return fc, name, nil
+}
+
+// webhookRotateKeyOptions are the flags of webhook rotate-key.
+type webhookRotateKeyOptions struct {
+	key  string
+	name string
+}
+
+// webhookRotateKeyFlags defines the flags of webhook rotate-key on fs.
+func webhookRotateKeyFlags(fs *flag.FlagSet, cfg *Config) *webhookRotateKeyOptions {
+	opt := &webhookRotateKeyOptions{}
+	fs.StringVar(&opt.key, "key", "", "the new webhook key from the CamPay dashboard (prompted if empty)")
+	fs.StringVar(&opt.name, "name", cfg.Profile, "profile to change (default: the active profile or \"default\")")
+	return opt
+}
+
+func rotateWebhookKey(cfg *Config, args []string) error {
+	fs := newFlagSet("webhook rotate-key")
+	opt := webhookRotateKeyFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	fc, profile, err := webhookProfile(opt.name)
+	if err != nil {
+		return err
+	}
+	p := fc.Profiles[profile]
+	current := p.WebhookKey
+	if current == "" {
+		current = cfg.WebhookKey // from the environment or a secret manager
+	}
+
+	newKey := strings.TrimSpace(opt.key)
+	if newKey == "" {
+		if newKey, err = promptSecret("New webhook key: "); err != nil {
+			return err
+		}
+		newKey = strings.TrimSpace(newKey)
+	}
+	if newKey == "" {
+		return invalidInput("the new webhook key is empty")
+	}
+	if newKey == current {
+		return invalidInput("the new webhook key is the one already in use")
+	}
+	if p.PreviousWebhookKey != "" && p.PreviousWebhookKey != current {
+		fmt.Printf("⚠ Replacing the previous key %s, which will no longer verify callbacks\n", keyFingerprint(p.PreviousWebhookKey))
+	}
+
+	now := time.Now().UTC()
+	p.PreviousWebhookKey = current
+	p.WebhookKey = newKey
+	p.WebhookKeyRotatedAt = &now
+	if p.Environment == "" {
+		p.Environment = cfg.Env
+	}
+	fc.Profiles[profile] = p
+	if err := saveFileConfig(fc); err != nil {
+		return err
+	}
+
+	auditRotation(AuditEvent{
+		Outcome:     "rotated",
+		Profile:     profile,
+		Environment: p.Environment,
+		Details: map[string]any{
+			"new_key":      keyFingerprint(newKey),
+			"previous_key": keyFingerprint(current),
+		},
+	})
+
+	path, _ := configPath()
+	fmt.Printf("✓ Profile %q now verifies callbacks with key %s (saved to %s)\n", profile, keyFingerprint(newKey), path)
+	if current != "" {
+		fmt.Printf("  Callbacks signed with the previous key %s are still accepted\n", keyFingerprint(current))
+		fmt.Println("  Restart serve, then run `campay webhook drop-previous-key` once CamPay uses the new key")
+	}
+	if cfg.Secrets.Provider != "" {
+		fmt.Printf("  The profile's keys now take precedence over %s; update the secret there too\n", cfg.Secrets.Provider)
+	}
+	if profile != cfg.Profile {
+		fmt.Printf("  Use it with --profile %s or CAMPAY_PROFILE=%s\n", profile, profile)
+	}
+	return nil
+}
+
+// webhookDropPreviousKeyOptions are the flags of webhook drop-previous-key.
+type webhookDropPreviousKeyOptions struct {
+	name string
+}
+
+// webhookDropPreviousKeyFlags defines the flags of webhook drop-previous-key on fs.
+func webhookDropPreviousKeyFlags(fs *flag.FlagSet, cfg *Config) *webhookDropPreviousKeyOptions {
+	opt := &webhookDropPreviousKeyOptions{}
+	fs.StringVar(&opt.name, "name", cfg.Profile, "profile to change (default: the active profile or \"default\")")
+	return opt
+}
+
+func dropPreviousWebhookKey(cfg *Config, args []string) error {
+	fs := newFlagSet("webhook drop-previous-key")
+	opt := webhookDropPreviousKeyFlags(fs, cfg)
+	if err := fs.Parse(args); err != nil {
+		return exitErr(exitValidation, err)
+	}
+
+	fc, profile, err := webhookProfile(opt.name)
+	if err != nil {
+		return err
+	}
+	p, ok := fc.Profiles[profile]
+	if !ok || p.PreviousWebhookKey == "" {
+		return invalidInput("profile %q has no previous webhook key", profile)
+	}
+	previous := p.PreviousWebhookKey
+	p.PreviousWebhookKey = ""
+	fc.Profiles[profile] = p
+	if err := saveFileConfig(fc); err != nil {
+		return err
+	}
+
+	auditRotation(AuditEvent{
+		Outcome:     "previous key dropped",
+		Profile:     profile,
+		Environment: p.Environment,
+		Details:     map[string]any{"previous_key": keyFingerprint(previous)},
+	})
+	fmt.Printf("✓ Profile %q no longer accepts callbacks signed with key %s\n", profile, keyFingerprint(previous))
+	return nil
+}